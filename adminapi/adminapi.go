@@ -0,0 +1,152 @@
+// Package adminapi provides the authenticated http.Handler of the internal management API on top of the token
+// and client stores: tokens listing, search and revocation and clients CRUD. The handler is not the part of the
+// OAuth 2.0 protocol, it must not be exposed to the clients.
+package adminapi
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3"
+)
+
+// TokenStore is the token store used by the handler, implemented by pg.TokenStore and pgmock.TokenStore
+type TokenStore interface {
+	Search(filter pg.TokenFilter, page pg.Pagination) ([]oauth2.TokenInfo, error)
+	ListExpiringWithin(d time.Duration, page pg.Pagination) ([]oauth2.TokenInfo, error)
+	RemoveWhere(filter pg.TokenFilter) (int64, error)
+	RemoveByAccess(access string) error
+	RemoveByRefresh(refresh string) error
+}
+
+// ClientStore is the client store used by the handler, implemented by pg.ClientStore and pgmock.ClientStore
+type ClientStore interface {
+	Create(info oauth2.ClientInfo) error
+	GetWithVersion(id string) (oauth2.ClientInfo, int64, error)
+	Update(info oauth2.ClientInfo, version int64) (int64, error)
+	Delete(id string) error
+}
+
+// Authenticator checks that the request is made by the administrator
+type Authenticator func(r *http.Request) bool
+
+// BearerToken returns authenticator accepting the requests with the static bearer token in Authorization header,
+// tokens are compared in constant time
+func BearerToken(token string) Authenticator {
+	return func(r *http.Request) bool {
+		auth := r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") {
+			return false
+		}
+		return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) == 1
+	}
+}
+
+// Handler is the management API handler, paths are relative to the handler root, use http.StripPrefix to mount it:
+//
+//	GET    /tokens           search tokens by client_id, user_id, scope, created_before, expires_after and expires_before
+//	DELETE /tokens           remove tokens matching the same filter, the filter must not be empty
+//	GET    /tokens/expiring  list tokens expiring within the duration, e.g. within=168h
+//	POST   /tokens/revoke    revoke the token, {"token": "...", "token_type_hint": "refresh_token"}
+//	POST   /clients          create the client
+//	GET    /clients/{id}     get the client with its version
+//	PUT    /clients/{id}     update the client of the version
+//	DELETE /clients/{id}     delete the client
+//
+// Listing endpoints accept limit and offset pagination parameters. Client secrets are never returned.
+type Handler struct {
+	tokens       TokenStore
+	clients      ClientStore
+	authenticate Authenticator
+	mux          *http.ServeMux
+}
+
+// NewHandler creates management API handler, every request is checked with the authenticator
+func NewHandler(tokens TokenStore, clients ClientStore, authenticate Authenticator) *Handler {
+	h := &Handler{tokens: tokens, clients: clients, authenticate: authenticate, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/tokens", h.serveTokens)
+	h.mux.HandleFunc("/tokens/expiring", h.serveExpiringTokens)
+	h.mux.HandleFunc("/tokens/revoke", h.serveRevoke)
+	h.mux.HandleFunc("/clients", h.serveClients)
+	h.mux.HandleFunc("/clients/", h.serveClient)
+	return h
+}
+
+// ServeHTTP authenticates and handles management API request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authenticate == nil || !h.authenticate(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// errorResponse is the error response with the same fields as RFC 6749 one
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	// headers are already sent, so there is nothing to do with the error
+	_ = jsoniter.NewEncoder(w).Encode(v)
+}
+
+func writeBadRequest(w http.ResponseWriter, description string) {
+	writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", ErrorDescription: description})
+}
+
+// writeStoreError writes the response for the store error, the errors details are not disclosed
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pg.ErrClientNotFound), errors.Is(err, pg.ErrTokenNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not_found"})
+	case errors.Is(err, pg.ErrClientAlreadyExists):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "conflict", ErrorDescription: "client already exists"})
+	case errors.Is(err, pg.ErrVersionConflict):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "conflict", ErrorDescription: "client version conflict"})
+	case errors.Is(err, pg.ErrEmptyTokenFilter):
+		writeBadRequest(w, "tokens filter is empty")
+	default:
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "server_error"})
+	}
+}
+
+// allowMethods checks the request method, writes the error response and returns false if it is not allowed
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "invalid_request", ErrorDescription: "method is not allowed"})
+	return false
+}
+
+// parsePagination reads limit and offset query parameters, zero limit is the store default page size
+func parsePagination(r *http.Request) (pg.Pagination, error) {
+	var page pg.Pagination
+	for name, dst := range map[string]*int{"limit": &page.Limit, "offset": &page.Offset} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return page, errors.New("invalid " + name)
+		}
+		*dst = n
+	}
+	return page, nil
+}
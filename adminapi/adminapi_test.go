@@ -0,0 +1,79 @@
+package adminapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"github.com/vgarvardt/go-oauth2-pg/pgmock"
+	"gopkg.in/oauth2.v3/models"
+)
+
+var (
+	_ TokenStore  = (*pg.TokenStore)(nil)
+	_ TokenStore  = (*pgmock.TokenStore)(nil)
+	_ ClientStore = (*pg.ClientStore)(nil)
+	_ ClientStore = (*pgmock.ClientStore)(nil)
+)
+
+func newHandler(t *testing.T) (*Handler, *pgmock.TokenStore, *pgmock.ClientStore) {
+	tokens := pgmock.NewTokenStore()
+	clients := pgmock.NewClientStore()
+	require.NoError(t, clients.Create(&models.Client{ID: "c1", Secret: "secret1", Domain: "https://c1.example.com"}))
+
+	now := time.Now()
+	require.NoError(t, tokens.Create(&models.Token{ClientID: "c1", UserID: "u1", Scope: "read", Access: "access1", AccessCreateAt: now, AccessExpiresIn: time.Hour}))
+	require.NoError(t, tokens.Create(&models.Token{
+		ClientID:         "c1",
+		UserID:           "u2",
+		Access:           "access2",
+		AccessCreateAt:   now,
+		AccessExpiresIn:  time.Hour,
+		Refresh:          "refresh2",
+		RefreshCreateAt:  now,
+		RefreshExpiresIn: 30 * 24 * time.Hour,
+	}))
+	return NewHandler(tokens, clients, BearerToken("admin")), tokens, clients
+}
+
+func request(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	req.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler_authentication(t *testing.T) {
+	h, _, _ := newHandler(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/tokens?client_id=c1", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="admin"`, w.Header().Get("WWW-Authenticate"))
+
+	r.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = request(h, http.MethodGet, "/tokens?client_id=c1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// empty token accepts nothing
+	assert.False(t, BearerToken("")(r))
+
+	w = request(h, http.MethodGet, "/unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
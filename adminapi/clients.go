@@ -0,0 +1,142 @@
+package adminapi
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3"
+)
+
+// clientBody is the client in the requests and responses, secret is accepted on creation only
+// and never returned
+type clientBody struct {
+	ID                string             `json:"id"`
+	Secret            string             `json:"secret,omitempty"`
+	Domain            string             `json:"domain,omitempty"`
+	UserID            string             `json:"user_id,omitempty"`
+	RedirectURIs      []string           `json:"redirect_uris,omitempty"`
+	AllowedScopes     []string           `json:"allowed_scopes,omitempty"`
+	AllowedGrantTypes []oauth2.GrantType `json:"allowed_grant_types,omitempty"`
+	ExpiresAt         *time.Time         `json:"expires_at,omitempty"`
+	Version           int64              `json:"version"`
+}
+
+// client returns the client information model of the body
+func (b clientBody) client() *pg.Client {
+	client := &pg.Client{
+		RedirectURIs:      b.RedirectURIs,
+		AllowedScopes:     b.AllowedScopes,
+		AllowedGrantTypes: b.AllowedGrantTypes,
+	}
+	client.ID, client.Secret, client.Domain, client.UserID = b.ID, b.Secret, b.Domain, b.UserID
+	if b.ExpiresAt != nil {
+		client.ExpiresAt = *b.ExpiresAt
+	}
+	return client
+}
+
+// newClientBody returns the response body for the client information, the optional fields are read
+// as the stores do for the models that provide them
+func newClientBody(info oauth2.ClientInfo, version int64) clientBody {
+	body := clientBody{ID: info.GetID(), Domain: info.GetDomain(), UserID: info.GetUserID(), Version: version}
+	if c, ok := info.(interface{ GetRedirectURIs() []string }); ok {
+		body.RedirectURIs = c.GetRedirectURIs()
+	}
+	if c, ok := info.(interface{ GetAllowedScopes() []string }); ok {
+		body.AllowedScopes = c.GetAllowedScopes()
+	}
+	if c, ok := info.(interface{ GetAllowedGrantTypes() []oauth2.GrantType }); ok {
+		body.AllowedGrantTypes = c.GetAllowedGrantTypes()
+	}
+	if c, ok := info.(interface{ GetExpiresAt() time.Time }); ok && !c.GetExpiresAt().IsZero() {
+		expiresAt := c.GetExpiresAt()
+		body.ExpiresAt = &expiresAt
+	}
+	return body
+}
+
+func decodeClient(w http.ResponseWriter, r *http.Request) (clientBody, bool) {
+	var body clientBody
+	if err := jsoniter.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeBadRequest(w, "malformed request body")
+		return body, false
+	}
+	return body, true
+}
+
+func (h *Handler) serveClients(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	body, ok := decodeClient(w, r)
+	if !ok {
+		return
+	}
+	if body.ID == "" {
+		writeBadRequest(w, "client id is required")
+		return
+	}
+
+	if err := h.clients.Create(body.client()); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	h.writeClient(w, http.StatusCreated, body.ID)
+}
+
+func (h *Handler) serveClient(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/clients/")
+	if id == "" || strings.Contains(id, "/") {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not_found"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.writeClient(w, http.StatusOK, id)
+	case http.MethodDelete:
+		if err := h.clients.Delete(id); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		body, ok := decodeClient(w, r)
+		if !ok {
+			return
+		}
+		if body.ID != "" && body.ID != id {
+			writeBadRequest(w, "client id does not match the path")
+			return
+		}
+		// secret is changed with the secret rotation only
+		body.ID, body.Secret = id, ""
+
+		if _, err := h.clients.Update(body.client(), body.Version); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		h.writeClient(w, http.StatusOK, id)
+	}
+}
+
+// writeClient writes the stored client with its current version
+func (h *Handler) writeClient(w http.ResponseWriter, status int, id string) {
+	info, version, err := h.clients.GetWithVersion(id)
+	if err == nil && info == nil {
+		err = pg.ErrClientNotFound
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, status, newClientBody(info, version))
+}
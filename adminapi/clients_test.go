@@ -0,0 +1,66 @@
+package adminapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_clients(t *testing.T) {
+	h, _, clients := newHandler(t)
+
+	w := request(h, http.MethodGet, "/clients/c1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var client clientBody
+	require.NoError(t, jsoniter.Unmarshal(w.Body.Bytes(), &client))
+	assert.Equal(t, "c1", client.ID)
+	assert.Equal(t, []string{"https://c1.example.com"}, client.RedirectURIs)
+	assert.NotContains(t, w.Body.String(), "secret1")
+
+	w = request(h, http.MethodPost, "/clients", `{"id":"c2","secret":"secret2","redirect_uris":["https://c2.example.com/cb"],"allowed_scopes":["read"]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret2")
+	_, err := clients.ValidateSecret("c2", "secret2")
+	require.NoError(t, err)
+
+	w = request(h, http.MethodPost, "/clients", `{"id":"c2"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = request(h, http.MethodPost, "/clients", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(h, http.MethodGet, "/clients/c2", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, jsoniter.Unmarshal(w.Body.Bytes(), &client))
+	version := client.Version
+
+	// stale version is refused, secret is kept on update
+	w = request(h, http.MethodPut, "/clients/c2", `{"redirect_uris":["https://c2.example.com/new"],"version":42}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	body, err := jsoniter.Marshal(clientBody{Secret: "changed", RedirectURIs: []string{"https://c2.example.com/new"}, Version: version})
+	require.NoError(t, err)
+	w = request(h, http.MethodPut, "/clients/c2", string(body))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, jsoniter.Unmarshal(w.Body.Bytes(), &client))
+	assert.Equal(t, []string{"https://c2.example.com/new"}, client.RedirectURIs)
+	assert.NotEqual(t, version, client.Version)
+	_, err = clients.ValidateSecret("c2", "secret2")
+	assert.NoError(t, err)
+
+	w = request(h, http.MethodPut, "/clients/c2", `{"id":"c1"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(h, http.MethodDelete, "/clients/c2", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = request(h, http.MethodDelete, "/clients/c2", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request(h, http.MethodGet, "/clients/c2", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = request(h, http.MethodGet, "/clients", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	w = request(h, http.MethodGet, "/clients/c1/secrets", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,185 @@
+package adminapi
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3"
+)
+
+// Token type hints defined by RFC 7009
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// tokenResponse is the token in the listing responses, token values are the ones returned by the store,
+// e.g. the digests with the hashed lookups, they are accepted by the revocation as is
+type tokenResponse struct {
+	ClientID         string     `json:"client_id"`
+	UserID           string     `json:"user_id,omitempty"`
+	Scope            string     `json:"scope,omitempty"`
+	Access           string     `json:"access,omitempty"`
+	AccessExpiresAt  *time.Time `json:"access_expires_at,omitempty"`
+	Refresh          string     `json:"refresh,omitempty"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type tokensResponse struct {
+	Tokens []tokenResponse `json:"tokens"`
+}
+
+type removedResponse struct {
+	Removed int64 `json:"removed"`
+}
+
+// revokeRequest is the token revocation request body
+type revokeRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+}
+
+// expiresAt returns the token expiration or nil for the token without the expiration
+func expiresAt(createdAt time.Time, expiresIn time.Duration) *time.Time {
+	if expiresIn <= 0 {
+		return nil
+	}
+	t := createdAt.Add(expiresIn)
+	return &t
+}
+
+func newTokensResponse(tokens []oauth2.TokenInfo) tokensResponse {
+	resp := tokensResponse{Tokens: make([]tokenResponse, len(tokens))}
+	for i, info := range tokens {
+		resp.Tokens[i] = tokenResponse{
+			ClientID:  info.GetClientID(),
+			UserID:    info.GetUserID(),
+			Scope:     info.GetScope(),
+			Access:    info.GetAccess(),
+			Refresh:   info.GetRefresh(),
+			CreatedAt: info.GetAccessCreateAt(),
+		}
+		if info.GetAccess() != "" {
+			resp.Tokens[i].AccessExpiresAt = expiresAt(info.GetAccessCreateAt(), info.GetAccessExpiresIn())
+		}
+		if info.GetRefresh() != "" {
+			resp.Tokens[i].RefreshExpiresAt = expiresAt(info.GetRefreshCreateAt(), info.GetRefreshExpiresIn())
+		}
+	}
+	return resp
+}
+
+// parseTokenFilter reads tokens filter query parameters, times are in RFC 3339 format
+func parseTokenFilter(r *http.Request) (pg.TokenFilter, error) {
+	query := r.URL.Query()
+	filter := pg.TokenFilter{ClientID: query.Get("client_id"), UserID: query.Get("user_id"), Scope: query.Get("scope")}
+	for name, dst := range map[string]*time.Time{
+		"created_before": &filter.CreatedBefore,
+		"expires_after":  &filter.ExpiresAfter,
+		"expires_before": &filter.ExpiresBefore,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, errors.New("invalid " + name)
+		}
+		*dst = t
+	}
+	return filter, nil
+}
+
+func (h *Handler) serveTokens(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+
+	filter, err := parseTokenFilter(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		removed, err := h.tokens.RemoveWhere(filter)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, removedResponse{Removed: removed})
+		return
+	}
+
+	page, err := parsePagination(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	tokens, err := h.tokens.Search(filter, page)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newTokensResponse(tokens))
+}
+
+func (h *Handler) serveExpiringTokens(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	within, err := time.ParseDuration(r.URL.Query().Get("within"))
+	if err != nil || within <= 0 {
+		writeBadRequest(w, "within must be positive duration, e.g. 168h")
+		return
+	}
+	page, err := parsePagination(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	tokens, err := h.tokens.ListExpiringWithin(within, page)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newTokensResponse(tokens))
+}
+
+// serveRevoke removes the token, the token without the type hint is removed as both access and refresh token.
+// Refresh token removal revokes the access token issued with it as well.
+func (h *Handler) serveRevoke(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	var req revokeRequest
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "malformed request body")
+		return
+	}
+	if req.Token == "" {
+		writeBadRequest(w, "token is required")
+		return
+	}
+
+	var err error
+	if req.TokenTypeHint != TokenTypeHintRefreshToken {
+		err = h.tokens.RemoveByAccess(req.Token)
+	}
+	if err == nil && req.TokenTypeHint != TokenTypeHintAccessToken {
+		err = h.tokens.RemoveByRefresh(req.Token)
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package adminapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_tokens(t *testing.T) {
+	h, tokens, _ := newHandler(t)
+
+	w := request(h, http.MethodGet, "/tokens?client_id=c1&limit=1&offset=1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp tokensResponse
+	require.NoError(t, jsoniter.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Tokens, 1)
+	assert.Equal(t, "access2", resp.Tokens[0].Access)
+	assert.Equal(t, "refresh2", resp.Tokens[0].Refresh)
+	assert.NotNil(t, resp.Tokens[0].RefreshExpiresAt)
+
+	w = request(h, http.MethodGet, "/tokens?expires_after=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid expires_after")
+	w = request(h, http.MethodGet, "/tokens?limit=-1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(h, http.MethodGet, "/tokens/expiring?within=2h", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	resp = tokensResponse{}
+	require.NoError(t, jsoniter.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Tokens, 1)
+	assert.Equal(t, "access1", resp.Tokens[0].Access)
+	w = request(h, http.MethodGet, "/tokens/expiring", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// empty filter does not remove all the tokens
+	w = request(h, http.MethodDelete, "/tokens", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request(h, http.MethodDelete, "/tokens?user_id=u1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"removed":1}`, w.Body.String())
+	_, err := tokens.GetByAccess("access1")
+	assert.Error(t, err)
+
+	w = request(h, http.MethodPost, "/tokens", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, DELETE", w.Header().Get("Allow"))
+}
+
+func TestHandler_revoke(t *testing.T) {
+	h, tokens, _ := newHandler(t)
+
+	w := request(h, http.MethodPost, "/tokens/revoke", `{"token":"refresh2","token_type_hint":"refresh_token"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, err := tokens.GetByAccess("access2")
+	assert.Error(t, err)
+
+	// token without the hint is removed as either kind
+	w = request(h, http.MethodPost, "/tokens/revoke", `{"token":"access1"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, err = tokens.GetByAccess("access1")
+	assert.Error(t, err)
+
+	w = request(h, http.MethodPost, "/tokens/revoke", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request(h, http.MethodPost, "/tokens/revoke", `{`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request(h, http.MethodGet, "/tokens/revoke", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,1170 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: admin.proto
+
+package admingrpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	empty "github.com/golang/protobuf/ptypes/empty"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// TokenTypeHint is the RFC 7009 token type hint
+type TokenTypeHint int32
+
+const (
+	TokenTypeHint_TOKEN_TYPE_HINT_UNSPECIFIED TokenTypeHint = 0
+	TokenTypeHint_ACCESS_TOKEN                TokenTypeHint = 1
+	TokenTypeHint_REFRESH_TOKEN               TokenTypeHint = 2
+)
+
+var TokenTypeHint_name = map[int32]string{
+	0: "TOKEN_TYPE_HINT_UNSPECIFIED",
+	1: "ACCESS_TOKEN",
+	2: "REFRESH_TOKEN",
+}
+
+var TokenTypeHint_value = map[string]int32{
+	"TOKEN_TYPE_HINT_UNSPECIFIED": 0,
+	"ACCESS_TOKEN":                1,
+	"REFRESH_TOKEN":               2,
+}
+
+func (x TokenTypeHint) String() string {
+	return proto.EnumName(TokenTypeHint_name, int32(x))
+}
+
+func (TokenTypeHint) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{0}
+}
+
+// Client is the OAuth 2.0 client, secret is accepted on creation only and never returned
+type Client struct {
+	Id                   string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Secret               string               `protobuf:"bytes,2,opt,name=secret,proto3" json:"secret,omitempty"`
+	Domain               string               `protobuf:"bytes,3,opt,name=domain,proto3" json:"domain,omitempty"`
+	UserId               string               `protobuf:"bytes,4,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	RedirectUris         []string             `protobuf:"bytes,5,rep,name=redirect_uris,json=redirectUris,proto3" json:"redirect_uris,omitempty"`
+	AllowedScopes        []string             `protobuf:"bytes,6,rep,name=allowed_scopes,json=allowedScopes,proto3" json:"allowed_scopes,omitempty"`
+	AllowedGrantTypes    []string             `protobuf:"bytes,7,rep,name=allowed_grant_types,json=allowedGrantTypes,proto3" json:"allowed_grant_types,omitempty"`
+	ExpiresAt            *timestamp.Timestamp `protobuf:"bytes,8,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	Version              int64                `protobuf:"varint,9,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Client) Reset()         { *m = Client{} }
+func (m *Client) String() string { return proto.CompactTextString(m) }
+func (*Client) ProtoMessage()    {}
+func (*Client) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{0}
+}
+
+func (m *Client) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Client.Unmarshal(m, b)
+}
+func (m *Client) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Client.Marshal(b, m, deterministic)
+}
+func (m *Client) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Client.Merge(m, src)
+}
+func (m *Client) XXX_Size() int {
+	return xxx_messageInfo_Client.Size(m)
+}
+func (m *Client) XXX_DiscardUnknown() {
+	xxx_messageInfo_Client.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Client proto.InternalMessageInfo
+
+func (m *Client) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Client) GetSecret() string {
+	if m != nil {
+		return m.Secret
+	}
+	return ""
+}
+
+func (m *Client) GetDomain() string {
+	if m != nil {
+		return m.Domain
+	}
+	return ""
+}
+
+func (m *Client) GetUserId() string {
+	if m != nil {
+		return m.UserId
+	}
+	return ""
+}
+
+func (m *Client) GetRedirectUris() []string {
+	if m != nil {
+		return m.RedirectUris
+	}
+	return nil
+}
+
+func (m *Client) GetAllowedScopes() []string {
+	if m != nil {
+		return m.AllowedScopes
+	}
+	return nil
+}
+
+func (m *Client) GetAllowedGrantTypes() []string {
+	if m != nil {
+		return m.AllowedGrantTypes
+	}
+	return nil
+}
+
+func (m *Client) GetExpiresAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return nil
+}
+
+func (m *Client) GetVersion() int64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+type CreateClientRequest struct {
+	Client               *Client  `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CreateClientRequest) Reset()         { *m = CreateClientRequest{} }
+func (m *CreateClientRequest) String() string { return proto.CompactTextString(m) }
+func (*CreateClientRequest) ProtoMessage()    {}
+func (*CreateClientRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{1}
+}
+
+func (m *CreateClientRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CreateClientRequest.Unmarshal(m, b)
+}
+func (m *CreateClientRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CreateClientRequest.Marshal(b, m, deterministic)
+}
+func (m *CreateClientRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CreateClientRequest.Merge(m, src)
+}
+func (m *CreateClientRequest) XXX_Size() int {
+	return xxx_messageInfo_CreateClientRequest.Size(m)
+}
+func (m *CreateClientRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CreateClientRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CreateClientRequest proto.InternalMessageInfo
+
+func (m *CreateClientRequest) GetClient() *Client {
+	if m != nil {
+		return m.Client
+	}
+	return nil
+}
+
+type GetClientRequest struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetClientRequest) Reset()         { *m = GetClientRequest{} }
+func (m *GetClientRequest) String() string { return proto.CompactTextString(m) }
+func (*GetClientRequest) ProtoMessage()    {}
+func (*GetClientRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{2}
+}
+
+func (m *GetClientRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetClientRequest.Unmarshal(m, b)
+}
+func (m *GetClientRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetClientRequest.Marshal(b, m, deterministic)
+}
+func (m *GetClientRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetClientRequest.Merge(m, src)
+}
+func (m *GetClientRequest) XXX_Size() int {
+	return xxx_messageInfo_GetClientRequest.Size(m)
+}
+func (m *GetClientRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetClientRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetClientRequest proto.InternalMessageInfo
+
+func (m *GetClientRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+// UpdateClientRequest updates the client of the client version, the secret is changed with the secret rotation only
+type UpdateClientRequest struct {
+	Client               *Client  `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UpdateClientRequest) Reset()         { *m = UpdateClientRequest{} }
+func (m *UpdateClientRequest) String() string { return proto.CompactTextString(m) }
+func (*UpdateClientRequest) ProtoMessage()    {}
+func (*UpdateClientRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{3}
+}
+
+func (m *UpdateClientRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UpdateClientRequest.Unmarshal(m, b)
+}
+func (m *UpdateClientRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UpdateClientRequest.Marshal(b, m, deterministic)
+}
+func (m *UpdateClientRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UpdateClientRequest.Merge(m, src)
+}
+func (m *UpdateClientRequest) XXX_Size() int {
+	return xxx_messageInfo_UpdateClientRequest.Size(m)
+}
+func (m *UpdateClientRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UpdateClientRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UpdateClientRequest proto.InternalMessageInfo
+
+func (m *UpdateClientRequest) GetClient() *Client {
+	if m != nil {
+		return m.Client
+	}
+	return nil
+}
+
+type DeleteClientRequest struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteClientRequest) Reset()         { *m = DeleteClientRequest{} }
+func (m *DeleteClientRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteClientRequest) ProtoMessage()    {}
+func (*DeleteClientRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{4}
+}
+
+func (m *DeleteClientRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteClientRequest.Unmarshal(m, b)
+}
+func (m *DeleteClientRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteClientRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteClientRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteClientRequest.Merge(m, src)
+}
+func (m *DeleteClientRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteClientRequest.Size(m)
+}
+func (m *DeleteClientRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteClientRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteClientRequest proto.InternalMessageInfo
+
+func (m *DeleteClientRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+// TokenFilter is the tokens filter, empty fields are ignored and non-empty fields are combined with AND
+type TokenFilter struct {
+	ClientId             string               `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	UserId               string               `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Scope                string               `protobuf:"bytes,3,opt,name=scope,proto3" json:"scope,omitempty"`
+	CreatedBefore        *timestamp.Timestamp `protobuf:"bytes,4,opt,name=created_before,json=createdBefore,proto3" json:"created_before,omitempty"`
+	ExpiresAfter         *timestamp.Timestamp `protobuf:"bytes,5,opt,name=expires_after,json=expiresAfter,proto3" json:"expires_after,omitempty"`
+	ExpiresBefore        *timestamp.Timestamp `protobuf:"bytes,6,opt,name=expires_before,json=expiresBefore,proto3" json:"expires_before,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *TokenFilter) Reset()         { *m = TokenFilter{} }
+func (m *TokenFilter) String() string { return proto.CompactTextString(m) }
+func (*TokenFilter) ProtoMessage()    {}
+func (*TokenFilter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{5}
+}
+
+func (m *TokenFilter) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TokenFilter.Unmarshal(m, b)
+}
+func (m *TokenFilter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TokenFilter.Marshal(b, m, deterministic)
+}
+func (m *TokenFilter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TokenFilter.Merge(m, src)
+}
+func (m *TokenFilter) XXX_Size() int {
+	return xxx_messageInfo_TokenFilter.Size(m)
+}
+func (m *TokenFilter) XXX_DiscardUnknown() {
+	xxx_messageInfo_TokenFilter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TokenFilter proto.InternalMessageInfo
+
+func (m *TokenFilter) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *TokenFilter) GetUserId() string {
+	if m != nil {
+		return m.UserId
+	}
+	return ""
+}
+
+func (m *TokenFilter) GetScope() string {
+	if m != nil {
+		return m.Scope
+	}
+	return ""
+}
+
+func (m *TokenFilter) GetCreatedBefore() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedBefore
+	}
+	return nil
+}
+
+func (m *TokenFilter) GetExpiresAfter() *timestamp.Timestamp {
+	if m != nil {
+		return m.ExpiresAfter
+	}
+	return nil
+}
+
+func (m *TokenFilter) GetExpiresBefore() *timestamp.Timestamp {
+	if m != nil {
+		return m.ExpiresBefore
+	}
+	return nil
+}
+
+// SearchTokensRequest is the tokens search, zero limit is the store default page size
+type SearchTokensRequest struct {
+	Filter               *TokenFilter `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	Limit                int32        `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset               int32        `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *SearchTokensRequest) Reset()         { *m = SearchTokensRequest{} }
+func (m *SearchTokensRequest) String() string { return proto.CompactTextString(m) }
+func (*SearchTokensRequest) ProtoMessage()    {}
+func (*SearchTokensRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{6}
+}
+
+func (m *SearchTokensRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchTokensRequest.Unmarshal(m, b)
+}
+func (m *SearchTokensRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchTokensRequest.Marshal(b, m, deterministic)
+}
+func (m *SearchTokensRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchTokensRequest.Merge(m, src)
+}
+func (m *SearchTokensRequest) XXX_Size() int {
+	return xxx_messageInfo_SearchTokensRequest.Size(m)
+}
+func (m *SearchTokensRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchTokensRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchTokensRequest proto.InternalMessageInfo
+
+func (m *SearchTokensRequest) GetFilter() *TokenFilter {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+func (m *SearchTokensRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *SearchTokensRequest) GetOffset() int32 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+// Token is the stored token, token values are the ones returned by the store, e.g. the digests with the hashed
+// lookups, they are accepted by RevokeToken as is
+type Token struct {
+	ClientId             string               `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	UserId               string               `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Scope                string               `protobuf:"bytes,3,opt,name=scope,proto3" json:"scope,omitempty"`
+	Access               string               `protobuf:"bytes,4,opt,name=access,proto3" json:"access,omitempty"`
+	AccessExpiresAt      *timestamp.Timestamp `protobuf:"bytes,5,opt,name=access_expires_at,json=accessExpiresAt,proto3" json:"access_expires_at,omitempty"`
+	Refresh              string               `protobuf:"bytes,6,opt,name=refresh,proto3" json:"refresh,omitempty"`
+	RefreshExpiresAt     *timestamp.Timestamp `protobuf:"bytes,7,opt,name=refresh_expires_at,json=refreshExpiresAt,proto3" json:"refresh_expires_at,omitempty"`
+	CreatedAt            *timestamp.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Token) Reset()         { *m = Token{} }
+func (m *Token) String() string { return proto.CompactTextString(m) }
+func (*Token) ProtoMessage()    {}
+func (*Token) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{7}
+}
+
+func (m *Token) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Token.Unmarshal(m, b)
+}
+func (m *Token) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Token.Marshal(b, m, deterministic)
+}
+func (m *Token) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Token.Merge(m, src)
+}
+func (m *Token) XXX_Size() int {
+	return xxx_messageInfo_Token.Size(m)
+}
+func (m *Token) XXX_DiscardUnknown() {
+	xxx_messageInfo_Token.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Token proto.InternalMessageInfo
+
+func (m *Token) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *Token) GetUserId() string {
+	if m != nil {
+		return m.UserId
+	}
+	return ""
+}
+
+func (m *Token) GetScope() string {
+	if m != nil {
+		return m.Scope
+	}
+	return ""
+}
+
+func (m *Token) GetAccess() string {
+	if m != nil {
+		return m.Access
+	}
+	return ""
+}
+
+func (m *Token) GetAccessExpiresAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.AccessExpiresAt
+	}
+	return nil
+}
+
+func (m *Token) GetRefresh() string {
+	if m != nil {
+		return m.Refresh
+	}
+	return ""
+}
+
+func (m *Token) GetRefreshExpiresAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.RefreshExpiresAt
+	}
+	return nil
+}
+
+func (m *Token) GetCreatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+type SearchTokensResponse struct {
+	Tokens               []*Token `protobuf:"bytes,1,rep,name=tokens,proto3" json:"tokens,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SearchTokensResponse) Reset()         { *m = SearchTokensResponse{} }
+func (m *SearchTokensResponse) String() string { return proto.CompactTextString(m) }
+func (*SearchTokensResponse) ProtoMessage()    {}
+func (*SearchTokensResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{8}
+}
+
+func (m *SearchTokensResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchTokensResponse.Unmarshal(m, b)
+}
+func (m *SearchTokensResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchTokensResponse.Marshal(b, m, deterministic)
+}
+func (m *SearchTokensResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchTokensResponse.Merge(m, src)
+}
+func (m *SearchTokensResponse) XXX_Size() int {
+	return xxx_messageInfo_SearchTokensResponse.Size(m)
+}
+func (m *SearchTokensResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchTokensResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchTokensResponse proto.InternalMessageInfo
+
+func (m *SearchTokensResponse) GetTokens() []*Token {
+	if m != nil {
+		return m.Tokens
+	}
+	return nil
+}
+
+type RevokeTokenRequest struct {
+	Token                string        `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	TokenTypeHint        TokenTypeHint `protobuf:"varint,2,opt,name=token_type_hint,json=tokenTypeHint,proto3,enum=oauth2pg.admin.v1.TokenTypeHint" json:"token_type_hint,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *RevokeTokenRequest) Reset()         { *m = RevokeTokenRequest{} }
+func (m *RevokeTokenRequest) String() string { return proto.CompactTextString(m) }
+func (*RevokeTokenRequest) ProtoMessage()    {}
+func (*RevokeTokenRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{9}
+}
+
+func (m *RevokeTokenRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RevokeTokenRequest.Unmarshal(m, b)
+}
+func (m *RevokeTokenRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RevokeTokenRequest.Marshal(b, m, deterministic)
+}
+func (m *RevokeTokenRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RevokeTokenRequest.Merge(m, src)
+}
+func (m *RevokeTokenRequest) XXX_Size() int {
+	return xxx_messageInfo_RevokeTokenRequest.Size(m)
+}
+func (m *RevokeTokenRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RevokeTokenRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RevokeTokenRequest proto.InternalMessageInfo
+
+func (m *RevokeTokenRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *RevokeTokenRequest) GetTokenTypeHint() TokenTypeHint {
+	if m != nil {
+		return m.TokenTypeHint
+	}
+	return TokenTypeHint_TOKEN_TYPE_HINT_UNSPECIFIED
+}
+
+type GetStatsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetStatsRequest) Reset()         { *m = GetStatsRequest{} }
+func (m *GetStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetStatsRequest) ProtoMessage()    {}
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{10}
+}
+
+func (m *GetStatsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetStatsRequest.Unmarshal(m, b)
+}
+func (m *GetStatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetStatsRequest.Marshal(b, m, deterministic)
+}
+func (m *GetStatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetStatsRequest.Merge(m, src)
+}
+func (m *GetStatsRequest) XXX_Size() int {
+	return xxx_messageInfo_GetStatsRequest.Size(m)
+}
+func (m *GetStatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetStatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetStatsRequest proto.InternalMessageInfo
+
+// TokenStatistics is the number of active and expired tokens of the client and the token kind
+type TokenStatistics struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Kind                 string   `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	Active               int64    `protobuf:"varint,3,opt,name=active,proto3" json:"active,omitempty"`
+	Expired              int64    `protobuf:"varint,4,opt,name=expired,proto3" json:"expired,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TokenStatistics) Reset()         { *m = TokenStatistics{} }
+func (m *TokenStatistics) String() string { return proto.CompactTextString(m) }
+func (*TokenStatistics) ProtoMessage()    {}
+func (*TokenStatistics) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{11}
+}
+
+func (m *TokenStatistics) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TokenStatistics.Unmarshal(m, b)
+}
+func (m *TokenStatistics) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TokenStatistics.Marshal(b, m, deterministic)
+}
+func (m *TokenStatistics) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TokenStatistics.Merge(m, src)
+}
+func (m *TokenStatistics) XXX_Size() int {
+	return xxx_messageInfo_TokenStatistics.Size(m)
+}
+func (m *TokenStatistics) XXX_DiscardUnknown() {
+	xxx_messageInfo_TokenStatistics.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TokenStatistics proto.InternalMessageInfo
+
+func (m *TokenStatistics) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *TokenStatistics) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *TokenStatistics) GetActive() int64 {
+	if m != nil {
+		return m.Active
+	}
+	return 0
+}
+
+func (m *TokenStatistics) GetExpired() int64 {
+	if m != nil {
+		return m.Expired
+	}
+	return 0
+}
+
+type Stats struct {
+	Tokens               []*TokenStatistics `protobuf:"bytes,1,rep,name=tokens,proto3" json:"tokens,omitempty"`
+	ExpiredBacklog       int64              `protobuf:"varint,2,opt,name=expired_backlog,json=expiredBacklog,proto3" json:"expired_backlog,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *Stats) Reset()         { *m = Stats{} }
+func (m *Stats) String() string { return proto.CompactTextString(m) }
+func (*Stats) ProtoMessage()    {}
+func (*Stats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{12}
+}
+
+func (m *Stats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Stats.Unmarshal(m, b)
+}
+func (m *Stats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Stats.Marshal(b, m, deterministic)
+}
+func (m *Stats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Stats.Merge(m, src)
+}
+func (m *Stats) XXX_Size() int {
+	return xxx_messageInfo_Stats.Size(m)
+}
+func (m *Stats) XXX_DiscardUnknown() {
+	xxx_messageInfo_Stats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Stats proto.InternalMessageInfo
+
+func (m *Stats) GetTokens() []*TokenStatistics {
+	if m != nil {
+		return m.Tokens
+	}
+	return nil
+}
+
+func (m *Stats) GetExpiredBacklog() int64 {
+	if m != nil {
+		return m.ExpiredBacklog
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterEnum("oauth2pg.admin.v1.TokenTypeHint", TokenTypeHint_name, TokenTypeHint_value)
+	proto.RegisterType((*Client)(nil), "oauth2pg.admin.v1.Client")
+	proto.RegisterType((*CreateClientRequest)(nil), "oauth2pg.admin.v1.CreateClientRequest")
+	proto.RegisterType((*GetClientRequest)(nil), "oauth2pg.admin.v1.GetClientRequest")
+	proto.RegisterType((*UpdateClientRequest)(nil), "oauth2pg.admin.v1.UpdateClientRequest")
+	proto.RegisterType((*DeleteClientRequest)(nil), "oauth2pg.admin.v1.DeleteClientRequest")
+	proto.RegisterType((*TokenFilter)(nil), "oauth2pg.admin.v1.TokenFilter")
+	proto.RegisterType((*SearchTokensRequest)(nil), "oauth2pg.admin.v1.SearchTokensRequest")
+	proto.RegisterType((*Token)(nil), "oauth2pg.admin.v1.Token")
+	proto.RegisterType((*SearchTokensResponse)(nil), "oauth2pg.admin.v1.SearchTokensResponse")
+	proto.RegisterType((*RevokeTokenRequest)(nil), "oauth2pg.admin.v1.RevokeTokenRequest")
+	proto.RegisterType((*GetStatsRequest)(nil), "oauth2pg.admin.v1.GetStatsRequest")
+	proto.RegisterType((*TokenStatistics)(nil), "oauth2pg.admin.v1.TokenStatistics")
+	proto.RegisterType((*Stats)(nil), "oauth2pg.admin.v1.Stats")
+}
+
+func init() { proto.RegisterFile("admin.proto", fileDescriptor_73a7fc70dcc2027c) }
+
+var fileDescriptor_73a7fc70dcc2027c = []byte{
+	// 932 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x51, 0x6f, 0xe2, 0x46,
+	0x10, 0x2e, 0x10, 0x9c, 0x30, 0x40, 0x02, 0x9b, 0x28, 0x75, 0x89, 0xd4, 0x43, 0x3e, 0xa5, 0x87,
+	0xfa, 0xc0, 0xf5, 0xa8, 0x54, 0xe9, 0xfa, 0x52, 0x11, 0xce, 0x09, 0xe8, 0xaa, 0xf4, 0xce, 0x90,
+	0x87, 0xf6, 0xc5, 0x72, 0xec, 0x81, 0xac, 0x62, 0x6c, 0x77, 0x77, 0xa1, 0x3d, 0xf5, 0xcf, 0xf4,
+	0x37, 0xf4, 0x67, 0xf4, 0xb1, 0xbf, 0xa8, 0xf2, 0xee, 0x3a, 0xe7, 0x24, 0x26, 0xdc, 0xc3, 0xbd,
+	0x79, 0x66, 0xbf, 0x9d, 0x19, 0xbe, 0x6f, 0x66, 0x16, 0xa8, 0x7b, 0xc1, 0x92, 0x46, 0xfd, 0x84,
+	0xc5, 0x22, 0x26, 0xed, 0xd8, 0x5b, 0x89, 0x9b, 0x41, 0xb2, 0xe8, 0x2b, 0xef, 0xfa, 0x55, 0xe7,
+	0x64, 0x11, 0xc7, 0x8b, 0x10, 0x5f, 0x4a, 0xc0, 0xf5, 0x6a, 0xfe, 0x12, 0x97, 0x89, 0xf8, 0xa0,
+	0xf0, 0x9d, 0x67, 0x0f, 0x0f, 0x05, 0x5d, 0x22, 0x17, 0xde, 0x32, 0x51, 0x00, 0xeb, 0x9f, 0x32,
+	0x18, 0xa3, 0x90, 0x62, 0x24, 0xc8, 0x3e, 0x94, 0x69, 0x60, 0x96, 0xba, 0xa5, 0x5e, 0xcd, 0x29,
+	0xd3, 0x80, 0x1c, 0x83, 0xc1, 0xd1, 0x67, 0x28, 0xcc, 0xb2, 0xf4, 0x69, 0x2b, 0xf5, 0x07, 0xf1,
+	0xd2, 0xa3, 0x91, 0x59, 0x51, 0x7e, 0x65, 0x91, 0x2f, 0x61, 0x77, 0xc5, 0x91, 0xb9, 0x34, 0x30,
+	0x77, 0xd4, 0x41, 0x6a, 0x4e, 0x02, 0xf2, 0x1c, 0x9a, 0x0c, 0x03, 0xca, 0xd0, 0x17, 0xee, 0x8a,
+	0x51, 0x6e, 0x56, 0xbb, 0x95, 0x5e, 0xcd, 0x69, 0x64, 0xce, 0x2b, 0x46, 0x39, 0x39, 0x85, 0x7d,
+	0x2f, 0x0c, 0xe3, 0x3f, 0x30, 0x70, 0xb9, 0x1f, 0x27, 0xc8, 0x4d, 0x43, 0xa2, 0x9a, 0xda, 0x3b,
+	0x95, 0x4e, 0xd2, 0x87, 0xc3, 0x0c, 0xb6, 0x60, 0x5e, 0x24, 0x5c, 0xf1, 0x21, 0xc5, 0xee, 0x4a,
+	0x6c, 0x5b, 0x1f, 0x5d, 0xa4, 0x27, 0xb3, 0xf4, 0x80, 0xbc, 0x06, 0xc0, 0x3f, 0x13, 0xca, 0x90,
+	0xbb, 0x9e, 0x30, 0xf7, 0xba, 0xa5, 0x5e, 0x7d, 0xd0, 0xe9, 0x2b, 0x56, 0xfa, 0x19, 0x2b, 0xfd,
+	0x59, 0xc6, 0x8a, 0x53, 0xd3, 0xe8, 0xa1, 0x20, 0x26, 0xec, 0xae, 0x91, 0x71, 0x1a, 0x47, 0x66,
+	0xad, 0x5b, 0xea, 0x55, 0x9c, 0xcc, 0xb4, 0xc6, 0x70, 0x38, 0x62, 0xe8, 0x09, 0x54, 0xcc, 0x39,
+	0xf8, 0xfb, 0x0a, 0xb9, 0x20, 0xaf, 0xc0, 0xf0, 0xa5, 0x43, 0x92, 0x58, 0x1f, 0x7c, 0xd5, 0x7f,
+	0xa4, 0x56, 0x5f, 0xdf, 0xd0, 0x40, 0xcb, 0x82, 0xd6, 0x05, 0x8a, 0xfb, 0x61, 0x1e, 0xe8, 0x90,
+	0x66, 0xbb, 0x4a, 0x82, 0xcf, 0x91, 0xed, 0x14, 0x0e, 0xdf, 0x60, 0x88, 0x02, 0x9f, 0x4e, 0xf8,
+	0x77, 0x19, 0xea, 0xb3, 0xf8, 0x16, 0xa3, 0x73, 0x1a, 0x0a, 0x64, 0xe4, 0x04, 0x6a, 0x2a, 0x80,
+	0x7b, 0x07, 0xdb, 0x53, 0x8e, 0x49, 0x90, 0x57, 0xbd, 0x7c, 0x4f, 0xf5, 0x23, 0xa8, 0x4a, 0x21,
+	0x75, 0x97, 0x28, 0x83, 0x0c, 0x61, 0xdf, 0x97, 0xd4, 0x05, 0xee, 0x35, 0xce, 0x63, 0x86, 0xe6,
+	0xce, 0x56, 0x4d, 0x9a, 0xfa, 0xc6, 0x99, 0xbc, 0x40, 0x7e, 0x82, 0xe6, 0x9d, 0xa4, 0x73, 0x81,
+	0xcc, 0xac, 0x6e, 0x8d, 0xd0, 0xc8, 0x54, 0x4d, 0xf1, 0x69, 0x0d, 0x59, 0x00, 0x5d, 0x83, 0xb1,
+	0xbd, 0x06, 0x7d, 0x43, 0xd5, 0x60, 0xfd, 0x05, 0x87, 0x53, 0xf4, 0x98, 0x7f, 0x23, 0x79, 0xe2,
+	0x19, 0x93, 0x3f, 0x80, 0x31, 0x97, 0x9c, 0x69, 0x4d, 0xbe, 0x2e, 0xd0, 0x24, 0xc7, 0xac, 0xa3,
+	0xd1, 0x29, 0x57, 0x21, 0x5d, 0x52, 0x35, 0x69, 0x55, 0x47, 0x19, 0xe9, 0xa0, 0xc5, 0xf3, 0x39,
+	0x47, 0x21, 0x29, 0xac, 0x3a, 0xda, 0xb2, 0xfe, 0x2b, 0x43, 0x55, 0x46, 0xf9, 0xac, 0xca, 0x1c,
+	0x83, 0xe1, 0xf9, 0x3e, 0x72, 0x9e, 0x4d, 0xaf, 0xb2, 0xc8, 0x39, 0xb4, 0xd5, 0x97, 0x9b, 0x1b,
+	0xa4, 0xed, 0x94, 0x1f, 0xa8, 0x4b, 0x76, 0x7e, 0x9c, 0x18, 0xce, 0x19, 0xf2, 0x1b, 0x49, 0x77,
+	0xcd, 0xc9, 0x4c, 0x32, 0x06, 0xa2, 0x3f, 0xf3, 0x29, 0x76, 0xb7, 0xa6, 0x68, 0xe9, 0x5b, 0x1f,
+	0x73, 0xbc, 0x06, 0xc8, 0xba, 0xeb, 0xd3, 0xa6, 0x5d, 0xa3, 0x87, 0xc2, 0x1a, 0xc3, 0xd1, 0x7d,
+	0x45, 0x79, 0x12, 0x47, 0x1c, 0xc9, 0x77, 0x60, 0x08, 0xe9, 0x31, 0x4b, 0xdd, 0x4a, 0xaf, 0x3e,
+	0x30, 0x37, 0x49, 0xea, 0x68, 0x9c, 0x25, 0x80, 0x38, 0xb8, 0x8e, 0x6f, 0x51, 0xb9, 0x75, 0x6b,
+	0x1c, 0x41, 0x55, 0x9e, 0x6b, 0x99, 0x94, 0x41, 0xc6, 0x70, 0x20, 0x3f, 0xe4, 0x1a, 0x73, 0x6f,
+	0x68, 0xa4, 0x5a, 0x60, 0x7f, 0xd0, 0xdd, 0x94, 0x26, 0x5d, 0x6b, 0x63, 0x1a, 0x09, 0xa7, 0x29,
+	0xf2, 0xa6, 0xd5, 0x86, 0x83, 0x0b, 0x14, 0x53, 0xe1, 0x89, 0xac, 0x1b, 0x2d, 0x01, 0x07, 0xf2,
+	0x4a, 0xea, 0xa4, 0x5c, 0x50, 0x9f, 0x3f, 0xdd, 0x30, 0x04, 0x76, 0x6e, 0x69, 0x94, 0x75, 0x8b,
+	0xfc, 0x56, 0x5d, 0x21, 0xe8, 0x5a, 0x35, 0x4b, 0xc5, 0xd1, 0x56, 0xaa, 0xa6, 0xd2, 0x4a, 0x2d,
+	0xfb, 0x8a, 0x93, 0x99, 0x56, 0x08, 0x55, 0x59, 0x05, 0xf9, 0xf1, 0x01, 0x73, 0xd6, 0xa6, 0x9f,
+	0xf4, 0xb1, 0xbe, 0x8c, 0x43, 0xf2, 0x02, 0x0e, 0x74, 0x3c, 0xf7, 0xda, 0xf3, 0x6f, 0xc3, 0x78,
+	0x21, 0xab, 0xaa, 0x38, 0x7a, 0x72, 0x83, 0x33, 0xe5, 0xfd, 0xf6, 0x0a, 0x9a, 0xf7, 0x68, 0x21,
+	0xcf, 0xe0, 0x64, 0xf6, 0xcb, 0x5b, 0xfb, 0xd2, 0x9d, 0xfd, 0xfa, 0xce, 0x76, 0xc7, 0x93, 0xcb,
+	0x99, 0x7b, 0x75, 0x39, 0x7d, 0x67, 0x8f, 0x26, 0xe7, 0x13, 0xfb, 0x4d, 0xeb, 0x0b, 0xd2, 0x82,
+	0xc6, 0x70, 0x34, 0xb2, 0xa7, 0x53, 0x57, 0xe2, 0x5a, 0x25, 0xd2, 0x86, 0xa6, 0x63, 0x9f, 0x3b,
+	0xf6, 0x74, 0xac, 0x5d, 0xe5, 0xc1, 0xbf, 0x3b, 0xd0, 0x18, 0xa6, 0x45, 0x4e, 0x91, 0xad, 0xa9,
+	0x8f, 0xe4, 0x3d, 0x34, 0xf2, 0x2b, 0x9f, 0x7c, 0x53, 0xb4, 0x6d, 0x1f, 0xbf, 0x09, 0x9d, 0xcd,
+	0x5b, 0x99, 0xbc, 0x85, 0xda, 0xdd, 0xee, 0x27, 0xcf, 0x0b, 0x70, 0x0f, 0x5f, 0x86, 0xa7, 0x82,
+	0xbd, 0x87, 0x46, 0xfe, 0x91, 0x28, 0xac, 0xaf, 0xe0, 0x15, 0x79, 0x2a, 0xe4, 0x25, 0x34, 0xf2,
+	0xaf, 0x45, 0x61, 0xc8, 0x82, 0xe7, 0xa4, 0x73, 0xfc, 0x68, 0xe0, 0xec, 0xf4, 0x1f, 0x09, 0x71,
+	0xa1, 0x91, 0x9f, 0xb0, 0xc2, 0x78, 0x05, 0x4b, 0xb5, 0xf3, 0x62, 0x2b, 0x4e, 0x8f, 0xea, 0xcf,
+	0x50, 0xcf, 0x0d, 0x1e, 0x39, 0x2d, 0xb8, 0xf7, 0x78, 0x30, 0x37, 0x96, 0x3b, 0x86, 0xbd, 0x6c,
+	0xa0, 0x88, 0x55, 0xac, 0x4e, 0x7e, 0xda, 0x3a, 0x45, 0x8b, 0x41, 0x02, 0xce, 0xea, 0xbf, 0xd5,
+	0xa4, 0x67, 0xc1, 0x12, 0xff, 0xda, 0x90, 0x69, 0xbe, 0xff, 0x7f, 0x00, 0xb2, 0x75, 0x78, 0x7a,
+	0xd7, 0x09, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// AdminServiceClient is the client API for AdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AdminServiceClient interface {
+	// CreateClient creates the client, ALREADY_EXISTS is returned for the existing client id
+	CreateClient(ctx context.Context, in *CreateClientRequest, opts ...grpc.CallOption) (*Client, error)
+	// GetClient returns the client with its version, NOT_FOUND is returned for the unknown client id
+	GetClient(ctx context.Context, in *GetClientRequest, opts ...grpc.CallOption) (*Client, error)
+	// UpdateClient updates the client of the version, ABORTED is returned when the client version has changed
+	UpdateClient(ctx context.Context, in *UpdateClientRequest, opts ...grpc.CallOption) (*Client, error)
+	// DeleteClient deletes the client
+	DeleteClient(ctx context.Context, in *DeleteClientRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	// SearchTokens returns the tokens matching the filter
+	SearchTokens(ctx context.Context, in *SearchTokensRequest, opts ...grpc.CallOption) (*SearchTokensResponse, error)
+	// RevokeToken removes the token, the token without the type hint is removed as both access and refresh token
+	RevokeToken(ctx context.Context, in *RevokeTokenRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	// GetStats returns the tokens counts by client and token kind and the expired tokens backlog
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error)
+}
+
+type adminServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminServiceClient(cc *grpc.ClientConn) AdminServiceClient {
+	return &adminServiceClient{cc}
+}
+
+func (c *adminServiceClient) CreateClient(ctx context.Context, in *CreateClientRequest, opts ...grpc.CallOption) (*Client, error) {
+	out := new(Client)
+	err := c.cc.Invoke(ctx, "/oauth2pg.admin.v1.AdminService/CreateClient", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) GetClient(ctx context.Context, in *GetClientRequest, opts ...grpc.CallOption) (*Client, error) {
+	out := new(Client)
+	err := c.cc.Invoke(ctx, "/oauth2pg.admin.v1.AdminService/GetClient", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) UpdateClient(ctx context.Context, in *UpdateClientRequest, opts ...grpc.CallOption) (*Client, error) {
+	out := new(Client)
+	err := c.cc.Invoke(ctx, "/oauth2pg.admin.v1.AdminService/UpdateClient", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) DeleteClient(ctx context.Context, in *DeleteClientRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/oauth2pg.admin.v1.AdminService/DeleteClient", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) SearchTokens(ctx context.Context, in *SearchTokensRequest, opts ...grpc.CallOption) (*SearchTokensResponse, error) {
+	out := new(SearchTokensResponse)
+	err := c.cc.Invoke(ctx, "/oauth2pg.admin.v1.AdminService/SearchTokens", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) RevokeToken(ctx context.Context, in *RevokeTokenRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/oauth2pg.admin.v1.AdminService/RevokeToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, "/oauth2pg.admin.v1.AdminService/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServiceServer is the server API for AdminService service.
+type AdminServiceServer interface {
+	// CreateClient creates the client, ALREADY_EXISTS is returned for the existing client id
+	CreateClient(context.Context, *CreateClientRequest) (*Client, error)
+	// GetClient returns the client with its version, NOT_FOUND is returned for the unknown client id
+	GetClient(context.Context, *GetClientRequest) (*Client, error)
+	// UpdateClient updates the client of the version, ABORTED is returned when the client version has changed
+	UpdateClient(context.Context, *UpdateClientRequest) (*Client, error)
+	// DeleteClient deletes the client
+	DeleteClient(context.Context, *DeleteClientRequest) (*empty.Empty, error)
+	// SearchTokens returns the tokens matching the filter
+	SearchTokens(context.Context, *SearchTokensRequest) (*SearchTokensResponse, error)
+	// RevokeToken removes the token, the token without the type hint is removed as both access and refresh token
+	RevokeToken(context.Context, *RevokeTokenRequest) (*empty.Empty, error)
+	// GetStats returns the tokens counts by client and token kind and the expired tokens backlog
+	GetStats(context.Context, *GetStatsRequest) (*Stats, error)
+}
+
+// UnimplementedAdminServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedAdminServiceServer struct {
+}
+
+func (*UnimplementedAdminServiceServer) CreateClient(ctx context.Context, req *CreateClientRequest) (*Client, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateClient not implemented")
+}
+func (*UnimplementedAdminServiceServer) GetClient(ctx context.Context, req *GetClientRequest) (*Client, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClient not implemented")
+}
+func (*UnimplementedAdminServiceServer) UpdateClient(ctx context.Context, req *UpdateClientRequest) (*Client, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateClient not implemented")
+}
+func (*UnimplementedAdminServiceServer) DeleteClient(ctx context.Context, req *DeleteClientRequest) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteClient not implemented")
+}
+func (*UnimplementedAdminServiceServer) SearchTokens(ctx context.Context, req *SearchTokensRequest) (*SearchTokensResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchTokens not implemented")
+}
+func (*UnimplementedAdminServiceServer) RevokeToken(ctx context.Context, req *RevokeTokenRequest) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeToken not implemented")
+}
+func (*UnimplementedAdminServiceServer) GetStats(ctx context.Context, req *GetStatsRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+
+func RegisterAdminServiceServer(s *grpc.Server, srv AdminServiceServer) {
+	s.RegisterService(&_AdminService_serviceDesc, srv)
+}
+
+func _AdminService_CreateClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).CreateClient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/oauth2pg.admin.v1.AdminService/CreateClient",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).CreateClient(ctx, req.(*CreateClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_GetClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).GetClient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/oauth2pg.admin.v1.AdminService/GetClient",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).GetClient(ctx, req.(*GetClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_UpdateClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).UpdateClient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/oauth2pg.admin.v1.AdminService/UpdateClient",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).UpdateClient(ctx, req.(*UpdateClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_DeleteClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).DeleteClient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/oauth2pg.admin.v1.AdminService/DeleteClient",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).DeleteClient(ctx, req.(*DeleteClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_SearchTokens_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchTokensRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).SearchTokens(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/oauth2pg.admin.v1.AdminService/SearchTokens",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).SearchTokens(ctx, req.(*SearchTokensRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_RevokeToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).RevokeToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/oauth2pg.admin.v1.AdminService/RevokeToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).RevokeToken(ctx, req.(*RevokeTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/oauth2pg.admin.v1.AdminService/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _AdminService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "oauth2pg.admin.v1.AdminService",
+	HandlerType: (*AdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateClient",
+			Handler:    _AdminService_CreateClient_Handler,
+		},
+		{
+			MethodName: "GetClient",
+			Handler:    _AdminService_GetClient_Handler,
+		},
+		{
+			MethodName: "UpdateClient",
+			Handler:    _AdminService_UpdateClient_Handler,
+		},
+		{
+			MethodName: "DeleteClient",
+			Handler:    _AdminService_DeleteClient_Handler,
+		},
+		{
+			MethodName: "SearchTokens",
+			Handler:    _AdminService_SearchTokens_Handler,
+		},
+		{
+			MethodName: "RevokeToken",
+			Handler:    _AdminService_RevokeToken_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _AdminService_GetStats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
@@ -0,0 +1,332 @@
+// Package admingrpc provides the gRPC implementation of the internal management API on top of the token and
+// client stores, the same operations adminapi package serves over HTTP, so the tooling in other languages
+// can manage the stores with the client generated from admin.proto. The service is not the part of the
+// OAuth 2.0 protocol, it must not be exposed to the clients.
+//
+// The package is optional, the stores do not depend on gRPC.
+package admingrpc
+
+//go:generate protoc --go_out=plugins=grpc:. admin.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/oauth2.v3"
+)
+
+// TokenStore is the token store used by the server, implemented by pg.TokenStore and pgmock.TokenStore
+type TokenStore interface {
+	Search(filter pg.TokenFilter, page pg.Pagination) ([]oauth2.TokenInfo, error)
+	RemoveByAccess(access string) error
+	RemoveByRefresh(refresh string) error
+	Statistics(ctx context.Context) ([]pg.TokenStatistics, error)
+	ExpiredBacklog(ctx context.Context) (int64, error)
+}
+
+// ClientStore is the client store used by the server, implemented by pg.ClientStore and pgmock.ClientStore
+type ClientStore interface {
+	Create(info oauth2.ClientInfo) error
+	GetWithVersion(id string) (oauth2.ClientInfo, int64, error)
+	Update(info oauth2.ClientInfo, version int64) (int64, error)
+	Delete(id string) error
+}
+
+// Authenticator checks that the call is made by the administrator, the incoming metadata is read from the context
+type Authenticator func(ctx context.Context) bool
+
+// BearerToken returns authenticator accepting the calls with the static bearer token in authorization metadata,
+// tokens are compared in constant time
+func BearerToken(token string) Authenticator {
+	return func(ctx context.Context) bool {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, auth := range md.Get("authorization") {
+			if token != "" && strings.HasPrefix(auth, "Bearer ") &&
+				subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Server is AdminServiceServer implementation, register it with RegisterAdminServiceServer
+type Server struct {
+	tokens       TokenStore
+	clients      ClientStore
+	authenticate Authenticator
+}
+
+var _ AdminServiceServer = (*Server)(nil)
+
+// NewServer creates management API server, every call is checked with the authenticator
+func NewServer(tokens TokenStore, clients ClientStore, authenticate Authenticator) *Server {
+	return &Server{tokens: tokens, clients: clients, authenticate: authenticate}
+}
+
+// authorize returns UNAUTHENTICATED status error for the call that is not made by the administrator
+func (s *Server) authorize(ctx context.Context) error {
+	if s.authenticate == nil || !s.authenticate(ctx) {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return nil
+}
+
+// storeError returns the status error for the store error, the errors details are not disclosed
+func storeError(err error) error {
+	switch {
+	case errors.Is(err, pg.ErrClientNotFound), errors.Is(err, pg.ErrTokenNotFound):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, pg.ErrClientAlreadyExists):
+		return status.Error(codes.AlreadyExists, "client already exists")
+	case errors.Is(err, pg.ErrVersionConflict):
+		return status.Error(codes.Aborted, "client version conflict")
+	case errors.Is(err, pg.ErrEmptyTokenFilter):
+		return status.Error(codes.InvalidArgument, "tokens filter is empty")
+	default:
+		return status.Error(codes.Unavailable, "store error")
+	}
+}
+
+// toTime returns the time of the timestamp, nil timestamp is the zero time
+func toTime(ts *timestamp.Timestamp) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+	return ptypes.Timestamp(ts)
+}
+
+// toTimestamp returns the timestamp of the time, zero time is nil timestamp
+func toTimestamp(t time.Time) *timestamp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	// times of the stores are within the timestamp range
+	ts, _ := ptypes.TimestampProto(t)
+	return ts
+}
+
+// CreateClient creates the client
+func (s *Server) CreateClient(ctx context.Context, req *CreateClientRequest) (*Client, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetClient().GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+
+	client, err := toClient(req.GetClient())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.clients.Create(client); err != nil {
+		return nil, storeError(err)
+	}
+	return s.getClient(client.ID)
+}
+
+// GetClient returns the client with its version
+func (s *Server) GetClient(ctx context.Context, req *GetClientRequest) (*Client, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+	return s.getClient(req.GetId())
+}
+
+// UpdateClient updates the client of the version
+func (s *Server) UpdateClient(ctx context.Context, req *UpdateClientRequest) (*Client, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetClient().GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+
+	client, err := toClient(req.GetClient())
+	if err != nil {
+		return nil, err
+	}
+	// secret is changed with the secret rotation only
+	client.Secret = ""
+	if _, err := s.clients.Update(client, req.GetClient().GetVersion()); err != nil {
+		return nil, storeError(err)
+	}
+	return s.getClient(client.ID)
+}
+
+// DeleteClient deletes the client
+func (s *Server) DeleteClient(ctx context.Context, req *DeleteClientRequest) (*empty.Empty, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+
+	if err := s.clients.Delete(req.GetId()); err != nil {
+		return nil, storeError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// getClient returns the stored client with its current version
+func (s *Server) getClient(id string) (*Client, error) {
+	info, version, err := s.clients.GetWithVersion(id)
+	if err == nil && info == nil {
+		err = pg.ErrClientNotFound
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return newClient(info, version), nil
+}
+
+// toClient returns the client information model of the message
+func toClient(c *Client) (*pg.Client, error) {
+	expiresAt, err := toTime(c.GetExpiresAt())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid expires_at")
+	}
+
+	client := &pg.Client{RedirectURIs: c.GetRedirectUris(), AllowedScopes: c.GetAllowedScopes(), ExpiresAt: expiresAt}
+	client.ID, client.Secret, client.Domain, client.UserID = c.GetId(), c.GetSecret(), c.GetDomain(), c.GetUserId()
+	for _, grantType := range c.GetAllowedGrantTypes() {
+		client.AllowedGrantTypes = append(client.AllowedGrantTypes, oauth2.GrantType(grantType))
+	}
+	return client, nil
+}
+
+// newClient returns the message for the client information, the optional fields are read as the stores do
+// for the models that provide them
+func newClient(info oauth2.ClientInfo, version int64) *Client {
+	client := &Client{Id: info.GetID(), Domain: info.GetDomain(), UserId: info.GetUserID(), Version: version}
+	if c, ok := info.(interface{ GetRedirectURIs() []string }); ok {
+		client.RedirectUris = c.GetRedirectURIs()
+	}
+	if c, ok := info.(interface{ GetAllowedScopes() []string }); ok {
+		client.AllowedScopes = c.GetAllowedScopes()
+	}
+	if c, ok := info.(interface{ GetAllowedGrantTypes() []oauth2.GrantType }); ok {
+		for _, grantType := range c.GetAllowedGrantTypes() {
+			client.AllowedGrantTypes = append(client.AllowedGrantTypes, grantType.String())
+		}
+	}
+	if c, ok := info.(interface{ GetExpiresAt() time.Time }); ok {
+		client.ExpiresAt = toTimestamp(c.GetExpiresAt())
+	}
+	return client
+}
+
+// SearchTokens returns the tokens matching the filter
+func (s *Server) SearchTokens(ctx context.Context, req *SearchTokensRequest) (*SearchTokensResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetLimit() < 0 || req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+	}
+
+	f := req.GetFilter()
+	filter := pg.TokenFilter{ClientID: f.GetClientId(), UserID: f.GetUserId(), Scope: f.GetScope()}
+	for name, field := range map[string]struct {
+		ts  *timestamp.Timestamp
+		dst *time.Time
+	}{
+		"created_before": {f.GetCreatedBefore(), &filter.CreatedBefore},
+		"expires_after":  {f.GetExpiresAfter(), &filter.ExpiresAfter},
+		"expires_before": {f.GetExpiresBefore(), &filter.ExpiresBefore},
+	} {
+		t, err := toTime(field.ts)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid "+name)
+		}
+		*field.dst = t
+	}
+
+	tokens, err := s.tokens.Search(filter, pg.Pagination{Limit: int(req.GetLimit()), Offset: int(req.GetOffset())})
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	resp := &SearchTokensResponse{Tokens: make([]*Token, len(tokens))}
+	for i, info := range tokens {
+		resp.Tokens[i] = newToken(info)
+	}
+	return resp, nil
+}
+
+// newToken returns the message for the token information
+func newToken(info oauth2.TokenInfo) *Token {
+	token := &Token{
+		ClientId:  info.GetClientID(),
+		UserId:    info.GetUserID(),
+		Scope:     info.GetScope(),
+		Access:    info.GetAccess(),
+		Refresh:   info.GetRefresh(),
+		CreatedAt: toTimestamp(info.GetAccessCreateAt()),
+	}
+	if info.GetAccess() != "" && info.GetAccessExpiresIn() > 0 {
+		token.AccessExpiresAt = toTimestamp(info.GetAccessCreateAt().Add(info.GetAccessExpiresIn()))
+	}
+	if info.GetRefresh() != "" && info.GetRefreshExpiresIn() > 0 {
+		token.RefreshExpiresAt = toTimestamp(info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn()))
+	}
+	return token
+}
+
+// RevokeToken removes the token, refresh token removal revokes the access token issued with it as well
+func (s *Server) RevokeToken(ctx context.Context, req *RevokeTokenRequest) (*empty.Empty, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	var err error
+	if req.GetTokenTypeHint() != TokenTypeHint_REFRESH_TOKEN {
+		err = s.tokens.RemoveByAccess(req.GetToken())
+	}
+	if err == nil && req.GetTokenTypeHint() != TokenTypeHint_ACCESS_TOKEN {
+		err = s.tokens.RemoveByRefresh(req.GetToken())
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// GetStats returns the tokens counts by client and token kind and the expired tokens backlog
+func (s *Server) GetStats(ctx context.Context, req *GetStatsRequest) (*Stats, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	statistics, err := s.tokens.Statistics(ctx)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	backlog, err := s.tokens.ExpiredBacklog(ctx)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	stats := &Stats{Tokens: make([]*TokenStatistics, len(statistics)), ExpiredBacklog: backlog}
+	for i, st := range statistics {
+		stats.Tokens[i] = &TokenStatistics{ClientId: st.ClientID, Kind: string(st.Kind), Active: st.Active, Expired: st.Expired}
+	}
+	return stats, nil
+}
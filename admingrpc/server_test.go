@@ -0,0 +1,188 @@
+package admingrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"github.com/vgarvardt/go-oauth2-pg/pgmock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gopkg.in/oauth2.v3/models"
+)
+
+var (
+	_ TokenStore  = (*pg.TokenStore)(nil)
+	_ TokenStore  = (*pgmock.TokenStore)(nil)
+	_ ClientStore = (*pg.ClientStore)(nil)
+	_ ClientStore = (*pgmock.ClientStore)(nil)
+)
+
+// newTestClient starts the server on the in-memory listener and returns the client connected to it,
+// the returned function stops the server
+func newTestClient(t *testing.T) (AdminServiceClient, *pgmock.TokenStore, *pgmock.ClientStore, func()) {
+	tokens := pgmock.NewTokenStore()
+	clients := pgmock.NewClientStore()
+	require.NoError(t, clients.Create(&models.Client{ID: "c1", Secret: "secret1", Domain: "https://c1.example.com"}))
+
+	now := time.Now()
+	require.NoError(t, tokens.Create(&models.Token{ClientID: "c1", UserID: "u1", Scope: "read", Access: "access1", AccessCreateAt: now, AccessExpiresIn: time.Hour}))
+	require.NoError(t, tokens.Create(&models.Token{
+		ClientID:         "c1",
+		UserID:           "u2",
+		Access:           "access2",
+		AccessCreateAt:   now,
+		AccessExpiresIn:  time.Hour,
+		Refresh:          "refresh2",
+		RefreshCreateAt:  now,
+		RefreshExpiresIn: 30 * 24 * time.Hour,
+	}))
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	RegisterAdminServiceServer(server, NewServer(tokens, clients, BearerToken("admin")))
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	require.NoError(t, err)
+
+	return NewAdminServiceClient(conn), tokens, clients, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func adminContext() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer admin")
+}
+
+func TestServer_authentication(t *testing.T) {
+	client, _, _, stop := newTestClient(t)
+	defer stop()
+
+	_, err := client.GetClient(context.Background(), &GetClientRequest{Id: "c1"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong")
+	_, err = client.GetStats(ctx, &GetStatsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.GetClient(adminContext(), &GetClientRequest{Id: "c1"})
+	assert.NoError(t, err)
+
+	// empty token accepts nothing
+	assert.False(t, BearerToken("")(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "))))
+}
+
+func TestServer_clients(t *testing.T) {
+	client, _, clients, stop := newTestClient(t)
+	defer stop()
+	ctx := adminContext()
+
+	c, err := client.GetClient(ctx, &GetClientRequest{Id: "c1"})
+	require.NoError(t, err)
+	assert.Equal(t, "c1", c.Id)
+	assert.Equal(t, []string{"https://c1.example.com"}, c.RedirectUris)
+	assert.Empty(t, c.Secret)
+
+	c, err = client.CreateClient(ctx, &CreateClientRequest{Client: &Client{
+		Id:                "c2",
+		Secret:            "secret2",
+		RedirectUris:      []string{"https://c2.example.com/cb"},
+		AllowedScopes:     []string{"read"},
+		AllowedGrantTypes: []string{"authorization_code"},
+		ExpiresAt:         toTimestamp(time.Now().Add(time.Hour)),
+	}})
+	require.NoError(t, err)
+	assert.Empty(t, c.Secret)
+	assert.Equal(t, []string{"authorization_code"}, c.AllowedGrantTypes)
+	assert.NotNil(t, c.ExpiresAt)
+	_, err = clients.ValidateSecret("c2", "secret2")
+	require.NoError(t, err)
+
+	_, err = client.CreateClient(ctx, &CreateClientRequest{Client: &Client{Id: "c2"}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.CreateClient(ctx, &CreateClientRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// stale version is refused, secret is kept on update
+	_, err = client.UpdateClient(ctx, &UpdateClientRequest{Client: &Client{Id: "c2", Version: 42}})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	updated, err := client.UpdateClient(ctx, &UpdateClientRequest{Client: &Client{
+		Id:           "c2",
+		Secret:       "changed",
+		RedirectUris: []string{"https://c2.example.com/new"},
+		Version:      c.Version,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://c2.example.com/new"}, updated.RedirectUris)
+	assert.NotEqual(t, c.Version, updated.Version)
+	_, err = clients.ValidateSecret("c2", "secret2")
+	assert.NoError(t, err)
+
+	_, err = client.DeleteClient(ctx, &DeleteClientRequest{Id: "c2"})
+	assert.NoError(t, err)
+	_, err = client.DeleteClient(ctx, &DeleteClientRequest{Id: "c2"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetClient(ctx, &GetClientRequest{Id: "c2"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_tokens(t *testing.T) {
+	client, tokens, _, stop := newTestClient(t)
+	defer stop()
+	ctx := adminContext()
+
+	resp, err := client.SearchTokens(ctx, &SearchTokensRequest{Filter: &TokenFilter{ClientId: "c1", Scope: "read"}})
+	require.NoError(t, err)
+	require.Len(t, resp.Tokens, 1)
+	assert.Equal(t, "access1", resp.Tokens[0].Access)
+	assert.NotNil(t, resp.Tokens[0].AccessExpiresAt)
+	assert.Nil(t, resp.Tokens[0].RefreshExpiresAt)
+
+	resp, err = client.SearchTokens(ctx, &SearchTokensRequest{Filter: &TokenFilter{ClientId: "c1"}, Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Len(t, resp.Tokens, 1)
+	_, err = client.SearchTokens(ctx, &SearchTokensRequest{Limit: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.RevokeToken(ctx, &RevokeTokenRequest{Token: "refresh2", TokenTypeHint: TokenTypeHint_ACCESS_TOKEN})
+	require.NoError(t, err)
+	info, err := tokens.GetByRefresh("refresh2")
+	require.NoError(t, err)
+	assert.NotNil(t, info)
+
+	_, err = client.RevokeToken(ctx, &RevokeTokenRequest{Token: "refresh2"})
+	require.NoError(t, err)
+	_, err = tokens.GetByAccess("access2")
+	assert.Equal(t, pg.ErrTokenNotFound, err)
+
+	_, err = client.RevokeToken(ctx, &RevokeTokenRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetStats(t *testing.T) {
+	client, tokens, _, stop := newTestClient(t)
+	defer stop()
+	require.NoError(t, tokens.Create(&models.Token{ClientID: "c2", Access: "expired", AccessCreateAt: time.Now().Add(-2 * time.Hour), AccessExpiresIn: time.Hour}))
+
+	stats, err := client.GetStats(adminContext(), &GetStatsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.ExpiredBacklog)
+
+	counts := make(map[string]*TokenStatistics)
+	for _, st := range stats.Tokens {
+		counts[st.ClientId+"/"+st.Kind] = st
+	}
+	require.Contains(t, counts, "c2/access")
+	assert.Equal(t, int64(1), counts["c2/access"].Expired)
+}
@@ -0,0 +1,264 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+// BackchannelRequestStatus is the status of the CIBA backchannel authentication request
+type BackchannelRequestStatus string
+
+// Backchannel authentication request statuses
+const (
+	BackchannelRequestPending  BackchannelRequestStatus = "pending"
+	BackchannelRequestApproved BackchannelRequestStatus = "approved"
+	BackchannelRequestDenied   BackchannelRequestStatus = "denied"
+)
+
+// BackchannelRequest is the OpenID Connect CIBA backchannel authentication request,
+// zero PolledAt means the token endpoint was not polled for the request yet
+type BackchannelRequest struct {
+	AuthReqID string
+	ClientID  string
+	LoginHint string
+	Scope     string
+	Status    BackchannelRequestStatus
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	PolledAt  time.Time
+}
+
+// backchannelRequestItem data item
+type backchannelRequestItem struct {
+	AuthReqID string     `db:"auth_req_id"`
+	ClientID  string     `db:"client_id"`
+	LoginHint string     `db:"login_hint"`
+	Scope     string     `db:"scope"`
+	Status    string     `db:"status"`
+	UserID    string     `db:"user_id"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	PolledAt  *time.Time `db:"polled_at"`
+}
+
+func (item *backchannelRequestItem) request() *BackchannelRequest {
+	req := &BackchannelRequest{
+		AuthReqID: item.AuthReqID,
+		ClientID:  item.ClientID,
+		LoginHint: item.LoginHint,
+		Scope:     item.Scope,
+		Status:    BackchannelRequestStatus(item.Status),
+		UserID:    item.UserID,
+		CreatedAt: item.CreatedAt,
+		ExpiresAt: item.ExpiresAt,
+	}
+	if item.PolledAt != nil {
+		req.PolledAt = *item.PolledAt
+	}
+	return req
+}
+
+const backchannelRequestColumns = "auth_req_id, client_id, login_hint, scope, status, user_id, created_at, expires_at, polled_at"
+
+// BackchannelRequestStore PostgreSQL CIBA backchannel authentication requests store
+type BackchannelRequestStore struct {
+	adapter   pgadapter.Adapter
+	tableName string
+	logger    Logger
+	clock     Clock
+
+	gcDisabled bool
+	gcInterval time.Duration
+	gcStrategy GCStrategy
+
+	initTableDisabled bool
+}
+
+// NewBackchannelRequestStore creates PostgreSQL CIBA backchannel authentication requests store instance
+func NewBackchannelRequestStore(adapter pgadapter.Adapter, options ...BackchannelRequestStoreOption) (*BackchannelRequestStore, error) {
+	store := &BackchannelRequestStore{
+		adapter:    adapter,
+		tableName:  "oauth2_backchannel_requests",
+		logger:     log.New(os.Stderr, "[OAUTH2-PG-ERROR]", log.LstdFlags),
+		clock:      systemClock{},
+		gcInterval: 10 * time.Minute,
+	}
+
+	for _, o := range options {
+		o(store)
+	}
+
+	if err := store.validate(); err != nil {
+		return nil, err
+	}
+
+	if !store.initTableDisabled {
+		if err := store.initTable(); err != nil {
+			return store, err
+		}
+	}
+
+	if !store.gcDisabled {
+		store.gcStrategy = &TickerGCStrategy{Interval: store.gcInterval}
+		store.gcStrategy.Start(store.clean)
+	}
+
+	return store, nil
+}
+
+func (s *BackchannelRequestStore) validate() error {
+	var problem string
+	switch {
+	case s.tableName == "":
+		problem = "empty table name"
+	case s.gcInterval <= 0:
+		problem = fmt.Sprintf("GC interval must be positive, got %s", s.gcInterval)
+	default:
+		return nil
+	}
+
+	return fmt.Errorf("invalid backchannel request store configuration: %s", problem)
+}
+
+func (s *BackchannelRequestStore) initTable() error {
+	return s.adapter.Exec(lockedDDL(s.tableName, createTableDDL(s.tableName, "auth_req_id", backchannelTableColumns, "")+
+		fmt.Sprintf("\nCREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s (expires_at);\n", s.tableName)))
+}
+
+// backchannelTableColumns are the backchannel authentication requests table columns
+var backchannelTableColumns = []tableColumn{
+	{"auth_req_id", "TEXT", "NOT NULL"},
+	{"client_id", "TEXT", "NOT NULL"},
+	{"login_hint", "TEXT", "NOT NULL"},
+	{"scope", "TEXT", "NOT NULL"},
+	{"status", "TEXT", "NOT NULL"},
+	{"user_id", "TEXT", "NOT NULL DEFAULT ''"},
+	{"created_at", "TIMESTAMPTZ", "NOT NULL"},
+	{"expires_at", "TIMESTAMPTZ", "NOT NULL"},
+	{"polled_at", "TIMESTAMPTZ", ""},
+}
+
+// Close stops garbage collection
+func (s *BackchannelRequestStore) Close() error {
+	if !s.gcDisabled {
+		s.gcStrategy.Stop()
+	}
+	return nil
+}
+
+func (s *BackchannelRequestStore) clean() {
+	if err := s.adapter.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires_at <= $1", s.tableName), s.clock.Now()); err != nil {
+		s.logger.Printf("Error while cleaning out outdated backchannel requests: %+v", err)
+	}
+}
+
+// Create stores the new pending backchannel authentication request expiring in expiresIn,
+// auth_req_id is generated when the request does not have one
+func (s *BackchannelRequestStore) Create(ctx context.Context, req *BackchannelRequest, expiresIn time.Duration) error {
+	if req.AuthReqID == "" {
+		id, err := generateSecret()
+		if err != nil {
+			return err
+		}
+		req.AuthReqID = id
+	}
+
+	req.Status = BackchannelRequestPending
+	req.CreatedAt = s.clock.Now()
+	req.ExpiresAt = req.CreatedAt.Add(expiresIn)
+	req.PolledAt = time.Time{}
+
+	return execContext(
+		ctx,
+		s.adapter,
+		fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL)", s.tableName, backchannelRequestColumns),
+		req.AuthReqID,
+		req.ClientID,
+		req.LoginHint,
+		req.Scope,
+		string(req.Status),
+		req.UserID,
+		req.CreatedAt,
+		req.ExpiresAt,
+	)
+}
+
+// Get returns the backchannel authentication request by auth_req_id
+func (s *BackchannelRequestStore) Get(ctx context.Context, authReqID string) (*BackchannelRequest, error) {
+	var item backchannelRequestItem
+	if err := selectOneContext(
+		ctx,
+		s.adapter,
+		&item,
+		fmt.Sprintf("SELECT %s FROM %s WHERE auth_req_id = $1", backchannelRequestColumns, s.tableName),
+		authReqID,
+	); err != nil {
+		return nil, err
+	}
+	return item.request(), nil
+}
+
+// Poll records the token endpoint poll of the client request and returns the request with the previous poll time,
+// so the caller can respond with slow_down error to the clients polling too often.
+// pgadapter.ErrNoRows is returned when there is no such request of the client.
+func (s *BackchannelRequestStore) Poll(ctx context.Context, clientID, authReqID string) (*BackchannelRequest, error) {
+	var item backchannelRequestItem
+	if err := selectOneContext(ctx, s.adapter, &item, fmt.Sprintf(`
+WITH previous AS (
+  SELECT auth_req_id, polled_at FROM %[1]s WHERE auth_req_id = $1 AND client_id = $2 FOR UPDATE
+)
+UPDATE %[1]s AS r SET polled_at = $3
+FROM previous
+WHERE r.auth_req_id = previous.auth_req_id
+RETURNING r.auth_req_id, r.client_id, r.login_hint, r.scope, r.status, r.user_id, r.created_at, r.expires_at, previous.polled_at
+`, s.tableName), authReqID, clientID, s.clock.Now()); err != nil {
+		return nil, err
+	}
+	return item.request(), nil
+}
+
+// Approve marks the pending not expired request as approved by the authenticated user,
+// pgadapter.ErrNoRows is returned when there is no such pending request
+func (s *BackchannelRequestStore) Approve(ctx context.Context, authReqID, userID string) error {
+	return s.complete(ctx, authReqID, BackchannelRequestApproved, userID)
+}
+
+// Deny marks the pending not expired request as denied,
+// pgadapter.ErrNoRows is returned when there is no such pending request
+func (s *BackchannelRequestStore) Deny(ctx context.Context, authReqID string) error {
+	return s.complete(ctx, authReqID, BackchannelRequestDenied, "")
+}
+
+func (s *BackchannelRequestStore) complete(ctx context.Context, authReqID string, status BackchannelRequestStatus, userID string) error {
+	var item struct {
+		AuthReqID string `db:"auth_req_id"`
+	}
+	return selectOneContext(
+		ctx,
+		s.adapter,
+		&item,
+		fmt.Sprintf(`UPDATE %s SET status = $2, user_id = $3
+WHERE auth_req_id = $1 AND status = $4 AND expires_at > $5
+RETURNING auth_req_id`, s.tableName),
+		authReqID,
+		string(status),
+		userID,
+		string(BackchannelRequestPending),
+		s.clock.Now(),
+	)
+}
+
+// Remove deletes the request, e.g. once the tokens are issued for the approved request
+func (s *BackchannelRequestStore) Remove(ctx context.Context, authReqID string) error {
+	err := execContext(ctx, s.adapter, fmt.Sprintf("DELETE FROM %s WHERE auth_req_id = $1", s.tableName), authReqID)
+	if err == pgadapter.ErrNoRows {
+		return nil
+	}
+	return err
+}
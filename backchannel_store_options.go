@@ -0,0 +1,48 @@
+package pg
+
+import "time"
+
+// BackchannelRequestStoreOption is the configuration options type for backchannel request store
+type BackchannelRequestStoreOption func(s *BackchannelRequestStore)
+
+// WithBackchannelRequestStoreTableName returns option that sets backchannel request store table name
+func WithBackchannelRequestStoreTableName(tableName string) BackchannelRequestStoreOption {
+	return func(s *BackchannelRequestStore) {
+		s.tableName = tableName
+	}
+}
+
+// WithBackchannelRequestStoreLogger returns option that sets backchannel request store logger implementation
+func WithBackchannelRequestStoreLogger(logger Logger) BackchannelRequestStoreOption {
+	return func(s *BackchannelRequestStore) {
+		s.logger = logger
+	}
+}
+
+// WithBackchannelRequestStoreClock returns option that sets backchannel request store clock used for requests expiration
+func WithBackchannelRequestStoreClock(clock Clock) BackchannelRequestStoreOption {
+	return func(s *BackchannelRequestStore) {
+		s.clock = clock
+	}
+}
+
+// WithBackchannelRequestStoreGCInterval returns option that sets backchannel request store garbage collection interval
+func WithBackchannelRequestStoreGCInterval(gcInterval time.Duration) BackchannelRequestStoreOption {
+	return func(s *BackchannelRequestStore) {
+		s.gcInterval = gcInterval
+	}
+}
+
+// WithBackchannelRequestStoreGCDisabled returns option that disables backchannel request store garbage collection
+func WithBackchannelRequestStoreGCDisabled() BackchannelRequestStoreOption {
+	return func(s *BackchannelRequestStore) {
+		s.gcDisabled = true
+	}
+}
+
+// WithBackchannelRequestStoreInitTableDisabled returns option that disables table creation on store instantiation
+func WithBackchannelRequestStoreInitTableDisabled() BackchannelRequestStoreOption {
+	return func(s *BackchannelRequestStore) {
+		s.initTableDisabled = true
+	}
+}
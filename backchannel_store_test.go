@@ -0,0 +1,75 @@
+package pg
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+func TestBackchannelRequestStore(t *testing.T) {
+	_, err := NewBackchannelRequestStore(nil, WithBackchannelRequestStoreTableName(""), WithBackchannelRequestStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid backchannel request store configuration: empty table name")
+
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewBackchannelRequestStore(adapter, WithBackchannelRequestStoreGCDisabled(), WithBackchannelRequestStoreClock(clock))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.True(t, strings.HasPrefix(adapter.execCalls[0].query, "SELECT pg_advisory_xact_lock(hashtext('oauth2_pg_init:oauth2_backchannel_requests'));\nCREATE TABLE IF NOT EXISTS oauth2_backchannel_requests"))
+
+	req := &BackchannelRequest{ClientID: "client", LoginHint: "user@example.com", Scope: "openid"}
+	require.NoError(t, store.Create(context.Background(), req, 5*time.Minute))
+	assert.NotEmpty(t, req.AuthReqID)
+	assert.Equal(t, BackchannelRequestPending, req.Status)
+	assert.Equal(t, clock.now.Add(5*time.Minute), req.ExpiresAt)
+	require.Equal(t, 2, len(adapter.execCalls))
+	assert.Equal(t, []interface{}{req.AuthReqID, "client", "user@example.com", "openid", "pending", "", clock.now, req.ExpiresAt}, adapter.execCalls[1].args)
+
+	_, err = store.Poll(context.Background(), "client", req.AuthReqID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, []interface{}{req.AuthReqID, "client", clock.now}, adapter.selectOneCalls[0].args)
+
+	require.NoError(t, store.Approve(context.Background(), req.AuthReqID, "user"))
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Equal(t, []interface{}{req.AuthReqID, "approved", "user", "pending", clock.now}, adapter.selectOneCalls[1].args)
+}
+
+func runBackchannelRequestStoreTest(t *testing.T, store *BackchannelRequestStore) {
+	ctx := context.Background()
+
+	req := &BackchannelRequest{ClientID: "client", LoginHint: "user@example.com", Scope: "openid"}
+	require.NoError(t, store.Create(ctx, req, time.Minute))
+
+	polled, err := store.Poll(ctx, "client", req.AuthReqID)
+	require.NoError(t, err)
+	assert.Equal(t, BackchannelRequestPending, polled.Status)
+	assert.True(t, polled.PolledAt.IsZero())
+
+	polled, err = store.Poll(ctx, "client", req.AuthReqID)
+	require.NoError(t, err)
+	assert.False(t, polled.PolledAt.IsZero())
+
+	_, err = store.Poll(ctx, "another client", req.AuthReqID)
+	assert.Equal(t, pgadapter.ErrNoRows, err)
+
+	require.NoError(t, store.Approve(ctx, req.AuthReqID, "user"))
+	assert.Equal(t, pgadapter.ErrNoRows, store.Deny(ctx, req.AuthReqID))
+
+	stored, err := store.Get(ctx, req.AuthReqID)
+	require.NoError(t, err)
+	assert.Equal(t, BackchannelRequestApproved, stored.Status)
+	assert.Equal(t, "user", stored.UserID)
+
+	require.NoError(t, store.Remove(ctx, req.AuthReqID))
+	_, err = store.Get(ctx, req.AuthReqID)
+	assert.Equal(t, pgadapter.ErrNoRows, err)
+}
@@ -0,0 +1,48 @@
+package pg
+
+import "fmt"
+
+// distributedTableDDL returns the statement that distributes the table across Citus worker nodes by the column,
+// the table is left as is when it is already distributed. Indexes created after the distribution are propagated
+// to all the shards.
+func distributedTableDDL(tableName, column string) string {
+	return fmt.Sprintf(
+		"SELECT create_distributed_table(%[1]s, %[2]s) WHERE NOT EXISTS (SELECT 1 FROM pg_dist_partition WHERE logicalrelid = %[1]s::regclass);\n",
+		quoteLiteral(tableName), quoteLiteral(column),
+	)
+}
+
+// distributionDDL returns the table distribution statement if the token table is distributed
+func (s *TokenStore) distributionDDL() string {
+	if s.distributionColumn == "" {
+		return ""
+	}
+	return distributedTableDDL(s.tableName, s.distributionColumn)
+}
+
+// distributionProblem returns the Citus distribution configuration problem or empty string
+func (s *TokenStore) distributionProblem() string {
+	if s.distributionColumn == "" {
+		return ""
+	}
+
+	var lookupColumn bool
+	for _, column := range s.lookupColumns {
+		lookupColumn = lookupColumn || column == s.distributionColumn
+	}
+
+	switch {
+	case !lookupColumn:
+		return fmt.Sprintf("distribution column must be one of the token lookup columns %v, got %q", s.lookupColumns, s.distributionColumn)
+	case s.dialect != DialectPostgres:
+		return fmt.Sprintf("Citus distribution is not supported by %s dialect", s.dialect)
+	case s.hypertableChunk > 0:
+		return "Citus distribution is set together with hypertable"
+	case s.exchangeLineage:
+		// foreign keys between the distributed table rows have to include the distribution column
+		return "Citus distribution does not support exchange lineage"
+	case s.clientForeignKey != "":
+		return "Citus distribution does not support client foreign key"
+	}
+	return ""
+}
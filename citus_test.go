@@ -0,0 +1,30 @@
+package pg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTokenStoreCitusDistribution(t *testing.T) {
+	adapter := new(mockAdapter)
+	_, err := NewTokenStore(adapter, WithTokenStoreCitusDistribution("access"), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "  CONSTRAINT tokens_pkey PRIMARY KEY (id, access)\n);\n")
+	assert.Contains(t, adapter.execCalls[0].query, "SELECT create_distributed_table('tokens', 'access') WHERE NOT EXISTS (SELECT 1 FROM pg_dist_partition WHERE logicalrelid = 'tokens'::regclass);\n")
+	// indexes are created on the distributed table
+	assert.True(t, strings.Index(adapter.execCalls[0].query, "create_distributed_table") < strings.Index(adapter.execCalls[0].query, "CREATE INDEX"))
+
+	_, err = NewTokenStore(adapter, WithTokenStoreCitusDistribution("client_id"), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, `invalid token store configuration: distribution column must be one of the token lookup columns [code access refresh], got "client_id"`)
+	_, err = NewTokenStore(adapter, WithTokenStoreCitusDistribution("code"), WithTokenStoreDialect(DialectYugabyte), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: Citus distribution is not supported by yugabyte dialect")
+	_, err = NewTokenStore(adapter, WithTokenStoreCitusDistribution("code"), WithTokenStoreExchangeLineage(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: Citus distribution does not support exchange lineage")
+	_, err = NewTokenStore(adapter, WithTokenStoreCitusDistribution("code"), WithTokenStoreClientForeignKey("oauth2_clients"), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: Citus distribution does not support client foreign key")
+}
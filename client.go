@@ -0,0 +1,76 @@
+package pg
+
+import (
+	"time"
+
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+// Client is the client information model that supports several redirect URIs per client
+type Client struct {
+	models.Client
+
+	RedirectURIs      []string
+	AllowedScopes     []string
+	AllowedGrantTypes []oauth2.GrantType
+	ExpiresAt         time.Time
+}
+
+// GetDomain returns the first registered redirect URI, falls back to the domain
+func (c *Client) GetDomain() string {
+	if len(c.RedirectURIs) > 0 {
+		return c.RedirectURIs[0]
+	}
+	return c.Domain
+}
+
+// GetRedirectURIs returns all registered redirect URIs
+func (c *Client) GetRedirectURIs() []string {
+	if len(c.RedirectURIs) == 0 && c.Domain != "" {
+		return []string{c.Domain}
+	}
+	return c.RedirectURIs
+}
+
+// GetAllowedScopes returns the scopes the client is allowed to request, empty list means no restriction
+func (c *Client) GetAllowedScopes() []string {
+	return c.AllowedScopes
+}
+
+// GetAllowedGrantTypes returns the grant types the client is allowed to use, empty list means no restriction
+func (c *Client) GetAllowedGrantTypes() []oauth2.GrantType {
+	return c.AllowedGrantTypes
+}
+
+// GetExpiresAt returns the client expiration time, zero time means the client never expires
+func (c *Client) GetExpiresAt() time.Time {
+	return c.ExpiresAt
+}
+
+// ClientSecret is the client secret with its validity period, nil ExpiresAt means the secret never expires
+type ClientSecret struct {
+	Secret    string     `json:"secret"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// redirectURIsGetter is implemented by client information models that provide several redirect URIs
+type redirectURIsGetter interface {
+	GetRedirectURIs() []string
+}
+
+// allowedScopesGetter is implemented by client information models that restrict requested scopes
+type allowedScopesGetter interface {
+	GetAllowedScopes() []string
+}
+
+// allowedGrantTypesGetter is implemented by client information models that restrict used grant types
+type allowedGrantTypesGetter interface {
+	GetAllowedGrantTypes() []oauth2.GrantType
+}
+
+// expiresAtGetter is implemented by client information models that expire
+type expiresAtGetter interface {
+	GetExpiresAt() time.Time
+}
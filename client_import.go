@@ -0,0 +1,181 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/json-iterator/go"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/yaml.v2"
+)
+
+// ClientDefinition is the client of the ImportJSON input, times are in RFC 3339 format
+type ClientDefinition struct {
+	ID                string    `yaml:"id" json:"id"`
+	Secret            string    `yaml:"secret" json:"secret"`
+	Domain            string    `yaml:"domain" json:"domain"`
+	UserID            string    `yaml:"user_id" json:"user_id"`
+	RedirectURIs      []string  `yaml:"redirect_uris" json:"redirect_uris"`
+	AllowedScopes     []string  `yaml:"allowed_scopes" json:"allowed_scopes"`
+	AllowedGrantTypes []string  `yaml:"allowed_grant_types" json:"allowed_grant_types"`
+	ExpiresAt         time.Time `yaml:"expires_at" json:"expires_at"`
+}
+
+// Client returns the client information model of the definition
+func (d ClientDefinition) Client() *Client {
+	client := &Client{RedirectURIs: d.RedirectURIs, AllowedScopes: d.AllowedScopes, ExpiresAt: d.ExpiresAt}
+	client.ID, client.Secret, client.Domain, client.UserID = d.ID, d.Secret, d.Domain, d.UserID
+	for _, grantType := range d.AllowedGrantTypes {
+		client.AllowedGrantTypes = append(client.AllowedGrantTypes, oauth2.GrantType(grantType))
+	}
+	return client
+}
+
+// importedClient is the client row of the import statement input
+type importedClient struct {
+	ID                string              `json:"id"`
+	Secret            string              `json:"secret"`
+	RedirectURIs      jsoniter.RawMessage `json:"redirect_uris"`
+	AllowedScopes     jsoniter.RawMessage `json:"allowed_scopes"`
+	AllowedGrantTypes jsoniter.RawMessage `json:"grant_types"`
+	ExpiresAt         interface{}         `json:"expires_at"`
+	Secrets           []ClientSecret      `json:"secrets"`
+	Data              jsoniter.RawMessage `json:"data"`
+}
+
+// ParseClientDefinitions reads JSON or YAML array of the client definitions from r, definitions without id
+// and with the same id are rejected
+func ParseClientDefinitions(r io.Reader) ([]ClientDefinition, error) {
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is the valid YAML, so both formats are read the same way
+	var definitions []ClientDefinition
+	if err := yaml.UnmarshalStrict(input, &definitions); err != nil {
+		return nil, fmt.Errorf("could not parse client definitions: %w", err)
+	}
+
+	seen := make(map[string]int, len(definitions))
+	for i, definition := range definitions {
+		if definition.ID == "" {
+			return nil, fmt.Errorf("client definition #%d has no id", i)
+		}
+		if j, ok := seen[definition.ID]; ok {
+			return nil, fmt.Errorf("client definitions #%d and #%d have the same id %q", j, i, definition.ID)
+		}
+		seen[definition.ID] = i
+	}
+	return definitions, nil
+}
+
+// ImportJSON reads the client definitions from r with ParseClientDefinitions and upserts all of them with the single
+// statement, so either all or none of the clients are stored. Results are reported in the definitions order the same
+// way EnsureClients reports them: missing clients are created, differing ones are updated and the same ones are left
+// unchanged. Secrets of the existing clients are not changed, use RotateSecret for that.
+func (s *ClientStore) ImportJSON(ctx context.Context, r io.Reader) ([]ClientSeedResult, error) {
+	definitions, err := ParseClientDefinitions(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(definitions) == 0 {
+		return []ClientSeedResult{}, nil
+	}
+
+	now := s.clock.Now()
+	rows := make([]importedClient, len(definitions))
+	for i, definition := range definitions {
+		if rows[i], err = s.importedClient(definition.Client(), now); err != nil {
+			return nil, fmt.Errorf("could not import client %q: %w", definition.ID, err)
+		}
+	}
+
+	data, err := jsoniter.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var item struct {
+		Results []byte `db:"results"`
+	}
+	if err := s.query(ctx, &item, fmt.Sprintf(`
+WITH input AS (
+  SELECT * FROM jsonb_to_recordset($1::jsonb) AS r(id TEXT, secret TEXT, redirect_uris JSONB, allowed_scopes JSONB, grant_types JSONB, expires_at TIMESTAMPTZ, secrets JSONB, data JSONB)
+), existing AS (
+  SELECT id FROM %[1]s WHERE id IN (SELECT id FROM input)
+), upserted AS (
+  INSERT INTO %[1]s AS t (id, secret, redirect_uris, allowed_scopes, grant_types, expires_at, secrets, data, created_at, updated_at)
+  SELECT id, secret, %[2]s, %[3]s, %[4]s, expires_at, secrets, data, $2, $2 FROM input
+  ON CONFLICT (id) DO UPDATE SET
+    redirect_uris  = EXCLUDED.redirect_uris,
+    allowed_scopes = EXCLUDED.allowed_scopes,
+    grant_types    = EXCLUDED.grant_types,
+    expires_at     = EXCLUDED.expires_at,
+    data           = jsonb_set(EXCLUDED.data, '{Secret}', to_jsonb(t.secret)),
+    updated_at     = EXCLUDED.updated_at,
+    version        = t.version + 1
+  WHERE t.data - 'Secret' IS DISTINCT FROM EXCLUDED.data - 'Secret'
+  RETURNING id
+)
+SELECT COALESCE(jsonb_object_agg(u.id, e.id IS NULL), '{}') AS results FROM upserted AS u LEFT JOIN existing AS e ON e.id = u.id
+`, s.tableName, textArray("redirect_uris"), textArray("allowed_scopes"), textArray("grant_types")), string(data), now); err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: %v", ErrClientAlreadyExists, err)
+		}
+		return nil, err
+	}
+
+	// upserted clients are reported as created or not, the ones that are missing are unchanged
+	var upserted map[string]bool
+	if err := jsoniter.Unmarshal(item.Results, &upserted); err != nil {
+		return nil, err
+	}
+
+	results := make([]ClientSeedResult, len(definitions))
+	for i, definition := range definitions {
+		created, ok := upserted[definition.ID]
+		switch {
+		case !ok:
+			results[i] = ClientUnchanged
+		case created:
+			results[i] = ClientCreated
+		default:
+			results[i] = ClientUpdated
+		}
+	}
+	return results, nil
+}
+
+// importedClient returns the client row the way Create stores it
+func (s *ClientStore) importedClient(client oauth2.ClientInfo, now time.Time) (importedClient, error) {
+	secret, err := s.storedSecret(client.GetSecret())
+	if err != nil {
+		return importedClient{}, err
+	}
+
+	data, err := jsoniter.Marshal(client)
+	if err != nil {
+		return importedClient{}, err
+	}
+	if s.secretHasher != nil || s.secretCipher != nil {
+		if data, err = replaceDataSecret(data, secret); err != nil {
+			return importedClient{}, err
+		}
+	}
+
+	allowedScopes, allowedGrantTypes, expiresAt := clientColumns(client)
+	return importedClient{
+		ID:                client.GetID(),
+		Secret:            secret,
+		RedirectURIs:      jsonArray(clientRedirectURIs(client)),
+		AllowedScopes:     jsonArray(allowedScopes),
+		AllowedGrantTypes: jsonArray(allowedGrantTypes),
+		ExpiresAt:         expiresAt,
+		Secrets:           []ClientSecret{{Secret: secret, CreatedAt: now}},
+		Data:              data,
+	}, nil
+}
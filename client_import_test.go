@@ -0,0 +1,168 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jsonClientDefinitions = `[
+  {"id": "new", "secret": "secret", "redirect_uris": ["https://new.example.com/cb"], "allowed_grant_types": ["client_credentials"]},
+  {"id": "changed", "secret": "secret", "allowed_scopes": ["read"], "expires_at": "2030-01-02T03:04:05Z"},
+  {"id": "same", "secret": "secret"}
+]`
+
+func TestParseClientDefinitions(t *testing.T) {
+	definitions, err := ParseClientDefinitions(strings.NewReader(jsonClientDefinitions))
+	require.NoError(t, err)
+	require.Equal(t, 3, len(definitions))
+	assert.Equal(t, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), definitions[1].ExpiresAt.UTC())
+
+	client := definitions[0].Client()
+	assert.Equal(t, "secret", client.GetSecret())
+	assert.Equal(t, "client_credentials", client.GetAllowedGrantTypes()[0].String())
+
+	yamlDefinitions, err := ParseClientDefinitions(strings.NewReader(`
+- id: new
+  secret: secret
+  redirect_uris: [https://new.example.com/cb]
+  allowed_grant_types: [client_credentials]
+`))
+	require.NoError(t, err)
+	assert.Equal(t, definitions[0], yamlDefinitions[0])
+
+	_, err = ParseClientDefinitions(strings.NewReader(`{"id": "c1"}`))
+	assert.Error(t, err)
+
+	// unknown fields are typos, not silently ignored
+	_, err = ParseClientDefinitions(strings.NewReader(`[{"id": "c1", "scopes": ["read"]}]`))
+	assert.Error(t, err)
+
+	_, err = ParseClientDefinitions(strings.NewReader(`[{"id": "c1"}, {"secret": "secret"}]`))
+	assert.EqualError(t, err, "client definition #1 has no id")
+
+	_, err = ParseClientDefinitions(strings.NewReader(`[{"id": "c1"}, {"id": "c2"}, {"id": "c1"}]`))
+	assert.EqualError(t, err, `client definitions #0 and #2 have the same id "c1"`)
+}
+
+func TestClientStore_ImportJSON(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		reflect.ValueOf(dst).Elem().FieldByName("Results").SetBytes([]byte(`{"new": true, "changed": false}`))
+		return nil
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	results, err := store.ImportJSON(context.Background(), strings.NewReader(jsonClientDefinitions))
+	require.NoError(t, err)
+	assert.Equal(t, []ClientSeedResult{ClientCreated, ClientUpdated, ClientUnchanged}, results)
+
+	// all the clients are upserted with the single statement
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	call := adapter.selectOneCalls[0]
+	assert.Contains(t, call.query, "jsonb_to_recordset($1::jsonb)")
+	assert.Contains(t, call.query, "WHERE t.data - 'Secret' IS DISTINCT FROM EXCLUDED.data - 'Secret'")
+	require.Equal(t, 2, len(call.args))
+
+	var rows []struct {
+		ID           string         `json:"id"`
+		RedirectURIs []string       `json:"redirect_uris"`
+		ExpiresAt    *time.Time     `json:"expires_at"`
+		Secrets      []ClientSecret `json:"secrets"`
+		Data         jsoniter.Any   `json:"data"`
+	}
+	require.NoError(t, jsoniter.UnmarshalFromString(call.args[0].(string), &rows))
+	require.Equal(t, 3, len(rows))
+	assert.Equal(t, []string{"https://new.example.com/cb"}, rows[0].RedirectURIs)
+	assert.Nil(t, rows[0].ExpiresAt)
+	assert.NotNil(t, rows[1].ExpiresAt)
+	assert.Equal(t, 1, len(rows[2].Secrets))
+	assert.Equal(t, "same", rows[2].Data.Get("ID").ToString())
+
+	// nothing to import is not queried
+	results, err = store.ImportJSON(context.Background(), strings.NewReader("[]"))
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Equal(t, 1, len(adapter.selectOneCalls))
+
+	_, err = store.ImportJSON(context.Background(), strings.NewReader(`[{"id": "c1"}, {"id": "c1"}]`))
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(adapter.selectOneCalls))
+}
+
+func TestClientStore_ImportJSON_errors(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return pgx.PgError{Code: "23505", ConstraintName: "oauth2_clients_domain_key"}
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	results, err := store.ImportJSON(context.Background(), strings.NewReader(jsonClientDefinitions))
+	assert.True(t, errors.Is(err, ErrClientAlreadyExists))
+	assert.Nil(t, results)
+}
+
+func TestClientStore_ImportJSON_secretHasher(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		reflect.ValueOf(dst).Elem().FieldByName("Results").SetBytes([]byte(`{}`))
+		return nil
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled(), WithClientStoreSecretHasher(SHA256SecretHasher{}))
+	require.NoError(t, err)
+
+	_, err = store.ImportJSON(context.Background(), strings.NewReader(`[{"id": "c1", "secret": "secret"}]`))
+	require.NoError(t, err)
+
+	// neither the secret column nor the data has the plain secret
+	assert.NotContains(t, adapter.selectOneCalls[0].args[0], `:"secret"`)
+}
+
+func runClientStoreImportJSONTest(t *testing.T, store *ClientStore) {
+	ctx := context.Background()
+	suffix := time.Now().String()
+	existing := fmt.Sprintf("existing imported id %s", suffix)
+	created := fmt.Sprintf("imported id %s", suffix)
+
+	definitions := fmt.Sprintf(`[
+  {"id": %q, "secret": "secret", "allowed_scopes": ["read"]},
+  {"id": %q, "secret": "secret", "redirect_uris": ["https://example.com/cb"]}
+]`, existing, created)
+
+	results, err := store.ImportJSON(ctx, strings.NewReader(fmt.Sprintf(`[{"id": %q, "secret": "secret"}]`, existing)))
+	require.NoError(t, err)
+	assert.Equal(t, []ClientSeedResult{ClientCreated}, results)
+
+	results, err = store.ImportJSON(ctx, strings.NewReader(definitions))
+	require.NoError(t, err)
+	assert.Equal(t, []ClientSeedResult{ClientUpdated, ClientCreated}, results)
+
+	results, err = store.ImportJSON(ctx, strings.NewReader(definitions))
+	require.NoError(t, err)
+	assert.Equal(t, []ClientSeedResult{ClientUnchanged, ClientUnchanged}, results)
+
+	info, version, err := store.GetWithVersion(existing)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, []string{"read"}, info.(*Client).GetAllowedScopes())
+
+	info, err = store.GetByID(created)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/cb", info.GetDomain())
+	_, err = store.ValidateSecret(created, "secret")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,76 @@
+package pg
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/oauth2.v3"
+)
+
+// ClientSeedResult is what EnsureClients did with the client
+type ClientSeedResult int
+
+// Client seeding results
+const (
+	// ClientUnchanged is the result for the stored client that is already the same as the seeded one
+	ClientUnchanged ClientSeedResult = iota
+	// ClientCreated is the result for the client that did not exist
+	ClientCreated
+	// ClientUpdated is the result for the stored client that differed from the seeded one
+	ClientUpdated
+)
+
+func (r ClientSeedResult) String() string {
+	switch r {
+	case ClientUnchanged:
+		return "unchanged"
+	case ClientCreated:
+		return "created"
+	case ClientUpdated:
+		return "updated"
+	}
+	return fmt.Sprintf("ClientSeedResult(%d)", int(r))
+}
+
+// CreateIfNotExists creates the client unless the client with the same id already exists, the existing client
+// is left as it is. Returns true if the client was created.
+func (s *ClientStore) CreateIfNotExists(info oauth2.ClientInfo) (bool, error) {
+	err := s.Create(info)
+	// the existing id is reported with the bare error, violation of other unique constraints is wrapped
+	if err == ErrClientAlreadyExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// EnsureClients makes the stored clients match the clients, e.g. the first-party clients seeded on every
+// application startup, and returns what was done with each of them in the same order. Missing clients are created
+// and the differing ones are updated, so concurrently starting instances seed the clients only once. Secrets of
+// the existing clients are not compared nor changed, use RotateSecret for that.
+func (s *ClientStore) EnsureClients(clients []oauth2.ClientInfo) ([]ClientSeedResult, error) {
+	results := make([]ClientSeedResult, 0, len(clients))
+	for _, info := range clients {
+		result, err := s.ensureClient(info)
+		if err != nil {
+			return results, fmt.Errorf("could not seed client %q: %w", info.GetID(), err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *ClientStore) ensureClient(info oauth2.ClientInfo) (ClientSeedResult, error) {
+	created, err := s.CreateIfNotExists(info)
+	if err != nil || created {
+		return ClientCreated, err
+	}
+
+	// the client is updated only if it differs, so the version does not change on every startup
+	_, err = s.update(info, "data - 'Secret' IS DISTINCT FROM $6::jsonb - 'Secret'")
+	if !errors.Is(err, ErrClientNotFound) {
+		return ClientUpdated, err
+	}
+
+	// nothing was updated, so either the client is the same or it was deleted since the creation attempt
+	return ClientUnchanged, s.checkExists(info.GetID())
+}
@@ -0,0 +1,125 @@
+package pg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestClientStore_CreateIfNotExists(t *testing.T) {
+	var insertErr error
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return insertErr
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	client := &Client{Client: models.Client{ID: "c1", Secret: "secret"}}
+
+	created, err := store.CreateIfNotExists(client)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	insertErr = pgadapter.ErrNoRows
+	created, err = store.CreateIfNotExists(client)
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	// another client with the same unique column value is not the existing client
+	insertErr = pgx.PgError{Code: "23505", ConstraintName: "oauth2_clients_domain_key"}
+	created, err = store.CreateIfNotExists(client)
+	assert.True(t, errors.Is(err, ErrClientAlreadyExists))
+	assert.False(t, created)
+}
+
+func TestClientStore_EnsureClients(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		id := args[0].(string)
+		switch {
+		case strings.Contains(query, "INSERT"):
+			if id == "new" {
+				return nil
+			}
+			return pgadapter.ErrNoRows
+		case strings.Contains(query, "UPDATE"):
+			if id == "changed" {
+				return nil
+			}
+			return pgadapter.ErrNoRows
+		case id == "deleted":
+			return pgadapter.ErrNoRows
+		}
+		return nil
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	results, err := store.EnsureClients([]oauth2.ClientInfo{
+		&models.Client{ID: "new", Secret: "secret"},
+		&models.Client{ID: "changed", Secret: "secret"},
+		&models.Client{ID: "same", Secret: "secret"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []ClientSeedResult{ClientCreated, ClientUpdated, ClientUnchanged}, results)
+	assert.Equal(t, "created updated unchanged", results[0].String()+" "+results[1].String()+" "+results[2].String())
+
+	var updates []queryCall
+	for _, call := range adapter.selectOneCalls {
+		if strings.Contains(call.query, "UPDATE") {
+			updates = append(updates, call)
+		}
+	}
+	require.Equal(t, 2, len(updates))
+	assert.Contains(t, updates[0].query, "WHERE id = $1 AND data - 'Secret' IS DISTINCT FROM $6::jsonb - 'Secret'")
+	assert.Equal(t, 7, len(updates[0].args))
+
+	results, err = store.EnsureClients([]oauth2.ClientInfo{
+		&models.Client{ID: "same", Secret: "secret"},
+		&models.Client{ID: "deleted", Secret: "secret"},
+	})
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+	assert.Contains(t, err.Error(), `"deleted"`)
+	assert.Equal(t, []ClientSeedResult{ClientUnchanged}, results)
+}
+
+func runClientStoreEnsureClientsTest(t *testing.T, store *ClientStore) {
+	id := fmt.Sprintf("seeded id %s", time.Now().String())
+	seed := []oauth2.ClientInfo{&Client{
+		Client:        models.Client{ID: id, Secret: "secret"},
+		RedirectURIs:  []string{"https://example.com/cb"},
+		AllowedScopes: []string{"read"},
+	}}
+
+	results, err := store.EnsureClients(seed)
+	require.NoError(t, err)
+	assert.Equal(t, []ClientSeedResult{ClientCreated}, results)
+
+	// next startup finds the same client, the secret is not compared
+	seed[0].(*Client).Secret = "another secret"
+	results, err = store.EnsureClients(seed)
+	require.NoError(t, err)
+	assert.Equal(t, []ClientSeedResult{ClientUnchanged}, results)
+
+	seed[0].(*Client).AllowedScopes = []string{"read", "write"}
+	results, err = store.EnsureClients(seed)
+	require.NoError(t, err)
+	assert.Equal(t, []ClientSeedResult{ClientUpdated}, results)
+
+	info, version, err := store.GetWithVersion(id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, "secret", info.GetSecret())
+	assert.Equal(t, []string{"read", "write"}, info.(*Client).GetAllowedScopes())
+}
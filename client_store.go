@@ -1,14 +1,21 @@
 package pg
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/json-iterator/go"
 	"github.com/vgarvardt/go-pg-adapter"
 	"gopkg.in/oauth2.v3"
-	"gopkg.in/oauth2.v3/models"
 )
 
 // ClientStore PostgreSQL client store
@@ -16,16 +23,40 @@ type ClientStore struct {
 	adapter   pgadapter.Adapter
 	tableName string
 	logger    Logger
+	clock     Clock
 
-	initTableDisabled bool
+	// pool is opened by NewClientStoreFromDSN and closed with the store
+	pool              *ownedPool
+	reconnectInterval time.Duration
+	acquireTimeout    time.Duration
+
+	secretGracePeriod time.Duration
+	secretHasher      SecretHasher
+	secretCipher      SecretCipher
+	secretResolver    SecretResolver
+
+	batchSize int
+
+	initTableDisabled  bool
+	lazyInit           bool
+	schemaVerification bool
+	strictSchema       bool
+	initTimeout        time.Duration
+
+	rowLevelSecurity bool
+	rlsSettingKey    string
+
+	redactor Redactor
 }
 
 // ClientStoreItem data item
 type ClientStoreItem struct {
-	ID     string `db:"id"`
-	Secret string `db:"secret"`
-	Domain string `db:"domain"`
-	Data   []byte `db:"data"`
+	ID       string `db:"id"`
+	Secret   string `db:"secret"`
+	Data     []byte `db:"data"`
+	Secrets  []byte `db:"secrets"`
+	Disabled bool   `db:"disabled"`
+	Expired  bool   `db:"expired"`
 }
 
 // NewClientStore creates PostgreSQL store instance
@@ -34,68 +65,791 @@ func NewClientStore(adapter pgadapter.Adapter, options ...ClientStoreOption) (*C
 		adapter:   adapter,
 		tableName: "oauth2_clients",
 		logger:    log.New(os.Stderr, "[OAUTH2-PG-ERROR]", log.LstdFlags),
+		clock:     systemClock{},
+		redactor:  DefaultRedactor,
+
+		secretGracePeriod: 24 * time.Hour,
+
+		batchSize: 1000,
 	}
 
 	for _, o := range options {
 		o(store)
 	}
 
-	var err error
-	if !store.initTableDisabled {
-		err = store.initTable()
+	if err := store.validate(); err != nil {
+		return nil, err
 	}
 
-	if err != nil {
+	if store.lazyInit {
+		store.adapter = newLazyInitAdapter(store.adapter, store.init)
+	} else if err := store.init(context.Background()); err != nil {
 		return store, err
 	}
 
-	return store, err
+	return store, nil
+}
+
+// init creates the table and verifies its schema if configured
+func (s *ClientStore) init(ctx context.Context) error {
+	ctx, cancel := initContext(ctx, s.initTimeout)
+	defer cancel()
+
+	var err error
+	if !s.initTableDisabled {
+		err = s.initTable(ctx)
+	}
+	if err == nil && (s.strictSchema || s.initTableDisabled && s.schemaVerification) {
+		err = s.VerifySchema(ctx)
+	}
+	return err
+}
+
+// Close closes the connection pool opened by NewClientStoreFromDSN, it is no-op for the store created with the adapter
+func (s *ClientStore) Close() error {
+	if s.pool != nil {
+		s.pool.Close()
+	}
+	return nil
+}
+
+func (s *ClientStore) validate() error {
+	var problem string
+	switch {
+	case s.tableName == "":
+		problem = "empty table name"
+	case s.secretGracePeriod < 0:
+		problem = fmt.Sprintf("secret grace period must not be negative, got %s", s.secretGracePeriod)
+	case s.secretHasher != nil && s.secretCipher != nil:
+		problem = "secret hasher is set together with secret cipher"
+	case s.secretResolver != nil && (s.secretHasher != nil || s.secretCipher != nil):
+		problem = "secret resolver is set together with secret hasher or cipher"
+	case s.batchSize <= 0:
+		problem = fmt.Sprintf("batch size must be positive, got %d", s.batchSize)
+	case s.rowLevelSecurity && s.rlsSettingKey == "":
+		problem = "empty row level security setting key"
+	case s.initTimeout < 0:
+		problem = fmt.Sprintf("init timeout must not be negative, got %s", s.initTimeout)
+	case s.reconnectInterval < 0:
+		problem = fmt.Sprintf("reconnect interval must not be negative, got %s", s.reconnectInterval)
+	case s.reconnectInterval > 0 && s.pool == nil:
+		problem = "reconnect interval requires the store created with NewClientStoreFromDSN"
+	case s.acquireTimeout < 0:
+		problem = fmt.Sprintf("acquire timeout must not be negative, got %s", s.acquireTimeout)
+	case s.acquireTimeout > 0 && s.pool == nil:
+		problem = "acquire timeout requires the store created with NewClientStoreFromDSN"
+	default:
+		return nil
+	}
+
+	return fmt.Errorf("invalid client store configuration: %s", problem)
+}
+
+func (s *ClientStore) initTable(ctx context.Context) error {
+	return execContext(ctx, s.adapter, timeoutDDL(s.initTimeout, lockedDDL(s.tableName, s.tableDDL())))
+}
+
+// tableDDL returns client table creation and upgrade statements
+func (s *ClientStore) tableDDL() string {
+	return createTableDDL(s.tableName, "id", clientTableColumns, "") + fmt.Sprintf(`
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM pg_attribute WHERE attrelid = '%[1]s'::regclass AND attname = 'domain' AND NOT attisdropped) THEN
+    UPDATE %[1]s SET redirect_uris = ARRAY[domain] WHERE redirect_uris = '{}' AND domain <> '';
+    ALTER TABLE %[1]s ALTER COLUMN domain DROP NOT NULL;
+  END IF;
+END $$;
+%[2]s`, s.tableName, s.rowLevelSecurityDDL())
+}
+
+// VerifySchema checks that the existing client table has all the columns and indexes used with the store
+// configuration, column types are compared too in the strict schema mode. The returned *SchemaError lists the problems.
+func (s *ClientStore) VerifySchema(ctx context.Context) error {
+	columns := clientTableColumns
+	if s.rowLevelSecurity {
+		columns = append(columns[:len(columns):len(columns)], tableColumn{name: "tenant_id", dataType: "TEXT"})
+	}
+	return verifySchema(ctx, func(ctx context.Context, dst interface{}, query string, args ...interface{}) error {
+		return selectOneContext(ctx, s.adapter, dst, query, args...)
+	}, s.tableName, columns, append([]string{s.tableName + "_pkey"}, ddlIndexNames(s.tableDDL())...), s.strictSchema)
 }
 
-func (s *ClientStore) initTable() error {
-	return s.adapter.Exec(fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS %[1]s (
-  id     TEXT  NOT NULL,
-  secret TEXT  NOT NULL,
-  domain TEXT  NOT NULL,
-  data   JSONB NOT NULL,
-  CONSTRAINT %[1]s_pkey PRIMARY KEY (id)
-);
-`, s.tableName))
+// clientTableColumns are the client table columns, columns added after the initial version have defaults
+// so they are added to the existing tables on initialization
+var clientTableColumns = []tableColumn{
+	{"id", "TEXT", "NOT NULL"},
+	{"secret", "TEXT", "NOT NULL"},
+	{"redirect_uris", "TEXT[]", "NOT NULL DEFAULT '{}'"},
+	{"allowed_scopes", "TEXT[]", "NOT NULL DEFAULT '{}'"},
+	{"grant_types", "TEXT[]", "NOT NULL DEFAULT '{}'"},
+	{"expires_at", "TIMESTAMPTZ", ""},
+	{"disabled", "BOOLEAN", "NOT NULL DEFAULT FALSE"},
+	{"secrets", "JSONB", "NOT NULL DEFAULT '[]'"},
+	{"data", "JSONB", "NOT NULL"},
+	{"created_at", "TIMESTAMPTZ", "NOT NULL DEFAULT now()"},
+	{"updated_at", "TIMESTAMPTZ", "NOT NULL DEFAULT now()"},
+	{"version", "BIGINT", "NOT NULL DEFAULT 1"},
+}
+
+// rowLevelSecurityDDL returns client table row level security statements if it is enabled
+func (s *ClientStore) rowLevelSecurityDDL() string {
+	if !s.rowLevelSecurity {
+		return ""
+	}
+	return rowLevelSecurityDDL(s.tableName, s.rlsSettingKey)
+}
+
+// selectOne runs the client query, adapter no rows error is wrapped with ErrClientNotFound
+func (s *ClientStore) selectOne(dst interface{}, query string, args ...interface{}) error {
+	return wrapNoRows(s.query(context.Background(), dst, query, args...), ErrClientNotFound)
+}
+
+// query runs the select query, query arguments echoed in the error message are redacted, e.g. the client secret
+func (s *ClientStore) query(ctx context.Context, dst interface{}, query string, args ...interface{}) error {
+	return redactError(selectOneContext(ctx, s.adapter, dst, query, args...), s.redactor, args)
 }
 
 func (s *ClientStore) toClientInfo(data []byte) (oauth2.ClientInfo, error) {
-	var cm models.Client
-	err := jsoniter.Unmarshal(data, &cm)
-	return &cm, err
+	var cm Client
+	if err := jsoniter.Unmarshal(data, &cm); err != nil {
+		return &cm, err
+	}
+
+	secret, err := s.revealSecret(cm.Secret)
+	if err != nil {
+		return nil, err
+	}
+	cm.Secret = secret
+	return &cm, nil
 }
 
-// GetByID retrieves and returns client information by id
+// GetByID retrieves and returns client information by id, returns ErrClientNotFound for unknown client
+// and ErrClientDisabled or ErrClientExpired for disabled or expired client. The secret is the hashed one
+// with WithClientStoreSecretHasher.
 func (s *ClientStore) GetByID(id string) (oauth2.ClientInfo, error) {
 	if id == "" {
 		return nil, nil
 	}
 
+	item, err := s.getItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toClientInfo(item.Data)
+}
+
+func (s *ClientStore) getItem(id string) (*ClientStoreItem, error) {
 	var item ClientStoreItem
-	if err := s.adapter.SelectOne(&item, fmt.Sprintf("SELECT * FROM %s WHERE id = $1", s.tableName), id); err != nil {
+	if err := s.selectOne(
+		&item,
+		fmt.Sprintf("SELECT id, secret, data, secrets, disabled, COALESCE(expires_at <= $2, FALSE) AS expired FROM %s WHERE id = $1", s.tableName),
+		id,
+		s.clock.Now(),
+	); err != nil {
+		return nil, err
+	}
+
+	if item.Disabled {
+		return nil, ErrClientDisabled
+	}
+	if item.Expired {
+		return nil, ErrClientExpired
+	}
+
+	return &item, nil
+}
+
+// ValidateSecret retrieves client information by id and checks the secret against all currently valid
+// client secrets using constant-time comparison or the configured SecretHasher,
+// returns ErrInvalidClientSecret when the secret does not match
+func (s *ClientStore) ValidateSecret(id, secret string) (oauth2.ClientInfo, error) {
+	item, err := s.getItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := s.validSecrets(item.Secret, item.Secrets)
+	if err != nil {
 		return nil, err
 	}
 
+	// check all the secrets without breaking early to not leak the number of valid secrets
+	valid := false
+	for _, cs := range secrets {
+		var match bool
+		if s.secretHasher != nil {
+			match = s.secretHasher.Verify(cs.Secret, secret)
+		} else {
+			match = subtle.ConstantTimeCompare([]byte(cs.Secret), []byte(secret)) == 1
+		}
+		valid = valid || match
+	}
+
+	if !valid {
+		return nil, ErrInvalidClientSecret
+	}
+
 	return s.toClientInfo(item.Data)
 }
 
-// Create creates and stores the new client information
+// Create creates and stores the new client information, ErrClientAlreadyExists is returned when the client with the same id
+// already exists or the client violates other unique constraint of the table
 func (s *ClientStore) Create(info oauth2.ClientInfo) error {
 	data, err := jsoniter.Marshal(info)
 	if err != nil {
 		return err
 	}
 
-	return s.adapter.Exec(
-		fmt.Sprintf("INSERT INTO %s (id, secret, domain, data) VALUES ($1, $2, $3, $4)", s.tableName),
+	allowedScopes, allowedGrantTypes, expiresAt := clientColumns(info)
+
+	secret, err := s.storedSecret(info.GetSecret())
+	if err != nil {
+		return err
+	}
+	if s.secretHasher != nil || s.secretCipher != nil {
+		if data, err = replaceDataSecret(data, secret); err != nil {
+			return err
+		}
+	}
+
+	now := s.clock.Now()
+	secrets, err := jsoniter.Marshal([]ClientSecret{{Secret: secret, CreatedAt: now}})
+	if err != nil {
+		return err
+	}
+
+	var item struct {
+		ID string `db:"id"`
+	}
+	err = s.query(
+		context.Background(),
+		&item,
+		fmt.Sprintf(`INSERT INTO %s (id, secret, redirect_uris, allowed_scopes, grant_types, expires_at, secrets, data, created_at, updated_at)
+VALUES ($1, $2, %s, %s, %s, $6, $7, $8, $9, $9)
+ON CONFLICT (id) DO NOTHING
+RETURNING id`, s.tableName, textArray("$3"), textArray("$4"), textArray("$5")),
 		info.GetID(),
-		info.GetSecret(),
-		info.GetDomain(),
+		secret,
+		jsonArray(clientRedirectURIs(info)),
+		jsonArray(allowedScopes),
+		jsonArray(allowedGrantTypes),
+		expiresAt,
+		secrets,
 		data,
+		now,
+	)
+	if errors.Is(err, pgadapter.ErrNoRows) {
+		return ErrClientAlreadyExists
+	}
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: %v", ErrClientAlreadyExists, err)
+	}
+	return err
+}
+
+// GetWithVersion returns client information by id together with its version to be passed to Update,
+// disabled and expired clients are returned as well
+func (s *ClientStore) GetWithVersion(id string) (oauth2.ClientInfo, int64, error) {
+	var item struct {
+		Data    []byte `db:"data"`
+		Version int64  `db:"version"`
+	}
+	if err := s.selectOne(&item, fmt.Sprintf("SELECT data, version FROM %s WHERE id = $1", s.tableName), id); err != nil {
+		return nil, 0, err
+	}
+
+	info, err := s.toClientInfo(item.Data)
+	return info, item.Version, err
+}
+
+// Update replaces the client information if the stored client has the expected version and returns the new version,
+// ErrVersionConflict is returned when the client was changed since the version was read.
+// Client secret is not changed by Update, use RotateSecret for that.
+func (s *ClientStore) Update(info oauth2.ClientInfo, version int64) (int64, error) {
+	newVersion, err := s.update(info, "version = $8", version)
+	if !errors.Is(err, ErrClientNotFound) {
+		return newVersion, err
+	}
+
+	// nothing was updated, so either the client does not exist or it has another version
+	if err := s.checkExists(info.GetID()); err != nil {
+		return 0, err
+	}
+	return 0, ErrVersionConflict
+}
+
+// update replaces the client information of the client matching the condition and returns the new version,
+// condition arguments are numbered from $8. ErrClientNotFound is returned when nothing was updated.
+func (s *ClientStore) update(info oauth2.ClientInfo, condition string, conditionArgs ...interface{}) (int64, error) {
+	data, err := jsoniter.Marshal(info)
+	if err != nil {
+		return 0, err
+	}
+
+	allowedScopes, allowedGrantTypes, expiresAt := clientColumns(info)
+
+	var item struct {
+		Version int64 `db:"version"`
+	}
+	err = s.selectOne(&item, fmt.Sprintf(`
+UPDATE %s SET
+  redirect_uris  = %s,
+  allowed_scopes = %s,
+  grant_types    = %s,
+  expires_at     = $5,
+  data           = jsonb_set($6::jsonb, '{Secret}', to_jsonb(secret)),
+  updated_at     = $7,
+  version        = version + 1
+WHERE id = $1 AND %s
+RETURNING version
+`, s.tableName, textArray("$2"), textArray("$3"), textArray("$4"), condition),
+		append([]interface{}{
+			info.GetID(),
+			jsonArray(clientRedirectURIs(info)),
+			jsonArray(allowedScopes),
+			jsonArray(allowedGrantTypes),
+			expiresAt,
+			data,
+			s.clock.Now(),
+		}, conditionArgs...)...,
+	)
+	return item.Version, err
+}
+
+// checkExists returns ErrClientNotFound when there is no client with the id
+func (s *ClientStore) checkExists(id string) error {
+	var item struct {
+		Version int64 `db:"version"`
+	}
+	return s.selectOne(&item, fmt.Sprintf("SELECT version FROM %s WHERE id = $1", s.tableName), id)
+}
+
+// Delete deletes the client, ErrClientNotFound is returned when there is no such client
+func (s *ClientStore) Delete(id string) error {
+	var item struct {
+		ID string `db:"id"`
+	}
+	return s.selectOne(&item, fmt.Sprintf("DELETE FROM %s WHERE id = $1 RETURNING id", s.tableName), id)
+}
+
+// DeleteWithTokens deletes the client together with all the tokens issued to it by the token store
+// with the single statement, so either both or none are removed. Token store table has to be in the same database.
+// ErrClientNotFound is returned when there is no such client. Not supported with token data compression.
+func (s *ClientStore) DeleteWithTokens(id string, tokenStore *TokenStore) error {
+	if tokenStore.compressor != nil {
+		// compressed token data can not be matched by the client
+		return errors.New("DeleteWithTokens is not supported with token data compression")
+	}
+
+	var item struct {
+		ID string `db:"id"`
+	}
+	return s.selectOne(&item, fmt.Sprintf(`
+WITH client AS (
+  DELETE FROM %[1]s WHERE id = $1 RETURNING id
+), tokens AS (
+  DELETE FROM %[2]s WHERE %[3]s IN (SELECT id FROM client)
+)
+SELECT id FROM client
+`, s.tableName, tokenStore.tableName, tokenStore.fieldExpr("ClientID")), id)
+}
+
+// Secrets returns all currently valid client secrets, the current one is the last
+func (s *ClientStore) Secrets(id string) ([]ClientSecret, error) {
+	var item struct {
+		Secret  string `db:"secret"`
+		Secrets []byte `db:"secrets"`
+	}
+	if err := s.selectOne(&item, fmt.Sprintf("SELECT secret, secrets FROM %s WHERE id = $1", s.tableName), id); err != nil {
+		return nil, err
+	}
+
+	return s.validSecrets(item.Secret, item.Secrets)
+}
+
+func (s *ClientStore) validSecrets(current string, data []byte) ([]ClientSecret, error) {
+	var secrets []ClientSecret
+	if err := jsoniter.Unmarshal(data, &secrets); err != nil {
+		return nil, err
+	}
+
+	// clients created before secrets rotation support have the only secret
+	if len(secrets) == 0 {
+		secrets = []ClientSecret{{Secret: current}}
+	}
+
+	now := s.clock.Now()
+	valid := make([]ClientSecret, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret.ExpiresAt != nil && !secret.ExpiresAt.After(now) {
+			continue
+		}
+		var err error
+		if secret.Secret, err = s.revealSecret(secret.Secret); err != nil {
+			return nil, err
+		}
+		valid = append(valid, secret)
+	}
+
+	return valid, nil
+}
+
+// revealSecret returns the secret stored encrypted or as the external reference,
+// plain and hashed secrets are returned as they are stored
+func (s *ClientStore) revealSecret(stored string) (string, error) {
+	switch {
+	case s.secretCipher != nil:
+		return s.secretCipher.Decrypt(stored)
+	case s.secretResolver != nil:
+		return s.secretResolver.Resolve(context.Background(), stored)
+	}
+	return stored, nil
+}
+
+// storedSecret returns the secret as it is stored, either hashed, encrypted or plain one,
+// the external reference is stored as it is
+func (s *ClientStore) storedSecret(secret string) (string, error) {
+	switch {
+	case s.secretHasher != nil:
+		return s.secretHasher.Hash(secret)
+	case s.secretCipher != nil:
+		return s.secretCipher.Encrypt(secret)
+	}
+	return secret, nil
+}
+
+// RotateSecret generates and stores the new client secret, previous secrets stay valid for the grace period.
+// Returned secret is neither hashed nor encrypted even when SecretHasher or SecretCipher is configured.
+func (s *ClientStore) RotateSecret(id string) (string, error) {
+	if s.secretResolver != nil {
+		return "", errors.New("RotateSecret is not supported with secret resolver, rotate the secret in the external store")
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	storedSecret, err := s.storedSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.clock.Now()
+	var item struct {
+		ID string `db:"id"`
+	}
+	if err := s.selectOne(&item, fmt.Sprintf(`
+UPDATE %s SET
+  secret     = $2,
+  updated_at = $3,
+  version    = version + 1,
+  data       = jsonb_set(data, '{Secret}', to_jsonb($2::text)),
+  secrets    = (
+    SELECT COALESCE(jsonb_agg(CASE WHEN e->>'expires_at' IS NULL THEN e || jsonb_build_object('expires_at', $4::timestamptz) ELSE e END), '[]')
+    FROM jsonb_array_elements(CASE WHEN secrets = '[]' THEN jsonb_build_array(jsonb_build_object('secret', secret)) ELSE secrets END) AS e
+    WHERE e->>'expires_at' IS NULL OR (e->>'expires_at')::timestamptz > $3
+  ) || jsonb_build_array(jsonb_build_object('secret', $2::text, 'created_at', $3::timestamptz, 'expires_at', NULL))
+WHERE id = $1
+RETURNING id
+`, s.tableName), id, storedSecret, now, now.Add(s.secretGracePeriod)); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// Disable disables the client, GetByID returns ErrClientDisabled for it until it is enabled again
+func (s *ClientStore) Disable(id string) error {
+	return s.setDisabled(id, true)
+}
+
+// Enable enables previously disabled client
+func (s *ClientStore) Enable(id string) error {
+	return s.setDisabled(id, false)
+}
+
+func (s *ClientStore) setDisabled(id string, disabled bool) error {
+	var item struct {
+		ID string `db:"id"`
+	}
+	return s.selectOne(
+		&item,
+		fmt.Sprintf("UPDATE %s SET disabled = $2, updated_at = $3, version = version + 1 WHERE id = $1 RETURNING id", s.tableName),
+		id,
+		disabled,
+		s.clock.Now(),
 	)
 }
+
+// ValidateRedirectURI checks if the uri is one of the redirect URIs registered for the client
+func (s *ClientStore) ValidateRedirectURI(id, uri string) (bool, error) {
+	var item struct {
+		Valid bool `db:"valid"`
+	}
+	if err := s.selectOne(&item, fmt.Sprintf("SELECT $2 = ANY(redirect_uris) AS valid FROM %s WHERE id = $1", s.tableName), id, uri); err != nil {
+		return false, err
+	}
+
+	return item.Valid, nil
+}
+
+// CheckScope checks if all the space-separated scopes are allowed for the client,
+// clients without allowed scopes are not restricted. Can be used as server.ClientScopeHandler.
+func (s *ClientStore) CheckScope(clientID string, scope string) (bool, error) {
+	var item struct {
+		Allowed bool `db:"allowed"`
+	}
+	if err := s.selectOne(
+		&item,
+		fmt.Sprintf("SELECT cardinality(allowed_scopes) = 0 OR %s <@ allowed_scopes AS allowed FROM %s WHERE id = $1", textArray("$2"), s.tableName),
+		clientID,
+		jsonArray(strings.Fields(scope)),
+	); err != nil {
+		return false, err
+	}
+
+	return item.Allowed, nil
+}
+
+// AllowedGrantTypes returns the grant types the client is allowed to use, empty list means no restriction
+func (s *ClientStore) AllowedGrantTypes(id string) ([]oauth2.GrantType, error) {
+	var item struct {
+		GrantTypes []byte `db:"grant_types"`
+	}
+	if err := s.selectOne(&item, fmt.Sprintf("SELECT array_to_json(grant_types) AS grant_types FROM %s WHERE id = $1", s.tableName), id); err != nil {
+		return nil, err
+	}
+
+	var grantTypes []oauth2.GrantType
+	err := jsoniter.Unmarshal(item.GrantTypes, &grantTypes)
+	return grantTypes, err
+}
+
+// CheckGrantType checks if the grant type is allowed for the client,
+// clients without allowed grant types are not restricted. Can be used as server.ClientAuthorizedHandler.
+func (s *ClientStore) CheckGrantType(clientID string, grant oauth2.GrantType) (bool, error) {
+	var item struct {
+		Allowed bool `db:"allowed"`
+	}
+	if err := s.selectOne(
+		&item,
+		fmt.Sprintf("SELECT cardinality(grant_types) = 0 OR $2 = ANY(grant_types) AS allowed FROM %s WHERE id = $1", s.tableName),
+		clientID,
+		grant.String(),
+	); err != nil {
+		return false, err
+	}
+
+	return item.Allowed, nil
+}
+
+// Export writes all the clients to w in the format, clients are loaded in batches ordered by id
+func (s *ClientStore) Export(ctx context.Context, w io.Writer, format ExportFormat) error {
+	lastID := ""
+	for {
+		var item struct {
+			Data []byte `db:"data"`
+		}
+		if err := s.query(ctx, &item, fmt.Sprintf(`
+SELECT COALESCE(jsonb_agg(jsonb_build_object('id', id, 'data', data) ORDER BY id), '[]') AS data
+FROM (SELECT id, data FROM %s WHERE id > $1 ORDER BY id LIMIT $2) AS batch
+`, s.tableName), lastID, s.batchSize); err != nil {
+			return err
+		}
+
+		var rows []struct {
+			ID   string              `json:"id"`
+			Data jsoniter.RawMessage `json:"data"`
+		}
+		if err := jsoniter.Unmarshal(item.Data, &rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			data := []byte(row.Data)
+			var err error
+			switch {
+			case format == ExportJSONLinesRedacted:
+				data, err = replaceDataSecret(data, redacted)
+			case s.secretCipher != nil:
+				// exported clients are imported into the store with its own cipher
+				data, err = s.decryptDataSecret(data)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < s.batchSize {
+			return nil
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+}
+
+// Import copies all the clients from the source into the store and returns the number of imported clients.
+// Clients are inserted in batches of the configured batch size with the single statement per batch,
+// the clients that already exist in the store are skipped and not counted.
+func (s *ClientStore) Import(ctx context.Context, src ClientSource) (int64, error) {
+	var imported int64
+	batch := make([]oauth2.ClientInfo, 0, s.batchSize)
+	flush := func() error {
+		n, err := s.importBatch(ctx, batch)
+		imported += n
+		batch = batch[:0]
+		return err
+	}
+
+	err := src.ForEach(ctx, func(info oauth2.ClientInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if batch = append(batch, info); len(batch) < s.batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+
+	return imported, err
+}
+
+// importBatch inserts the clients with the single statement skipping the existing ones
+// and returns the number of inserted clients
+func (s *ClientStore) importBatch(ctx context.Context, batch []oauth2.ClientInfo) (int64, error) {
+	now := s.clock.Now()
+	rows := make([]importedClient, len(batch))
+	for i, info := range batch {
+		var err error
+		if rows[i], err = s.importedClient(info, now); err != nil {
+			return 0, fmt.Errorf("could not import client %q: %w", info.GetID(), err)
+		}
+	}
+
+	data, err := jsoniter.Marshal(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	var item struct {
+		Count int64 `db:"count"`
+	}
+	if err := s.query(ctx, &item, fmt.Sprintf(`
+WITH inserted AS (
+  INSERT INTO %[1]s (id, secret, redirect_uris, allowed_scopes, grant_types, expires_at, secrets, data, created_at, updated_at)
+  SELECT id, secret, %[2]s, %[3]s, %[4]s, expires_at, secrets, data, $2, $2
+  FROM jsonb_to_recordset($1::jsonb) AS r(id TEXT, secret TEXT, redirect_uris JSONB, allowed_scopes JSONB, grant_types JSONB, expires_at TIMESTAMPTZ, secrets JSONB, data JSONB)
+  ON CONFLICT (id) DO NOTHING
+  RETURNING 1
+)
+SELECT count(*) AS count FROM inserted
+`, s.tableName, textArray("redirect_uris"), textArray("allowed_scopes"), textArray("grant_types")), string(data), now); err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%w: %v", ErrClientAlreadyExists, err)
+		}
+		return 0, err
+	}
+
+	return item.Count, nil
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// replaceDataSecret replaces the secret in the serialized client information
+func replaceDataSecret(data []byte, secret string) ([]byte, error) {
+	var fields map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	encoded, err := jsoniter.Marshal(secret)
+	if err != nil {
+		return nil, err
+	}
+	fields["Secret"] = encoded
+
+	return jsoniter.Marshal(fields)
+}
+
+// decryptDataSecret replaces the encrypted secret in the serialized client information with the decrypted one
+func (s *ClientStore) decryptDataSecret(data []byte) ([]byte, error) {
+	var fields struct {
+		Secret string
+	}
+	if err := jsoniter.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.revealSecret(fields.Secret)
+	if err != nil {
+		return nil, err
+	}
+	return replaceDataSecret(data, secret)
+}
+
+// clientColumns returns client information values stored in the dedicated columns
+func clientColumns(info oauth2.ClientInfo) (allowedScopes, allowedGrantTypes []string, expiresAt interface{}) {
+	if g, ok := info.(allowedScopesGetter); ok {
+		allowedScopes = g.GetAllowedScopes()
+	}
+	if g, ok := info.(allowedGrantTypesGetter); ok {
+		for _, gt := range g.GetAllowedGrantTypes() {
+			allowedGrantTypes = append(allowedGrantTypes, gt.String())
+		}
+	}
+	if g, ok := info.(expiresAtGetter); ok && !g.GetExpiresAt().IsZero() {
+		expiresAt = g.GetExpiresAt()
+	}
+	return
+}
+
+func clientRedirectURIs(info oauth2.ClientInfo) []string {
+	if g, ok := info.(redirectURIsGetter); ok {
+		return g.GetRedirectURIs()
+	}
+	if domain := info.GetDomain(); domain != "" {
+		return []string{domain}
+	}
+	return []string{}
+}
+
+// jsonArray encodes the list as JSON array parameter that is converted to TEXT[] with textArray
+func jsonArray(values []string) []byte {
+	if values == nil {
+		values = []string{}
+	}
+	// marshalling of the strings slice never fails
+	data, _ := jsoniter.Marshal(values)
+	return data
+}
+
+// textArray returns SQL expression that converts JSON array parameter into TEXT[]
+func textArray(param string) string {
+	return fmt.Sprintf("ARRAY(SELECT jsonb_array_elements_text(%s::jsonb))", param)
+}
+
+// Check checks that the database is reachable and the store table exists,
+// compatible with hellofresh/health-go CheckFunc
+func (s *ClientStore) Check(ctx context.Context) error {
+	return checkTable(ctx, func(ctx context.Context, dst interface{}, query string, args ...interface{}) error {
+		return selectOneContext(ctx, s.adapter, dst, query, args...)
+	}, s.tableName)
+}
+
+// HealthCheck is the context-less Check version compatible with heptiolabs/healthcheck Check
+func (s *ClientStore) HealthCheck() error {
+	return s.Check(context.Background())
+}
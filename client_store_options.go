@@ -1,5 +1,7 @@
 package pg
 
+import "time"
+
 // ClientStoreOption is the configuration options type for client store
 type ClientStoreOption func(s *ClientStore)
 
@@ -17,9 +19,128 @@ func WithClientStoreLogger(logger Logger) ClientStoreOption {
 	}
 }
 
+// WithClientStoreClock returns option that sets client store clock used for client and secrets expiration
+func WithClientStoreClock(clock Clock) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.clock = clock
+	}
+}
+
 // WithClientStoreInitTableDisabled returns option that disables table creation on client store instantiation
 func WithClientStoreInitTableDisabled() ClientStoreOption {
 	return func(s *ClientStore) {
 		s.initTableDisabled = true
 	}
 }
+
+// WithClientStoreLazyInit returns option that defers the table initialization and the schema verification
+// until the first store operation, so the store can be created while the database is not available yet,
+// e.g. on serverless cold start. Failed initialization fails the operation and is run again by the next one.
+func WithClientStoreLazyInit() ClientStoreOption {
+	return func(s *ClientStore) {
+		s.lazyInit = true
+	}
+}
+
+// WithClientStoreReconnectInterval returns option that checks the connection of the pool opened by
+// NewClientStoreFromDSN with the interval and opens the new pool when the connection is lost, e.g. after
+// the database failover, so the queries stop failing on the stale connections without the service restart
+func WithClientStoreReconnectInterval(interval time.Duration) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.reconnectInterval = interval
+	}
+}
+
+// WithClientStoreAcquireTimeout returns option that bounds how long the queries wait for the free connection
+// of the exhausted pool opened by NewClientStoreFromDSN, the queries that timed out fail with ErrStoreBusy.
+// Acquisition timeout errors of the pgx pools passed with the adapter are returned as ErrStoreBusy too.
+func WithClientStoreAcquireTimeout(timeout time.Duration) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.acquireTimeout = timeout
+	}
+}
+
+// WithClientStoreSchemaVerification returns option that verifies the existing table schema on client store
+// instantiation when table creation is disabled, see ClientStore.VerifySchema
+func WithClientStoreSchemaVerification() ClientStoreOption {
+	return func(s *ClientStore) {
+		s.schemaVerification = true
+	}
+}
+
+// WithClientStoreStrictSchema returns option that refuses client store instantiation when the existing table
+// column types differ from the expected ones, e.g. expires_at is timestamp without time zone,
+// the schema is verified after the table initialization
+func WithClientStoreStrictSchema() ClientStoreOption {
+	return func(s *ClientStore) {
+		s.strictSchema = true
+	}
+}
+
+// WithClientStoreInitTimeout returns option that bounds how long the table initialization and the schema verification
+// may take on client store instantiation, so a locked catalog or unreachable database fails the constructor fast
+func WithClientStoreInitTimeout(timeout time.Duration) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.initTimeout = timeout
+	}
+}
+
+// WithClientStoreSecretGracePeriod returns option that sets how long the previous client secret stays valid after rotation
+func WithClientStoreSecretGracePeriod(gracePeriod time.Duration) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.secretGracePeriod = gracePeriod
+	}
+}
+
+// WithClientStoreSecretHasher returns option that enables client secrets hashing. GetByID returns the hashed secret,
+// while the oauth2.v3 manager compares the token request secret with the client GetSecret, so the token requests
+// of the clients with hashed secrets are rejected. Authenticate the clients with ValidateSecret instead, e.g. in the
+// server ClientInfoHandler returning the hashed secret of the validated client.
+func WithClientStoreSecretHasher(hasher SecretHasher) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.secretHasher = hasher
+	}
+}
+
+// WithClientStoreSecretCipher returns option that enables client secrets encryption at rest, the secret column
+// and the secret in the client information data are encrypted, and GetByID returns the decrypted secret.
+// Secrets stored before the option was enabled can not be decrypted, so export the clients with the store without
+// the option and import them into the store with it.
+func WithClientStoreSecretCipher(cipher SecretCipher) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.secretCipher = cipher
+	}
+}
+
+// WithClientStoreSecretResolver returns option that enables external secrets mode: the client secret passed to Create
+// is the reference, e.g. Vault path, it is stored instead of the secret and resolved with the resolver on read,
+// so the secrets are never stored in the database. Secrets are rotated in the external store then.
+func WithClientStoreSecretResolver(resolver SecretResolver) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.secretResolver = resolver
+	}
+}
+
+// WithClientStoreBatchSize returns option that sets the number of clients loaded at once by batch operations, e.g. Export
+func WithClientStoreBatchSize(batchSize int) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.batchSize = batchSize
+	}
+}
+
+// WithClientStoreRowLevelSecurity returns option that enables row level security on the client table and installs
+// the policy that limits rows to the tenant set in the settingKey run-time parameter, e.g. app.tenant_id
+func WithClientStoreRowLevelSecurity(settingKey string) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.rowLevelSecurity = true
+		s.rlsSettingKey = settingKey
+	}
+}
+
+// WithClientStoreRedactor returns option that sets the redactor applied to the query error messages on top of the
+// query arguments redaction, so the client secrets are never logged or returned in errors, default is DefaultRedactor
+func WithClientStoreRedactor(redactor Redactor) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.redactor = redactor
+	}
+}
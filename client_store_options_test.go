@@ -1,11 +1,15 @@
 package pg
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/oauth2.v3/models"
 )
 
 func TestWithClientStoreInitTableDisabled(t *testing.T) {
@@ -22,6 +26,143 @@ func TestWithClientStoreTableName(t *testing.T) {
 	assert.Equal(t, randomName, store.tableName)
 }
 
+func TestWithClientStoreSecretGracePeriod(t *testing.T) {
+	store, err := NewClientStore(nil, WithClientStoreSecretGracePeriod(time.Hour), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, store.secretGracePeriod)
+}
+
+func TestWithClientStoreSecretHasher(t *testing.T) {
+	store, err := NewClientStore(nil, WithClientStoreSecretHasher(SHA256SecretHasher{}), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, SHA256SecretHasher{}, store.secretHasher)
+}
+
+func TestWithClientStoreSecretCipher(t *testing.T) {
+	c, err := NewAESGCMSecretCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	adapter := new(mockAdapter)
+	store, err := NewClientStore(adapter, WithClientStoreSecretCipher(c), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Create(&models.Client{ID: "id", Secret: "secret"}))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	stored := adapter.selectOneCalls[0].args[1].(string)
+	data := adapter.selectOneCalls[0].args[7].([]byte)
+	secrets := adapter.selectOneCalls[0].args[6].([]byte)
+	assert.NotContains(t, string(data), `"secret"`)
+	assert.Contains(t, string(data), stored)
+	assert.Contains(t, string(secrets), stored)
+
+	// stored secret is decrypted on read
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		item := dst.(*ClientStoreItem)
+		item.Secret, item.Data, item.Secrets = stored, data, secrets
+		return nil
+	}
+	info, err := store.GetByID("id")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", info.GetSecret())
+
+	_, err = store.ValidateSecret("id", "secret")
+	assert.NoError(t, err)
+	_, err = store.ValidateSecret("id", stored)
+	assert.Equal(t, ErrInvalidClientSecret, err)
+
+	_, err = NewClientStore(adapter, WithClientStoreSecretCipher(c), WithClientStoreSecretHasher(SHA256SecretHasher{}), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: secret hasher is set together with secret cipher")
+}
+
+func TestWithClientStoreSecretResolver(t *testing.T) {
+	resolver := SecretResolverFunc(func(ctx context.Context, reference string) (string, error) {
+		if reference != "vault:secret/clients/id" {
+			return "", errors.New("unknown reference")
+		}
+		return "secret", nil
+	})
+
+	adapter := new(mockAdapter)
+	store, err := NewClientStore(adapter, WithClientStoreSecretResolver(resolver), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	// the reference is stored instead of the secret
+	require.NoError(t, store.Create(&models.Client{ID: "id", Secret: "vault:secret/clients/id"}))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, "vault:secret/clients/id", adapter.selectOneCalls[0].args[1])
+	data := adapter.selectOneCalls[0].args[7].([]byte)
+	secrets := adapter.selectOneCalls[0].args[6].([]byte)
+
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		item := dst.(*ClientStoreItem)
+		item.Secret, item.Data, item.Secrets = "vault:secret/clients/id", data, secrets
+		return nil
+	}
+	info, err := store.GetByID("id")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", info.GetSecret())
+
+	_, err = store.ValidateSecret("id", "secret")
+	assert.NoError(t, err)
+	_, err = store.ValidateSecret("id", "vault:secret/clients/id")
+	assert.Equal(t, ErrInvalidClientSecret, err)
+
+	_, err = store.RotateSecret("id")
+	assert.EqualError(t, err, "RotateSecret is not supported with secret resolver, rotate the secret in the external store")
+
+	_, err = NewClientStore(adapter, WithClientStoreSecretResolver(resolver), WithClientStoreSecretHasher(SHA256SecretHasher{}), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: secret resolver is set together with secret hasher or cipher")
+}
+
+func TestWithClientStoreBatchSize(t *testing.T) {
+	store, err := NewClientStore(nil, WithClientStoreBatchSize(10), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, 10, store.batchSize)
+}
+
+func TestClientStore_validate(t *testing.T) {
+	_, err := NewClientStore(nil, WithClientStoreTableName(""), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: empty table name")
+
+	_, err = NewClientStore(nil, WithClientStoreSecretGracePeriod(-time.Hour), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: secret grace period must not be negative, got -1h0m0s")
+
+	_, err = NewClientStore(nil, WithClientStoreBatchSize(-1), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: batch size must be positive, got -1")
+
+	_, err = NewClientStore(nil, WithClientStoreRowLevelSecurity(""), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: empty row level security setting key")
+}
+
+func TestWithClientStoreRowLevelSecurity(t *testing.T) {
+	adapter := new(mockAdapter)
+	_, err := NewClientStore(adapter, WithClientStoreRowLevelSecurity("app.tenant'id"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	query := adapter.execCalls[0].query
+	assert.Contains(t, query, "ALTER TABLE oauth2_clients FORCE ROW LEVEL SECURITY;")
+	assert.Contains(t, query, "current_setting('app.tenant''id', TRUE)")
+}
+
+func TestWithClientStoreClock(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*ClientStoreItem).Data = []byte(`{"ID":"id"}`)
+		return nil
+	}
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewClientStore(adapter, WithClientStoreClock(clock), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, clock, store.clock)
+
+	_, err = store.GetByID("id")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, []interface{}{"id", clock.now}, adapter.selectOneCalls[0].args)
+}
+
 func TestWithClientStoreLogger(t *testing.T) {
 	l := new(memoryLogger)
 
@@ -47,3 +188,36 @@ func TestWithClientStoreLogger(t *testing.T) {
 	assert.Equal(t, 12, l.args[1][0])
 	assert.Equal(t, "22", l.args[1][1])
 }
+
+func TestWithClientStoreInitTimeout(t *testing.T) {
+	_, err := NewClientStore(nil, WithClientStoreInitTimeout(-time.Second), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: init timeout must not be negative, got -1s")
+
+	adapter := new(deadlineAdapter)
+	_, err = NewClientStore(adapter, WithClientStoreInitTimeout(time.Second))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.True(t, strings.HasPrefix(adapter.execCalls[0].query, "SET LOCAL statement_timeout = 1000;\nSET LOCAL lock_timeout = 1000;\n"))
+	assert.Equal(t, []bool{true}, adapter.deadlines)
+}
+
+func TestWithClientStoreLazyInit(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*ClientStoreItem).Data = []byte(`{"ID":"id"}`)
+		return nil
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreLazyInit())
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(adapter.execCalls))
+
+	_, err = store.GetByID("id")
+	require.NoError(t, err)
+	_, err = store.GetByID("id")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "CREATE TABLE IF NOT EXISTS oauth2_clients")
+	assert.Equal(t, 2, len(adapter.selectOneCalls))
+}
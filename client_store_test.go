@@ -1,11 +1,19 @@
 package pg
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
 )
 
 func TestClientStore_initTable(t *testing.T) {
@@ -17,6 +25,223 @@ func TestClientStore_initTable(t *testing.T) {
 	assert.Equal(t, 1, len(adapter.execCalls))
 	assert.Equal(t, 0, len(adapter.selectOneCalls))
 
-	// new line character is the character at position 0
-	assert.Equal(t, 1, strings.Index(adapter.execCalls[0].query, "CREATE TABLE IF NOT EXISTS"))
+	// table initialization is serialized with the advisory lock taken in the same implicit transaction
+	assert.True(t, strings.HasPrefix(adapter.execCalls[0].query, "SELECT pg_advisory_xact_lock(hashtext('oauth2_pg_init:oauth2_clients'));\nCREATE TABLE IF NOT EXISTS"))
+}
+
+func TestClientStore_toClientInfo(t *testing.T) {
+	store, err := NewClientStore(nil, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	// data stored by the previous versions has domain only
+	info, err := store.toClientInfo([]byte(`{"ID":"id","Secret":"secret","Domain":"https://example.com","UserID":"user"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", info.GetDomain())
+	assert.Equal(t, []string{"https://example.com"}, info.(*Client).GetRedirectURIs())
+
+	info, err = store.toClientInfo([]byte(`{"ID":"id","Secret":"secret","RedirectURIs":["https://example.com/cb","https://example.org/cb"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/cb", info.GetDomain())
+	assert.Equal(t, []string{"https://example.com/cb", "https://example.org/cb"}, info.(*Client).GetRedirectURIs())
+}
+
+func TestSHA256SecretHasher(t *testing.T) {
+	hasher := SHA256SecretHasher{}
+
+	hashed, err := hasher.Hash("secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, "secret", hashed)
+
+	assert.True(t, hasher.Verify(hashed, "secret"))
+	assert.False(t, hasher.Verify(hashed, "another secret"))
+}
+
+func TestAESGCMSecretCipher(t *testing.T) {
+	_, err := NewAESGCMSecretCipher([]byte("short"))
+	assert.EqualError(t, err, "crypto/aes: invalid key size 5")
+
+	c, err := NewAESGCMSecretCipher([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	encrypted, err := c.Encrypt("secret")
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "secret")
+
+	// random nonce makes every encryption different
+	another, err := c.Encrypt("secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, another)
+
+	secret, err := c.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", secret)
+
+	other, err := NewAESGCMSecretCipher([]byte("fedcba9876543210fedcba9876543210"))
+	require.NoError(t, err)
+	_, err = other.Decrypt(encrypted)
+	assert.EqualError(t, err, "cipher: message authentication failed")
+	_, err = c.Decrypt("c2hvcnQ=")
+	assert.EqualError(t, err, "encrypted secret is too short")
+}
+
+func TestClientStore_Import(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		// one client of every batch is inserted, so the existing client of the first batch is skipped
+		dst.(*struct {
+			Count int64 `db:"count"`
+		}).Count = 1
+		return nil
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled(), WithClientStoreBatchSize(2))
+	require.NoError(t, err)
+
+	clients := []oauth2.ClientInfo{
+		&models.Client{ID: "id1", Secret: "secret1"},
+		&models.Client{ID: "id2", Secret: "secret2"},
+		&models.Client{ID: "id3", Secret: "secret3"},
+	}
+
+	imported, err := store.Import(context.Background(), ClientSourceFunc(func(ctx context.Context, fn func(oauth2.ClientInfo) error) error {
+		for _, client := range clients {
+			if err := fn(client); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), imported)
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[0].query, "ON CONFLICT (id) DO NOTHING")
+	assert.Contains(t, adapter.selectOneCalls[0].args[0], `"id":"id1"`)
+	assert.Contains(t, adapter.selectOneCalls[0].args[0], `"id":"id2"`)
+	assert.Contains(t, adapter.selectOneCalls[1].args[0], `"id":"id3"`)
+}
+
+func TestClientStore_errors(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return pgadapter.ErrNoRows
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrClientAlreadyExists, store.Create(&models.Client{ID: "id", Secret: "secret"}))
+	assert.Contains(t, adapter.selectOneCalls[0].query, "ON CONFLICT (id) DO NOTHING")
+
+	_, err = store.GetByID("id")
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+	assert.True(t, errors.Is(err, pgadapter.ErrNoRows))
+	assert.True(t, errors.Is(store.Delete("id"), ErrClientNotFound))
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sql state " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestClientStore_uniqueViolation(t *testing.T) {
+	var driverErr error
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return driverErr
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	for _, driverErr = range []error{
+		pgx.PgError{Code: "23505", ConstraintName: "oauth2_clients_domain_key"},
+		&pgx.PgError{Code: "23505"},
+		sqlStateError("23505"),
+		fmt.Errorf("wrapped: %w", sqlStateError("23505")),
+	} {
+		err = store.Create(&models.Client{ID: "id", Secret: "secret"})
+		assert.True(t, errors.Is(err, ErrClientAlreadyExists), "%T", driverErr)
+	}
+
+	for _, driverErr = range []error{pgx.PgError{Code: "23503"}, sqlStateError("23502"), errors.New("23505")} {
+		err = store.Create(&models.Client{ID: "id", Secret: "secret"})
+		assert.Equal(t, driverErr, err)
+	}
+}
+
+func TestClientStore_timestamps(t *testing.T) {
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled(), WithClientStoreClock(clock))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Create(&models.Client{ID: "id", Secret: "secret"}))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[0].query, "created_at, updated_at)")
+	assert.Equal(t, clock.now, adapter.selectOneCalls[0].args[8])
+
+	require.NoError(t, store.Disable("id"))
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[1].query, "updated_at = $3")
+	assert.Equal(t, clock.now, adapter.selectOneCalls[1].args[2])
+}
+
+func TestClientStore_Update(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if strings.Contains(query, "UPDATE") {
+			return pgadapter.ErrNoRows
+		}
+		return nil
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	_, err = store.Update(&Client{Client: models.Client{ID: "id", Secret: "secret"}}, 3)
+	assert.Equal(t, ErrVersionConflict, err)
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[0].query, "WHERE id = $1 AND version = $8")
+	assert.Equal(t, int64(3), adapter.selectOneCalls[0].args[7])
+	assert.Equal(t, "SELECT version FROM oauth2_clients WHERE id = $1", adapter.selectOneCalls[1].query)
+}
+
+func TestClientStore_Delete(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Delete("id"))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, "DELETE FROM oauth2_clients WHERE id = $1 RETURNING id", adapter.selectOneCalls[0].query)
+	assert.Equal(t, []interface{}{"id"}, adapter.selectOneCalls[0].args)
+}
+
+func TestClientStore_DeleteWithTokens(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	tokenStore, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.NoError(t, store.DeleteWithTokens("id", tokenStore))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[0].query, "DELETE FROM tokens WHERE data->>'ClientID' IN (SELECT id FROM client)")
+	assert.Equal(t, []interface{}{"id"}, adapter.selectOneCalls[0].args)
+}
+
+func TestClientStore_DeleteWithTokens_compression(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	tokenStore, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreCompression(GzipCompressor{}))
+	require.NoError(t, err)
+
+	// the client is kept when its tokens can not be deleted
+	assert.EqualError(t, store.DeleteWithTokens("id", tokenStore), "DeleteWithTokens is not supported with token data compression")
+	assert.Empty(t, adapter.selectOneCalls)
 }
@@ -0,0 +1,228 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/json-iterator/go"
+	"gopkg.in/oauth2.v3"
+)
+
+// ClientSyncStore is the client store the syncer reconciles, implemented by ClientStore and pgmock.ClientStore
+type ClientSyncStore interface {
+	EnsureClients(clients []oauth2.ClientInfo) ([]ClientSeedResult, error)
+	Export(ctx context.Context, w io.Writer, format ExportFormat) error
+	Delete(id string) error
+}
+
+var _ ClientSyncStore = (*ClientStore)(nil)
+
+// ClientSyncReport is what the sync did with the clients, ids are in the desired state order
+// and the deleted ones are in the store export order
+type ClientSyncReport struct {
+	Created   []string
+	Updated   []string
+	Unchanged []string
+	Deleted   []string
+}
+
+// ClientSyncer makes the stored clients match the desired state, e.g. the clients config file managed in git.
+// Missing clients are created and the differing ones are updated with EnsureClients, so the secrets of the existing
+// clients are not changed, and the stored clients missing from the desired state are deleted when pruning is enabled.
+type ClientSyncer struct {
+	store    ClientSyncStore
+	logger   Logger
+	observer func(ClientSyncReport)
+
+	prune    bool
+	managed  func(info oauth2.ClientInfo) bool
+	interval time.Duration
+	resync   time.Duration
+}
+
+// ClientSyncerOption is the configuration options type for client syncer
+type ClientSyncerOption func(s *ClientSyncer)
+
+// WithClientSyncerPrune returns option that enables deletion of the stored clients missing from the desired state,
+// managed reports if the client is managed by the syncer, e.g. by the id prefix, nil managed prunes all the clients
+func WithClientSyncerPrune(managed func(info oauth2.ClientInfo) bool) ClientSyncerOption {
+	return func(s *ClientSyncer) {
+		s.prune = true
+		s.managed = managed
+	}
+}
+
+// WithClientSyncerLogger returns option that sets client syncer logger implementation, Watch sync errors are logged
+func WithClientSyncerLogger(logger Logger) ClientSyncerOption {
+	return func(s *ClientSyncer) {
+		s.logger = logger
+	}
+}
+
+// WithClientSyncerObserver returns option that sets the function called with the report of every successful
+// Watch sync, e.g. to log or count the changes
+func WithClientSyncerObserver(observer func(ClientSyncReport)) ClientSyncerOption {
+	return func(s *ClientSyncer) {
+		s.observer = observer
+	}
+}
+
+// WithClientSyncerInterval returns option that sets how often Watch checks the file for changes, default is 10 seconds
+func WithClientSyncerInterval(interval time.Duration) ClientSyncerOption {
+	return func(s *ClientSyncer) {
+		s.interval = interval
+	}
+}
+
+// WithClientSyncerResyncInterval returns option that sets how often Watch syncs the unchanged file,
+// so the manual changes of the stored clients are reverted, default is 10 minutes
+func WithClientSyncerResyncInterval(interval time.Duration) ClientSyncerOption {
+	return func(s *ClientSyncer) {
+		s.resync = interval
+	}
+}
+
+// NewClientSyncer creates client syncer instance reconciling the store
+func NewClientSyncer(store ClientSyncStore, options ...ClientSyncerOption) (*ClientSyncer, error) {
+	s := &ClientSyncer{
+		store:    store,
+		logger:   log.New(os.Stderr, "[OAUTH2-PG-ERROR]", log.LstdFlags),
+		interval: 10 * time.Second,
+		resync:   10 * time.Minute,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	if s.interval <= 0 || s.resync <= 0 {
+		return nil, errors.New("invalid client syncer configuration: intervals must be positive")
+	}
+	return s, nil
+}
+
+// Sync makes the stored clients match the clients. Pruning with the empty desired state is refused,
+// so the truncated config file does not delete all the clients.
+func (s *ClientSyncer) Sync(ctx context.Context, clients []oauth2.ClientInfo) (ClientSyncReport, error) {
+	var report ClientSyncReport
+	if s.prune && len(clients) == 0 {
+		return report, errors.New("refusing to prune all the clients with the empty desired state")
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	results, err := s.store.EnsureClients(clients)
+	for i, result := range results {
+		id := clients[i].GetID()
+		switch result {
+		case ClientCreated:
+			report.Created = append(report.Created, id)
+		case ClientUpdated:
+			report.Updated = append(report.Updated, id)
+		default:
+			report.Unchanged = append(report.Unchanged, id)
+		}
+	}
+	if err != nil || !s.prune {
+		return report, err
+	}
+
+	desired := make(map[string]bool, len(clients))
+	for _, info := range clients {
+		desired[info.GetID()] = true
+	}
+
+	// stored clients are collected first, so the export batches are not shifted by the deletion
+	var buf bytes.Buffer
+	if err := s.store.Export(ctx, &buf, ExportJSONLinesRedacted); err != nil {
+		return report, err
+	}
+
+	var stale []string
+	decoder := jsoniter.NewDecoder(&buf)
+	for decoder.More() {
+		var client Client
+		if err := decoder.Decode(&client); err != nil {
+			return report, err
+		}
+		if !desired[client.ID] && (s.managed == nil || s.managed(&client)) {
+			stale = append(stale, client.ID)
+		}
+	}
+
+	for _, id := range stale {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		// the client deleted concurrently is pruned anyway
+		if err := s.store.Delete(id); err != nil && !errors.Is(err, ErrClientNotFound) {
+			return report, fmt.Errorf("could not prune client %q: %w", id, err)
+		}
+		report.Deleted = append(report.Deleted, id)
+	}
+	return report, nil
+}
+
+// SyncFile makes the stored clients match the client definitions of the JSON or YAML file,
+// see ParseClientDefinitions for the file format
+func (s *ClientSyncer) SyncFile(ctx context.Context, path string) (ClientSyncReport, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ClientSyncReport{}, err
+	}
+	return s.syncContent(ctx, content)
+}
+
+func (s *ClientSyncer) syncContent(ctx context.Context, content []byte) (ClientSyncReport, error) {
+	definitions, err := ParseClientDefinitions(bytes.NewReader(content))
+	if err != nil {
+		return ClientSyncReport{}, err
+	}
+
+	clients := make([]oauth2.ClientInfo, len(definitions))
+	for i, definition := range definitions {
+		clients[i] = definition.Client()
+	}
+	return s.Sync(ctx, clients)
+}
+
+// Watch syncs the file right away and then every time its content changes until the context is done, e.g. the file
+// of the mounted Kubernetes ConfigMap. The unchanged file is synced again every resync interval. Sync errors, e.g.
+// the invalid file, are logged and the file is synced again on the next check.
+func (s *ClientSyncer) Watch(ctx context.Context, path string) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	var synced []byte
+	var syncedAt time.Time
+	for {
+		content, err := ioutil.ReadFile(path)
+		if err == nil && (synced == nil || !bytes.Equal(content, synced) || time.Since(syncedAt) >= s.resync) {
+			var report ClientSyncReport
+			if report, err = s.syncContent(ctx, content); err == nil {
+				synced, syncedAt = content, time.Now()
+				if s.observer != nil {
+					s.observer(report)
+				}
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			synced = nil
+			s.logger.Printf("could not sync clients with %s: %s", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+// syncStore is the in-memory ClientSyncStore comparing the clients without the secrets
+type syncStore struct {
+	mu        sync.Mutex
+	clients   map[string]Client
+	deleteErr error
+}
+
+func newSyncStore(ids ...string) *syncStore {
+	s := &syncStore{clients: make(map[string]Client)}
+	for _, id := range ids {
+		s.clients[id] = Client{Client: models.Client{ID: id, Secret: "secret"}}
+	}
+	return s
+}
+
+func (s *syncStore) EnsureClients(clients []oauth2.ClientInfo) ([]ClientSeedResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]ClientSeedResult, 0, len(clients))
+	for _, info := range clients {
+		client := *info.(*Client)
+		stored, ok := s.clients[client.ID]
+		if !ok {
+			results = append(results, ClientCreated)
+			s.clients[client.ID] = client
+			continue
+		}
+
+		client.Secret = stored.Secret
+		if reflect.DeepEqual(client, stored) {
+			results = append(results, ClientUnchanged)
+			continue
+		}
+		results = append(results, ClientUpdated)
+		s.clients[client.ID] = client
+	}
+	return results, nil
+}
+
+func (s *syncStore) Export(ctx context.Context, w io.Writer, format ExportFormat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.clients))
+	for id := range s.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		data, err := jsoniter.Marshal(s.clients[id])
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.deleteErr != nil {
+		return s.deleteErr
+	}
+	if _, ok := s.clients[id]; !ok {
+		return ErrClientNotFound
+	}
+	delete(s.clients, id)
+	return nil
+}
+
+func (s *syncStore) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.clients))
+	for id := range s.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func desiredClients(ids ...string) []oauth2.ClientInfo {
+	clients := make([]oauth2.ClientInfo, len(ids))
+	for i, id := range ids {
+		clients[i] = &Client{Client: models.Client{ID: id, Secret: "secret"}, AllowedScopes: []string{"read"}}
+	}
+	return clients
+}
+
+func TestNewClientSyncer(t *testing.T) {
+	_, err := NewClientSyncer(newSyncStore(), WithClientSyncerInterval(0))
+	assert.Error(t, err)
+
+	_, err = NewClientSyncer(newSyncStore(), WithClientSyncerResyncInterval(-time.Second))
+	assert.Error(t, err)
+}
+
+func TestClientSyncer_Sync(t *testing.T) {
+	store := newSyncStore("unmanaged")
+	syncer, err := NewClientSyncer(store)
+	require.NoError(t, err)
+
+	report, err := syncer.Sync(context.Background(), desiredClients("c1", "c2"))
+	require.NoError(t, err)
+	assert.Equal(t, ClientSyncReport{Created: []string{"c1", "c2"}}, report)
+
+	clients := desiredClients("c1", "c2")
+	clients[1].(*Client).AllowedScopes = []string{"read", "write"}
+	report, err = syncer.Sync(context.Background(), clients)
+	require.NoError(t, err)
+	assert.Equal(t, ClientSyncReport{Updated: []string{"c2"}, Unchanged: []string{"c1"}}, report)
+
+	// clients missing from the desired state are left as they are unless pruned
+	report, err = syncer.Sync(context.Background(), desiredClients("c1"))
+	require.NoError(t, err)
+	assert.Empty(t, report.Deleted)
+	assert.Equal(t, []string{"c1", "c2", "unmanaged"}, store.ids())
+}
+
+func TestClientSyncer_Sync_prune(t *testing.T) {
+	store := newSyncStore("unmanaged", "gitops-c2", "gitops-c3")
+	syncer, err := NewClientSyncer(store, WithClientSyncerPrune(func(info oauth2.ClientInfo) bool {
+		return strings.HasPrefix(info.GetID(), "gitops-")
+	}))
+	require.NoError(t, err)
+
+	report, err := syncer.Sync(context.Background(), desiredClients("gitops-c1", "gitops-c2"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gitops-c1"}, report.Created)
+	assert.Equal(t, []string{"gitops-c2"}, report.Updated)
+	assert.Equal(t, []string{"gitops-c3"}, report.Deleted)
+	assert.Equal(t, []string{"gitops-c1", "gitops-c2", "unmanaged"}, store.ids())
+
+	_, err = syncer.Sync(context.Background(), nil)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"gitops-c1", "gitops-c2", "unmanaged"}, store.ids())
+
+	store.deleteErr = errors.New("connection refused")
+	_, err = syncer.Sync(context.Background(), desiredClients("gitops-c1"))
+	assert.EqualError(t, err, `could not prune client "gitops-c2": connection refused`)
+}
+
+func TestClientSyncer_SyncFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client-sync")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "clients.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("- id: c1\n  secret: secret\n  allowed_scopes: [read]\n"), 0600))
+
+	store := newSyncStore()
+	syncer, err := NewClientSyncer(store)
+	require.NoError(t, err)
+
+	report, err := syncer.SyncFile(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c1"}, report.Created)
+	assert.Equal(t, []string{"read"}, store.clients["c1"].AllowedScopes)
+
+	_, err = syncer.SyncFile(context.Background(), filepath.Join(dir, "missing.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+type syncLogger struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (l *syncLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(&l.buf, format+"\n", v...)
+}
+
+func (l *syncLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+// replaceFile replaces the file content atomically the way the mounted ConfigMap is updated,
+// so the watcher never reads the truncated file
+func replaceFile(path string, content []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func TestClientSyncer_Watch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client-sync")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "clients.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"id": "c1", "secret": "secret"}]`), 0600))
+
+	reports := make(chan ClientSyncReport, 10)
+	logger := new(syncLogger)
+	syncer, err := NewClientSyncer(
+		newSyncStore(),
+		WithClientSyncerInterval(10*time.Millisecond),
+		WithClientSyncerLogger(logger),
+		WithClientSyncerObserver(func(report ClientSyncReport) {
+			reports <- report
+		}),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- syncer.Watch(ctx, path)
+	}()
+
+	assert.Equal(t, []string{"c1"}, (<-reports).Created)
+
+	// invalid file is logged and the valid one is synced again
+	require.NoError(t, replaceFile(path, []byte(`[{"id": "c1", "scopes": ["read"]}]`)))
+	require.Eventually(t, func() bool {
+		return strings.Contains(logger.String(), "could not sync clients with "+path)
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, replaceFile(path, []byte(`[{"id": "c1", "secret": "secret"}, {"id": "c2", "secret": "secret"}]`)))
+	report := <-reports
+	assert.Equal(t, []string{"c2"}, report.Created)
+	assert.Equal(t, []string{"c1"}, report.Unchanged)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Empty(t, reports)
+}
+
+func runClientStoreSyncTest(t *testing.T, store *ClientStore) {
+	prefix := fmt.Sprintf("synced id %s ", time.Now().String())
+	syncer, err := NewClientSyncer(store, WithClientSyncerPrune(func(info oauth2.ClientInfo) bool {
+		return strings.HasPrefix(info.GetID(), prefix)
+	}))
+	require.NoError(t, err)
+
+	report, err := syncer.Sync(context.Background(), desiredClients(prefix+"c1", prefix+"c2"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{prefix + "c1", prefix + "c2"}, report.Created)
+
+	report, err = syncer.Sync(context.Background(), desiredClients(prefix+"c1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{prefix + "c1"}, report.Unchanged)
+	assert.Equal(t, []string{prefix + "c2"}, report.Deleted)
+
+	_, err = store.GetByID(prefix + "c2")
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+}
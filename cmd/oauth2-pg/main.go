@@ -0,0 +1,385 @@
+// Command oauth2-pg runs one-off operator actions against the token and client store tables, e.g. the schema
+// initialization before the first deployment or the token revocation during the incident.
+//
+// The database is selected with the -dsn flag or OAUTH2_PG_DSN environment variable, store tables and other
+// settings are read from the same environment variables as pg.TokenStoreConfigFromEnv and
+// pg.ClientStoreConfigFromEnv read, so the command works with the tables of the application.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+)
+
+// command is the subcommand of the tool, run receives the subcommand arguments without the name
+type command struct {
+	usage string
+	run   func(ctx context.Context, env *environment, args []string) error
+}
+
+var commands = map[string]command{
+	"init-schema":   {"create the token and client tables and their indexes", initSchema},
+	"migrate":       {"add the columns and indexes missing in the tables created by previous versions and verify the schema", migrate},
+	"gc-now":        {"remove the expired tokens once", gcNow},
+	"list-clients":  {"write the clients as JSON lines with the secrets redacted", listClients},
+	"create-client": {"register the client, the secret is generated and printed if not set", createClient},
+	"revoke-token":  {"remove the access or refresh token", revokeToken},
+	"purge-user":    {"remove all the tokens and clients of the user", purgeUser},
+}
+
+// environment is the subcommand execution environment
+type environment struct {
+	dsn    string
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	err := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	cancel()
+	if err == flag.ErrHelp {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "oauth2-pg: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags and runs the subcommand, flag.ErrHelp is returned after the usage is printed
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	env := &environment{stdout: stdout, stderr: stderr}
+
+	flags := flag.NewFlagSet("oauth2-pg", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&env.dsn, "dsn", os.Getenv("OAUTH2_PG_DSN"), "database connection string, either URI or DSN (default $OAUTH2_PG_DSN)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: oauth2-pg [-dsn connection-string] <command> [flags]\n\nCommands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(stderr, "  %-14s %s\n", name, commands[name].usage)
+		}
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q, run oauth2-pg -h for the list of commands", flags.Arg(0))
+	}
+	if env.dsn == "" {
+		return errors.New("database connection string is not set, use -dsn flag or OAUTH2_PG_DSN environment variable")
+	}
+	return cmd.run(ctx, env, flags.Args()[1:])
+}
+
+// parseFlags parses the subcommand flags, the subcommand takes no positional arguments
+func (env *environment) parseFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(env.stderr)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	return nil
+}
+
+// tokenStore opens the token store configured with the environment variables, GC is never started
+// as the store lives for a single action
+func (env *environment) tokenStore(ctx context.Context, options ...pg.TokenStoreOption) (*pg.TokenStore, error) {
+	config, err := pg.TokenStoreConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	options = append(append(config.Options(), pg.WithTokenStoreGCDisabled()), options...)
+	return pg.NewTokenStoreFromDSN(ctx, env.dsn, options...)
+}
+
+// clientStore opens the client store configured with the environment variables
+func (env *environment) clientStore(ctx context.Context, options ...pg.ClientStoreOption) (*pg.ClientStore, error) {
+	config, err := pg.ClientStoreConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return pg.NewClientStoreFromDSN(ctx, env.dsn, append(config.Options(), options...)...)
+}
+
+// existingTokenStore opens the token store without the table initialization, so the actions on the tables
+// that do not exist fail instead of creating them
+func (env *environment) existingTokenStore(ctx context.Context, options ...pg.TokenStoreOption) (*pg.TokenStore, error) {
+	return env.tokenStore(ctx, append([]pg.TokenStoreOption{pg.WithTokenStoreInitTableDisabled()}, options...)...)
+}
+
+// existingClientStore opens the client store without the table initialization
+func (env *environment) existingClientStore(ctx context.Context) (*pg.ClientStore, error) {
+	return env.clientStore(ctx, pg.WithClientStoreInitTableDisabled())
+}
+
+func initSchema(ctx context.Context, env *environment, args []string) error {
+	if err := env.parseFlags(flag.NewFlagSet("init-schema", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+
+	tokens, err := env.tokenStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer tokens.Close()
+
+	clients, err := env.clientStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+
+	fmt.Fprintln(env.stdout, "Schema is initialized")
+	return nil
+}
+
+func migrate(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	strict := flags.Bool("strict", false, "fail when the existing column types differ from the expected ones")
+	if err := env.parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	// table initialization statements add the columns and indexes the existing tables lack
+	var (
+		tokenOptions  []pg.TokenStoreOption
+		clientOptions []pg.ClientStoreOption
+	)
+	if *strict {
+		tokenOptions = append(tokenOptions, pg.WithTokenStoreStrictSchema())
+		clientOptions = append(clientOptions, pg.WithClientStoreStrictSchema())
+	}
+
+	tokens, err := env.tokenStore(ctx, tokenOptions...)
+	if err != nil {
+		return err
+	}
+	defer tokens.Close()
+
+	clients, err := env.clientStore(ctx, clientOptions...)
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+
+	if err := tokens.VerifySchema(ctx); err != nil {
+		return err
+	}
+	if err := clients.VerifySchema(ctx); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(env.stdout, "Schema is up to date")
+	return nil
+}
+
+func gcNow(ctx context.Context, env *environment, args []string) error {
+	if err := env.parseFlags(flag.NewFlagSet("gc-now", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+
+	var (
+		stats pg.GCStats
+		gcErr error
+	)
+	tokens, err := env.existingTokenStore(ctx,
+		pg.WithTokenStoreGCObserver(func(s pg.GCStats) { stats = s }),
+		pg.WithTokenStoreErrorHandler(func(op string, err error) {
+			if op == "GC" {
+				gcErr = err
+			}
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	defer tokens.Close()
+
+	tokens.TriggerGCForTest()
+	if gcErr != nil {
+		return gcErr
+	}
+
+	fmt.Fprintf(env.stdout, "Table %s: deleted=%d cleared=%d duration=%s\n", stats.TableName, stats.Deleted, stats.Cleared, stats.Duration)
+	return nil
+}
+
+func listClients(ctx context.Context, env *environment, args []string) error {
+	if err := env.parseFlags(flag.NewFlagSet("list-clients", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+
+	clients, err := env.existingClientStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+
+	return clients.Export(ctx, env.stdout, pg.ExportJSONLinesRedacted)
+}
+
+// stringsFlag is the repeatable string flag
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func createClient(ctx context.Context, env *environment, args []string) error {
+	var (
+		client       pg.Client
+		redirectURIs stringsFlag
+		scopes       stringsFlag
+	)
+	flags := flag.NewFlagSet("create-client", flag.ContinueOnError)
+	flags.StringVar(&client.ID, "id", "", "client id (required)")
+	flags.StringVar(&client.Secret, "secret", "", "client secret, the random one is generated and printed if not set")
+	flags.StringVar(&client.Domain, "domain", "", "client domain")
+	flags.StringVar(&client.UserID, "user-id", "", "id of the user that owns the client")
+	flags.Var(&redirectURIs, "redirect-uri", "registered redirect URI, may be repeated")
+	flags.Var(&scopes, "scope", "allowed scope, may be repeated, all scopes are allowed if not set")
+	if err := env.parseFlags(flags, args); err != nil {
+		return err
+	}
+	if client.ID == "" {
+		return errors.New("create-client requires -id flag")
+	}
+
+	generated := client.Secret == ""
+	if generated {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		client.Secret = hex.EncodeToString(buf)
+	}
+	client.RedirectURIs, client.AllowedScopes = redirectURIs, scopes
+
+	clients, err := env.existingClientStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+
+	if err := clients.Create(&client); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(env.stdout, "Client %s is created\n", client.ID)
+	if generated {
+		fmt.Fprintf(env.stdout, "Secret: %s\n", client.Secret)
+	}
+	return nil
+}
+
+func revokeToken(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("revoke-token", flag.ContinueOnError)
+	token := flags.String("token", "", "token value (required)")
+	tokenType := flags.String("type", "both", "token type: access, refresh or both")
+	if err := env.parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *token == "" {
+		return errors.New("revoke-token requires -token flag")
+	}
+
+	access, refresh := *tokenType == "access" || *tokenType == "both", *tokenType == "refresh" || *tokenType == "both"
+	if !access && !refresh {
+		return fmt.Errorf("unknown token type %q, expected access, refresh or both", *tokenType)
+	}
+
+	tokens, err := env.existingTokenStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer tokens.Close()
+
+	if access {
+		if err := tokens.RemoveByAccess(*token); err != nil {
+			return err
+		}
+	}
+	if refresh {
+		if err := tokens.RemoveByRefresh(*token); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(env.stdout, "Token is revoked")
+	return nil
+}
+
+func purgeUser(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("purge-user", flag.ContinueOnError)
+	userID := flags.String("user-id", "", "user id (required)")
+	if err := env.parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *userID == "" {
+		return errors.New("purge-user requires -user-id flag")
+	}
+
+	tokens, err := env.existingTokenStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer tokens.Close()
+
+	clients, err := env.existingClientStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+
+	report, err := tokens.PurgeUserData(ctx, *userID, clients)
+	if err != nil {
+		return err
+	}
+
+	buf, err := jsoniter.Marshal(report)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.stdout, string(buf))
+	return nil
+}
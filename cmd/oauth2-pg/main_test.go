@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runForTest(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, &stdout, &stderr)
+	assert.Empty(t, stdout.String())
+	return stderr.String(), err
+}
+
+func TestRun_Usage(t *testing.T) {
+	stderr, err := runForTest(t)
+	assert.Equal(t, flag.ErrHelp, err)
+	for name := range commands {
+		assert.Contains(t, stderr, name)
+	}
+	assert.Contains(t, stderr, "-dsn")
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	_, err := runForTest(t, "-dsn", "postgres://localhost/oauth2", "drop-everything")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown command "drop-everything"`)
+}
+
+func TestRun_NoDSN(t *testing.T) {
+	dsn, ok := os.LookupEnv("OAUTH2_PG_DSN")
+	require.NoError(t, os.Unsetenv("OAUTH2_PG_DSN"))
+	if ok {
+		defer os.Setenv("OAUTH2_PG_DSN", dsn)
+	}
+
+	_, err := runForTest(t, "gc-now")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "OAUTH2_PG_DSN")
+}
+
+func TestRun_InvalidCommandFlags(t *testing.T) {
+	for name, args := range map[string][]string{
+		"create-client without id":    {"create-client", "-secret", "secret"},
+		"revoke-token without token":  {"revoke-token", "-type", "access"},
+		"revoke-token with bad type":  {"revoke-token", "-token", "token", "-type", "code"},
+		"purge-user without user id":  {"purge-user"},
+		"gc-now with extra arguments": {"gc-now", "now"},
+		"migrate with unknown flag":   {"migrate", "-force"},
+	} {
+		args := args
+		t.Run(name, func(t *testing.T) {
+			_, err := runForTest(t, append([]string{"-dsn", "postgres://localhost/oauth2"}, args...)...)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package pg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/json-iterator/go"
+)
+
+// Compressor compresses and decompresses serialized token data
+type Compressor interface {
+	// Name is the format marker stored alongside the compressed payload
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor is the gzip Compressor implementation
+type GzipCompressor struct {
+	Level int
+}
+
+// Name returns gzip format marker
+func (c GzipCompressor) Name() string {
+	return "gzip"
+}
+
+// Compress compresses data with gzip using configured compression level, zero level means default compression
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses gzip compressed data
+func (c GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// compressedData is the JSONB envelope for the compressed token data,
+// payload is base64 encoded by JSON marshalling
+type compressedData struct {
+	Compression string `json:"$compression"`
+	Payload     []byte `json:"$payload"`
+}
+
+func compress(c Compressor, data []byte) ([]byte, error) {
+	payload, err := c.Compress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsoniter.Marshal(compressedData{Compression: c.Name(), Payload: payload})
+}
+
+var compressionMarker = []byte(`"$compression"`)
+
+// decompress returns data as is if it is not compressed or decompresses it with the compressor
+// that matches envelope format marker
+func decompress(compressors map[string]Compressor, data []byte) ([]byte, error) {
+	if !bytes.Contains(data, compressionMarker) {
+		return data, nil
+	}
+
+	var envelope compressedData
+	if err := jsoniter.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Compression == "" {
+		return data, nil
+	}
+
+	c, ok := compressors[envelope.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown token data compression %q", envelope.Compression)
+	}
+
+	return c.Decompress(envelope.Payload)
+}
@@ -0,0 +1,224 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+// TokenStoreConfig is the token store configuration, zero values keep the defaults.
+// Read caches are store instances and are not configured here, see NewFallbackTokenStore.
+type TokenStoreConfig struct {
+	TableName          string
+	GCInterval         time.Duration
+	GCDisabled         bool
+	GCRetention        time.Duration
+	InitTableDisabled  bool
+	SchemaVerification bool
+	StrictSchema       bool
+	ColumnsStorage     bool
+	BatchSize          int
+	HashKeys           []TokenHashKey
+}
+
+// Options returns token store options for the configuration
+func (c TokenStoreConfig) Options() []TokenStoreOption {
+	var options []TokenStoreOption
+	if c.TableName != "" {
+		options = append(options, WithTokenStoreTableName(c.TableName))
+	}
+	if c.GCInterval != 0 {
+		options = append(options, WithTokenStoreGCInterval(c.GCInterval))
+	}
+	if c.GCDisabled {
+		options = append(options, WithTokenStoreGCDisabled())
+	}
+	if c.GCRetention != 0 {
+		options = append(options, WithTokenStoreGCRetention(c.GCRetention))
+	}
+	if c.InitTableDisabled {
+		options = append(options, WithTokenStoreInitTableDisabled())
+	}
+	if c.SchemaVerification {
+		options = append(options, WithTokenStoreSchemaVerification())
+	}
+	if c.StrictSchema {
+		options = append(options, WithTokenStoreStrictSchema())
+	}
+	if c.ColumnsStorage {
+		options = append(options, WithTokenStoreColumnsStorage())
+	}
+	if c.BatchSize != 0 {
+		options = append(options, WithTokenStoreBatchSize(c.BatchSize))
+	}
+	if len(c.HashKeys) > 0 {
+		options = append(options, WithTokenStoreHMACLookups(c.HashKeys...))
+	}
+	return options
+}
+
+// TokenStoreConfigFromEnv reads token store configuration from the environment variables:
+// OAUTH2_PG_TOKEN_TABLE, OAUTH2_PG_TOKEN_GC_INTERVAL, OAUTH2_PG_TOKEN_GC_DISABLED, OAUTH2_PG_TOKEN_GC_RETENTION,
+// OAUTH2_PG_TOKEN_INIT_TABLE_DISABLED, OAUTH2_PG_TOKEN_SCHEMA_VERIFICATION, OAUTH2_PG_TOKEN_STRICT_SCHEMA,
+// OAUTH2_PG_TOKEN_COLUMNS_STORAGE, OAUTH2_PG_TOKEN_BATCH_SIZE and OAUTH2_PG_TOKEN_HASH_KEYS (see ParseTokenHashKeys for the format)
+func TokenStoreConfigFromEnv() (TokenStoreConfig, error) {
+	var (
+		c   TokenStoreConfig
+		env envReader
+	)
+
+	c.TableName = os.Getenv("OAUTH2_PG_TOKEN_TABLE")
+	c.GCInterval = env.duration("OAUTH2_PG_TOKEN_GC_INTERVAL")
+	c.GCDisabled = env.bool("OAUTH2_PG_TOKEN_GC_DISABLED")
+	c.GCRetention = env.duration("OAUTH2_PG_TOKEN_GC_RETENTION")
+	c.InitTableDisabled = env.bool("OAUTH2_PG_TOKEN_INIT_TABLE_DISABLED")
+	c.SchemaVerification = env.bool("OAUTH2_PG_TOKEN_SCHEMA_VERIFICATION")
+	c.StrictSchema = env.bool("OAUTH2_PG_TOKEN_STRICT_SCHEMA")
+	c.ColumnsStorage = env.bool("OAUTH2_PG_TOKEN_COLUMNS_STORAGE")
+	c.BatchSize = env.int("OAUTH2_PG_TOKEN_BATCH_SIZE")
+
+	c.HashKeys = env.tokenHashKeys("OAUTH2_PG_TOKEN_HASH_KEYS")
+
+	return c, env.err
+}
+
+// NewTokenStoreFromConfig creates PostgreSQL store instance from the configuration,
+// options are applied after the configuration ones
+func NewTokenStoreFromConfig(adapter pgadapter.Adapter, config TokenStoreConfig, options ...TokenStoreOption) (*TokenStore, error) {
+	return NewTokenStore(adapter, append(config.Options(), options...)...)
+}
+
+// NewTokenStoreFromEnv creates PostgreSQL store instance from the environment variables configuration,
+// see TokenStoreConfigFromEnv for the variables list
+func NewTokenStoreFromEnv(adapter pgadapter.Adapter, options ...TokenStoreOption) (*TokenStore, error) {
+	config, err := TokenStoreConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewTokenStoreFromConfig(adapter, config, options...)
+}
+
+// ClientStoreConfig is the client store configuration, zero values keep the defaults
+type ClientStoreConfig struct {
+	TableName          string
+	InitTableDisabled  bool
+	SchemaVerification bool
+	StrictSchema       bool
+	SecretGracePeriod  time.Duration
+	BatchSize          int
+}
+
+// Options returns client store options for the configuration
+func (c ClientStoreConfig) Options() []ClientStoreOption {
+	var options []ClientStoreOption
+	if c.TableName != "" {
+		options = append(options, WithClientStoreTableName(c.TableName))
+	}
+	if c.InitTableDisabled {
+		options = append(options, WithClientStoreInitTableDisabled())
+	}
+	if c.SchemaVerification {
+		options = append(options, WithClientStoreSchemaVerification())
+	}
+	if c.StrictSchema {
+		options = append(options, WithClientStoreStrictSchema())
+	}
+	if c.SecretGracePeriod != 0 {
+		options = append(options, WithClientStoreSecretGracePeriod(c.SecretGracePeriod))
+	}
+	if c.BatchSize != 0 {
+		options = append(options, WithClientStoreBatchSize(c.BatchSize))
+	}
+	return options
+}
+
+// ClientStoreConfigFromEnv reads client store configuration from the environment variables:
+// OAUTH2_PG_CLIENT_TABLE, OAUTH2_PG_CLIENT_INIT_TABLE_DISABLED, OAUTH2_PG_CLIENT_SCHEMA_VERIFICATION,
+// OAUTH2_PG_CLIENT_STRICT_SCHEMA, OAUTH2_PG_CLIENT_SECRET_GRACE_PERIOD and OAUTH2_PG_CLIENT_BATCH_SIZE
+func ClientStoreConfigFromEnv() (ClientStoreConfig, error) {
+	var (
+		c   ClientStoreConfig
+		env envReader
+	)
+
+	c.TableName = os.Getenv("OAUTH2_PG_CLIENT_TABLE")
+	c.InitTableDisabled = env.bool("OAUTH2_PG_CLIENT_INIT_TABLE_DISABLED")
+	c.SchemaVerification = env.bool("OAUTH2_PG_CLIENT_SCHEMA_VERIFICATION")
+	c.StrictSchema = env.bool("OAUTH2_PG_CLIENT_STRICT_SCHEMA")
+	c.SecretGracePeriod = env.duration("OAUTH2_PG_CLIENT_SECRET_GRACE_PERIOD")
+	c.BatchSize = env.int("OAUTH2_PG_CLIENT_BATCH_SIZE")
+
+	return c, env.err
+}
+
+// NewClientStoreFromConfig creates PostgreSQL store instance from the configuration,
+// options are applied after the configuration ones
+func NewClientStoreFromConfig(adapter pgadapter.Adapter, config ClientStoreConfig, options ...ClientStoreOption) (*ClientStore, error) {
+	return NewClientStore(adapter, append(config.Options(), options...)...)
+}
+
+// NewClientStoreFromEnv creates PostgreSQL store instance from the environment variables configuration,
+// see ClientStoreConfigFromEnv for the variables list
+func NewClientStoreFromEnv(adapter pgadapter.Adapter, options ...ClientStoreOption) (*ClientStore, error) {
+	config, err := ClientStoreConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewClientStoreFromConfig(adapter, config, options...)
+}
+
+// envReader parses environment variables keeping the first parsing error
+type envReader struct {
+	err error
+}
+
+func (r *envReader) lookup(key string, parse func(value string) error) {
+	value := os.Getenv(key)
+	if value == "" || r.err != nil {
+		return
+	}
+	if err := parse(value); err != nil {
+		r.err = fmt.Errorf("invalid %s environment variable value %q: %v", key, value, err)
+	}
+}
+
+// tokenHashKeys parses HMAC keys list, the value is secret and is not included into the error
+func (r *envReader) tokenHashKeys(key string) []TokenHashKey {
+	value := os.Getenv(key)
+	if value == "" || r.err != nil {
+		return nil
+	}
+
+	keys, err := ParseTokenHashKeys(value)
+	if err != nil {
+		r.err = fmt.Errorf("invalid %s environment variable value: %v", key, err)
+	}
+	return keys
+}
+
+func (r *envReader) duration(key string) (d time.Duration) {
+	r.lookup(key, func(value string) (err error) {
+		d, err = time.ParseDuration(value)
+		return
+	})
+	return
+}
+
+func (r *envReader) bool(key string) (b bool) {
+	r.lookup(key, func(value string) (err error) {
+		b, err = strconv.ParseBool(value)
+		return
+	})
+	return
+}
+
+func (r *envReader) int(key string) (i int) {
+	r.lookup(key, func(value string) (err error) {
+		i, err = strconv.Atoi(value)
+		return
+	})
+	return
+}
@@ -0,0 +1,91 @@
+package pg
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setEnv(t *testing.T, env map[string]string) func() {
+	for key, value := range env {
+		require.NoError(t, os.Setenv(key, value))
+	}
+	return func() {
+		for key := range env {
+			require.NoError(t, os.Unsetenv(key))
+		}
+	}
+}
+
+func TestNewTokenStoreFromEnv(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"OAUTH2_PG_TOKEN_TABLE":               "env_tokens",
+		"OAUTH2_PG_TOKEN_GC_DISABLED":         "true",
+		"OAUTH2_PG_TOKEN_GC_RETENTION":        "1h",
+		"OAUTH2_PG_TOKEN_INIT_TABLE_DISABLED": "1",
+		"OAUTH2_PG_TOKEN_BATCH_SIZE":          "10",
+		"OAUTH2_PG_TOKEN_HASH_KEYS":           "k2:c2VjcmV0Mg==, k1:c2VjcmV0MQ==",
+	})()
+
+	store, err := NewTokenStoreFromEnv(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "env_tokens", store.tableName)
+	assert.True(t, store.gcDisabled)
+	assert.Equal(t, time.Hour, store.gcRetention)
+	assert.True(t, store.initTableDisabled)
+	assert.False(t, store.columnsStorage)
+	assert.Equal(t, 10, store.batchSize)
+	assert.Equal(t, []TokenHashKey{{ID: "k2", Key: []byte("secret2")}, {ID: "k1", Key: []byte("secret1")}}, store.hashKeys)
+}
+
+func TestStoreConfigFromEnv_schema(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"OAUTH2_PG_TOKEN_SCHEMA_VERIFICATION":  "true",
+		"OAUTH2_PG_TOKEN_STRICT_SCHEMA":        "true",
+		"OAUTH2_PG_CLIENT_SCHEMA_VERIFICATION": "true",
+		"OAUTH2_PG_CLIENT_STRICT_SCHEMA":       "1",
+	})()
+
+	tokenConfig, err := TokenStoreConfigFromEnv()
+	require.NoError(t, err)
+	assert.True(t, tokenConfig.SchemaVerification)
+	assert.True(t, tokenConfig.StrictSchema)
+	assert.Equal(t, 2, len(tokenConfig.Options()))
+
+	clientConfig, err := ClientStoreConfigFromEnv()
+	require.NoError(t, err)
+	assert.True(t, clientConfig.SchemaVerification)
+	assert.True(t, clientConfig.StrictSchema)
+	assert.Equal(t, 2, len(clientConfig.Options()))
+}
+
+func TestTokenStoreConfigFromEnv_invalid(t *testing.T) {
+	defer setEnv(t, map[string]string{"OAUTH2_PG_TOKEN_GC_INTERVAL": "ten minutes"})()
+
+	_, err := TokenStoreConfigFromEnv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid OAUTH2_PG_TOKEN_GC_INTERVAL environment variable value "ten minutes"`)
+}
+
+func TestTokenStoreConfigFromEnv_invalidHashKeys(t *testing.T) {
+	defer setEnv(t, map[string]string{"OAUTH2_PG_TOKEN_HASH_KEYS": "k1:c2VjcmV0MQ==,secret"})()
+
+	_, err := TokenStoreConfigFromEnv()
+	assert.EqualError(t, err, "invalid OAUTH2_PG_TOKEN_HASH_KEYS environment variable value: token hash key #2 must be in <id>:<base64 key> format")
+}
+
+func TestNewClientStoreFromConfig(t *testing.T) {
+	store, err := NewClientStoreFromConfig(nil, ClientStoreConfig{
+		TableName:         "config_clients",
+		InitTableDisabled: true,
+		SecretGracePeriod: time.Hour,
+	}, WithClientStoreBatchSize(5))
+	require.NoError(t, err)
+	assert.Equal(t, "config_clients", store.tableName)
+	assert.True(t, store.initTableDisabled)
+	assert.Equal(t, time.Hour, store.secretGracePeriod)
+	assert.Equal(t, 5, store.batchSize)
+}
@@ -0,0 +1,211 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+// Credentials is the short-lived database password, e.g. AWS RDS IAM authentication token
+// or GCP Cloud SQL IAM access token, zero ExpiresAt means the password does not expire
+type Credentials struct {
+	Password  string
+	ExpiresAt time.Time
+}
+
+// CredentialsProvider returns the fresh database credentials, e.g. generated with the cloud SDK
+type CredentialsProvider func(ctx context.Context) (Credentials, error)
+
+// AdapterConnector opens the adapter authenticated with the password, e.g. the connection pool
+// with the password set in its configuration, the closer closes all the adapter connections
+type AdapterConnector func(ctx context.Context, password string) (pgadapter.Adapter, io.Closer, error)
+
+// CredentialsAdapter is the adapter authenticating with the short-lived credentials instead of the static password.
+// Adapter is reconnected with the fresh credentials when the current ones are about to expire, and when the query
+// fails with the authentication error, e.g. the credentials were revoked, the query is retried once reconnected.
+type CredentialsAdapter struct {
+	provider CredentialsProvider
+	connect  AdapterConnector
+	logger   Logger
+	clock    Clock
+
+	refreshMargin time.Duration
+
+	mu        sync.RWMutex
+	adapter   pgadapter.Adapter
+	closer    io.Closer
+	expiresAt time.Time
+}
+
+var _ ContextAdapter = (*CredentialsAdapter)(nil)
+
+// CredentialsAdapterOption is the configuration options type for credentials adapter
+type CredentialsAdapterOption func(a *CredentialsAdapter)
+
+// WithCredentialsAdapterRefreshMargin returns option that sets how long before the credentials expiration
+// the adapter is reconnected with the fresh ones, default is 1 minute
+func WithCredentialsAdapterRefreshMargin(margin time.Duration) CredentialsAdapterOption {
+	return func(a *CredentialsAdapter) {
+		a.refreshMargin = margin
+	}
+}
+
+// WithCredentialsAdapterLogger returns option that sets credentials adapter logger implementation
+func WithCredentialsAdapterLogger(logger Logger) CredentialsAdapterOption {
+	return func(a *CredentialsAdapter) {
+		a.logger = logger
+	}
+}
+
+// WithCredentialsAdapterClock returns option that sets the source of the current time
+// the credentials expiration is checked against
+func WithCredentialsAdapterClock(clock Clock) CredentialsAdapterOption {
+	return func(a *CredentialsAdapter) {
+		a.clock = clock
+	}
+}
+
+// NewCredentialsAdapter creates credentials adapter instance connected with the credentials of the provider
+func NewCredentialsAdapter(ctx context.Context, provider CredentialsProvider, connect AdapterConnector, options ...CredentialsAdapterOption) (*CredentialsAdapter, error) {
+	a := &CredentialsAdapter{
+		provider:      provider,
+		connect:       connect,
+		logger:        log.New(os.Stderr, "[OAUTH2-PG-ERROR]", log.LstdFlags),
+		clock:         systemClock{},
+		refreshMargin: time.Minute,
+	}
+
+	for _, o := range options {
+		o(a)
+	}
+
+	if a.refreshMargin < 0 {
+		return nil, errors.New("invalid credentials adapter configuration: refresh margin must not be negative")
+	}
+
+	if err := a.reconnect(ctx, nil); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reconnect opens the adapter with the fresh credentials and closes the previous one, stale is the adapter
+// the caller saw, so the adapter already reconnected by the concurrent call is not reconnected again
+func (a *CredentialsAdapter) reconnect(ctx context.Context, stale pgadapter.Adapter) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.adapter != stale {
+		return nil
+	}
+
+	credentials, err := a.provider(ctx)
+	if err != nil {
+		return err
+	}
+	adapter, closer, err := a.connect(ctx, credentials.Password)
+	if err != nil {
+		return err
+	}
+
+	if a.closer != nil {
+		if err := a.closer.Close(); err != nil {
+			a.logger.Printf("Error while closing adapter with expired credentials: %+v", err)
+		}
+	}
+	a.adapter, a.closer, a.expiresAt = adapter, closer, credentials.ExpiresAt
+	return nil
+}
+
+// current returns the connected adapter, the adapter is reconnected first if its credentials are about to expire
+func (a *CredentialsAdapter) current(ctx context.Context) (pgadapter.Adapter, error) {
+	a.mu.RLock()
+	adapter, expiresAt := a.adapter, a.expiresAt
+	a.mu.RUnlock()
+
+	if adapter == nil {
+		return nil, errors.New("credentials adapter is closed")
+	}
+	if expiresAt.IsZero() || a.clock.Now().Add(a.refreshMargin).Before(expiresAt) {
+		return adapter, nil
+	}
+
+	if err := a.reconnect(ctx, adapter); err != nil {
+		return nil, err
+	}
+	return a.current(ctx)
+}
+
+// run runs fn with the connected adapter, fn is run once again with the reconnected adapter
+// if it fails with the authentication error
+func (a *CredentialsAdapter) run(ctx context.Context, fn func(adapter pgadapter.Adapter) error) error {
+	adapter, err := a.current(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(adapter)
+	if !isAuthenticationError(err) {
+		return err
+	}
+
+	if reconnectErr := a.reconnect(ctx, adapter); reconnectErr != nil {
+		a.logger.Printf("Error while reconnecting adapter with fresh credentials: %+v", reconnectErr)
+		return err
+	}
+	if adapter, err = a.current(ctx); err != nil {
+		return err
+	}
+	return fn(adapter)
+}
+
+// isAuthenticationError checks if the error is the invalid authorization specification error, SQLSTATE class 28
+func isAuthenticationError(err error) bool {
+	return strings.HasPrefix(sqlState(err), "28")
+}
+
+// Exec runs the query with the connected adapter
+func (a *CredentialsAdapter) Exec(query string, args ...interface{}) error {
+	return a.ExecContext(context.Background(), query, args...)
+}
+
+// SelectOne runs the select query with the connected adapter
+func (a *CredentialsAdapter) SelectOne(dst interface{}, query string, args ...interface{}) error {
+	return a.SelectOneContext(context.Background(), dst, query, args...)
+}
+
+// ExecContext runs the query with the connected adapter, query is cancelled with the context
+// if the adapter supports it
+func (a *CredentialsAdapter) ExecContext(ctx context.Context, query string, args ...interface{}) error {
+	return a.run(ctx, func(adapter pgadapter.Adapter) error {
+		return execContext(ctx, adapter, query, args...)
+	})
+}
+
+// SelectOneContext runs the select query with the connected adapter, query is cancelled with the context
+// if the adapter supports it
+func (a *CredentialsAdapter) SelectOneContext(ctx context.Context, dst interface{}, query string, args ...interface{}) error {
+	return a.run(ctx, func(adapter pgadapter.Adapter) error {
+		return selectOneContext(ctx, adapter, dst, query, args...)
+	})
+}
+
+// Close closes the connected adapter, the queries run after it fail
+func (a *CredentialsAdapter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	closer := a.closer
+	a.adapter, a.closer = nil, nil
+	if closer == nil {
+		return nil
+	}
+	return closer.Close()
+}
@@ -0,0 +1,103 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+type credentialsConnector struct {
+	passwords []string
+	adapters  []*mockAdapter
+	closed    int
+}
+
+func (c *credentialsConnector) connect(ctx context.Context, password string) (pgadapter.Adapter, io.Closer, error) {
+	adapter := new(mockAdapter)
+	c.passwords = append(c.passwords, password)
+	c.adapters = append(c.adapters, adapter)
+	return adapter, closerFunc(func() error {
+		c.closed++
+		return nil
+	}), nil
+}
+
+func TestCredentialsAdapter(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	var generated int
+	provider := func(ctx context.Context) (Credentials, error) {
+		generated++
+		return Credentials{Password: fmt.Sprintf("token-%d", generated), ExpiresAt: clock.now.Add(15 * time.Minute)}, nil
+	}
+	connector := new(credentialsConnector)
+
+	adapter, err := NewCredentialsAdapter(context.Background(), provider, connector.connect, WithCredentialsAdapterClock(clock))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token-1"}, connector.passwords)
+
+	require.NoError(t, adapter.Exec("SELECT 1"))
+	clock.now = clock.now.Add(10 * time.Minute)
+	require.NoError(t, adapter.SelectOne(nil, "SELECT 2"))
+	assert.Equal(t, []string{"token-1"}, connector.passwords)
+	assert.Equal(t, 1, len(connector.adapters[0].execCalls))
+	assert.Equal(t, 1, len(connector.adapters[0].selectOneCalls))
+
+	// credentials are about to expire, adapter is reconnected and the previous one is closed
+	clock.now = clock.now.Add(4*time.Minute + time.Second)
+	require.NoError(t, adapter.Exec("SELECT 3"))
+	assert.Equal(t, []string{"token-1", "token-2"}, connector.passwords)
+	assert.Equal(t, 1, connector.closed)
+	assert.Equal(t, "SELECT 3", connector.adapters[1].execCalls[0].query)
+
+	// authentication error reconnects the adapter and retries the query
+	connector.adapters[1].execCallback = func(query string, args ...interface{}) error {
+		return sqlStateError("28P01")
+	}
+	require.NoError(t, adapter.Exec("SELECT 4"))
+	assert.Equal(t, []string{"token-1", "token-2", "token-3"}, connector.passwords)
+	assert.Equal(t, "SELECT 4", connector.adapters[2].execCalls[0].query)
+
+	// other errors are returned as is
+	connector.adapters[2].execCallback = func(query string, args ...interface{}) error {
+		return sqlStateError(uniqueViolation)
+	}
+	assert.Equal(t, sqlStateError(uniqueViolation), adapter.Exec("SELECT 5"))
+	assert.Equal(t, 3, len(connector.passwords))
+
+	require.NoError(t, adapter.Close())
+	assert.Equal(t, 3, connector.closed)
+	assert.EqualError(t, adapter.Exec("SELECT 6"), "credentials adapter is closed")
+}
+
+func TestNewCredentialsAdapter(t *testing.T) {
+	providerErr := errors.New("provider error")
+	_, err := NewCredentialsAdapter(context.Background(), func(ctx context.Context) (Credentials, error) {
+		return Credentials{}, providerErr
+	}, new(credentialsConnector).connect)
+	assert.Equal(t, providerErr, err)
+
+	_, err = NewCredentialsAdapter(context.Background(), nil, nil, WithCredentialsAdapterRefreshMargin(-time.Second))
+	assert.EqualError(t, err, "invalid credentials adapter configuration: refresh margin must not be negative")
+
+	// credentials without expiration are not refreshed
+	connector := new(credentialsConnector)
+	adapter, err := NewCredentialsAdapter(context.Background(), func(ctx context.Context) (Credentials, error) {
+		return Credentials{Password: "secret"}, nil
+	}, connector.connect)
+	require.NoError(t, err)
+	require.NoError(t, adapter.Exec("SELECT 1"))
+	assert.Equal(t, []string{"secret"}, connector.passwords)
+}
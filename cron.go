@@ -0,0 +1,255 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cronSchedule is the parsed standard five fields cron expression: minute, hour, day of month, month
+// and day of week. Fields are the lists of values, ranges and steps, e.g. "*/15", "1-5" or "0,30".
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// day of month and day of week restricted together match either of them as in cron
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [...]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCronSchedule parses the five fields cron expression, e.g. "0 3 * * *"
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron schedule %q must have %d fields, got %d", expr, len(cronFields), len(fields))
+	}
+
+	var bits [len(cronFields)]uint64
+	for i, field := range fields {
+		var err error
+		if bits[i], err = cronFields[i].parse(field); err != nil {
+			return nil, fmt.Errorf("cron schedule %q: %v", expr, err)
+		}
+	}
+
+	// both 0 and 7 are Sunday
+	dow := bits[4]
+	if dow&(1<<7) != 0 {
+		dow = dow&^(1<<7) | 1
+	}
+
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     dow,
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parse returns the bit set of the field values
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, part[i+1:])
+			}
+			rangePart = part[:i]
+		}
+
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				high = f.max
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rangePart)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s value %q, must be from %d to %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// next returns the first time matching the schedule after t, zero time is returned if there is none
+// in the following five years, e.g. for the 30th of February
+func (c *cronSchedule) next(t time.Time) time.Time {
+	// steps are rounded in the time zone, Truncate rounds the absolute time and is off in the zones with :30 offsets
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// cronGCStrategy runs garbage collection on the cron schedule, e.g. in the off-peak hours only. With the backlog cap
+// the expired tokens backlog is checked every GC interval and garbage collection runs between the scheduled runs
+// once the backlog exceeds the cap, so the table does not grow unbounded until the next scheduled run.
+type cronGCStrategy struct {
+	store    *TokenStore
+	expr     string
+	schedule *cronSchedule
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Start starts garbage collection goroutine
+func (g *cronGCStrategy) Start(clean func()) {
+	g.stop, g.done = make(chan struct{}), make(chan struct{})
+	go g.run(clean)
+}
+
+func (g *cronGCStrategy) run(clean func()) {
+	defer close(g.done)
+
+	timer := time.NewTimer(g.untilNext())
+	defer timer.Stop()
+
+	var backlogTicks <-chan time.Time
+	if g.store.gcBacklogCap > 0 {
+		ticker := time.NewTicker(g.store.gcInterval)
+		defer ticker.Stop()
+		backlogTicks = ticker.C
+	}
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-timer.C:
+			clean()
+			timer.Reset(g.untilNext())
+		case <-backlogTicks:
+			backlog, err := g.store.ExpiredBacklog(context.Background())
+			if err != nil {
+				g.store.logger.Printf("Error while checking expired tokens backlog: %+v", err)
+				continue
+			}
+			if backlog > g.store.gcBacklogCap {
+				clean()
+			}
+		}
+	}
+}
+
+// untilNext returns the duration until the next scheduled run
+func (g *cronGCStrategy) untilNext() time.Duration {
+	now := g.store.clock.Now()
+	next := g.schedule.next(now)
+	if next.IsZero() {
+		// schedule matching no time is refused by the store validation, wait for the backlog checks only
+		return time.Duration(1<<63 - 1)
+	}
+	return next.Sub(now)
+}
+
+// Stop stops garbage collection goroutine
+func (g *cronGCStrategy) Stop() {
+	g.stopOnce.Do(func() {
+		if g.stop != nil {
+			close(g.stop)
+		}
+	})
+}
+
+// wait waits for the stopped garbage collection goroutine to exit or the context to be done
+func (g *cronGCStrategy) wait(ctx context.Context) error {
+	if g.done == nil {
+		return nil
+	}
+	select {
+	case <-g.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// problem returns the schedule problem or empty string
+func (g *cronGCStrategy) problem() string {
+	schedule, err := parseCronSchedule(g.expr)
+	switch {
+	case err != nil:
+		return err.Error()
+	case schedule.next(g.store.clock.Now()).IsZero():
+		return fmt.Sprintf("cron schedule %q never matches", g.expr)
+	}
+	g.schedule = schedule
+	return ""
+}
+
+// gcScheduled checks if garbage collection runs on the cron schedule
+func (s *TokenStore) gcScheduled() bool {
+	_, ok := s.gcStrategy.(*cronGCStrategy)
+	return ok
+}
+
+// gcBacklogCapped checks if garbage collection runs on the cron schedule with the backlog cap,
+// GC interval is the backlog check interval then
+func (s *TokenStore) gcBacklogCapped() bool {
+	return s.gcScheduled() && s.gcBacklogCap > 0
+}
@@ -0,0 +1,169 @@
+package pg
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronSchedule_next(t *testing.T) {
+	// Friday
+	now := time.Date(2019, 3, 1, 12, 30, 15, 0, time.UTC)
+
+	for expr, expected := range map[string]time.Time{
+		"* * * * *":       time.Date(2019, 3, 1, 12, 31, 0, 0, time.UTC),
+		"0 3 * * *":       time.Date(2019, 3, 2, 3, 0, 0, 0, time.UTC),
+		"*/15 * * * *":    time.Date(2019, 3, 1, 12, 45, 0, 0, time.UTC),
+		"30 12 * * *":     time.Date(2019, 3, 2, 12, 30, 0, 0, time.UTC),
+		"0 1-5 * * *":     time.Date(2019, 3, 2, 1, 0, 0, 0, time.UTC),
+		"0,40 22 * * *":   time.Date(2019, 3, 1, 22, 0, 0, 0, time.UTC),
+		"0 3 * * 0":       time.Date(2019, 3, 3, 3, 0, 0, 0, time.UTC),
+		"0 3 * * 7":       time.Date(2019, 3, 3, 3, 0, 0, 0, time.UTC),
+		"0 3 * * 1-5":     time.Date(2019, 3, 4, 3, 0, 0, 0, time.UTC),
+		"0 0 1 * *":       time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":      time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 15 * 0":      time.Date(2019, 3, 3, 0, 0, 0, 0, time.UTC),
+		"0 2/6 * * *":     time.Date(2019, 3, 1, 14, 0, 0, 0, time.UTC),
+		"0 0 * 1,6 *":     time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC),
+		"0 3 31 12 *":     time.Date(2019, 12, 31, 3, 0, 0, 0, time.UTC),
+		" 0  3  *  *  * ": time.Date(2019, 3, 2, 3, 0, 0, 0, time.UTC),
+		"0 0 30 2 *":      {},
+		"0 3 13 * 5":      time.Date(2019, 3, 8, 3, 0, 0, 0, time.UTC),
+	} {
+		schedule, err := parseCronSchedule(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, expected, schedule.next(now), expr)
+	}
+
+	// hours are stepped in the schedule time zone with the half hour offset
+	kolkata := time.FixedZone("IST", 5*60*60+30*60)
+	now = time.Date(2019, 3, 1, 12, 30, 15, 0, kolkata)
+	for expr, expected := range map[string]time.Time{
+		"0 3 * * *":    time.Date(2019, 3, 2, 3, 0, 0, 0, kolkata),
+		"*/15 * * * *": time.Date(2019, 3, 1, 12, 45, 0, 0, kolkata),
+		"0 2/6 * * *":  time.Date(2019, 3, 1, 14, 0, 0, 0, kolkata),
+	} {
+		schedule, err := parseCronSchedule(expr)
+		require.NoError(t, err, expr)
+		assert.True(t, expected.Equal(schedule.next(now)), "%s: %s", expr, schedule.next(now))
+	}
+}
+
+func TestParseCronSchedule(t *testing.T) {
+	for expr, expected := range map[string]string{
+		"0 3 * *":     `cron schedule "0 3 * *" must have 5 fields, got 4`,
+		"60 3 * * *":  `cron schedule "60 3 * * *": invalid minute value "60", must be from 0 to 59`,
+		"0 3 0 * *":   `cron schedule "0 3 0 * *": invalid day of month value "0", must be from 1 to 31`,
+		"0 3 * 13 *":  `cron schedule "0 3 * 13 *": invalid month value "13", must be from 1 to 12`,
+		"0 3 * * 8":   `cron schedule "0 3 * * 8": invalid day of week value "8", must be from 0 to 7`,
+		"0 5-3 * * *": `cron schedule "0 5-3 * * *": invalid hour range "5-3"`,
+		"*/0 * * * *": `cron schedule "*/0 * * * *": invalid minute step "0"`,
+		"@daily":      `cron schedule "@daily" must have 5 fields, got 1`,
+		"0 3 * * MON": `cron schedule "0 3 * * MON": invalid day of week value "MON", must be from 0 to 7`,
+		"0 3,, * * *": `cron schedule "0 3,, * * *": invalid hour value "", must be from 0 to 23`,
+		"0 3 * * */x": `cron schedule "0 3 * * */x": invalid day of week step "x"`,
+		"0 3 * 1-x *": `cron schedule "0 3 * 1-x *": invalid month value "x", must be from 1 to 12`,
+	} {
+		_, err := parseCronSchedule(expr)
+		assert.EqualError(t, err, expected, expr)
+	}
+}
+
+func TestWithTokenStoreGCSchedule(t *testing.T) {
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCSchedule("0 3 * * *"), WithTokenStoreClock(clock), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	strategy := store.gcStrategy.(*cronGCStrategy)
+	assert.Equal(t, 15*time.Hour, strategy.untilNext())
+	assert.NoError(t, store.Close())
+
+	// backlog is checked every GC interval
+	store, err = NewTokenStore(adapter, WithTokenStoreGCSchedule("0 3 * * *"), WithTokenStoreGCBacklogCap(1000), WithTokenStoreGCInterval(time.Minute), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), store.gcBacklogCap)
+	assert.NoError(t, store.Close())
+
+	_, err = NewTokenStore(adapter, WithTokenStoreGCSchedule("0 3 * *"), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, `invalid token store configuration: cron schedule "0 3 * *" must have 5 fields, got 4`)
+	_, err = NewTokenStore(adapter, WithTokenStoreGCSchedule("0 0 30 2 *"), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, `invalid token store configuration: cron schedule "0 0 30 2 *" never matches`)
+	_, err = NewTokenStore(adapter, WithTokenStoreGCSchedule("0 3 * * *"), WithTokenStoreGCBacklogCap(-1), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC backlog cap must not be negative, got -1")
+	_, err = NewTokenStore(adapter, WithTokenStoreGCBacklogCap(1000), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC backlog cap requires GC schedule")
+	_, err = NewTokenStore(adapter, WithTokenStoreGCSchedule("0 3 * * *"), WithTokenStoreGCInterval(time.Minute), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC interval is set together with GC strategy")
+}
+
+func TestCronGCStrategy_backlogCap(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		reflect.ValueOf(dst).Elem().FieldByName("Backlog").SetInt(5)
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	store.gcInterval, store.gcBacklogCap = 10*time.Millisecond, 1
+
+	cleaned := make(chan struct{}, 1)
+	strategy := &cronGCStrategy{store: store, expr: "0 3 * * *"}
+	require.Equal(t, "", strategy.problem())
+
+	strategy.Start(func() {
+		select {
+		case cleaned <- struct{}{}:
+		default:
+		}
+	})
+	defer strategy.Stop()
+
+	select {
+	case <-cleaned:
+	case <-time.After(time.Second):
+		t.Fatal("garbage collection did not run with the backlog exceeding the cap")
+	}
+}
+
+func TestCronGCStrategy_wait(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if strings.Contains(query, "AS backlog") {
+			reflect.ValueOf(dst).Elem().FieldByName("Backlog").SetInt(5)
+		}
+		return nil
+	}
+
+	// the pass is blocked after its queries are done, so there is no in-flight query to wait for
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	store, err := NewTokenStore(adapter, WithTokenStoreGCSchedule("0 3 * * *"), WithTokenStoreGCBacklogCap(1),
+		WithTokenStoreGCInterval(10*time.Millisecond), WithTokenStoreInitTableDisabled(), WithTokenStoreGCObserver(func(GCStats) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+		}))
+	require.NoError(t, err)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("garbage collection did not run with the backlog exceeding the cap")
+	}
+
+	// close waits for the running garbage collection pass
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, store.CloseContext(ctx))
+
+	close(release)
+	assert.NoError(t, store.Drain(context.Background()))
+}
@@ -0,0 +1,131 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+// Dialect is the SQL dialect of the database server speaking PostgreSQL wire protocol
+type Dialect string
+
+// Supported dialects
+const (
+	// DialectPostgres is PostgreSQL, the default dialect
+	DialectPostgres Dialect = "postgres"
+	// DialectCockroach is CockroachDB: bigserial keys are generated with unique_rowid() and are not sequential,
+	// table initialization is not serialized with the advisory lock, statements failed with the serialization
+	// error are retried, and the features relying on PostgreSQL extensions or index types are not supported
+	DialectCockroach Dialect = "cockroach"
+	// DialectYugabyte is YugabyteDB: token table can be pre-split into tablets, table initialization runs without
+	// the advisory lock on the versions that do not support them, statements failed with the serialization error
+	// are retried, and the index types YugabyteDB does not support are not allowed
+	DialectYugabyte Dialect = "yugabyte"
+)
+
+func (d Dialect) valid() bool {
+	return d == DialectPostgres || d == DialectCockroach || d == DialectYugabyte
+}
+
+// featureNotSupported is the SQLSTATE YugabyteDB returns for the advisory locks on the versions without them
+const featureNotSupported = "0A000"
+
+// serializationFailure is the SQLSTATE CockroachDB returns for the transaction that has to be retried by the client
+const serializationFailure = "40001"
+
+// serializationRetries is the number of times the statement failed with the serialization error is retried
+const serializationRetries = 3
+
+// retry runs fn and retries it with the growing delay while it fails with the serialization error, failed statement
+// is rolled back by the server, so it is safe to run it again. PostgreSQL runs single statements without retries.
+func (d Dialect) retry(ctx context.Context, fn func() error) error {
+	err := fn()
+	if d == DialectPostgres {
+		return err
+	}
+
+	for attempt := 1; attempt <= serializationRetries && sqlState(err) == serializationFailure; attempt++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+		err = fn()
+	}
+	return err
+}
+
+// keyColumn returns the token table primary key column definition, CockroachDB serial columns are generated with
+// unique_rowid() anyway, so the default is set explicitly to get the same column type the schema verification expects
+func (d Dialect) keyColumn(keyType TokenKeyType) tableColumn {
+	if d == DialectCockroach && keyType == TokenKeyBigSerial {
+		return tableColumn{"id", "INT8", "NOT NULL DEFAULT unique_rowid()"}
+	}
+	return tableColumn{"id", keyType.columnType(), "NOT NULL"}
+}
+
+// storageDDL returns the table creation storage clause, YugabyteDB table is pre-split into the tablets if set
+func (d Dialect) storageDDL(tablets int) string {
+	if d == DialectYugabyte && tablets > 0 {
+		return fmt.Sprintf("SPLIT INTO %d TABLETS", tablets)
+	}
+	return ""
+}
+
+// initTable runs table initialization statements serialized with the advisory lock and bounded with the server-side
+// timeouts. CockroachDB has no advisory locks and table initialization is bounded by the context only, YugabyteDB
+// versions without advisory locks fail the locked statements and they are run again without the lock.
+func (d Dialect) initTable(ctx context.Context, adapter pgadapter.Adapter, tableName string, timeout time.Duration, ddl string) error {
+	run := func(ddl string) error {
+		return d.retry(ctx, func() error {
+			return execContext(ctx, adapter, ddl)
+		})
+	}
+
+	if d == DialectCockroach {
+		return run(ddl)
+	}
+
+	err := run(timeoutDDL(timeout, lockedDDL(tableName, ddl)))
+	if d == DialectYugabyte && sqlState(err) == featureNotSupported {
+		return run(timeoutDDL(timeout, ddl))
+	}
+	return err
+}
+
+// dialectProblem returns the configured token store feature the dialect does not support or empty string
+func (s *TokenStore) dialectProblem() string {
+	if s.tablets < 0 {
+		return fmt.Sprintf("tablets count must not be negative, got %d", s.tablets)
+	}
+	if s.tablets > 0 && s.dialect != DialectYugabyte {
+		return fmt.Sprintf("tablets count requires %s dialect", DialectYugabyte)
+	}
+
+	var feature string
+	switch {
+	case s.dialect == DialectPostgres:
+		// all the features are supported
+	case s.brinExpiryIndex:
+		feature = "BRIN expiry index"
+	case s.hashIndexes:
+		feature = "hash indexes"
+	case s.dialect == DialectYugabyte:
+		// the rest of the features are supported by YugabyteDB
+	case s.rowLevelSecurity:
+		feature = "row level security"
+	case s.clientForeignKey != "":
+		feature = "client foreign key"
+	default:
+		if _, ok := s.gcStrategy.(*pgCronGCStrategy); ok {
+			feature = "pg_cron GC"
+		}
+	}
+
+	if feature == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s is not supported by %s dialect", feature, s.dialect)
+}
@@ -0,0 +1,102 @@
+package pg
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialectCockroach(t *testing.T) {
+	adapter := new(mockAdapter)
+	store, err := NewTokenStore(adapter, WithTokenStoreDialect(DialectCockroach), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	// no advisory lock, bigserial key is generated explicitly
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.True(t, strings.HasPrefix(adapter.execCalls[0].query, "\nCREATE TABLE IF NOT EXISTS tokens ("))
+	assert.Contains(t, adapter.execCalls[0].query, "  id                    INT8        NOT NULL DEFAULT unique_rowid(),\n")
+
+	_, err = store.ExpiredBacklog(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) AS backlog FROM tokens WHERE expires_at <= $1", adapter.selectOneCalls[0].query)
+
+	for feature, option := range map[string]TokenStoreOption{
+		"BRIN expiry index":  WithTokenStoreBRINExpiryIndex(),
+		"hash indexes":       WithTokenStoreHashIndexes(),
+		"row level security": WithTokenStoreRowLevelSecurity("app.tenant_id"),
+		"client foreign key": WithTokenStoreClientForeignKey("clients"),
+		"pg_cron GC":         WithTokenStoreGCPGCron("*/10 * * * *"),
+	} {
+		_, err = NewTokenStore(adapter, WithTokenStoreDialect(DialectCockroach), option, WithTokenStoreInitTableDisabled())
+		assert.EqualError(t, err, "invalid token store configuration: "+feature+" is not supported by cockroach dialect")
+	}
+}
+
+func TestDialectYugabyte(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		if strings.Contains(query, "pg_advisory_xact_lock") {
+			return sqlStateError(featureNotSupported)
+		}
+		return nil
+	}
+	store, err := NewTokenStore(adapter, WithTokenStoreDialect(DialectYugabyte), WithTokenStoreTablets(8), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	// table initialization is run again without the advisory lock
+	require.Equal(t, 2, len(adapter.execCalls))
+	assert.True(t, strings.HasPrefix(adapter.execCalls[1].query, "\nCREATE TABLE IF NOT EXISTS tokens ("))
+	assert.Contains(t, adapter.execCalls[1].query, "  CONSTRAINT tokens_pkey PRIMARY KEY (id)\n) SPLIT INTO 8 TABLETS;\n")
+	assert.Contains(t, adapter.execCalls[1].query, "  id                    BIGSERIAL   NOT NULL,\n")
+
+	_, err = store.ExpiredBacklog(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) AS backlog FROM tokens WHERE expires_at <= $1", adapter.selectOneCalls[0].query)
+
+	_, err = NewTokenStore(adapter, WithTokenStoreDialect(DialectYugabyte), WithTokenStoreBRINExpiryIndex(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: BRIN expiry index is not supported by yugabyte dialect")
+	_, err = NewTokenStore(adapter, WithTokenStoreDialect(DialectYugabyte), WithTokenStoreRowLevelSecurity("app.tenant_id"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.NoError(t, err)
+	_, err = NewTokenStore(adapter, WithTokenStoreTablets(8), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: tablets count requires yugabyte dialect")
+	_, err = NewTokenStore(adapter, WithTokenStoreDialect(DialectYugabyte), WithTokenStoreTablets(-1), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: tablets count must not be negative, got -1")
+}
+
+func TestDialect_retry(t *testing.T) {
+	var calls int
+	fail := func() error {
+		calls++
+		return sqlStateError(serializationFailure)
+	}
+
+	assert.Equal(t, sqlStateError(serializationFailure), DialectPostgres.retry(context.Background(), fail))
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	assert.Equal(t, sqlStateError(serializationFailure), DialectCockroach.retry(context.Background(), fail))
+	assert.Equal(t, 1+serializationRetries, calls)
+
+	// other errors are not retried
+	calls = 0
+	assert.Equal(t, sqlStateError(uniqueViolation), DialectCockroach.retry(context.Background(), func() error {
+		calls++
+		return sqlStateError(uniqueViolation)
+	}))
+	assert.Equal(t, 1, calls)
+
+	adapter := new(mockAdapter)
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		if len(adapter.execCalls) < 2 {
+			return sqlStateError(serializationFailure)
+		}
+		return nil
+	}
+	store, err := NewTokenStore(adapter, WithTokenStoreDialect(DialectCockroach), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	require.NoError(t, store.RemoveByAccess("access"))
+	assert.Equal(t, 2, len(adapter.execCalls))
+}
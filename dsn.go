@@ -0,0 +1,287 @@
+package pg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/vgarvardt/go-pg-adapter"
+	"github.com/vgarvardt/pgx-helpers"
+)
+
+// NewTokenStoreFromDSN creates PostgreSQL store instance with the pgx connection pool opened with the connection
+// string, either URI or DSN, the pool is owned by the store and closed on the store Close
+func NewTokenStoreFromDSN(ctx context.Context, dsn string, options ...TokenStoreOption) (*TokenStore, error) {
+	// pool settings are read from the options before the pool is opened
+	settings := new(TokenStore)
+	for _, o := range options {
+		o(settings)
+	}
+
+	pool, err := openOwnedPool(ctx, dsn, settings.acquireTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewTokenStore(pool, append([]TokenStoreOption{withTokenStorePool(pool)}, options...)...)
+	if err != nil {
+		if store != nil {
+			store.Close()
+		}
+		pool.Close()
+		return nil, err
+	}
+
+	if store.reconnectInterval > 0 {
+		pool.supervise(store.reconnectInterval, store.logger)
+	}
+	return store, nil
+}
+
+// NewClientStoreFromDSN creates PostgreSQL store instance with the pgx connection pool opened with the connection
+// string, either URI or DSN, the pool is owned by the store and closed on the store Close
+func NewClientStoreFromDSN(ctx context.Context, dsn string, options ...ClientStoreOption) (*ClientStore, error) {
+	// pool settings are read from the options before the pool is opened
+	settings := new(ClientStore)
+	for _, o := range options {
+		o(settings)
+	}
+
+	pool, err := openOwnedPool(ctx, dsn, settings.acquireTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewClientStore(pool, append([]ClientStoreOption{withClientStorePool(pool)}, options...)...)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	if store.reconnectInterval > 0 {
+		pool.supervise(store.reconnectInterval, store.logger)
+	}
+	return store, nil
+}
+
+// withTokenStorePool returns option that makes the store own the pool, it is set by NewTokenStoreFromDSN,
+// so the option validation knows the store owns the pool
+func withTokenStorePool(pool *ownedPool) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.pool = pool
+	}
+}
+
+// withClientStorePool returns option that makes the store own the pool, it is set by NewClientStoreFromDSN,
+// so the option validation knows the store owns the pool
+func withClientStorePool(pool *ownedPool) ClientStoreOption {
+	return func(s *ClientStore) {
+		s.pool = pool
+	}
+}
+
+// ownedPool is the adapter of the pgx connection pool opened with the connection string and owned by the store.
+// The supervisor opens the new pool when the current one lost the connection, e.g. after the database failover,
+// so the stale pool connections fail no more queries.
+type ownedPool struct {
+	dsn            string
+	acquireTimeout time.Duration
+
+	mu     sync.RWMutex
+	pool   *pgx.ConnPool
+	closed bool
+
+	probing int32
+
+	done chan struct{}
+}
+
+func openOwnedPool(ctx context.Context, dsn string, acquireTimeout time.Duration) (*ownedPool, error) {
+	pool, err := openPool(ctx, dsn, acquireTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &ownedPool{dsn: dsn, acquireTimeout: acquireTimeout, pool: pool}, nil
+}
+
+var _ ContextAdapter = (*ownedPool)(nil)
+
+func (p *ownedPool) current() *pgx.ConnPool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pool
+}
+
+// Exec runs the query with the current pool
+func (p *ownedPool) Exec(query string, args ...interface{}) error {
+	return p.ExecContext(context.Background(), query, args...)
+}
+
+// SelectOne runs the select query with the current pool
+func (p *ownedPool) SelectOne(dst interface{}, query string, args ...interface{}) error {
+	return p.SelectOneContext(context.Background(), dst, query, args...)
+}
+
+// ExecContext runs the query with the current pool, the running query is cancelled when the context is done
+func (p *ownedPool) ExecContext(ctx context.Context, query string, args ...interface{}) error {
+	_, err := p.current().ExecEx(ctx, query, nil, args...)
+	return err
+}
+
+// SelectOneContext runs the select query with the current pool and scans the row into dst the same way
+// pgxadapter does, the running query is cancelled when the context is done
+func (p *ownedPool) SelectOneContext(ctx context.Context, dst interface{}, query string, args ...interface{}) error {
+	if err := pgxhelpers.ScanStruct(p.current().QueryRowEx(ctx, query, nil, args...), dst); err != nil {
+		if err == pgx.ErrNoRows {
+			return pgadapter.ErrNoRows
+		}
+		return err
+	}
+	return nil
+}
+
+// supervise checks the pool connection with the interval and reopens the pool when the connection is lost,
+// errors are logged with the logger. The supervisor stops on Close.
+func (p *ownedPool) supervise(interval time.Duration, logger Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done = make(chan struct{})
+	go func(done <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := p.check(interval); err != nil {
+					logger.Printf("Error while reconnecting lost database connection: %+v", err)
+				}
+			}
+		}
+	}(p.done)
+}
+
+// check reopens the pool if its connection is lost, both the check and the opening are bounded with the timeout
+func (p *ownedPool) check(timeout time.Duration) error {
+	if !p.connectionLost(timeout) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	pool, err := openPool(ctx, p.dsn, p.acquireTimeout)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		pool.Close()
+		return nil
+	}
+	stale := p.pool
+	p.pool = pool
+	p.mu.Unlock()
+
+	stale.Close()
+	return nil
+}
+
+// Close stops the supervisor and closes the pool, second and subsequent calls are no-op
+func (p *ownedPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	if p.done != nil {
+		close(p.done)
+	}
+	p.pool.Close()
+}
+
+// connectionLost probes the pool connection, only the connection lost errors mean the lost connection. The probe
+// waiting for the connection of the busy pool or for the answer longer than the timeout is not the failover,
+// it is left to finish in the background and no other probe starts until it is done.
+func (p *ownedPool) connectionLost(timeout time.Duration) bool {
+	if !atomic.CompareAndSwapInt32(&p.probing, 0, 1) {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	probed := make(chan error, 1)
+	go func() {
+		defer atomic.StoreInt32(&p.probing, 0)
+		defer cancel()
+		probed <- p.probe(ctx)
+	}()
+
+	select {
+	case err := <-probed:
+		return isConnectionLost(err)
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// probe runs the query with the pool connection, the exhausted pool is not probed, as its connections are in use
+// and report the lost connection themselves
+func (p *ownedPool) probe(ctx context.Context) error {
+	pool := p.current()
+	if stat := pool.Stat(); stat.AvailableConnections == 0 && stat.CurrentConnections >= stat.MaxConnections {
+		return nil
+	}
+
+	conn, err := pool.Acquire()
+	if err != nil {
+		return err
+	}
+	defer pool.Release(conn)
+
+	_, err = conn.ExecEx(ctx, "SELECT 1", nil)
+	return err
+}
+
+// openPool opens the pgx connection pool, zero acquire timeout means the queries wait for the free connection
+// without the bound. Pgx pool connects without the context, so the pool opened after the context is done is closed
+// in the background.
+func openPool(ctx context.Context, dsn string, acquireTimeout time.Duration) (*pgx.ConnPool, error) {
+	config, err := pgx.ParseConnectionString(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		pool *pgx.ConnPool
+		err  error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		pool, err := pgx.NewConnPool(pgx.ConnPoolConfig{ConnConfig: config, AcquireTimeout: acquireTimeout})
+		opened <- result{pool, err}
+	}()
+
+	select {
+	case r := <-opened:
+		return r.pool, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-opened; r.err == nil {
+				r.pool.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
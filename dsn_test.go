@@ -0,0 +1,181 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/pgmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestNewTokenStoreFromDSN(t *testing.T) {
+	_, err := NewTokenStoreFromDSN(context.Background(), "postgres://user@localhost/db?sslmode=bogus")
+	assert.EqualError(t, err, "sslmode is invalid")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewTokenStoreFromDSN(ctx, "postgres://user@localhost:5432/db")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestNewClientStoreFromDSN(t *testing.T) {
+	_, err := NewClientStoreFromDSN(context.Background(), "host=localhost sslmode=bogus")
+	assert.EqualError(t, err, "sslmode is invalid")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewClientStoreFromDSN(ctx, "host=localhost user=user dbname=db")
+	assert.Equal(t, context.Canceled, err)
+
+	// store created with the adapter does not own the pool
+	store := &ClientStore{}
+	assert.NoError(t, store.Close())
+}
+
+func TestWithTokenStoreReconnectInterval(t *testing.T) {
+	_, err := NewTokenStore(new(mockAdapter), WithTokenStoreReconnectInterval(time.Second), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: reconnect interval requires the store created with NewTokenStoreFromDSN")
+	_, err = NewTokenStore(new(mockAdapter), withTokenStorePool(new(ownedPool)), WithTokenStoreReconnectInterval(-time.Second), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: reconnect interval must not be negative, got -1s")
+}
+
+func TestWithClientStoreReconnectInterval(t *testing.T) {
+	_, err := NewClientStore(new(mockAdapter), WithClientStoreReconnectInterval(time.Second), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: reconnect interval requires the store created with NewClientStoreFromDSN")
+	_, err = NewClientStore(new(mockAdapter), withClientStorePool(new(ownedPool)), WithClientStoreReconnectInterval(-time.Second), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: reconnect interval must not be negative, got -1s")
+}
+
+func TestWithTokenStoreAcquireTimeout(t *testing.T) {
+	_, err := NewTokenStore(new(mockAdapter), WithTokenStoreAcquireTimeout(time.Second), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: acquire timeout requires the store created with NewTokenStoreFromDSN")
+	_, err = NewTokenStore(new(mockAdapter), withTokenStorePool(new(ownedPool)), WithTokenStoreAcquireTimeout(-time.Second), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: acquire timeout must not be negative, got -1s")
+}
+
+func TestWithClientStoreAcquireTimeout(t *testing.T) {
+	_, err := NewClientStore(new(mockAdapter), WithClientStoreAcquireTimeout(time.Second), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: acquire timeout requires the store created with NewClientStoreFromDSN")
+	_, err = NewClientStore(new(mockAdapter), withClientStorePool(new(ownedPool)), WithClientStoreAcquireTimeout(-time.Second), WithClientStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: acquire timeout must not be negative, got -1s")
+}
+
+func TestNewTokenStoreFromDSN_queryTimeout(t *testing.T) {
+	store, err := NewTokenStoreFromDSN(
+		context.Background(),
+		uri,
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreGCDisabled(),
+		WithTokenStoreQueryTimeout(100*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, store.Close())
+	}()
+
+	// the running query is cancelled by the pool once the deadline is exceeded
+	ctx, cancel := store.queryContext(context.Background())
+	defer cancel()
+	started := time.Now()
+	err = execContext(ctx, store.adapter, "SELECT pg_sleep(10)")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	assert.False(t, errors.Is(err, ErrConnectionLost))
+	assert.True(t, time.Since(started) < 5*time.Second)
+
+	// the connection of the cancelled query is reused
+	token := &models.Token{ClientID: "client", Access: "access", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour}
+	require.NoError(t, store.Create(token))
+	info, err := store.GetByAccess("access")
+	require.NoError(t, err)
+	assert.Equal(t, "client", info.GetClientID())
+}
+
+// blackHoleDSN starts the server accepting the single pgx connection and never answering its queries,
+// e.g. the connection black-holed by the failover
+func blackHoleDSN(t *testing.T) string {
+	return scriptedDSN(t, pgmock.WaitForClose())
+}
+
+// scriptedDSN starts the server accepting the single pgx connection and running the steps after its initialization,
+// the connection is closed once the steps are done
+func scriptedDSN(t *testing.T, steps ...pgmock.Step) string {
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+	script.Steps = append(script.Steps, pgmock.PgxInitSteps()...)
+	script.Steps = append(script.Steps, steps...)
+
+	server, err := pgmock.NewServer(script)
+	require.NoError(t, err)
+	go server.ServeOne()
+
+	return fmt.Sprintf("postgres://user@%s/db?sslmode=disable", server.Addr())
+}
+
+func TestOwnedPool_connectionLost(t *testing.T) {
+	pool, err := openOwnedPool(context.Background(), scriptedDSN(t), 0)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	// server closed the connection
+	assert.True(t, pool.connectionLost(time.Second))
+
+	// the probe not answered within the timeout is not the lost connection,
+	// no other probe starts until it is done
+	pool, err = openOwnedPool(context.Background(), blackHoleDSN(t), 0)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	started := time.Now()
+	atomic.StoreInt32(&pool.probing, 1)
+	assert.False(t, pool.connectionLost(time.Hour))
+	atomic.StoreInt32(&pool.probing, 0)
+	assert.False(t, pool.connectionLost(50*time.Millisecond))
+	assert.True(t, time.Since(started) < time.Second)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&pool.probing) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOwnedPool_queryTimeout(t *testing.T) {
+	pool, err := openOwnedPool(context.Background(), blackHoleDSN(t), 0)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	store, err := NewTokenStore(pool, withTokenStorePool(pool), WithTokenStoreQueryTimeout(50*time.Millisecond),
+		WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	// the query never answered by the server is cancelled once the deadline is exceeded
+	started := time.Now()
+	_, err = store.GetByAccess("access")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	assert.False(t, errors.Is(err, ErrConnectionLost))
+	assert.True(t, time.Since(started) < time.Second)
+}
+
+func TestOwnedPool_supervise(t *testing.T) {
+	pool, err := openOwnedPool(context.Background(), blackHoleDSN(t), 0)
+	require.NoError(t, err)
+
+	supervising := func() bool {
+		buf := make([]byte, 1<<20)
+		return strings.Contains(string(buf[:runtime.Stack(buf, true)]), "(*ownedPool).supervise")
+	}
+
+	pool.supervise(time.Hour, new(memoryLogger))
+	assert.True(t, supervising())
+
+	// the supervisor stops on the pool close
+	pool.Close()
+	pool.Close()
+	assert.Eventually(t, func() bool {
+		return !supervising()
+	}, time.Second, 10*time.Millisecond)
+}
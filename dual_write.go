@@ -0,0 +1,120 @@
+package pg
+
+import (
+	"log"
+	"os"
+
+	"gopkg.in/oauth2.v3"
+)
+
+// DualWriteTokenStore is the migration token store that writes to both primary and secondary stores
+// and reads from the primary one. Swap the stores to cut over from the old storage to the new one
+// without invalidating live tokens, remove the wrapper when the old tokens expire.
+type DualWriteTokenStore struct {
+	primary   oauth2.TokenStore
+	secondary oauth2.TokenStore
+	logger    Logger
+
+	readFallback bool
+}
+
+// DualWriteTokenStoreOption is the configuration options type for dual-write token store
+type DualWriteTokenStoreOption func(s *DualWriteTokenStore)
+
+// WithDualWriteTokenStoreLogger returns option that sets dual-write token store logger implementation
+func WithDualWriteTokenStoreLogger(logger Logger) DualWriteTokenStoreOption {
+	return func(s *DualWriteTokenStore) {
+		s.logger = logger
+	}
+}
+
+// WithDualWriteTokenStoreReadFallback returns option that makes the store read from the secondary store
+// when the token is not found in the primary one, e.g. for the tokens issued before dual-write was enabled
+func WithDualWriteTokenStoreReadFallback() DualWriteTokenStoreOption {
+	return func(s *DualWriteTokenStore) {
+		s.readFallback = true
+	}
+}
+
+// NewDualWriteTokenStore creates dual-write token store instance, primary store errors are returned
+// to the caller while secondary store write errors are logged only
+func NewDualWriteTokenStore(primary, secondary oauth2.TokenStore, options ...DualWriteTokenStoreOption) *DualWriteTokenStore {
+	store := &DualWriteTokenStore{
+		primary:   primary,
+		secondary: secondary,
+		logger:    log.New(os.Stderr, "[OAUTH2-PG-ERROR]", log.LstdFlags),
+	}
+
+	for _, o := range options {
+		o(store)
+	}
+
+	return store
+}
+
+func (s *DualWriteTokenStore) write(op string, fn func(store oauth2.TokenStore) error) error {
+	if err := fn(s.primary); err != nil {
+		return err
+	}
+	if err := fn(s.secondary); err != nil {
+		s.logger.Printf("Error while running %s on secondary token store: %+v", op, err)
+	}
+	return nil
+}
+
+func (s *DualWriteTokenStore) read(fn func(store oauth2.TokenStore) (oauth2.TokenInfo, error)) (oauth2.TokenInfo, error) {
+	info, err := fn(s.primary)
+	if s.readFallback && isNotFound(info, err) {
+		return fn(s.secondary)
+	}
+	return info, err
+}
+
+// Create creates and stores the new token information in both stores
+func (s *DualWriteTokenStore) Create(info oauth2.TokenInfo) error {
+	return s.write("Create", func(store oauth2.TokenStore) error {
+		return store.Create(info)
+	})
+}
+
+// RemoveByCode deletes the authorization code from both stores
+func (s *DualWriteTokenStore) RemoveByCode(code string) error {
+	return s.write("RemoveByCode", func(store oauth2.TokenStore) error {
+		return store.RemoveByCode(code)
+	})
+}
+
+// RemoveByAccess uses the access token to delete the token information from both stores
+func (s *DualWriteTokenStore) RemoveByAccess(access string) error {
+	return s.write("RemoveByAccess", func(store oauth2.TokenStore) error {
+		return store.RemoveByAccess(access)
+	})
+}
+
+// RemoveByRefresh uses the refresh token to delete the token information from both stores
+func (s *DualWriteTokenStore) RemoveByRefresh(refresh string) error {
+	return s.write("RemoveByRefresh", func(store oauth2.TokenStore) error {
+		return store.RemoveByRefresh(refresh)
+	})
+}
+
+// GetByCode uses the authorization code for token information data
+func (s *DualWriteTokenStore) GetByCode(code string) (oauth2.TokenInfo, error) {
+	return s.read(func(store oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return store.GetByCode(code)
+	})
+}
+
+// GetByAccess uses the access token for token information data
+func (s *DualWriteTokenStore) GetByAccess(access string) (oauth2.TokenInfo, error) {
+	return s.read(func(store oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return store.GetByAccess(access)
+	})
+}
+
+// GetByRefresh uses the refresh token for token information data
+func (s *DualWriteTokenStore) GetByRefresh(refresh string) (oauth2.TokenInfo, error) {
+	return s.read(func(store oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return store.GetByRefresh(refresh)
+	})
+}
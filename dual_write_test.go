@@ -0,0 +1,99 @@
+package pg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+type memoryTokenStore struct {
+	tokens    map[string]oauth2.TokenInfo
+	createErr error
+	getErr    error
+}
+
+func newMemoryTokenStore() *memoryTokenStore {
+	return &memoryTokenStore{tokens: make(map[string]oauth2.TokenInfo)}
+}
+
+func (s *memoryTokenStore) Create(info oauth2.TokenInfo) error {
+	if s.createErr != nil {
+		return s.createErr
+	}
+	s.tokens[info.GetAccess()] = info
+	return nil
+}
+
+func (s *memoryTokenStore) RemoveByCode(code string) error {
+	return nil
+}
+
+func (s *memoryTokenStore) RemoveByAccess(access string) error {
+	delete(s.tokens, access)
+	return nil
+}
+
+func (s *memoryTokenStore) RemoveByRefresh(refresh string) error {
+	return nil
+}
+
+func (s *memoryTokenStore) GetByCode(code string) (oauth2.TokenInfo, error) {
+	return nil, pgadapter.ErrNoRows
+}
+
+func (s *memoryTokenStore) GetByAccess(access string) (oauth2.TokenInfo, error) {
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+	if info, ok := s.tokens[access]; ok {
+		return info, nil
+	}
+	return nil, pgadapter.ErrNoRows
+}
+
+func (s *memoryTokenStore) GetByRefresh(refresh string) (oauth2.TokenInfo, error) {
+	return nil, pgadapter.ErrNoRows
+}
+
+func TestDualWriteTokenStore(t *testing.T) {
+	primary, secondary := newMemoryTokenStore(), newMemoryTokenStore()
+	l := new(memoryLogger)
+	store := NewDualWriteTokenStore(primary, secondary, WithDualWriteTokenStoreLogger(l))
+
+	token := models.NewToken()
+	token.SetAccess("access")
+	require.NoError(t, store.Create(token))
+	assert.Equal(t, token, primary.tokens["access"])
+	assert.Equal(t, token, secondary.tokens["access"])
+
+	secondary.createErr = errors.New("secondary is down")
+	token2 := models.NewToken()
+	token2.SetAccess("access2")
+	require.NoError(t, store.Create(token2))
+	assert.Equal(t, 1, len(l.formats))
+
+	primary.createErr = errors.New("primary is down")
+	assert.Equal(t, primary.createErr, store.Create(token2))
+
+	// old token exists in the secondary store only
+	legacy := models.NewToken()
+	legacy.SetAccess("legacy")
+	secondary.tokens["legacy"] = legacy
+
+	_, err := store.GetByAccess("legacy")
+	assert.Equal(t, pgadapter.ErrNoRows, err)
+
+	store = NewDualWriteTokenStore(primary, secondary, WithDualWriteTokenStoreReadFallback())
+	info, err := store.GetByAccess("legacy")
+	require.NoError(t, err)
+	assert.Equal(t, legacy, info)
+
+	require.NoError(t, store.RemoveByAccess("access"))
+	assert.Nil(t, primary.tokens["access"])
+	assert.Nil(t, secondary.tokens["access"])
+}
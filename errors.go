@@ -0,0 +1,150 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx"
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+var (
+	// ErrTokenNotFound is returned when there is no such token
+	ErrTokenNotFound error = notFoundError("token not found")
+	// ErrTokenExpired is returned when the token is already expired
+	ErrTokenExpired = errors.New("token is expired")
+	// ErrClientNotFound is returned when there is no such client
+	ErrClientNotFound error = notFoundError("client not found")
+	// ErrClientAlreadyExists is returned when the client with the same id already exists
+	ErrClientAlreadyExists = errors.New("client already exists")
+
+	// ErrClientDisabled is returned when the requested client is disabled
+	ErrClientDisabled = errors.New("client is disabled")
+	// ErrClientExpired is returned when the requested client is expired
+	ErrClientExpired = errors.New("client is expired")
+	// ErrInvalidClientSecret is returned when the client secret does not match any of the valid client secrets
+	ErrInvalidClientSecret = errors.New("invalid client secret")
+	// ErrVersionConflict is returned when the client was changed since its version was read
+	ErrVersionConflict = errors.New("client version conflict")
+
+	// ErrRefreshReuseDetected is returned when already rotated refresh token is used again,
+	// the whole token family is revoked by then
+	ErrRefreshReuseDetected = errors.New("refresh token reuse detected")
+
+	// ErrEmptyTokenFilter is returned when the tokens filter without criteria is used for tokens removal
+	ErrEmptyTokenFilter = errors.New("tokens filter is empty")
+
+	// ErrConnectionLost is matched with errors.Is by the errors of the queries that lost the database connection,
+	// e.g. the server was restarted or failed over, the query may succeed once the connection is re-established
+	ErrConnectionLost = errors.New("database connection lost")
+	// ErrStoreBusy is matched with errors.Is by the errors of the queries that timed out waiting for the free
+	// connection of the exhausted pool, callers may shed the load instead of retrying
+	ErrStoreBusy = errors.New("store is busy")
+)
+
+// notFoundError is the not found error that errors.Is also matches with pgadapter.ErrNoRows,
+// so the code checking for the adapter error keeps working
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+func (e notFoundError) Is(target error) bool {
+	return target == pgadapter.ErrNoRows
+}
+
+// wrapNoRows wraps the adapter no rows error with the not found error, other errors are returned as is
+func wrapNoRows(err, notFound error) error {
+	if errors.Is(err, pgadapter.ErrNoRows) {
+		return fmt.Errorf("%w: %v", notFound, err)
+	}
+	return err
+}
+
+// driverError is the driver error classified as ErrConnectionLost or ErrStoreBusy,
+// errors.Is matches it with the class and errors.As with the driver error
+type driverError struct {
+	class error
+	err   error
+}
+
+func (e driverError) Error() string {
+	return fmt.Sprintf("%s: %v", e.class, e.err)
+}
+
+func (e driverError) Is(target error) bool {
+	return target == e.class
+}
+
+func (e driverError) Unwrap() error {
+	return e.err
+}
+
+// wrapDriverError wraps the connection lost and the pool acquisition timeout errors with driverError,
+// other errors are returned as is
+func wrapDriverError(err error) error {
+	if err == nil || errors.As(err, new(driverError)) {
+		return err
+	}
+	if errors.Is(err, pgx.ErrAcquireTimeout) {
+		return driverError{ErrStoreBusy, err}
+	}
+	if isConnectionLost(err) {
+		return driverError{ErrConnectionLost, err}
+	}
+	return err
+}
+
+// isConnectionLost checks if the driver error means the connection is lost: SQLSTATE class 08 connection exceptions,
+// server shutdown errors, closed connections and network errors. Timeouts and cancellations are not the lost
+// connection, so the slow query is not reported as the failover.
+func isConnectionLost(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if state := sqlState(err); state != "" {
+		return strings.HasPrefix(state, "08") || state == "57P01" || state == "57P02" || state == "57P03"
+	}
+
+	var opErr *net.OpError
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, pgx.ErrDeadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || (errors.As(err, &opErr) && !opErr.Timeout())
+}
+
+// uniqueViolation is the Postgres SQLSTATE of the unique constraint violation
+const uniqueViolation = "23505"
+
+// isUniqueViolation returns true if the driver error is the unique constraint violation
+func isUniqueViolation(err error) bool {
+	return sqlState(err) == uniqueViolation
+}
+
+// sqlState returns SQLSTATE of the first driver error in the chain or empty string. Drivers are not required
+// by the package, so the SQLSTATE is taken either from the SQLState method (pgconn, lib/pq) or from the Code
+// string field (pgx.PgError, pq.Error).
+func sqlState(err error) string {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if withState, ok := err.(interface{ SQLState() string }); ok {
+			return withState.SQLState()
+		}
+
+		v := reflect.ValueOf(err)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		if code := v.FieldByName("Code"); code.IsValid() && code.Kind() == reflect.String {
+			return code.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package pg
+
+import (
+	"io"
+
+	"github.com/json-iterator/go"
+	"gopkg.in/oauth2.v3"
+)
+
+// ExportFormat is the store contents export format
+type ExportFormat int
+
+// Supported export formats
+const (
+	// ExportJSONLines exports every entry as JSON object on a separate line
+	ExportJSONLines ExportFormat = iota
+	// ExportJSONLinesRedacted is the same as ExportJSONLines, but token values and client secrets are redacted
+	ExportJSONLinesRedacted
+)
+
+const redacted = "[REDACTED]"
+
+func redactToken(info oauth2.TokenInfo) {
+	if info.GetCode() != "" {
+		info.SetCode(redacted)
+	}
+	if info.GetAccess() != "" {
+		info.SetAccess(redacted)
+	}
+	if info.GetRefresh() != "" {
+		info.SetRefresh(redacted)
+	}
+}
+
+func writeJSONLine(w io.Writer, v interface{}) error {
+	data, err := jsoniter.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
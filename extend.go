@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExtendAccess extends the access token lifetime by d in place, both the row expiration and the serialized token
+// are updated with the single statement, e.g. for the sliding sessions. ErrTokenNotFound is returned when there is
+// no such access token and ErrTokenExpired is returned when it is already expired. Tokens without the expiration
+// are left as they are.
+func (s *TokenStore) ExtendAccess(access string, d time.Duration) (err error) {
+	defer s.reportError("ExtendAccess", &err)
+
+	return s.extend(context.Background(), TokenKindAccess, access, d)
+}
+
+// ExtendRefresh extends the refresh token lifetime by d in place the same way ExtendAccess does
+func (s *TokenStore) ExtendRefresh(refresh string, d time.Duration) (err error) {
+	defer s.reportError("ExtendRefresh", &err)
+
+	return s.extend(context.Background(), TokenKindRefresh, refresh, d)
+}
+
+// tokenLifetimeFields are the serialized token created at and expires in fields of the token kinds
+var tokenLifetimeFields = map[TokenKind][2]string{
+	TokenKindAccess:  {"AccessCreateAt", "AccessExpiresIn"},
+	TokenKindRefresh: {"RefreshCreateAt", "RefreshExpiresIn"},
+}
+
+func (s *TokenStore) extend(ctx context.Context, kind TokenKind, value string, d time.Duration) error {
+	switch {
+	case value == "":
+		return ErrTokenNotFound
+	case d <= 0:
+		return fmt.Errorf("token lifetime extension must be positive, got %s", d)
+	case s.compressor != nil:
+		// compressed token data can not be updated by the database
+		return errors.New("token lifetime extension is not supported with token data compression")
+	case s.hypertableChunk > 0:
+		// expiration is the hypertable time column, rows can not move between the chunks
+		return errors.New("token lifetime extension is not supported with hypertable")
+	}
+
+	column := string(kind)
+	createdAt, expiresIn := fmt.Sprintf("(data->>'%s')::timestamptz", tokenLifetimeFields[kind][0]), fmt.Sprintf("(data->>'%s')::bigint", tokenLifetimeFields[kind][1])
+	if s.columnsStorage {
+		createdAt, expiresIn = column+"_created_at", column+"_expires_in"
+	}
+	// expires in is stored in nanoseconds, timestamps are shifted by the interval in microseconds
+	shift := "$3::bigint * interval '1 microsecond'"
+	extended := expiresIn + " <> 0"
+
+	payload := fmt.Sprintf("data = CASE WHEN %[1]s THEN jsonb_set(data, '{%[2]s}', to_jsonb(%[3]s + $2)) ELSE data END", extended, tokenLifetimeFields[kind][1], expiresIn)
+	if s.columnsStorage {
+		payload = fmt.Sprintf("%[1]s = CASE WHEN %[2]s THEN %[1]s + $2 ELSE 0 END", expiresIn, extended)
+	}
+
+	// rows expire with the refresh token unless they have none or the split store table expires them by own kind
+	expiresAt := extended
+	switch {
+	case s.expiryKind != "" && s.expiryKind != kind:
+		expiresAt = ""
+	case s.expiryKind == "" && kind == TokenKindAccess:
+		expiresAt += " AND refresh = ''"
+	}
+
+	set := payload
+	if expiresAt != "" {
+		set += fmt.Sprintf(", expires_at = CASE WHEN %s THEN expires_at + %s ELSE expires_at END", expiresAt, shift)
+	}
+	if s.accessExpiration && kind == TokenKindAccess {
+		set += ", access_expires_at = access_expires_at + " + shift
+	}
+
+	condition := fmt.Sprintf("%s AND (%s = 0 OR %s + %s / 1000 * interval '1 microsecond' > $4)", s.lookupCondition(column), expiresIn, createdAt, expiresIn)
+	if s.refreshReuseDetection {
+		condition += " AND consumed_at IS NULL"
+	}
+
+	var item struct {
+		Extended bool `db:"extended"`
+	}
+	err := s.selectOne(ctx, &item, fmt.Sprintf("UPDATE %s SET %s, updated_at = $4 WHERE %s RETURNING TRUE AS extended", s.tableName, set, condition),
+		s.lookupArg(value), int64(d), int64(d/time.Microsecond), s.clock.Now())
+	if !errors.Is(err, ErrTokenNotFound) {
+		return err
+	}
+	return s.expiredOrNotFound(ctx, column, value)
+}
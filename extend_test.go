@@ -0,0 +1,64 @@
+package pg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+func TestTokenStore_ExtendAccess(t *testing.T) {
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreClock(clock), WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	require.NoError(t, store.ExtendAccess("access", time.Hour))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, `UPDATE tokens SET data = CASE WHEN (data->>'AccessExpiresIn')::bigint <> 0 THEN jsonb_set(data, '{AccessExpiresIn}', to_jsonb((data->>'AccessExpiresIn')::bigint + $2)) ELSE data END, `+
+		`expires_at = CASE WHEN (data->>'AccessExpiresIn')::bigint <> 0 AND refresh = '' THEN expires_at + $3::bigint * interval '1 microsecond' ELSE expires_at END, updated_at = $4 `+
+		`WHERE access = $1 AND ((data->>'AccessExpiresIn')::bigint = 0 OR (data->>'AccessCreateAt')::timestamptz + (data->>'AccessExpiresIn')::bigint / 1000 * interval '1 microsecond' > $4) RETURNING TRUE AS extended`, adapter.selectOneCalls[0].query)
+	assert.Equal(t, []interface{}{"access", int64(time.Hour), int64(time.Hour / time.Microsecond), clock.now}, adapter.selectOneCalls[0].args)
+
+	require.NoError(t, store.ExtendRefresh("refresh", time.Hour))
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[1].query, ", expires_at = CASE WHEN (data->>'RefreshExpiresIn')::bigint <> 0 THEN expires_at + ")
+
+	assert.EqualError(t, store.ExtendAccess("access", 0), "token lifetime extension must be positive, got 0s")
+	assert.Equal(t, ErrTokenNotFound, store.ExtendAccess("", time.Hour))
+
+	// columns storage updates the expires in column
+	adapter.selectOneCalls = nil
+	store, err = NewTokenStore(adapter, WithTokenStoreColumnsStorage(), WithTokenStoreAccessExpiration(), WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	require.NoError(t, store.ExtendAccess("access", time.Hour))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.True(t, strings.HasPrefix(adapter.selectOneCalls[0].query, "UPDATE tokens SET access_expires_in = CASE WHEN access_expires_in <> 0 THEN access_expires_in + $2 ELSE 0 END, "), adapter.selectOneCalls[0].query)
+	assert.Contains(t, adapter.selectOneCalls[0].query, ", access_expires_at = access_expires_at + $3::bigint * interval '1 microsecond', ")
+	assert.Contains(t, adapter.selectOneCalls[0].query, "access_created_at + access_expires_in / 1000 * interval '1 microsecond' > $4")
+
+	store, err = NewTokenStore(adapter, WithTokenStoreCompression(GzipCompressor{}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.EqualError(t, store.ExtendAccess("access", time.Hour), "token lifetime extension is not supported with token data compression")
+}
+
+func TestTokenStore_ExtendAccess_expired(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if strings.HasPrefix(query, "SELECT TRUE AS expired") && args[0] == "expired" {
+			return nil
+		}
+		return pgadapter.ErrNoRows
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrTokenExpired, store.ExtendAccess("expired", time.Hour))
+	assert.True(t, errors.Is(store.ExtendRefresh("unknown", time.Hour), ErrTokenNotFound))
+}
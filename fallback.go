@@ -0,0 +1,158 @@
+package pg
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3"
+)
+
+// FallbackTokenStore is the migration token store that chains the primary store with the fallback ones, e.g. the
+// legacy storage. Tokens are created in the primary store and looked up in the chain order until found, so the tokens
+// issued before the migration keep working while the new tokens never reach the fallback stores.
+// Read-only stores, e.g. the cache, may be looked up before the primary one, see WithFallbackTokenStoreCaches.
+type FallbackTokenStore struct {
+	caches    []oauth2.TokenStore
+	primary   oauth2.TokenStore
+	fallbacks []oauth2.TokenStore
+	logger    Logger
+
+	promotion bool
+}
+
+// FallbackTokenStoreOption is the configuration options type for fallback token store
+type FallbackTokenStoreOption func(s *FallbackTokenStore)
+
+// WithFallbackTokenStoreLogger returns option that sets fallback token store logger implementation
+func WithFallbackTokenStoreLogger(logger Logger) FallbackTokenStoreOption {
+	return func(s *FallbackTokenStore) {
+		s.logger = logger
+	}
+}
+
+// WithFallbackTokenStoreCaches returns option that sets the read-only stores looked up in the given order before
+// the primary one, e.g. cache → primary → legacy storage. Tokens are never created in the caches, they are only
+// removed from them, and the tokens found in the caches are not promoted. Cache lookup errors are logged only.
+func WithFallbackTokenStoreCaches(caches ...oauth2.TokenStore) FallbackTokenStoreOption {
+	return func(s *FallbackTokenStore) {
+		s.caches = caches
+	}
+}
+
+// WithFallbackTokenStorePromotion returns option that copies the tokens found in the fallback stores to the primary one,
+// so the following lookups of the same token do not reach the fallback stores. Promotion errors are logged only.
+func WithFallbackTokenStorePromotion() FallbackTokenStoreOption {
+	return func(s *FallbackTokenStore) {
+		s.promotion = true
+	}
+}
+
+// NewFallbackTokenStore creates fallback token store instance, fallback stores are looked up in the given order
+func NewFallbackTokenStore(primary oauth2.TokenStore, fallbacks []oauth2.TokenStore, options ...FallbackTokenStoreOption) *FallbackTokenStore {
+	store := &FallbackTokenStore{
+		primary:   primary,
+		fallbacks: fallbacks,
+		logger:    log.New(os.Stderr, "[OAUTH2-PG-ERROR]", log.LstdFlags),
+	}
+
+	for _, o := range options {
+		o(store)
+	}
+
+	return store
+}
+
+// remove runs the removal on all the stores, so the removed token can not be found in any of them,
+// the first error is returned after all the stores are tried
+func (s *FallbackTokenStore) remove(fn func(store oauth2.TokenStore) error) error {
+	err := fn(s.primary)
+	for _, store := range append(append([]oauth2.TokenStore{}, s.caches...), s.fallbacks...) {
+		if storeErr := fn(store); err == nil {
+			err = storeErr
+		}
+	}
+	return err
+}
+
+func (s *FallbackTokenStore) read(fn func(store oauth2.TokenStore) (oauth2.TokenInfo, error)) (oauth2.TokenInfo, error) {
+	// caches are never the source of truth, so the primary store is looked up on the cache errors as well
+	for i, store := range s.caches {
+		info, err := fn(store)
+		if err == nil && info != nil {
+			return info, nil
+		}
+		if err != nil && !errors.Is(err, pgadapter.ErrNoRows) {
+			s.logger.Printf("Error while reading token from cache token store %d: %+v", i, err)
+		}
+	}
+
+	info, err := fn(s.primary)
+
+	for i, store := range s.fallbacks {
+		if !isNotFound(info, err) {
+			break
+		}
+
+		info, err = fn(store)
+		if s.promotion && err == nil && info != nil {
+			if promoteErr := s.primary.Create(info); promoteErr != nil {
+				s.logger.Printf("Error while promoting token from fallback token store %d: %+v", i, promoteErr)
+			}
+		}
+	}
+	return info, err
+}
+
+// isNotFound returns true if the token lookup found nothing, some stores return nil token instead of the error
+func isNotFound(info oauth2.TokenInfo, err error) bool {
+	return errors.Is(err, pgadapter.ErrNoRows) || (err == nil && info == nil)
+}
+
+// Create creates and stores the new token information in the primary store
+func (s *FallbackTokenStore) Create(info oauth2.TokenInfo) error {
+	return s.primary.Create(info)
+}
+
+// RemoveByCode deletes the authorization code from all the stores
+func (s *FallbackTokenStore) RemoveByCode(code string) error {
+	return s.remove(func(store oauth2.TokenStore) error {
+		return store.RemoveByCode(code)
+	})
+}
+
+// RemoveByAccess uses the access token to delete the token information from all the stores
+func (s *FallbackTokenStore) RemoveByAccess(access string) error {
+	return s.remove(func(store oauth2.TokenStore) error {
+		return store.RemoveByAccess(access)
+	})
+}
+
+// RemoveByRefresh uses the refresh token to delete the token information from all the stores
+func (s *FallbackTokenStore) RemoveByRefresh(refresh string) error {
+	return s.remove(func(store oauth2.TokenStore) error {
+		return store.RemoveByRefresh(refresh)
+	})
+}
+
+// GetByCode uses the authorization code for token information data
+func (s *FallbackTokenStore) GetByCode(code string) (oauth2.TokenInfo, error) {
+	return s.read(func(store oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return store.GetByCode(code)
+	})
+}
+
+// GetByAccess uses the access token for token information data
+func (s *FallbackTokenStore) GetByAccess(access string) (oauth2.TokenInfo, error) {
+	return s.read(func(store oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return store.GetByAccess(access)
+	})
+}
+
+// GetByRefresh uses the refresh token for token information data
+func (s *FallbackTokenStore) GetByRefresh(refresh string) (oauth2.TokenInfo, error) {
+	return s.read(func(store oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return store.GetByRefresh(refresh)
+	})
+}
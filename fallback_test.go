@@ -0,0 +1,117 @@
+package pg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestFallbackTokenStore(t *testing.T) {
+	primary, cache, legacy := newMemoryTokenStore(), newMemoryTokenStore(), newMemoryTokenStore()
+	store := NewFallbackTokenStore(primary, []oauth2.TokenStore{cache, legacy})
+
+	token := models.NewToken()
+	token.SetAccess("access")
+	require.NoError(t, store.Create(token))
+	assert.Equal(t, token, primary.tokens["access"])
+	assert.Equal(t, 0, len(cache.tokens))
+	assert.Equal(t, 0, len(legacy.tokens))
+
+	// old token exists in the last fallback store only
+	old := models.NewToken()
+	old.SetAccess("old")
+	legacy.tokens["old"] = old
+
+	info, err := store.GetByAccess("old")
+	require.NoError(t, err)
+	assert.Equal(t, old, info)
+	assert.Nil(t, primary.tokens["old"])
+
+	_, err = store.GetByAccess("unknown")
+	assert.Equal(t, pgadapter.ErrNoRows, err)
+
+	// removed token can not be found in any of the stores
+	cache.tokens["access"] = token
+	require.NoError(t, store.RemoveByAccess("access"))
+	assert.Nil(t, primary.tokens["access"])
+	assert.Nil(t, cache.tokens["access"])
+	_, err = store.GetByAccess("access")
+	assert.Equal(t, pgadapter.ErrNoRows, err)
+}
+
+func TestFallbackTokenStore_promotion(t *testing.T) {
+	primary, legacy := newMemoryTokenStore(), newMemoryTokenStore()
+	l := new(memoryLogger)
+	store := NewFallbackTokenStore(primary, []oauth2.TokenStore{legacy}, WithFallbackTokenStorePromotion(), WithFallbackTokenStoreLogger(l))
+
+	old := models.NewToken()
+	old.SetAccess("old")
+	legacy.tokens["old"] = old
+
+	info, err := store.GetByAccess("old")
+	require.NoError(t, err)
+	assert.Equal(t, old, info)
+	assert.Equal(t, old, primary.tokens["old"])
+
+	// promotion errors do not fail the lookup
+	primary.createErr = errors.New("primary is down")
+	older := models.NewToken()
+	older.SetAccess("older")
+	legacy.tokens["older"] = older
+
+	info, err = store.GetByAccess("older")
+	require.NoError(t, err)
+	assert.Equal(t, older, info)
+	assert.Equal(t, 1, len(l.formats))
+}
+
+func TestFallbackTokenStore_caches(t *testing.T) {
+	cache, primary, legacy := newMemoryTokenStore(), newMemoryTokenStore(), newMemoryTokenStore()
+	l := new(memoryLogger)
+	store := NewFallbackTokenStore(primary, []oauth2.TokenStore{legacy}, WithFallbackTokenStoreCaches(cache), WithFallbackTokenStorePromotion(), WithFallbackTokenStoreLogger(l))
+
+	// new tokens are created in the primary store only
+	token := models.NewToken()
+	token.SetAccess("access")
+	require.NoError(t, store.Create(token))
+	assert.Equal(t, token, primary.tokens["access"])
+	assert.Equal(t, 0, len(cache.tokens))
+
+	// cache is looked up before the primary store
+	cached := models.NewToken()
+	cached.SetAccess("access")
+	cache.tokens["access"] = cached
+	info, err := store.GetByAccess("access")
+	require.NoError(t, err)
+	assert.True(t, cached == info)
+
+	// tokens missing in the cache are read from the chain, promoted to the primary store only
+	old := models.NewToken()
+	old.SetAccess("old")
+	legacy.tokens["old"] = old
+	info, err = store.GetByAccess("old")
+	require.NoError(t, err)
+	assert.Equal(t, old, info)
+	assert.Equal(t, old, primary.tokens["old"])
+	assert.Nil(t, cache.tokens["old"])
+	assert.Equal(t, 0, len(l.formats))
+
+	// failing cache is logged and skipped
+	cache.getErr = errors.New("cache is down")
+	info, err = store.GetByAccess("old")
+	require.NoError(t, err)
+	assert.Equal(t, old, info)
+	assert.Equal(t, 1, len(l.formats))
+	cache.getErr = nil
+
+	require.NoError(t, store.RemoveByAccess("access"))
+	assert.Nil(t, cache.tokens["access"])
+	assert.Nil(t, primary.tokens["access"])
+	_, err = store.GetByAccess("access")
+	assert.Equal(t, pgadapter.ErrNoRows, err)
+}
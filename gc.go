@@ -0,0 +1,109 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// GCStrategy runs token store garbage collection, clean removes expired tokens from the store
+type GCStrategy interface {
+	Start(clean func())
+	Stop()
+}
+
+// TickerGCStrategy is the default GCStrategy that runs garbage collection with the fixed interval
+type TickerGCStrategy struct {
+	Interval time.Duration
+
+	ticker   *time.Ticker
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Start starts garbage collection goroutine
+func (g *TickerGCStrategy) Start(clean func()) {
+	g.ticker = time.NewTicker(g.Interval)
+	g.stop, g.done = make(chan struct{}), make(chan struct{})
+	go func(ticker *time.Ticker, stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				clean()
+			}
+		}
+	}(g.ticker, g.stop, g.done)
+}
+
+// Stop stops garbage collection ticker and goroutine, the running pass is finished first
+func (g *TickerGCStrategy) Stop() {
+	g.stopOnce.Do(func() {
+		if g.ticker != nil {
+			g.ticker.Stop()
+			close(g.stop)
+		}
+	})
+}
+
+// wait waits for the stopped garbage collection goroutine to exit or the context to be done
+func (g *TickerGCStrategy) wait(ctx context.Context) error {
+	if g.done == nil {
+		return nil
+	}
+	select {
+	case <-g.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// gcWaiter is the GCStrategy which goroutine is awaited by the store Drain after Stop
+type gcWaiter interface {
+	wait(ctx context.Context) error
+}
+
+// NoopGCStrategy is the GCStrategy that never cleans the store, e.g. when cleanup is handled by DBAs
+type NoopGCStrategy struct{}
+
+// Start does nothing
+func (NoopGCStrategy) Start(func()) {}
+
+// Stop does nothing
+func (NoopGCStrategy) Stop() {}
+
+// pgCronGCStrategy delegates garbage collection to the pg_cron job executed by the database server
+type pgCronGCStrategy struct {
+	store    *TokenStore
+	schedule string
+}
+
+// Start installs or updates pg_cron job named after the token table, errors are logged with the store logger
+func (g *pgCronGCStrategy) Start(func()) {
+	err := g.store.exec(
+		context.Background(),
+		"SELECT cron.schedule($1, $2, $3)",
+		fmt.Sprintf("oauth2_gc_%s", g.store.tableName),
+		g.schedule,
+		fmt.Sprintf("DELETE FROM %s WHERE %s", g.store.tableName, g.store.gcCondition(func(retention time.Duration) string {
+			return fmt.Sprintf("now() - interval '%d seconds'", int64(retention/time.Second))
+		})),
+	)
+	if err != nil {
+		g.store.logger.Printf("Error while scheduling pg_cron cleaning job: %+v", err)
+	}
+}
+
+// Stop keeps the job scheduled as the other store instances rely on it
+func (g *pgCronGCStrategy) Stop() {}
+
+// gcPGCron checks if garbage collection is delegated to the pg_cron job
+func (s *TokenStore) gcPGCron() bool {
+	_, ok := s.gcStrategy.(*pgCronGCStrategy)
+	return ok
+}
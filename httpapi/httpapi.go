@@ -0,0 +1,110 @@
+// Package httpapi provides http.Handler implementations of the OAuth 2.0 endpoints that work right on top
+// of the token and client stores: RFC 7009 token revocation and RFC 7662 token introspection.
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3"
+)
+
+// TokenStore is the token store used by the handlers, implemented by pg.TokenStore and pgmock.TokenStore
+type TokenStore interface {
+	GetByAccess(access string) (oauth2.TokenInfo, error)
+	GetByRefresh(refresh string) (oauth2.TokenInfo, error)
+	RemoveByAccess(access string) error
+	RemoveByRefresh(refresh string) error
+}
+
+// ClientStore is the client store used by the handlers for client authentication,
+// implemented by pg.ClientStore and pgmock.ClientStore
+type ClientStore interface {
+	ValidateSecret(id, secret string) (oauth2.ClientInfo, error)
+}
+
+// Token type hints defined by RFC 7009
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// errorResponse is the RFC 6749 error response
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// authenticateClient authenticates the client with HTTP Basic authentication or the request body credentials,
+// writes the error response and returns nil if the client is not authenticated
+func authenticateClient(w http.ResponseWriter, r *http.Request, clients ClientStore) oauth2.ClientInfo {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if id != "" {
+		// the reason is not reported to not disclose whether the client exists
+		if client, err := clients.ValidateSecret(id, secret); err == nil {
+			return client
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+	writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid_client"})
+	return nil
+}
+
+// parseForm checks the request method and parses the request body, writes the error response and returns false
+// if the request is not valid
+func parseForm(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "invalid_request", ErrorDescription: "POST method is required"})
+		return false
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", ErrorDescription: "malformed request body"})
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	// headers are already sent, so there is nothing to do with the error
+	_ = jsoniter.NewEncoder(w).Encode(v)
+}
+
+// lookupToken finds the token by its value trying the hinted type first, returns the found token info
+// and its type or nil if there is no such token or it is expired
+func lookupToken(tokens TokenStore, token, hint string) (oauth2.TokenInfo, string, error) {
+	types := []string{TokenTypeHintAccessToken, TokenTypeHintRefreshToken}
+	if hint == TokenTypeHintRefreshToken {
+		types[0], types[1] = types[1], types[0]
+	}
+
+	for _, typ := range types {
+		get := tokens.GetByAccess
+		if typ == TokenTypeHintRefreshToken {
+			get = tokens.GetByRefresh
+		}
+
+		info, err := get(token)
+		if errors.Is(err, pgadapter.ErrNoRows) || errors.Is(err, pg.ErrTokenExpired) || (err == nil && info == nil) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return info, typ, nil
+	}
+
+	return nil, "", nil
+}
@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+)
+
+// introspectionResponse is the RFC 7662 introspection response
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// IntrospectionHandler is the RFC 7662 token introspection endpoint handler
+type IntrospectionHandler struct {
+	tokens  TokenStore
+	clients ClientStore
+}
+
+// NewIntrospectionHandler creates token introspection endpoint handler, the caller is authenticated against
+// the client store
+func NewIntrospectionHandler(tokens TokenStore, clients ClientStore) *IntrospectionHandler {
+	return &IntrospectionHandler{tokens: tokens, clients: clients}
+}
+
+// ServeHTTP handles token introspection request
+func (h *IntrospectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !parseForm(w, r) {
+		return
+	}
+
+	if authenticateClient(w, r, h.clients) == nil {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", ErrorDescription: "token is required"})
+		return
+	}
+
+	info, typ, err := lookupToken(h.tokens, token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.response(info, typ))
+}
+
+func (h *IntrospectionHandler) response(info oauth2.TokenInfo, typ string) introspectionResponse {
+	if info == nil {
+		return introspectionResponse{}
+	}
+
+	createdAt, expiresIn, tokenType := info.GetAccessCreateAt(), info.GetAccessExpiresIn(), "Bearer"
+	if typ == TokenTypeHintRefreshToken {
+		createdAt, expiresIn, tokenType = info.GetRefreshCreateAt(), info.GetRefreshExpiresIn(), TokenTypeHintRefreshToken
+	}
+
+	resp := introspectionResponse{
+		Active:    true,
+		Scope:     info.GetScope(),
+		ClientID:  info.GetClientID(),
+		Subject:   info.GetUserID(),
+		TokenType: tokenType,
+		IssuedAt:  createdAt.Unix(),
+	}
+
+	// zero expiration means the token does not expire
+	if expiresIn > 0 {
+		expiresAt := createdAt.Add(expiresIn)
+		if !expiresAt.After(time.Now()) {
+			return introspectionResponse{}
+		}
+		resp.ExpiresAt = expiresAt.Unix()
+	}
+
+	return resp
+}
@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestIntrospectionHandler(t *testing.T) {
+	tokens, clients := newStores(t)
+	require.NoError(t, tokens.Create(&models.Token{
+		ClientID:        "c2",
+		Access:          "expired",
+		AccessCreateAt:  time.Now().Add(-2 * time.Hour),
+		AccessExpiresIn: time.Hour,
+	}))
+	h := NewIntrospectionHandler(tokens, clients)
+
+	w := postForm(h, url.Values{"token": {"access1"}}, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postForm(h, url.Values{"token": {"access1"}}, "c2", "secret2")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp introspectionResponse
+	require.NoError(t, jsoniter.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Active)
+	assert.Equal(t, "c1", resp.ClientID)
+	assert.Equal(t, "read", resp.Scope)
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.True(t, resp.ExpiresAt > time.Now().Unix())
+
+	w = postForm(h, url.Values{"token": {"refresh2"}, "token_type_hint": {"refresh_token"}}, "c1", "secret1")
+	require.Equal(t, http.StatusOK, w.Code)
+	resp = introspectionResponse{}
+	require.NoError(t, jsoniter.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Active)
+	assert.Equal(t, "refresh_token", resp.TokenType)
+
+	for _, token := range []string{"expired", "unknown"} {
+		w = postForm(h, url.Values{"token": {token}}, "c1", "secret1")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"active":false}`, w.Body.String())
+	}
+}
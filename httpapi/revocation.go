@@ -0,0 +1,63 @@
+package httpapi
+
+import "net/http"
+
+// RevocationHandler is the RFC 7009 token revocation endpoint handler
+type RevocationHandler struct {
+	tokens  TokenStore
+	clients ClientStore
+}
+
+// NewRevocationHandler creates token revocation endpoint handler, the caller is authenticated against
+// the client store and can revoke only the tokens issued to it
+func NewRevocationHandler(tokens TokenStore, clients ClientStore) *RevocationHandler {
+	return &RevocationHandler{tokens: tokens, clients: clients}
+}
+
+// ServeHTTP handles token revocation request
+func (h *RevocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !parseForm(w, r) {
+		return
+	}
+
+	client := authenticateClient(w, r, h.clients)
+	if client == nil {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", ErrorDescription: "token is required"})
+		return
+	}
+
+	info, typ, err := lookupToken(h.tokens, token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "server_error"})
+		return
+	}
+
+	// unknown tokens are not reported, the client can not do anything with them anyway
+	if info == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if info.GetClientID() != client.GetID() {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "unauthorized_client", ErrorDescription: "token was issued to another client"})
+		return
+	}
+
+	if err := h.remove(token, typ); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "server_error"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// remove deletes the token, refresh token removal revokes the access token issued with it as well
+func (h *RevocationHandler) remove(token, typ string) error {
+	if typ == TokenTypeHintRefreshToken {
+		return h.tokens.RemoveByRefresh(token)
+	}
+	return h.tokens.RemoveByAccess(token)
+}
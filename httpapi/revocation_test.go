@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"github.com/vgarvardt/go-oauth2-pg/pgmock"
+	"gopkg.in/oauth2.v3/models"
+)
+
+var (
+	_ TokenStore  = (*pg.TokenStore)(nil)
+	_ TokenStore  = (*pgmock.TokenStore)(nil)
+	_ ClientStore = (*pg.ClientStore)(nil)
+	_ ClientStore = (*pgmock.ClientStore)(nil)
+)
+
+func newStores(t *testing.T) (*pgmock.TokenStore, *pgmock.ClientStore) {
+	tokens := pgmock.NewTokenStore()
+	clients := pgmock.NewClientStore()
+	require.NoError(t, clients.Create(&models.Client{ID: "c1", Secret: "secret1"}))
+	require.NoError(t, clients.Create(&models.Client{ID: "c2", Secret: "secret2"}))
+
+	now := time.Now()
+	require.NoError(t, tokens.Create(&models.Token{ClientID: "c1", Scope: "read", Access: "access1", AccessCreateAt: now, AccessExpiresIn: time.Hour}))
+	require.NoError(t, tokens.Create(&models.Token{
+		ClientID:         "c1",
+		Access:           "access2",
+		AccessCreateAt:   now,
+		AccessExpiresIn:  time.Hour,
+		Refresh:          "refresh2",
+		RefreshCreateAt:  now,
+		RefreshExpiresIn: 24 * time.Hour,
+	}))
+	return tokens, clients
+}
+
+func postForm(h http.Handler, values url.Values, clientID, secret string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		r.SetBasicAuth(clientID, secret)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRevocationHandler(t *testing.T) {
+	tokens, clients := newStores(t)
+	h := NewRevocationHandler(tokens, clients)
+
+	w := postForm(h, url.Values{"token": {"access1"}}, "c1", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"invalid_client"`)
+
+	w = postForm(h, url.Values{"token": {"access1"}}, "c2", "secret2")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"unauthorized_client"`)
+	_, err := tokens.GetByAccess("access1")
+	require.NoError(t, err)
+
+	w = postForm(h, url.Values{}, "c1", "secret1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postForm(h, url.Values{"token": {"access1"}}, "c1", "secret1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err = tokens.GetByAccess("access1")
+	assert.Error(t, err)
+
+	// refresh token revocation revokes the access token as well, credentials are accepted in the body too
+	w = postForm(h, url.Values{"token": {"refresh2"}, "token_type_hint": {"refresh_token"}, "client_id": {"c1"}, "client_secret": {"secret1"}}, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err = tokens.GetByAccess("access2")
+	assert.Error(t, err)
+
+	// unknown tokens are not reported
+	w = postForm(h, url.Values{"token": {"unknown"}}, "c1", "secret1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+}
@@ -0,0 +1,34 @@
+package pg
+
+import (
+	"context"
+
+	"gopkg.in/oauth2.v3"
+)
+
+// TokenSource enumerates all tokens of another token store implementation, oauth2.TokenStore has no way
+// to list stored tokens, so every backend (Redis, MySQL, memory) needs its own iteration implementation
+type TokenSource interface {
+	ForEach(ctx context.Context, fn func(oauth2.TokenInfo) error) error
+}
+
+// TokenSourceFunc is the function type adapter for TokenSource
+type TokenSourceFunc func(ctx context.Context, fn func(oauth2.TokenInfo) error) error
+
+// ForEach calls f(ctx, fn)
+func (f TokenSourceFunc) ForEach(ctx context.Context, fn func(oauth2.TokenInfo) error) error {
+	return f(ctx, fn)
+}
+
+// ClientSource enumerates all clients of another client store implementation
+type ClientSource interface {
+	ForEach(ctx context.Context, fn func(oauth2.ClientInfo) error) error
+}
+
+// ClientSourceFunc is the function type adapter for ClientSource
+type ClientSourceFunc func(ctx context.Context, fn func(oauth2.ClientInfo) error) error
+
+// ForEach calls f(ctx, fn)
+func (f ClientSourceFunc) ForEach(ctx context.Context, fn func(oauth2.ClientInfo) error) error {
+	return f(ctx, fn)
+}
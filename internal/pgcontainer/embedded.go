@@ -0,0 +1,58 @@
+package pgcontainer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/fergusstrange/embedded-postgres"
+)
+
+// StartEmbedded starts PostgreSQL process from the binaries downloaded and cached by fergusstrange/embedded-postgres,
+// does not require docker. Instance runs on the free port with the data in the temporary directory.
+func StartEmbedded(ctx context.Context) (*Instance, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	runtimePath, err := ioutil.TempDir("", "oauth2-pg-")
+	if err != nil {
+		return nil, err
+	}
+
+	db := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V10).
+		Port(port).
+		Username(user).
+		Password(password).
+		Database(database).
+		RuntimePath(runtimePath))
+	if err := db.Start(); err != nil {
+		os.RemoveAll(runtimePath)
+		return nil, fmt.Errorf("could not start embedded postgres: %v", err)
+	}
+
+	return &Instance{
+		URI: fmt.Sprintf("postgres://%s:%s@localhost:%d/%s?sslmode=disable", user, password, port, database),
+		stop: func(ctx context.Context) error {
+			err := db.Stop()
+			if rmErr := os.RemoveAll(runtimePath); err == nil {
+				err = rmErr
+			}
+			return err
+		},
+	}, nil
+}
+
+func freePort() (uint32, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
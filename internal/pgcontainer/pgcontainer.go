@@ -0,0 +1,78 @@
+// Package pgcontainer starts disposable PostgreSQL instances for tests, it does not depend on the stores package
+// so it can be used by the stores own tests as well as by the pgtest harness.
+package pgcontainer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// DefaultImage is the PostgreSQL docker image started by default
+const DefaultImage = "postgres:10"
+
+const (
+	user     = "oauth2"
+	password = "oauth2"
+	database = "oauth2"
+)
+
+// Instance is the running disposable PostgreSQL instance
+type Instance struct {
+	// URI is the connection URI of the instance
+	URI string
+
+	stop func(ctx context.Context) error
+}
+
+// StartDocker starts PostgreSQL docker container from the image using testcontainers
+func StartDocker(ctx context.Context, image string) (*Instance, error) {
+	if image == "" {
+		image = DefaultImage
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        image,
+			ExposedPorts: []string{"5432/tcp"},
+			Env: map[string]string{
+				"POSTGRES_USER":     user,
+				"POSTGRES_PASSWORD": password,
+				"POSTGRES_DB":       database,
+			},
+			// postgres image restarts the server once after the initialization
+			WaitingFor: wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not start postgres container: %v", err)
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, err
+	}
+
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, err
+	}
+
+	return &Instance{
+		URI:  fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, password, host, port.Port(), database),
+		stop: container.Terminate,
+	}, nil
+}
+
+// Stop stops and removes the instance
+func (i *Instance) Stop(ctx context.Context) error {
+	return i.stop(ctx)
+}
@@ -0,0 +1,137 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+// lastUsedTracker collects the access token uses between the flushes, so the lookups do not write to the table
+type lastUsedTracker struct {
+	mu   sync.Mutex
+	uses map[string]time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// touch remembers the access token use, uses are recorded by the lookup column values
+func (s *TokenStore) touch(access string) {
+	if s.lastUsed == nil {
+		return
+	}
+
+	now := s.clock.Now()
+	s.lastUsed.mu.Lock()
+	defer s.lastUsed.mu.Unlock()
+	for _, value := range s.lookupValues(access) {
+		s.lastUsed.uses[value] = now
+	}
+}
+
+// runLastUsedFlush flushes the remembered uses every interval until the store is drained
+func (s *TokenStore) runLastUsedFlush() {
+	ticker := time.NewTicker(s.lastUsedInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.lastUsed.stop:
+			return
+		case <-ticker.C:
+			if err := s.flushLastUsed(context.Background()); err != nil {
+				s.logger.Printf("Error while flushing token last use times: %+v", err)
+			}
+		}
+	}
+}
+
+// stopLastUsedFlush stops the flushes and writes the uses remembered since the last one
+func (s *TokenStore) stopLastUsedFlush(ctx context.Context) {
+	if s.lastUsed == nil {
+		return
+	}
+
+	s.lastUsed.stopOnce.Do(func() { close(s.lastUsed.stop) })
+	if err := s.flushLastUsed(ctx); err != nil {
+		s.logger.Printf("Error while flushing token last use times: %+v", err)
+	}
+}
+
+// flushLastUsed writes the remembered uses with the single statement, uses are remembered again
+// for the next flush if it fails
+func (s *TokenStore) flushLastUsed(ctx context.Context) error {
+	s.lastUsed.mu.Lock()
+	uses := s.lastUsed.uses
+	s.lastUsed.uses = make(map[string]time.Time, len(uses))
+	s.lastUsed.mu.Unlock()
+
+	if len(uses) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(uses))
+	for value, usedAt := range uses {
+		values[value] = usedAt.Format(time.RFC3339Nano)
+	}
+	buf, err := jsoniter.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	err = s.exec(ctx, fmt.Sprintf(`
+UPDATE %s AS t SET last_used_at = u.value::timestamptz FROM jsonb_each_text($1::jsonb) AS u
+WHERE t.access = u.key AND (t.last_used_at IS NULL OR t.last_used_at < u.value::timestamptz)`, s.tableName), string(buf))
+	if err == nil || errors.Is(err, pgadapter.ErrNoRows) {
+		return nil
+	}
+
+	s.lastUsed.mu.Lock()
+	defer s.lastUsed.mu.Unlock()
+	for value, usedAt := range uses {
+		if usedAt.After(s.lastUsed.uses[value]) {
+			s.lastUsed.uses[value] = usedAt
+		}
+	}
+	return err
+}
+
+// lastUsedDDL returns idle tokens index creation statement if the last use tracking is enabled
+func (s *TokenStore) lastUsedDDL() string {
+	if s.lastUsedInterval == 0 {
+		return ""
+	}
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_last_used_at ON %[1]s (COALESCE(last_used_at, created_at)) WHERE code = '';\n", s.tableName)
+}
+
+// RemoveIdleSince deletes the access and refresh tokens that were not used by GetByAccess for the idle duration,
+// tokens that were never used are idle since they were created. Uses remembered since the last flush are written
+// first, so the recently used tokens are not removed. Requires WithTokenStoreLastUsed option.
+func (s *TokenStore) RemoveIdleSince(idle time.Duration) (_ int64, err error) {
+	defer s.reportError("RemoveIdleSince", &err)
+
+	switch {
+	case s.lastUsed == nil:
+		return 0, errors.New("RemoveIdleSince requires last use tracking")
+	case idle <= 0:
+		return 0, fmt.Errorf("idle duration must be positive, got %s", idle)
+	}
+
+	ctx := context.Background()
+	if err := s.flushLastUsed(ctx); err != nil {
+		return 0, err
+	}
+
+	var item struct {
+		Count int64 `db:"count"`
+	}
+	err = s.selectOne(ctx, &item, fmt.Sprintf(
+		"WITH deleted AS (DELETE FROM %s WHERE code = '' AND COALESCE(last_used_at, created_at) <= $1 RETURNING 1) SELECT count(*) AS count FROM deleted",
+		s.tableName), s.clock.Now().Add(-idle))
+	return item.Count, err
+}
@@ -0,0 +1,88 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestWithTokenStoreLastUsed(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	data, err := jsoniter.Marshal(&models.Token{Access: "access", AccessCreateAt: clock.now, AccessExpiresIn: time.Hour})
+	require.NoError(t, err)
+
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if item, ok := dst.(*tokenDataItem); ok {
+			item.Data = data
+		}
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreLastUsed(time.Hour), WithTokenStoreClock(clock), WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Contains(t, store.tableDDL(), "last_used_at TIMESTAMPTZ")
+	assert.Contains(t, store.tableDDL(), "CREATE INDEX IF NOT EXISTS idx_tokens_last_used_at ON tokens (COALESCE(last_used_at, created_at)) WHERE code = '';")
+
+	// lookups do not write until the flush
+	_, err = store.GetByAccess("access")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(adapter.execCalls))
+
+	// remembered uses are flushed before the idle tokens are removed
+	_, err = store.RemoveIdleSince(30 * time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "UPDATE tokens AS t SET last_used_at = u.value::timestamptz FROM jsonb_each_text($1::jsonb) AS u")
+	assert.Equal(t, []interface{}{`{"access":"2019-03-01T12:00:00Z"}`}, adapter.execCalls[0].args)
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Equal(t, "WITH deleted AS (DELETE FROM tokens WHERE code = '' AND COALESCE(last_used_at, created_at) <= $1 RETURNING 1) SELECT count(*) AS count FROM deleted", adapter.selectOneCalls[1].query)
+	assert.Equal(t, []interface{}{clock.now.Add(-30 * time.Minute)}, adapter.selectOneCalls[1].args)
+
+	// nothing to flush
+	_, err = store.RemoveIdleSince(30 * time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(adapter.execCalls))
+
+	// uses remembered since the last flush are written on drain
+	_, err = store.GetByAccess("access")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+	assert.Equal(t, 2, len(adapter.execCalls))
+
+	_, err = NewTokenStore(adapter, WithTokenStoreLastUsed(-time.Second), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: last used flush interval must not be negative, got -1s")
+}
+
+func TestTokenStore_flushLastUsed(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		return errors.New("connection refused")
+	}
+
+	keys := []TokenHashKey{{ID: "k2", Key: []byte("secret2")}, {ID: "k1", Key: []byte("secret1")}}
+	store, err := NewTokenStore(adapter, WithTokenStoreLastUsed(time.Hour), WithTokenStoreHMACLookups(keys...), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	// token may be stored with the digest of any of the rotated keys
+	store.touch("access")
+	assert.Equal(t, 2, len(store.lastUsed.uses))
+
+	// failed flush keeps the uses for the next one
+	assert.EqualError(t, store.flushLastUsed(context.Background()), "connection refused")
+	assert.Equal(t, 2, len(store.lastUsed.uses))
+
+	_, err = store.RemoveIdleSince(0)
+	assert.EqualError(t, err, "idle duration must be positive, got 0s")
+
+	store, err = NewTokenStore(adapter, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	_, err = store.RemoveIdleSince(time.Hour)
+	assert.EqualError(t, err, "RemoveIdleSince requires last use tracking")
+}
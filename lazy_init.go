@@ -0,0 +1,66 @@
+package pg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+// lazyInitKey marks the context of the store initialization queries, so they are not deferred themselves
+type lazyInitKey struct{}
+
+// lazyInitAdapter is the adapter that runs the store initialization before the first query. Failed initialization
+// is run again before the next query, so the store recovers once the database becomes available.
+type lazyInitAdapter struct {
+	adapter pgadapter.Adapter
+	init    func(ctx context.Context) error
+
+	done uint32
+	mu   sync.Mutex
+}
+
+func newLazyInitAdapter(adapter pgadapter.Adapter, init func(ctx context.Context) error) *lazyInitAdapter {
+	return &lazyInitAdapter{adapter: adapter, init: init}
+}
+
+func (a *lazyInitAdapter) ensureInit(ctx context.Context) error {
+	if atomic.LoadUint32(&a.done) == 1 || ctx.Value(lazyInitKey{}) != nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.done == 1 {
+		return nil
+	}
+	if err := a.init(context.WithValue(ctx, lazyInitKey{}, true)); err != nil {
+		return err
+	}
+	atomic.StoreUint32(&a.done, 1)
+	return nil
+}
+
+func (a *lazyInitAdapter) Exec(query string, args ...interface{}) error {
+	return a.ExecContext(context.Background(), query, args...)
+}
+
+func (a *lazyInitAdapter) SelectOne(dst interface{}, query string, args ...interface{}) error {
+	return a.SelectOneContext(context.Background(), dst, query, args...)
+}
+
+func (a *lazyInitAdapter) ExecContext(ctx context.Context, query string, args ...interface{}) error {
+	if err := a.ensureInit(ctx); err != nil {
+		return err
+	}
+	return execContext(ctx, a.adapter, query, args...)
+}
+
+func (a *lazyInitAdapter) SelectOneContext(ctx context.Context, dst interface{}, query string, args ...interface{}) error {
+	if err := a.ensureInit(ctx); err != nil {
+		return err
+	}
+	return selectOneContext(ctx, a.adapter, dst, query, args...)
+}
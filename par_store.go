@@ -0,0 +1,154 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+// PARRequestURIPrefix is the prefix of the request_uri values generated by PARStore
+const PARRequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PARStore PostgreSQL RFC 9126 pushed authorization requests store,
+// every pushed request can be consumed only once
+type PARStore struct {
+	adapter   pgadapter.Adapter
+	tableName string
+	logger    Logger
+	clock     Clock
+
+	requestLifetime time.Duration
+
+	gcDisabled bool
+	gcInterval time.Duration
+	gcStrategy GCStrategy
+
+	initTableDisabled bool
+}
+
+// NewPARStore creates PostgreSQL pushed authorization requests store instance
+func NewPARStore(adapter pgadapter.Adapter, options ...PARStoreOption) (*PARStore, error) {
+	store := &PARStore{
+		adapter:         adapter,
+		tableName:       "oauth2_pushed_requests",
+		logger:          log.New(os.Stderr, "[OAUTH2-PG-ERROR]", log.LstdFlags),
+		clock:           systemClock{},
+		requestLifetime: time.Minute,
+		gcInterval:      time.Minute,
+	}
+
+	for _, o := range options {
+		o(store)
+	}
+
+	if err := store.validate(); err != nil {
+		return nil, err
+	}
+
+	if !store.initTableDisabled {
+		if err := store.initTable(); err != nil {
+			return store, err
+		}
+	}
+
+	if !store.gcDisabled {
+		store.gcStrategy = &TickerGCStrategy{Interval: store.gcInterval}
+		store.gcStrategy.Start(store.clean)
+	}
+
+	return store, nil
+}
+
+func (s *PARStore) validate() error {
+	var problem string
+	switch {
+	case s.tableName == "":
+		problem = "empty table name"
+	case s.requestLifetime <= 0:
+		problem = fmt.Sprintf("request lifetime must be positive, got %s", s.requestLifetime)
+	case s.gcInterval <= 0:
+		problem = fmt.Sprintf("GC interval must be positive, got %s", s.gcInterval)
+	default:
+		return nil
+	}
+
+	return fmt.Errorf("invalid PAR store configuration: %s", problem)
+}
+
+func (s *PARStore) initTable() error {
+	return s.adapter.Exec(lockedDDL(s.tableName, createTableDDL(s.tableName, "request_uri", parTableColumns, "")+
+		fmt.Sprintf("\nCREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s (expires_at);\n", s.tableName)))
+}
+
+// parTableColumns are the pushed authorization requests table columns
+var parTableColumns = []tableColumn{
+	{"request_uri", "TEXT", "NOT NULL"},
+	{"client_id", "TEXT", "NOT NULL"},
+	{"created_at", "TIMESTAMPTZ", "NOT NULL"},
+	{"expires_at", "TIMESTAMPTZ", "NOT NULL"},
+	{"data", "BYTEA", "NOT NULL"},
+}
+
+// Close stops garbage collection
+func (s *PARStore) Close() error {
+	if !s.gcDisabled {
+		s.gcStrategy.Stop()
+	}
+	return nil
+}
+
+func (s *PARStore) clean() {
+	if err := s.adapter.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires_at <= $1", s.tableName), s.clock.Now()); err != nil {
+		s.logger.Printf("Error while cleaning out outdated pushed authorization requests: %+v", err)
+	}
+}
+
+// Create stores the serialized authorization request pushed by the client and returns generated request_uri
+// together with its lifetime for the expires_in response field
+func (s *PARStore) Create(ctx context.Context, clientID string, request []byte) (string, time.Duration, error) {
+	id, err := generateSecret()
+	if err != nil {
+		return "", 0, err
+	}
+	requestURI := PARRequestURIPrefix + id
+
+	now := s.clock.Now()
+	err = execContext(
+		ctx,
+		s.adapter,
+		fmt.Sprintf("INSERT INTO %s (request_uri, client_id, created_at, expires_at, data) VALUES ($1, $2, $3, $4, $5)", s.tableName),
+		requestURI,
+		clientID,
+		now,
+		now.Add(s.requestLifetime),
+		request,
+	)
+	if err != nil {
+		return "", 0, err
+	}
+	return requestURI, s.requestLifetime, nil
+}
+
+// Consume returns and deletes the serialized authorization request pushed by the client,
+// pgadapter.ErrNoRows is returned for unknown, expired, already consumed or another client requests
+func (s *PARStore) Consume(ctx context.Context, clientID, requestURI string) ([]byte, error) {
+	var item struct {
+		Data []byte `db:"data"`
+	}
+	if err := selectOneContext(
+		ctx,
+		s.adapter,
+		&item,
+		fmt.Sprintf("DELETE FROM %s WHERE request_uri = $1 AND client_id = $2 AND expires_at > $3 RETURNING data", s.tableName),
+		requestURI,
+		clientID,
+		s.clock.Now(),
+	); err != nil {
+		return nil, err
+	}
+	return item.Data, nil
+}
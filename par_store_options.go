@@ -0,0 +1,55 @@
+package pg
+
+import "time"
+
+// PARStoreOption is the configuration options type for pushed authorization requests store
+type PARStoreOption func(s *PARStore)
+
+// WithPARStoreTableName returns option that sets pushed authorization requests store table name
+func WithPARStoreTableName(tableName string) PARStoreOption {
+	return func(s *PARStore) {
+		s.tableName = tableName
+	}
+}
+
+// WithPARStoreLogger returns option that sets pushed authorization requests store logger implementation
+func WithPARStoreLogger(logger Logger) PARStoreOption {
+	return func(s *PARStore) {
+		s.logger = logger
+	}
+}
+
+// WithPARStoreClock returns option that sets pushed authorization requests store clock used for requests expiration
+func WithPARStoreClock(clock Clock) PARStoreOption {
+	return func(s *PARStore) {
+		s.clock = clock
+	}
+}
+
+// WithPARStoreRequestLifetime returns option that sets how long the pushed request can be consumed, default is 1 minute
+func WithPARStoreRequestLifetime(lifetime time.Duration) PARStoreOption {
+	return func(s *PARStore) {
+		s.requestLifetime = lifetime
+	}
+}
+
+// WithPARStoreGCInterval returns option that sets pushed authorization requests store garbage collection interval
+func WithPARStoreGCInterval(gcInterval time.Duration) PARStoreOption {
+	return func(s *PARStore) {
+		s.gcInterval = gcInterval
+	}
+}
+
+// WithPARStoreGCDisabled returns option that disables pushed authorization requests store garbage collection
+func WithPARStoreGCDisabled() PARStoreOption {
+	return func(s *PARStore) {
+		s.gcDisabled = true
+	}
+}
+
+// WithPARStoreInitTableDisabled returns option that disables table creation on store instantiation
+func WithPARStoreInitTableDisabled() PARStoreOption {
+	return func(s *PARStore) {
+		s.initTableDisabled = true
+	}
+}
@@ -0,0 +1,58 @@
+package pg
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+func TestPARStore(t *testing.T) {
+	_, err := NewPARStore(nil, WithPARStoreRequestLifetime(0), WithPARStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid PAR store configuration: request lifetime must be positive, got 0s")
+
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewPARStore(adapter, WithPARStoreGCDisabled(), WithPARStoreClock(clock), WithPARStoreRequestLifetime(90*time.Second))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.True(t, strings.HasPrefix(adapter.execCalls[0].query, "SELECT pg_advisory_xact_lock(hashtext('oauth2_pg_init:oauth2_pushed_requests'));\nCREATE TABLE IF NOT EXISTS oauth2_pushed_requests"))
+
+	requestURI, expiresIn, err := store.Create(context.Background(), "client", []byte("response_type=code"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(requestURI, PARRequestURIPrefix))
+	assert.Equal(t, 90*time.Second, expiresIn)
+	require.Equal(t, 2, len(adapter.execCalls))
+	assert.Equal(t, []interface{}{requestURI, "client", clock.now, clock.now.Add(90 * time.Second), []byte("response_type=code")}, adapter.execCalls[1].args)
+
+	_, err = store.Consume(context.Background(), "client", requestURI)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.True(t, strings.HasPrefix(adapter.selectOneCalls[0].query, "DELETE FROM oauth2_pushed_requests"))
+	assert.Equal(t, []interface{}{requestURI, "client", clock.now}, adapter.selectOneCalls[0].args)
+}
+
+func runPARStoreTest(t *testing.T, store *PARStore) {
+	ctx := context.Background()
+
+	requestURI, _, err := store.Create(ctx, "client", []byte("response_type=code&scope=openid"))
+	require.NoError(t, err)
+
+	_, err = store.Consume(ctx, "another client", requestURI)
+	assert.Equal(t, pgadapter.ErrNoRows, err)
+
+	request, err := store.Consume(ctx, "client", requestURI)
+	require.NoError(t, err)
+	assert.Equal(t, "response_type=code&scope=openid", string(request))
+
+	// pushed requests are single-use
+	_, err = store.Consume(ctx, "client", requestURI)
+	assert.Equal(t, pgadapter.ErrNoRows, err)
+}
@@ -1,6 +1,143 @@
 package pg
 
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
 // Logger is the PostgreSQL store logger interface
 type Logger interface {
 	Printf(format string, v ...interface{})
 }
+
+// Clock is the source of the current time used by the stores for expiration checks and garbage collection
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ContextAdapter is the optional adapter interface for the drivers that support query cancellation with context,
+// stores fall back to the context-less pgadapter.Adapter methods when adapter does not implement it
+type ContextAdapter interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) error
+	SelectOneContext(ctx context.Context, dst interface{}, query string, args ...interface{}) error
+}
+
+// execContext runs the query with the context if the adapter supports it, other adapters run the query
+// in the background, so the call returns once the context is done. Connection lost and busy pool errors
+// are wrapped with driverError.
+func execContext(ctx context.Context, adapter pgadapter.Adapter, query string, args ...interface{}) error {
+	if a, ok := adapter.(ContextAdapter); ok {
+		return wrapDriverError(a.ExecContext(ctx, query, args...))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		return wrapDriverError(adapter.Exec(query, args...))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- adapter.Exec(query, args...)
+	}()
+
+	select {
+	case err := <-done:
+		return wrapDriverError(err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// selectOneContext runs the select query with the context if the adapter supports it, other adapters run the query
+// in the background, so the call returns once the context is done. The background query scans the row into
+// the copy of dst, so dst is not written after the call returns. Connection lost and busy pool errors are wrapped
+// with driverError.
+func selectOneContext(ctx context.Context, adapter pgadapter.Adapter, dst interface{}, query string, args ...interface{}) error {
+	if a, ok := adapter.(ContextAdapter); ok {
+		return wrapDriverError(a.SelectOneContext(ctx, dst, query, args...))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		return wrapDriverError(adapter.SelectOne(dst, query, args...))
+	}
+
+	target := reflect.ValueOf(dst).Elem()
+	scanned := reflect.New(target.Type())
+	scanned.Elem().Set(target)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- adapter.SelectOne(scanned.Interface(), query, args...)
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			target.Set(scanned.Elem())
+		}
+		return wrapDriverError(err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type selectOneFunc func(ctx context.Context, dst interface{}, query string, args ...interface{}) error
+
+// lockedDDL prepends table initialization statements with the transaction-level advisory lock, so the instances
+// starting simultaneously do not race on the table and index creation. Statements of the query without parameters
+// run in the single implicit transaction, so the lock is released once they are done.
+func lockedDDL(tableName, ddl string) string {
+	return fmt.Sprintf("SELECT pg_advisory_xact_lock(hashtext(%s));", quoteLiteral("oauth2_pg_init:"+tableName)) + ddl
+}
+
+// initContext returns the context bounding table initialization with the timeout, zero timeout means no bound
+func initContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutDDL prepends table initialization statements with the local statement and lock timeouts, so the server
+// bounds them also for the adapters that do not support query cancellation with context
+func timeoutDDL(timeout time.Duration, ddl string) string {
+	if timeout == 0 {
+		return ddl
+	}
+	// round up, zero milliseconds value disables the timeout
+	ms := int64((timeout + time.Millisecond - 1) / time.Millisecond)
+	return fmt.Sprintf("SET LOCAL statement_timeout = %[1]d;\nSET LOCAL lock_timeout = %[1]d;\n", ms) + ddl
+}
+
+// sanitizeQuery collapses the query whitespaces into the single line suitable for logging
+func sanitizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// checkTable checks that the database is reachable and the table exists
+func checkTable(ctx context.Context, selectOne selectOneFunc, tableName string) error {
+	var item struct {
+		Exists bool `db:"exists"`
+	}
+	if err := selectOne(ctx, &item, "SELECT to_regclass($1) IS NOT NULL AS exists", tableName); err != nil {
+		return err
+	}
+	if !item.Exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	return nil
+}
@@ -0,0 +1,500 @@
+package pgmock
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3"
+)
+
+// ClientStore is the in-memory pg.ClientStore fake, missing clients are reported with pg.ErrClientNotFound
+// the same way the real store does
+type ClientStore struct {
+	mu                sync.RWMutex
+	clock             pg.Clock
+	secretGracePeriod time.Duration
+	secretHasher      pg.SecretHasher
+	items             map[string]*clientItem
+}
+
+type clientItem struct {
+	client   pg.Client
+	secrets  []pg.ClientSecret
+	disabled bool
+	version  int64
+}
+
+// NewClientStore creates in-memory client store fake
+func NewClientStore(opts ...Option) *ClientStore {
+	o := newOptions(opts)
+	return &ClientStore{
+		clock:             o.clock,
+		secretGracePeriod: o.secretGracePeriod,
+		secretHasher:      o.secretHasher,
+		items:             make(map[string]*clientItem),
+	}
+}
+
+// GetByID retrieves and returns client information by id,
+// returns pg.ErrClientDisabled or pg.ErrClientExpired for disabled or expired client
+func (s *ClientStore) GetByID(id string) (oauth2.ClientInfo, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, err := s.getItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	client := item.client
+	return &client, nil
+}
+
+// getItem must be called with the lock held
+func (s *ClientStore) getItem(id string) (*clientItem, error) {
+	item, ok := s.items[id]
+	if !ok {
+		return nil, pg.ErrClientNotFound
+	}
+	if item.disabled {
+		return nil, pg.ErrClientDisabled
+	}
+	if !item.client.ExpiresAt.IsZero() && !item.client.ExpiresAt.After(s.clock.Now()) {
+		return nil, pg.ErrClientExpired
+	}
+	return item, nil
+}
+
+// ValidateSecret retrieves client information by id and checks the secret against all currently valid
+// client secrets, returns pg.ErrInvalidClientSecret when the secret does not match
+func (s *ClientStore) ValidateSecret(id, secret string) (oauth2.ClientInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, err := s.getItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := false
+	for _, cs := range s.validSecrets(item) {
+		var match bool
+		if s.secretHasher != nil {
+			match = s.secretHasher.Verify(cs.Secret, secret)
+		} else {
+			match = subtle.ConstantTimeCompare([]byte(cs.Secret), []byte(secret)) == 1
+		}
+		valid = valid || match
+	}
+
+	if !valid {
+		return nil, pg.ErrInvalidClientSecret
+	}
+
+	client := item.client
+	return &client, nil
+}
+
+// Create creates and stores the new client information, pg.ErrClientAlreadyExists is returned when the client
+// with the same id already exists
+func (s *ClientStore) Create(info oauth2.ClientInfo) error {
+	var client pg.Client
+	if err := copyJSON(info, &client); err != nil {
+		return err
+	}
+	client.RedirectURIs = client.GetRedirectURIs()
+
+	if s.secretHasher != nil {
+		secret, err := s.secretHasher.Hash(client.Secret)
+		if err != nil {
+			return err
+		}
+		client.Secret = secret
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[client.ID]; ok {
+		return pg.ErrClientAlreadyExists
+	}
+	s.items[client.ID] = &clientItem{
+		client:  client,
+		secrets: []pg.ClientSecret{{Secret: client.Secret, CreatedAt: s.clock.Now()}},
+		version: 1,
+	}
+	return nil
+}
+
+// GetWithVersion returns client information by id together with its version to be passed to Update,
+// disabled and expired clients are returned as well
+func (s *ClientStore) GetWithVersion(id string) (oauth2.ClientInfo, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return nil, 0, pg.ErrClientNotFound
+	}
+
+	client := item.client
+	return &client, item.version, nil
+}
+
+// Update replaces the client information if the stored client has the expected version and returns the new version,
+// pg.ErrVersionConflict is returned when the client was changed since the version was read.
+// Client secret is not changed by Update, use RotateSecret for that.
+func (s *ClientStore) Update(info oauth2.ClientInfo, version int64) (int64, error) {
+	var client pg.Client
+	if err := copyJSON(info, &client); err != nil {
+		return 0, err
+	}
+	client.RedirectURIs = client.GetRedirectURIs()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[client.ID]
+	if !ok {
+		return 0, pg.ErrClientNotFound
+	}
+	if item.version != version {
+		return 0, pg.ErrVersionConflict
+	}
+
+	client.Secret = item.client.Secret
+	item.client = client
+	item.version++
+	return item.version, nil
+}
+
+// CreateIfNotExists creates the client unless the client with the same id already exists,
+// returns true if the client was created
+func (s *ClientStore) CreateIfNotExists(info oauth2.ClientInfo) (bool, error) {
+	err := s.Create(info)
+	if err == pg.ErrClientAlreadyExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// EnsureClients creates the missing clients and updates the differing ones, secrets of the existing clients
+// are not compared nor changed
+func (s *ClientStore) EnsureClients(clients []oauth2.ClientInfo) ([]pg.ClientSeedResult, error) {
+	results := make([]pg.ClientSeedResult, 0, len(clients))
+	for _, info := range clients {
+		created, err := s.CreateIfNotExists(info)
+		if err != nil {
+			return results, err
+		}
+		if created {
+			results = append(results, pg.ClientCreated)
+			continue
+		}
+
+		var client pg.Client
+		if err := copyJSON(info, &client); err != nil {
+			return results, err
+		}
+		client.RedirectURIs = client.GetRedirectURIs()
+
+		s.mu.Lock()
+		item, ok := s.items[client.ID]
+		if !ok {
+			s.mu.Unlock()
+			return results, pg.ErrClientNotFound
+		}
+		client.Secret = item.client.Secret
+		same, err := sameJSON(client, item.client)
+		if err == nil && !same {
+			item.client = client
+			item.version++
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return results, err
+		}
+
+		if same {
+			results = append(results, pg.ClientUnchanged)
+		} else {
+			results = append(results, pg.ClientUpdated)
+		}
+	}
+	return results, nil
+}
+
+// ImportJSON reads the client definitions from r with pg.ParseClientDefinitions and seeds them with EnsureClients
+func (s *ClientStore) ImportJSON(ctx context.Context, r io.Reader) ([]pg.ClientSeedResult, error) {
+	definitions, err := pg.ParseClientDefinitions(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	clients := make([]oauth2.ClientInfo, len(definitions))
+	for i, definition := range definitions {
+		clients[i] = definition.Client()
+	}
+	return s.EnsureClients(clients)
+}
+
+// Delete deletes the client, pg.ErrClientNotFound is returned when there is no such client
+func (s *ClientStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return pg.ErrClientNotFound
+	}
+	delete(s.items, id)
+	return nil
+}
+
+// Secrets returns all currently valid client secrets, the current one is the last
+func (s *ClientStore) Secrets(id string) ([]pg.ClientSecret, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return nil, pg.ErrClientNotFound
+	}
+	return s.validSecrets(item), nil
+}
+
+// validSecrets must be called with the lock held
+func (s *ClientStore) validSecrets(item *clientItem) []pg.ClientSecret {
+	now := s.clock.Now()
+	valid := make([]pg.ClientSecret, 0, len(item.secrets))
+	for _, secret := range item.secrets {
+		if secret.ExpiresAt == nil || secret.ExpiresAt.After(now) {
+			valid = append(valid, secret)
+		}
+	}
+	return valid
+}
+
+// RotateSecret generates and stores the new client secret, previous secrets stay valid for the grace period.
+// Returned secret is not hashed even when SecretHasher is configured.
+func (s *ClientStore) RotateSecret(id string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(buf)
+
+	storedSecret := secret
+	if s.secretHasher != nil {
+		var err error
+		if storedSecret, err = s.secretHasher.Hash(secret); err != nil {
+			return "", err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return "", pg.ErrClientNotFound
+	}
+
+	now := s.clock.Now()
+	expiresAt := now.Add(s.secretGracePeriod)
+	secrets := s.validSecrets(item)
+	for i := range secrets {
+		if secrets[i].ExpiresAt == nil {
+			secrets[i].ExpiresAt = &expiresAt
+		}
+	}
+	item.secrets = append(secrets, pg.ClientSecret{Secret: storedSecret, CreatedAt: now})
+	item.client.Secret = storedSecret
+	item.version++
+
+	return secret, nil
+}
+
+// Disable disables the client, GetByID returns pg.ErrClientDisabled for it until it is enabled again
+func (s *ClientStore) Disable(id string) error {
+	return s.setDisabled(id, true)
+}
+
+// Enable enables previously disabled client
+func (s *ClientStore) Enable(id string) error {
+	return s.setDisabled(id, false)
+}
+
+func (s *ClientStore) setDisabled(id string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return pg.ErrClientNotFound
+	}
+	item.disabled = disabled
+	item.version++
+	return nil
+}
+
+func (s *ClientStore) client(id string) (pg.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return pg.Client{}, pg.ErrClientNotFound
+	}
+	return item.client, nil
+}
+
+// ValidateRedirectURI checks if the uri is one of the redirect URIs registered for the client
+func (s *ClientStore) ValidateRedirectURI(id, uri string) (bool, error) {
+	client, err := s.client(id)
+	if err != nil {
+		return false, err
+	}
+
+	for _, u := range client.RedirectURIs {
+		if u == uri {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CheckScope checks if all the space-separated scopes are allowed for the client,
+// clients without allowed scopes are not restricted
+func (s *ClientStore) CheckScope(clientID string, scope string) (bool, error) {
+	client, err := s.client(clientID)
+	if err != nil {
+		return false, err
+	}
+
+	if len(client.AllowedScopes) == 0 {
+		return true, nil
+	}
+	for _, requested := range strings.Fields(scope) {
+		if !contains(client.AllowedScopes, requested) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// AllowedGrantTypes returns the grant types the client is allowed to use, empty list means no restriction
+func (s *ClientStore) AllowedGrantTypes(id string) ([]oauth2.GrantType, error) {
+	client, err := s.client(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]oauth2.GrantType{}, client.AllowedGrantTypes...), nil
+}
+
+// CheckGrantType checks if the grant type is allowed for the client,
+// clients without allowed grant types are not restricted
+func (s *ClientStore) CheckGrantType(clientID string, grant oauth2.GrantType) (bool, error) {
+	client, err := s.client(clientID)
+	if err != nil {
+		return false, err
+	}
+
+	if len(client.AllowedGrantTypes) == 0 {
+		return true, nil
+	}
+	for _, gt := range client.AllowedGrantTypes {
+		if gt == grant {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Export writes all the clients ordered by id to w in the format
+func (s *ClientStore) Export(ctx context.Context, w io.Writer, format pg.ExportFormat) error {
+	s.mu.RLock()
+	clients := make([]pg.Client, 0, len(s.items))
+	for _, item := range s.items {
+		clients = append(clients, item.client)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ID < clients[j].ID
+	})
+
+	for i := range clients {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if format == pg.ExportJSONLinesRedacted {
+			clients[i].Secret = "[REDACTED]"
+		}
+		data, err := jsoniter.Marshal(&clients[i])
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import copies all the clients from the source into the store and returns the number of imported clients
+func (s *ClientStore) Import(ctx context.Context, src pg.ClientSource) (int64, error) {
+	var imported int64
+	err := src.ForEach(ctx, func(info oauth2.ClientInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.Create(info); err != nil {
+			return err
+		}
+		imported++
+		return nil
+	})
+
+	return imported, err
+}
+
+// VerifySchema always succeeds, the fake has no schema
+func (s *ClientStore) VerifySchema(ctx context.Context) error {
+	return nil
+}
+
+// Check always succeeds unless the context is done
+func (s *ClientStore) Check(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// HealthCheck always succeeds
+func (s *ClientStore) HealthCheck() error {
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
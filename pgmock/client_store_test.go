@@ -0,0 +1,183 @@
+package pgmock
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+var _ pg.ClientStorer = (*ClientStore)(nil)
+
+func TestClientStore(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: now}
+	store := NewClientStore(WithClock(clock), WithSecretGracePeriod(time.Hour))
+
+	require.NoError(t, store.Create(&pg.Client{
+		Client:            models.Client{ID: "c1", Secret: "secret"},
+		RedirectURIs:      []string{"https://a.example.com", "https://b.example.com"},
+		AllowedScopes:     []string{"read", "write"},
+		AllowedGrantTypes: []oauth2.GrantType{oauth2.AuthorizationCode},
+	}))
+	require.NoError(t, store.Create(&models.Client{ID: "c2", Secret: "secret", Domain: "https://c.example.com"}))
+	require.NoError(t, store.Create(&pg.Client{Client: models.Client{ID: "c3"}, ExpiresAt: now}))
+
+	info, err := store.GetByID("c1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.example.com", info.GetDomain())
+
+	_, err = store.GetByID("unknown")
+	assert.Equal(t, pg.ErrClientNotFound, err)
+	_, err = store.GetByID("c3")
+	assert.Equal(t, pg.ErrClientExpired, err)
+
+	valid, err := store.ValidateRedirectURI("c2", "https://c.example.com")
+	require.NoError(t, err)
+	assert.True(t, valid)
+	valid, err = store.ValidateRedirectURI("c1", "https://c.example.com")
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	allowed, err := store.CheckScope("c1", "read write")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, err = store.CheckScope("c1", "read admin")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	allowed, err = store.CheckScope("c2", "admin")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = store.CheckGrantType("c1", oauth2.ClientCredentials)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	allowed, err = store.CheckGrantType("c2", oauth2.ClientCredentials)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	newSecret, err := store.RotateSecret("c1")
+	require.NoError(t, err)
+	_, err = store.ValidateSecret("c1", "secret")
+	assert.NoError(t, err)
+	_, err = store.ValidateSecret("c1", newSecret)
+	assert.NoError(t, err)
+
+	clock.now = now.Add(2 * time.Hour)
+	_, err = store.ValidateSecret("c1", "secret")
+	assert.Equal(t, pg.ErrInvalidClientSecret, err)
+	secrets, err := store.Secrets("c1")
+	require.NoError(t, err)
+	require.Len(t, secrets, 1)
+	assert.Equal(t, newSecret, secrets[0].Secret)
+
+	require.NoError(t, store.Disable("c2"))
+	_, err = store.GetByID("c2")
+	assert.Equal(t, pg.ErrClientDisabled, err)
+	require.NoError(t, store.Enable("c2"))
+	_, err = store.GetByID("c2")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, store.Export(context.Background(), &buf, pg.ExportJSONLinesRedacted))
+	assert.NotContains(t, buf.String(), newSecret)
+
+	imported, err := NewClientStore().Import(context.Background(), pg.ClientSourceFunc(func(ctx context.Context, fn func(oauth2.ClientInfo) error) error {
+		return fn(&models.Client{ID: "c4"})
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), imported)
+}
+
+func TestClientStore_SecretHasher(t *testing.T) {
+	store := NewClientStore(WithSecretHasher(pg.SHA256SecretHasher{}))
+	require.NoError(t, store.Create(&models.Client{ID: "c1", Secret: "secret"}))
+
+	info, err := store.ValidateSecret("c1", "secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, "secret", info.GetSecret())
+}
+
+func TestClientStore_Update(t *testing.T) {
+	store := NewClientStore()
+	require.NoError(t, store.Create(&pg.Client{Client: models.Client{ID: "c1", Secret: "secret"}}))
+
+	info, version, err := store.GetWithVersion("c1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	client := info.(*pg.Client)
+	client.RedirectURIs = []string{"https://example.com/cb"}
+	client.Secret = "ignored"
+	newVersion, err := store.Update(client, version)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), newVersion)
+
+	_, err = store.Update(client, version)
+	assert.Equal(t, pg.ErrVersionConflict, err)
+
+	_, err = store.ValidateSecret("c1", "secret")
+	assert.NoError(t, err)
+	ok, err := store.ValidateRedirectURI("c1", "https://example.com/cb")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = store.Update(&pg.Client{Client: models.Client{ID: "unknown"}}, 1)
+	assert.Equal(t, pg.ErrClientNotFound, err)
+}
+
+func TestClientStore_EnsureClients(t *testing.T) {
+	store := NewClientStore()
+	require.NoError(t, store.Create(&pg.Client{Client: models.Client{ID: "c1", Secret: "secret"}}))
+
+	created, err := store.CreateIfNotExists(&models.Client{ID: "c1", Secret: "changed"})
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	seed := []oauth2.ClientInfo{
+		&models.Client{ID: "c1", Secret: "changed", Domain: "https://c1.example.com"},
+		&models.Client{ID: "c2", Secret: "secret2"},
+	}
+	results, err := store.EnsureClients(seed)
+	require.NoError(t, err)
+	assert.Equal(t, []pg.ClientSeedResult{pg.ClientUpdated, pg.ClientCreated}, results)
+
+	results, err = store.EnsureClients(seed)
+	require.NoError(t, err)
+	assert.Equal(t, []pg.ClientSeedResult{pg.ClientUnchanged, pg.ClientUnchanged}, results)
+
+	_, version, err := store.GetWithVersion("c1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	_, err = store.ValidateSecret("c1", "secret")
+	assert.NoError(t, err)
+}
+
+func TestClientStore_ImportJSON(t *testing.T) {
+	store := NewClientStore()
+	require.NoError(t, store.Create(&pg.Client{Client: models.Client{ID: "c1", Secret: "secret"}}))
+
+	definitions := `[{"id": "c1", "secret": "changed", "allowed_scopes": ["read"]}, {"id": "c2", "secret": "secret2"}]`
+	results, err := store.ImportJSON(context.Background(), strings.NewReader(definitions))
+	require.NoError(t, err)
+	assert.Equal(t, []pg.ClientSeedResult{pg.ClientUpdated, pg.ClientCreated}, results)
+
+	results, err = store.ImportJSON(context.Background(), strings.NewReader(definitions))
+	require.NoError(t, err)
+	assert.Equal(t, []pg.ClientSeedResult{pg.ClientUnchanged, pg.ClientUnchanged}, results)
+
+	_, err = store.ValidateSecret("c1", "secret")
+	assert.NoError(t, err)
+
+	_, err = store.ImportJSON(context.Background(), strings.NewReader(`[{"id": "c3"}, {"id": "c3"}]`))
+	assert.Error(t, err)
+	_, err = store.GetByID("c3")
+	assert.Equal(t, pg.ErrClientNotFound, err)
+}
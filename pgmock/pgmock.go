@@ -0,0 +1,77 @@
+// Package pgmock provides in-memory fakes of the PostgreSQL token and client stores with the same method sets,
+// so applications can unit-test their handlers without running PostgreSQL instance.
+package pgmock
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+)
+
+// Option is the configuration options type for all the fakes
+type Option func(*options)
+
+type options struct {
+	clock             pg.Clock
+	secretGracePeriod time.Duration
+	secretHasher      pg.SecretHasher
+}
+
+// WithClock sets the clock used for expiration checks, system clock is used by default
+func WithClock(clock pg.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithSecretGracePeriod sets the period previous client secrets stay valid after rotation, default is 24 hours
+func WithSecretGracePeriod(period time.Duration) Option {
+	return func(o *options) {
+		o.secretGracePeriod = period
+	}
+}
+
+// WithSecretHasher sets the hasher for the stored client secrets
+func WithSecretHasher(hasher pg.SecretHasher) Option {
+	return func(o *options) {
+		o.secretHasher = hasher
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{clock: systemClock{}, secretGracePeriod: 24 * time.Hour}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// copyJSON deep copies src into dst through JSON serialization to isolate stored values from the caller
+func copyJSON(src, dst interface{}) error {
+	data, err := jsoniter.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return jsoniter.Unmarshal(data, dst)
+}
+
+// sameJSON returns true if the values are marshalled to the same JSON
+func sameJSON(a, b interface{}) (bool, error) {
+	aData, err := jsoniter.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bData, err := jsoniter.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aData, bData), nil
+}
@@ -0,0 +1,689 @@
+package pgmock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+// TokenStore is the in-memory pg.TokenStore fake, missing tokens are reported with pg.ErrTokenNotFound
+// the same way the real store does
+type TokenStore struct {
+	mu     sync.RWMutex
+	clock  pg.Clock
+	lastID int64
+	items  []tokenItem
+	paused bool
+}
+
+type tokenItem struct {
+	id        int64
+	parentID  int64
+	family    string
+	createdAt time.Time
+	usedAt    time.Time
+	token     models.Token
+	details   json.RawMessage
+}
+
+// info returns the copy of the item token, *pg.Token when it has authorization details as the real store does
+func (item *tokenItem) info() oauth2.TokenInfo {
+	if len(item.details) > 0 {
+		return &pg.Token{Token: item.token, AuthorizationDetails: item.details}
+	}
+	token := item.token
+	return &token
+}
+
+// NewTokenStore creates in-memory token store fake
+func NewTokenStore(opts ...Option) *TokenStore {
+	o := newOptions(opts)
+	return &TokenStore{clock: o.clock}
+}
+
+// Close does nothing, the fake has no background GC
+func (s *TokenStore) Close() error {
+	return nil
+}
+
+// CloseContext does nothing, the fake has no background GC
+func (s *TokenStore) CloseContext(ctx context.Context) error {
+	return nil
+}
+
+// Drain does nothing, all the fake operations are synchronous
+func (s *TokenStore) Drain(ctx context.Context) error {
+	return nil
+}
+
+// PauseGC makes TriggerGCForTest keep the expired tokens until ResumeGC
+func (s *TokenStore) PauseGC() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// ResumeGC resumes the GC paused with PauseGC
+func (s *TokenStore) ResumeGC() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+// GCPaused checks if the GC is paused with PauseGC
+func (s *TokenStore) GCPaused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.paused
+}
+
+// TriggerGCForTest removes all the expired tokens unless the GC is paused
+func (s *TokenStore) TriggerGCForTest() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused {
+		return
+	}
+
+	now := s.clock.Now()
+	s.removeItems(func(item *tokenItem) bool {
+		return !tokenExpiresAt(&item.token).After(now)
+	})
+}
+
+// Create creates and stores the new token information
+func (s *TokenStore) Create(info oauth2.TokenInfo) error {
+	_, err := s.CreateWithID(context.Background(), info)
+	return err
+}
+
+// CreateWithID creates and stores the new token information and returns the generated sequential id
+func (s *TokenStore) CreateWithID(ctx context.Context, info oauth2.TokenInfo) (int64, error) {
+	var token pg.Token
+	if err := copyJSON(info, &token); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(&token, 0, ""), nil
+}
+
+// add stores the token with the next sequential id, the token starts the new family unless the family is set.
+// Must be called with the write lock held.
+func (s *TokenStore) add(token *pg.Token, parentID int64, family string) int64 {
+	s.lastID++
+	if family == "" {
+		family = strconv.FormatInt(s.lastID, 10)
+	}
+	s.items = append(s.items, tokenItem{
+		id:        s.lastID,
+		parentID:  parentID,
+		family:    family,
+		createdAt: s.clock.Now(),
+		token:     token.Token,
+		details:   token.AuthorizationDetails,
+	})
+	return s.lastID
+}
+
+// find returns the first stored item with the matching token or nil, must be called with the lock held
+func (s *TokenStore) find(match func(t *models.Token) bool) *tokenItem {
+	for i := range s.items {
+		if match(&s.items[i].token) {
+			return &s.items[i]
+		}
+	}
+	return nil
+}
+
+// removeItems deletes the matching items together with the tokens exchanged for them and returns the number
+// of matching items, must be called with the write lock held. Exchanged tokens are always stored after the parent.
+func (s *TokenStore) removeItems(match func(item *tokenItem) bool) int64 {
+	var removed int64
+	removedIDs := make(map[int64]bool)
+	items := s.items[:0]
+	for i := range s.items {
+		item := s.items[i]
+		if match(&item) {
+			removed++
+			removedIDs[item.id] = true
+			continue
+		}
+		if removedIDs[item.parentID] {
+			removedIDs[item.id] = true
+			continue
+		}
+		items = append(items, item)
+	}
+	s.items = items
+	return removed
+}
+
+// Rotate replaces the token issued with the refresh token by the new token information, the new token inherits
+// the refresh token family. pg.ErrTokenNotFound or pg.ErrTokenExpired is returned for unknown or expired refresh token.
+func (s *TokenStore) Rotate(ctx context.Context, refresh string, info oauth2.TokenInfo) error {
+	var token pg.Token
+	if err := copyJSON(info, &token); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.find(func(t *models.Token) bool { return t.Refresh == refresh })
+	if old == nil {
+		return pg.ErrTokenNotFound
+	}
+	if !tokenExpiresAt(&old.token).After(s.clock.Now()) {
+		return pg.ErrTokenExpired
+	}
+
+	id, family := old.id, old.family
+	s.removeItems(func(item *tokenItem) bool { return item.id == id })
+	s.add(&token, 0, family)
+	return nil
+}
+
+// ExtendAccess extends the access token lifetime by d, pg.ErrTokenNotFound or pg.ErrTokenExpired is returned
+// for unknown or expired access token
+func (s *TokenStore) ExtendAccess(access string, d time.Duration) error {
+	return s.extend(pg.TokenKindAccess, access, d, func(t *models.Token) bool { return t.Access == access })
+}
+
+// ExtendRefresh extends the refresh token lifetime by d the same way ExtendAccess does
+func (s *TokenStore) ExtendRefresh(refresh string, d time.Duration) error {
+	return s.extend(pg.TokenKindRefresh, refresh, d, func(t *models.Token) bool { return t.Refresh == refresh })
+}
+
+func (s *TokenStore) extend(kind pg.TokenKind, value string, d time.Duration, match func(t *models.Token) bool) error {
+	if d <= 0 {
+		return fmt.Errorf("token lifetime extension must be positive, got %s", d)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := s.find(match)
+	if value == "" || item == nil {
+		return pg.ErrTokenNotFound
+	}
+	if tokenKindExpired(&item.token, kind, s.clock.Now()) {
+		return pg.ErrTokenExpired
+	}
+
+	expiresIn := &item.token.AccessExpiresIn
+	if kind == pg.TokenKindRefresh {
+		expiresIn = &item.token.RefreshExpiresIn
+	}
+	if *expiresIn != 0 {
+		*expiresIn += d
+	}
+	return nil
+}
+
+// FamilyID returns the family of the refresh token, every token created not by Rotate starts the new family
+func (s *TokenStore) FamilyID(refresh string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item := s.find(func(t *models.Token) bool { return t.Refresh == refresh })
+	if item == nil {
+		return "", pg.ErrTokenNotFound
+	}
+	return item.family, nil
+}
+
+// RemoveFamily deletes all the tokens of the refresh token family
+func (s *TokenStore) RemoveFamily(familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeItems(func(item *tokenItem) bool { return item.family == familyID })
+	return nil
+}
+
+// CreateExchanged creates and stores the token exchanged for the parent subject token, exchanged tokens are removed
+// together with the parent token. pg.ErrTokenNotFound or pg.ErrTokenExpired is returned for unknown or expired
+// parent token. Actor is not stored by the fake.
+func (s *TokenStore) CreateExchanged(ctx context.Context, parent, info oauth2.TokenInfo, actor string) error {
+	var token pg.Token
+	if err := copyJSON(info, &token); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match := func(t *models.Token) bool { return t.Access == parent.GetAccess() }
+	if parent.GetAccess() == "" {
+		match = func(t *models.Token) bool { return t.Refresh == parent.GetRefresh() }
+	}
+	item := s.find(match)
+	if item == nil {
+		return pg.ErrTokenNotFound
+	}
+	if !tokenExpiresAt(&item.token).After(s.clock.Now()) {
+		return pg.ErrTokenExpired
+	}
+
+	s.add(&token, item.id, "")
+	return nil
+}
+
+// CreateWithKey creates and stores the new token information and returns the generated sequential id as text
+func (s *TokenStore) CreateWithKey(ctx context.Context, info oauth2.TokenInfo) (string, error) {
+	id, err := s.CreateWithID(ctx, info)
+	return strconv.FormatInt(id, 10), err
+}
+
+func (s *TokenStore) remove(match func(t *models.Token) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeItems(func(item *tokenItem) bool { return match(&item.token) })
+}
+
+// RemoveByCode deletes the authorization code
+func (s *TokenStore) RemoveByCode(code string) error {
+	s.remove(func(t *models.Token) bool { return t.Code == code })
+	return nil
+}
+
+// RemoveByAccess uses the access token to delete the token information
+func (s *TokenStore) RemoveByAccess(access string) error {
+	s.remove(func(t *models.Token) bool { return t.Access == access })
+	return nil
+}
+
+// RemoveByRefresh uses the refresh token to delete the token information
+func (s *TokenStore) RemoveByRefresh(refresh string) error {
+	s.remove(func(t *models.Token) bool { return t.Refresh == refresh })
+	return nil
+}
+
+func (s *TokenStore) get(kind pg.TokenKind, match func(t *models.Token) bool) (oauth2.TokenInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.items {
+		if match(&s.items[i].token) {
+			if tokenKindExpired(&s.items[i].token, kind, s.clock.Now()) {
+				return nil, pg.ErrTokenExpired
+			}
+			return s.items[i].info(), nil
+		}
+	}
+	return nil, pg.ErrTokenNotFound
+}
+
+// GetByCode uses the authorization code for token information data, pg.ErrTokenExpired is returned for the expired code
+func (s *TokenStore) GetByCode(code string) (oauth2.TokenInfo, error) {
+	if code == "" {
+		return nil, nil
+	}
+	return s.get(pg.TokenKindCode, func(t *models.Token) bool { return t.Code == code })
+}
+
+// GetByAccess uses the access token for token information data, pg.ErrTokenExpired is returned for the expired token
+func (s *TokenStore) GetByAccess(access string) (oauth2.TokenInfo, error) {
+	if access == "" {
+		return nil, nil
+	}
+	info, err := s.get(pg.TokenKindAccess, func(t *models.Token) bool { return t.Access == access })
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item := s.find(func(t *models.Token) bool { return t.Access == access }); item != nil {
+		item.usedAt = s.clock.Now()
+	}
+	return info, nil
+}
+
+// GetByAccessWithRefresh works as GetByAccess and also returns the refresh token issued with the access token
+func (s *TokenStore) GetByAccessWithRefresh(access string) (oauth2.TokenInfo, pg.RefreshLink, error) {
+	info, err := s.GetByAccess(access)
+	if err != nil || info == nil || info.GetRefresh() == "" {
+		return info, pg.RefreshLink{}, err
+	}
+
+	link := pg.RefreshLink{Exists: true}
+	if info.GetRefreshExpiresIn() > 0 {
+		link.ExpiresAt = info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn())
+	}
+	return info, link, nil
+}
+
+// GetByRefresh uses the refresh token for token information data, pg.ErrTokenExpired is returned for the expired token
+func (s *TokenStore) GetByRefresh(refresh string) (oauth2.TokenInfo, error) {
+	if refresh == "" {
+		return nil, nil
+	}
+	return s.get(pg.TokenKindRefresh, func(t *models.Token) bool { return t.Refresh == refresh })
+}
+
+// FindByClaim returns all tokens which serialized field defined by the dot-separated path equals to the value
+func (s *TokenStore) FindByClaim(path string, value interface{}) ([]oauth2.TokenInfo, error) {
+	var expected interface{}
+	if err := copyJSON(value, &expected); err != nil {
+		return nil, err
+	}
+
+	return s.selectTokens(func(item *tokenItem) (bool, error) {
+		var claim interface{}
+		if err := copyJSON(&item.token, &claim); err != nil {
+			return false, err
+		}
+		for _, key := range strings.Split(path, ".") {
+			fields, ok := claim.(map[string]interface{})
+			if !ok {
+				return false, nil
+			}
+			claim = fields[key]
+		}
+		return reflect.DeepEqual(claim, expected), nil
+	})
+}
+
+func (s *TokenStore) selectTokens(match func(item *tokenItem) (bool, error)) ([]oauth2.TokenInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]oauth2.TokenInfo, 0)
+	for i := range s.items {
+		ok, err := match(&s.items[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			tokens = append(tokens, s.items[i].info())
+		}
+	}
+	return tokens, nil
+}
+
+// ExpiredBacklog returns the exact number of expired tokens awaiting the garbage collection
+func (s *TokenStore) ExpiredBacklog(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.clock.Now()
+	var backlog int64
+	for i := range s.items {
+		if !tokenExpiresAt(&s.items[i].token).After(now) {
+			backlog++
+		}
+	}
+	return backlog, nil
+}
+
+// Statistics returns active and expired tokens counts grouped by client id and token kind
+func (s *TokenStore) Statistics(ctx context.Context) ([]pg.TokenStatistics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.clock.Now()
+	index := make(map[pg.TokenStatistics]int)
+	var stats []pg.TokenStatistics
+	for i := range s.items {
+		t := &s.items[i].token
+		key := pg.TokenStatistics{ClientID: t.ClientID, Kind: tokenKind(t)}
+		n, ok := index[key]
+		if !ok {
+			n = len(stats)
+			index[key] = n
+			stats = append(stats, key)
+		}
+		if tokenExpiresAt(t).After(now) {
+			stats[n].Active++
+		} else {
+			stats[n].Expired++
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].ClientID != stats[j].ClientID {
+			return stats[i].ClientID < stats[j].ClientID
+		}
+		return stats[i].Kind < stats[j].Kind
+	})
+	return stats, nil
+}
+
+// RemoveWhere deletes all the tokens matching the filter and returns the number of deleted tokens,
+// returns pg.ErrEmptyTokenFilter for the filter without criteria
+func (s *TokenStore) RemoveWhere(filter pg.TokenFilter) (int64, error) {
+	if filter.IsEmpty() {
+		return 0, pg.ErrEmptyTokenFilter
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeItems(func(item *tokenItem) bool { return matchFilter(filter, item) }), nil
+}
+
+// RemoveIdleSince deletes the access and refresh tokens that were not used by GetByAccess for the idle duration,
+// tokens that were never used are idle since they were created
+func (s *TokenStore) RemoveIdleSince(idle time.Duration) (int64, error) {
+	if idle <= 0 {
+		return 0, fmt.Errorf("idle duration must be positive, got %s", idle)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := s.clock.Now().Add(-idle)
+	return s.removeItems(func(item *tokenItem) bool {
+		usedAt := item.usedAt
+		if usedAt.IsZero() {
+			usedAt = item.createdAt
+		}
+		return item.token.Code == "" && !usedAt.After(since)
+	}), nil
+}
+
+// Search returns the page of the tokens matching the filter ordered by creation
+func (s *TokenStore) Search(filter pg.TokenFilter, page pg.Pagination) ([]oauth2.TokenInfo, error) {
+	tokens, err := s.selectTokens(func(item *tokenItem) (bool, error) {
+		return matchFilter(filter, item), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paginate(tokens, page), nil
+}
+
+// paginate returns the page of the tokens, default page limit is 100 as in the real store
+func paginate(tokens []oauth2.TokenInfo, page pg.Pagination) []oauth2.TokenInfo {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if page.Offset >= len(tokens) {
+		return tokens[:0]
+	}
+	tokens = tokens[page.Offset:]
+	if len(tokens) > limit {
+		tokens = tokens[:limit]
+	}
+	return tokens
+}
+
+// ListExpiringWithin returns the page of the valid tokens that expire within the duration ordered by expiration,
+// authorization codes are not listed
+func (s *TokenStore) ListExpiringWithin(d time.Duration, page pg.Pagination) ([]oauth2.TokenInfo, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("expiration window must be positive, got %s", d)
+	}
+
+	now := s.clock.Now()
+	tokens, err := s.selectTokens(func(item *tokenItem) (bool, error) {
+		expiresAt := tokenExpiresAt(&item.token)
+		return item.token.Code == "" && expiresAt.After(now) && !expiresAt.After(now.Add(d)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokenExpiresAt(tokens[i]).Before(tokenExpiresAt(tokens[j]))
+	})
+	return paginate(tokens, page), nil
+}
+
+// ForEach calls fn for every token matching the filter, iteration stops on the first fn or context error
+func (s *TokenStore) ForEach(ctx context.Context, filter pg.TokenFilter, fn func(oauth2.TokenInfo) error) error {
+	tokens, err := s.selectTokens(func(item *tokenItem) (bool, error) {
+		return matchFilter(filter, item), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Export writes all the tokens to w in the format
+func (s *TokenStore) Export(ctx context.Context, w io.Writer, format pg.ExportFormat) error {
+	return s.ForEach(ctx, pg.TokenFilter{}, func(info oauth2.TokenInfo) error {
+		if format == pg.ExportJSONLinesRedacted {
+			redactToken(info)
+		}
+		data, err := jsoniter.Marshal(info)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// Import copies all the tokens from the source into the store and returns the number of imported tokens,
+// already expired tokens are skipped
+func (s *TokenStore) Import(ctx context.Context, src pg.TokenSource) (int64, error) {
+	var imported int64
+	err := src.ForEach(ctx, func(info oauth2.TokenInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if tokenExpiresAt(info).Before(s.clock.Now()) {
+			return nil
+		}
+		if err := s.Create(info); err != nil {
+			return err
+		}
+		imported++
+		return nil
+	})
+
+	return imported, err
+}
+
+// VerifySchema always succeeds, the fake has no schema
+func (s *TokenStore) VerifySchema(ctx context.Context) error {
+	return nil
+}
+
+// Check always succeeds unless the context is done
+func (s *TokenStore) Check(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// HealthCheck always succeeds
+func (s *TokenStore) HealthCheck() error {
+	return nil
+}
+
+func matchFilter(filter pg.TokenFilter, item *tokenItem) bool {
+	t := &item.token
+	if filter.ClientID != "" && t.ClientID != filter.ClientID {
+		return false
+	}
+	if filter.UserID != "" && t.UserID != filter.UserID {
+		return false
+	}
+	if filter.Scope != "" && !contains(strings.Split(t.Scope, " "), filter.Scope) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !item.createdAt.Before(filter.CreatedBefore) {
+		return false
+	}
+	expiresAt := tokenExpiresAt(t)
+	if !filter.ExpiresAfter.IsZero() && !expiresAt.After(filter.ExpiresAfter) {
+		return false
+	}
+	if !filter.ExpiresBefore.IsZero() && expiresAt.After(filter.ExpiresBefore) {
+		return false
+	}
+	return true
+}
+
+func tokenKind(t *models.Token) pg.TokenKind {
+	if t.Code != "" {
+		return pg.TokenKindCode
+	}
+	if t.Refresh != "" {
+		return pg.TokenKindRefresh
+	}
+	return pg.TokenKindAccess
+}
+
+func tokenExpiresAt(info oauth2.TokenInfo) time.Time {
+	if info.GetCode() != "" {
+		return info.GetCodeCreateAt().Add(info.GetCodeExpiresIn())
+	}
+	if info.GetRefresh() != "" {
+		return info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn())
+	}
+	return info.GetAccessCreateAt().Add(info.GetAccessExpiresIn())
+}
+
+func redactToken(info oauth2.TokenInfo) {
+	const redacted = "[REDACTED]"
+	if info.GetCode() != "" {
+		info.SetCode(redacted)
+	}
+	if info.GetAccess() != "" {
+		info.SetAccess(redacted)
+	}
+	if info.GetRefresh() != "" {
+		info.SetRefresh(redacted)
+	}
+}
+
+// tokenKindExpired returns true if the token of the kind is expired, tokens without the expiration never expire
+func tokenKindExpired(info oauth2.TokenInfo, kind pg.TokenKind, now time.Time) bool {
+	createdAt, expiresIn := info.GetAccessCreateAt(), info.GetAccessExpiresIn()
+	switch kind {
+	case pg.TokenKindCode:
+		createdAt, expiresIn = info.GetCodeCreateAt(), info.GetCodeExpiresIn()
+	case pg.TokenKindRefresh:
+		createdAt, expiresIn = info.GetRefreshCreateAt(), info.GetRefreshExpiresIn()
+	}
+	return expiresIn > 0 && !createdAt.Add(expiresIn).After(now)
+}
@@ -0,0 +1,252 @@
+package pgmock
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3/models"
+)
+
+var _ pg.TokenStorer = (*TokenStore)(nil)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestTokenStore(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: now}
+	store := NewTokenStore(WithClock(clock))
+
+	code := &models.Token{ClientID: "c1", UserID: "u1", Scope: "read write", Code: "code", CodeCreateAt: now, CodeExpiresIn: time.Minute}
+	access := &models.Token{ClientID: "c1", UserID: "u2", Scope: "read", Access: "access", AccessCreateAt: now, AccessExpiresIn: time.Hour}
+	refresh := &models.Token{ClientID: "c2", UserID: "u1", Access: "access2", AccessCreateAt: now, AccessExpiresIn: time.Hour, Refresh: "refresh", RefreshCreateAt: now, RefreshExpiresIn: 24 * time.Hour}
+	for i, token := range []*models.Token{code, access, refresh} {
+		id, err := store.CreateWithID(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, int64(i+1), id)
+	}
+
+	info, err := store.GetByCode("code")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", info.GetUserID())
+
+	info, err = store.GetByAccess("access2")
+	require.NoError(t, err)
+	assert.Equal(t, "refresh", info.GetRefresh())
+
+	// returned token is a copy
+	info.SetUserID("changed")
+	info, err = store.GetByRefresh("refresh")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", info.GetUserID())
+
+	_, err = store.GetByAccess("unknown")
+	assert.Equal(t, pg.ErrTokenNotFound, err)
+
+	info, err = store.GetByAccess("")
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+
+	tokens, err := store.FindByClaim("UserID", "u1")
+	require.NoError(t, err)
+	assert.Len(t, tokens, 2)
+
+	tokens, err = store.Search(pg.TokenFilter{Scope: "read"}, pg.Pagination{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "access", tokens[0].GetAccess())
+
+	clock.now = now.Add(30 * time.Minute)
+	stats, err := store.Statistics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []pg.TokenStatistics{
+		{ClientID: "c1", Kind: pg.TokenKindAccess, Active: 1},
+		{ClientID: "c1", Kind: pg.TokenKindCode, Expired: 1},
+		{ClientID: "c2", Kind: pg.TokenKindRefresh, Active: 1},
+	}, stats)
+
+	backlog, err := store.ExpiredBacklog(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), backlog)
+
+	// expired code is not removed by GC yet
+	_, err = store.GetByCode("code")
+	assert.Equal(t, pg.ErrTokenExpired, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, store.Export(context.Background(), &buf, pg.ExportJSONLinesRedacted))
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+	assert.NotContains(t, buf.String(), `"access"`)
+
+	store.PauseGC()
+	assert.True(t, store.GCPaused())
+	store.TriggerGCForTest()
+	_, err = store.GetByCode("code")
+	assert.Equal(t, pg.ErrTokenExpired, err)
+
+	store.ResumeGC()
+	store.TriggerGCForTest()
+	_, err = store.GetByCode("code")
+	assert.Equal(t, pg.ErrTokenNotFound, err)
+
+	_, err = store.RemoveWhere(pg.TokenFilter{})
+	assert.Equal(t, pg.ErrEmptyTokenFilter, err)
+
+	removed, err := store.RemoveWhere(pg.TokenFilter{ClientID: "c1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	require.NoError(t, store.RemoveByRefresh("refresh"))
+	_, err = store.GetByAccess("access2")
+	assert.Equal(t, pg.ErrTokenNotFound, err)
+
+	assert.NoError(t, store.Check(context.Background()))
+	assert.NoError(t, store.Close())
+}
+
+func TestTokenStore_AuthorizationDetails(t *testing.T) {
+	store := NewTokenStore()
+
+	token := pg.NewToken()
+	token.SetAccess("access")
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Hour)
+	token.SetAuthorizationDetails([]byte(`[{"type":"payment_initiation"}]`))
+	require.NoError(t, store.Create(token))
+	require.NoError(t, store.Create(&models.Token{Access: "plain", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour}))
+
+	info, err := store.GetByAccess("access")
+	require.NoError(t, err)
+	require.IsType(t, &pg.Token{}, info)
+	assert.JSONEq(t, `[{"type":"payment_initiation"}]`, string(info.(*pg.Token).GetAuthorizationDetails()))
+
+	info, err = store.GetByAccess("plain")
+	require.NoError(t, err)
+	assert.IsType(t, &models.Token{}, info)
+}
+
+func TestTokenStore_Rotate(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: now}
+	store := NewTokenStore(WithClock(clock))
+
+	require.NoError(t, store.Create(&models.Token{Access: "a1", AccessCreateAt: now, AccessExpiresIn: time.Hour, Refresh: "r1", RefreshCreateAt: now, RefreshExpiresIn: time.Hour}))
+	family, err := store.FamilyID("r1")
+	require.NoError(t, err)
+
+	require.NoError(t, store.CreateExchanged(context.Background(), &models.Token{Access: "a1"}, &models.Token{Access: "exchanged", AccessCreateAt: now, AccessExpiresIn: time.Hour}, "actor"))
+	assert.Equal(t, pg.ErrTokenNotFound, store.CreateExchanged(context.Background(), &models.Token{Access: "unknown"}, &models.Token{Access: "a3"}, ""))
+
+	require.NoError(t, store.Rotate(context.Background(), "r1", &models.Token{Access: "a2", AccessCreateAt: now, AccessExpiresIn: time.Hour, Refresh: "r2", RefreshCreateAt: now, RefreshExpiresIn: time.Hour}))
+	assert.Equal(t, pg.ErrTokenNotFound, store.Rotate(context.Background(), "r1", &models.Token{Refresh: "r3"}))
+
+	// exchanged token is removed together with the rotated parent
+	_, err = store.GetByAccess("exchanged")
+	assert.Equal(t, pg.ErrTokenNotFound, err)
+
+	rotatedFamily, err := store.FamilyID("r2")
+	require.NoError(t, err)
+	assert.Equal(t, family, rotatedFamily)
+
+	clock.now = now.Add(2 * time.Hour)
+	assert.Equal(t, pg.ErrTokenExpired, store.Rotate(context.Background(), "r2", &models.Token{Refresh: "r3"}))
+
+	require.NoError(t, store.RemoveFamily(family))
+	_, err = store.FamilyID("r2")
+	assert.Equal(t, pg.ErrTokenNotFound, err)
+	assert.NoError(t, store.VerifySchema(context.Background()))
+}
+
+func TestTokenStore_ExtendAccess(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: now}
+	store := NewTokenStore(WithClock(clock))
+
+	require.NoError(t, store.Create(&models.Token{Access: "a1", AccessCreateAt: now, AccessExpiresIn: time.Hour, Refresh: "r1", RefreshCreateAt: now, RefreshExpiresIn: time.Hour}))
+
+	clock.now = now.Add(90 * time.Minute)
+	assert.Equal(t, pg.ErrTokenExpired, store.ExtendAccess("a1", time.Hour))
+
+	clock.now = now.Add(30 * time.Minute)
+	require.NoError(t, store.ExtendAccess("a1", time.Hour))
+	require.NoError(t, store.ExtendRefresh("r1", 2*time.Hour))
+
+	info, err := store.GetByAccess("a1")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, info.GetAccessExpiresIn())
+	assert.Equal(t, 3*time.Hour, info.GetRefreshExpiresIn())
+
+	assert.Equal(t, pg.ErrTokenNotFound, store.ExtendAccess("unknown", time.Hour))
+	assert.EqualError(t, store.ExtendRefresh("r1", -time.Hour), "token lifetime extension must be positive, got -1h0m0s")
+}
+
+func TestTokenStore_RemoveIdleSince(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: now}
+	store := NewTokenStore(WithClock(clock))
+
+	require.NoError(t, store.Create(&models.Token{Access: "used", AccessCreateAt: now, AccessExpiresIn: 24 * time.Hour}))
+	require.NoError(t, store.Create(&models.Token{Access: "idle", AccessCreateAt: now, AccessExpiresIn: 24 * time.Hour}))
+
+	clock.now = now.Add(time.Hour)
+	_, err := store.GetByAccess("used")
+	require.NoError(t, err)
+
+	clock.now = now.Add(90 * time.Minute)
+	removed, err := store.RemoveIdleSince(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	_, err = store.GetByAccess("idle")
+	assert.Equal(t, pg.ErrTokenNotFound, err)
+	_, err = store.GetByAccess("used")
+	assert.NoError(t, err)
+}
+
+func TestTokenStore_GetByAccessWithRefresh(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewTokenStore(WithClock(&fixedClock{now: now}))
+
+	require.NoError(t, store.Create(&models.Token{Access: "a1", AccessCreateAt: now, AccessExpiresIn: time.Hour, Refresh: "r1", RefreshCreateAt: now, RefreshExpiresIn: 24 * time.Hour}))
+	require.NoError(t, store.Create(&models.Token{Access: "a2", AccessCreateAt: now, AccessExpiresIn: time.Hour}))
+
+	_, link, err := store.GetByAccessWithRefresh("a1")
+	require.NoError(t, err)
+	assert.Equal(t, pg.RefreshLink{Exists: true, ExpiresAt: now.Add(24 * time.Hour)}, link)
+
+	_, link, err = store.GetByAccessWithRefresh("a2")
+	require.NoError(t, err)
+	assert.False(t, link.Exists)
+}
+
+func TestTokenStore_ListExpiringWithin(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewTokenStore(WithClock(&fixedClock{now: now}))
+
+	require.NoError(t, store.Create(&models.Token{Access: "later", AccessCreateAt: now, AccessExpiresIn: 48 * time.Hour}))
+	require.NoError(t, store.Create(&models.Token{Access: "soon", AccessCreateAt: now, AccessExpiresIn: time.Hour}))
+	require.NoError(t, store.Create(&models.Token{Access: "expired", AccessCreateAt: now.Add(-2 * time.Hour), AccessExpiresIn: time.Hour}))
+	require.NoError(t, store.Create(&models.Token{Access: "long", AccessCreateAt: now, AccessExpiresIn: 30 * 24 * time.Hour}))
+
+	tokens, err := store.ListExpiringWithin(72*time.Hour, pg.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "soon", tokens[0].GetAccess())
+	assert.Equal(t, "later", tokens[1].GetAccess())
+
+	tokens, err = store.ListExpiringWithin(72*time.Hour, pg.Pagination{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "later", tokens[0].GetAccess())
+}
@@ -0,0 +1,210 @@
+package pgtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+	"gopkg.in/yaml.v2"
+)
+
+// Stores are the stores the fixtures are loaded into and dumped from, e.g. the harness stores or pgmock fakes,
+// nil store is skipped
+type Stores struct {
+	Tokens  pg.TokenStorer
+	Clients pg.ClientStorer
+}
+
+// Fixtures is the fixture file content, JSON is the valid YAML, so both formats are read the same way.
+// Times are in RFC 3339 format and durations are in time.ParseDuration format, e.g. 1h.
+type Fixtures struct {
+	Clients []FixtureClient `yaml:"clients,omitempty" json:"clients,omitempty"`
+	Tokens  []FixtureToken  `yaml:"tokens,omitempty" json:"tokens,omitempty"`
+}
+
+// FixtureClient is the client of the fixture file
+type FixtureClient struct {
+	ID                string    `yaml:"id" json:"id"`
+	Secret            string    `yaml:"secret,omitempty" json:"secret,omitempty"`
+	Domain            string    `yaml:"domain,omitempty" json:"domain,omitempty"`
+	UserID            string    `yaml:"user_id,omitempty" json:"user_id,omitempty"`
+	RedirectURIs      []string  `yaml:"redirect_uris,omitempty" json:"redirect_uris,omitempty"`
+	AllowedScopes     []string  `yaml:"allowed_scopes,omitempty" json:"allowed_scopes,omitempty"`
+	AllowedGrantTypes []string  `yaml:"allowed_grant_types,omitempty" json:"allowed_grant_types,omitempty"`
+	ExpiresAt         time.Time `yaml:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// FixtureToken is the token of the fixture file, token created at fields default to the load time,
+// so the fixtures with the expires in fields only stay valid whenever they are loaded
+type FixtureToken struct {
+	ClientID         string        `yaml:"client_id" json:"client_id"`
+	UserID           string        `yaml:"user_id,omitempty" json:"user_id,omitempty"`
+	RedirectURI      string        `yaml:"redirect_uri,omitempty" json:"redirect_uri,omitempty"`
+	Scope            string        `yaml:"scope,omitempty" json:"scope,omitempty"`
+	Code             string        `yaml:"code,omitempty" json:"code,omitempty"`
+	CodeCreatedAt    time.Time     `yaml:"code_created_at,omitempty" json:"code_created_at,omitempty"`
+	CodeExpiresIn    time.Duration `yaml:"code_expires_in,omitempty" json:"code_expires_in,omitempty"`
+	Access           string        `yaml:"access,omitempty" json:"access,omitempty"`
+	AccessCreatedAt  time.Time     `yaml:"access_created_at,omitempty" json:"access_created_at,omitempty"`
+	AccessExpiresIn  time.Duration `yaml:"access_expires_in,omitempty" json:"access_expires_in,omitempty"`
+	Refresh          string        `yaml:"refresh,omitempty" json:"refresh,omitempty"`
+	RefreshCreatedAt time.Time     `yaml:"refresh_created_at,omitempty" json:"refresh_created_at,omitempty"`
+	RefreshExpiresIn time.Duration `yaml:"refresh_expires_in,omitempty" json:"refresh_expires_in,omitempty"`
+}
+
+// client returns the client information model of the fixture
+func (c FixtureClient) client() *pg.Client {
+	client := &pg.Client{RedirectURIs: c.RedirectURIs, AllowedScopes: c.AllowedScopes, ExpiresAt: c.ExpiresAt}
+	client.ID, client.Secret, client.Domain, client.UserID = c.ID, c.Secret, c.Domain, c.UserID
+	for _, grantType := range c.AllowedGrantTypes {
+		client.AllowedGrantTypes = append(client.AllowedGrantTypes, oauth2.GrantType(grantType))
+	}
+	return client
+}
+
+// token returns the token information model of the fixture, unset created at fields are now
+func (t FixtureToken) token(now time.Time) *models.Token {
+	createdAt := func(value string, at time.Time) time.Time {
+		if value != "" && at.IsZero() {
+			return now
+		}
+		return at
+	}
+	return &models.Token{
+		ClientID:         t.ClientID,
+		UserID:           t.UserID,
+		RedirectURI:      t.RedirectURI,
+		Scope:            t.Scope,
+		Code:             t.Code,
+		CodeCreateAt:     createdAt(t.Code, t.CodeCreatedAt),
+		CodeExpiresIn:    t.CodeExpiresIn,
+		Access:           t.Access,
+		AccessCreateAt:   createdAt(t.Access, t.AccessCreatedAt),
+		AccessExpiresIn:  t.AccessExpiresIn,
+		Refresh:          t.Refresh,
+		RefreshCreateAt:  createdAt(t.Refresh, t.RefreshCreatedAt),
+		RefreshExpiresIn: t.RefreshExpiresIn,
+	}
+}
+
+// newFixtureToken returns the fixture of the token information
+func newFixtureToken(info oauth2.TokenInfo) FixtureToken {
+	return FixtureToken{
+		ClientID:         info.GetClientID(),
+		UserID:           info.GetUserID(),
+		RedirectURI:      info.GetRedirectURI(),
+		Scope:            info.GetScope(),
+		Code:             info.GetCode(),
+		CodeCreatedAt:    info.GetCodeCreateAt(),
+		CodeExpiresIn:    info.GetCodeExpiresIn(),
+		Access:           info.GetAccess(),
+		AccessCreatedAt:  info.GetAccessCreateAt(),
+		AccessExpiresIn:  info.GetAccessExpiresIn(),
+		Refresh:          info.GetRefresh(),
+		RefreshCreatedAt: info.GetRefreshCreateAt(),
+		RefreshExpiresIn: info.GetRefreshExpiresIn(),
+	}
+}
+
+// LoadFixtures reads YAML or JSON fixtures from r and creates the clients and then the tokens in the stores,
+// so the token table referencing the client table can be seeded too. Already expired tokens are created as is,
+// e.g. to test the garbage collection.
+func LoadFixtures(ctx context.Context, stores Stores, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var fixtures Fixtures
+	if err := yaml.UnmarshalStrict(data, &fixtures); err != nil {
+		return fmt.Errorf("could not parse fixtures: %w", err)
+	}
+
+	if len(fixtures.Clients) > 0 && stores.Clients == nil {
+		return errors.New("fixtures have clients but there is no client store")
+	}
+	if len(fixtures.Tokens) > 0 && stores.Tokens == nil {
+		return errors.New("fixtures have tokens but there is no token store")
+	}
+
+	for i, c := range fixtures.Clients {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := stores.Clients.Create(c.client()); err != nil {
+			return fmt.Errorf("could not create client #%d %q: %w", i, c.ID, err)
+		}
+	}
+
+	now := time.Now()
+	for i, t := range fixtures.Tokens {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := stores.Tokens.Create(t.token(now)); err != nil {
+			return fmt.Errorf("could not create token #%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// DumpFixtures writes all the clients and tokens of the stores to w as YAML fixtures LoadFixtures reads,
+// e.g. to seed another environment with the state. Clients are dumped with the secrets as the store exports
+// them, so the secrets of the store with the secret hasher are not restored by loading the dump.
+func DumpFixtures(ctx context.Context, stores Stores, w io.Writer) error {
+	var fixtures Fixtures
+
+	if stores.Clients != nil {
+		var buf bytes.Buffer
+		if err := stores.Clients.Export(ctx, &buf, pg.ExportJSONLines); err != nil {
+			return err
+		}
+
+		decoder := jsoniter.NewDecoder(&buf)
+		for decoder.More() {
+			var client pg.Client
+			if err := decoder.Decode(&client); err != nil {
+				return err
+			}
+
+			fixture := FixtureClient{
+				ID:                client.ID,
+				Secret:            client.Secret,
+				Domain:            client.Domain,
+				UserID:            client.UserID,
+				RedirectURIs:      client.RedirectURIs,
+				AllowedScopes:     client.AllowedScopes,
+				AllowedGrantTypes: make([]string, len(client.AllowedGrantTypes)),
+				ExpiresAt:         client.ExpiresAt,
+			}
+			for i, grantType := range client.AllowedGrantTypes {
+				fixture.AllowedGrantTypes[i] = grantType.String()
+			}
+			fixtures.Clients = append(fixtures.Clients, fixture)
+		}
+	}
+
+	if stores.Tokens != nil {
+		if err := stores.Tokens.ForEach(ctx, pg.TokenFilter{}, func(info oauth2.TokenInfo) error {
+			fixtures.Tokens = append(fixtures.Tokens, newFixtureToken(info))
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	data, err := yaml.Marshal(&fixtures)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
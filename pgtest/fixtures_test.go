@@ -0,0 +1,113 @@
+package pgtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"github.com/vgarvardt/go-oauth2-pg/pgmock"
+	"gopkg.in/oauth2.v3"
+)
+
+const yamlFixtures = `
+clients:
+  - id: c1
+    secret: secret1
+    redirect_uris: [https://c1.example.com/cb]
+    allowed_scopes: [read, write]
+    allowed_grant_types: [authorization_code, refresh_token]
+tokens:
+  - client_id: c1
+    user_id: u1
+    scope: read
+    access: access1
+    access_expires_in: 1h
+    refresh: refresh1
+    refresh_created_at: 2019-01-02T03:04:05Z
+    refresh_expires_in: 720h
+  - client_id: c1
+    code: code1
+    code_expires_in: 10m
+`
+
+func TestLoadFixtures(t *testing.T) {
+	ctx := context.Background()
+	stores := Stores{Tokens: pgmock.NewTokenStore(), Clients: pgmock.NewClientStore()}
+
+	before := time.Now()
+	require.NoError(t, LoadFixtures(ctx, stores, strings.NewReader(yamlFixtures)))
+
+	client, err := stores.Clients.ValidateSecret("c1", "secret1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://c1.example.com/cb", client.GetDomain())
+	allowed, err := stores.Clients.CheckGrantType("c1", oauth2.Refreshing)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	token, err := stores.Tokens.GetByAccess("access1")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", token.GetUserID())
+	assert.Equal(t, time.Hour, token.GetAccessExpiresIn())
+	// unset created at is the load time, set one is kept
+	assert.False(t, token.GetAccessCreateAt().Before(before))
+	assert.Equal(t, time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC), token.GetRefreshCreateAt().UTC())
+
+	token, err = stores.Tokens.GetByCode("code1")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, token.GetCodeExpiresIn())
+}
+
+func TestLoadFixtures_JSON(t *testing.T) {
+	stores := Stores{Tokens: pgmock.NewTokenStore()}
+
+	require.NoError(t, LoadFixtures(context.Background(), stores, strings.NewReader(
+		`{"tokens": [{"client_id": "c1", "access": "access1", "access_expires_in": "1h"}]}`)))
+
+	token, err := stores.Tokens.GetByAccess("access1")
+	require.NoError(t, err)
+	assert.Equal(t, "c1", token.GetClientID())
+}
+
+func TestLoadFixtures_errors(t *testing.T) {
+	ctx := context.Background()
+
+	err := LoadFixtures(ctx, Stores{Tokens: pgmock.NewTokenStore()}, strings.NewReader(yamlFixtures))
+	assert.EqualError(t, err, "fixtures have clients but there is no client store")
+
+	// unknown fields are typos, not silently ignored
+	err = LoadFixtures(ctx, Stores{Clients: pgmock.NewClientStore()}, strings.NewReader("clients:\n  - id: c1\n    scopes: [read]\n"))
+	assert.Error(t, err)
+
+	err = LoadFixtures(ctx, Stores{Clients: pgmock.NewClientStore()}, strings.NewReader("clients:\n  - id: c1\n  - id: c1\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `client #1 "c1"`)
+	assert.True(t, errors.Is(err, pg.ErrClientAlreadyExists))
+}
+
+func TestDumpFixtures(t *testing.T) {
+	ctx := context.Background()
+	stores := Stores{Tokens: pgmock.NewTokenStore(), Clients: pgmock.NewClientStore()}
+	require.NoError(t, LoadFixtures(ctx, stores, strings.NewReader(yamlFixtures)))
+
+	var dump bytes.Buffer
+	require.NoError(t, DumpFixtures(ctx, stores, &dump))
+	assert.Contains(t, dump.String(), "refresh_created_at: 2019-01-02T03:04:05Z")
+	assert.Contains(t, dump.String(), "refresh_expires_in: 720h0m0s")
+
+	// the dump is loaded into another environment as is
+	restored := Stores{Tokens: pgmock.NewTokenStore(), Clients: pgmock.NewClientStore()}
+	require.NoError(t, LoadFixtures(ctx, restored, bytes.NewReader(dump.Bytes())))
+
+	var again bytes.Buffer
+	require.NoError(t, DumpFixtures(ctx, restored, &again))
+	assert.Equal(t, dump.String(), again.String())
+
+	_, err := restored.Clients.ValidateSecret("c1", "secret1")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,160 @@
+// Package pgtest is the integration test harness that starts disposable PostgreSQL instance
+// and creates ready-to-use stores backed by uniquely named tables.
+package pgtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	// registers pgx database/sql driver
+	_ "github.com/jackc/pgx/stdlib"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"github.com/vgarvardt/go-oauth2-pg/internal/pgcontainer"
+	"github.com/vgarvardt/go-pg-adapter"
+	"github.com/vgarvardt/go-pg-adapter/sqladapter"
+)
+
+// Option is the configuration options type for the harness
+type Option func(*options)
+
+type options struct {
+	uri      string
+	image    string
+	embedded bool
+}
+
+// WithURI makes the harness use already running PostgreSQL instance instead of starting the new one
+func WithURI(uri string) Option {
+	return func(o *options) {
+		o.uri = uri
+	}
+}
+
+// WithImage sets the PostgreSQL docker image, default is postgres:10
+func WithImage(image string) Option {
+	return func(o *options) {
+		o.image = image
+	}
+}
+
+// WithEmbeddedPostgres makes the harness start PostgreSQL process with fergusstrange/embedded-postgres
+// instead of docker container, for the machines without docker
+func WithEmbeddedPostgres() Option {
+	return func(o *options) {
+		o.embedded = true
+	}
+}
+
+// Harness is the disposable PostgreSQL instance with the stores factory
+type Harness struct {
+	// URI is the connection URI of the instance
+	URI string
+
+	db       *sql.DB
+	adapter  pgadapter.Adapter
+	instance *pgcontainer.Instance
+	tables   int64
+}
+
+// New starts disposable PostgreSQL docker container with testcontainers, embedded PostgreSQL process
+// if the WithEmbeddedPostgres option is set, or connects to the running instance if the WithURI option is set.
+// Harness must be closed to stop the started instance.
+func New(ctx context.Context, opts ...Option) (*Harness, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	h := &Harness{URI: o.uri}
+	if h.URI == "" {
+		var (
+			instance *pgcontainer.Instance
+			err      error
+		)
+		if o.embedded {
+			instance, err = pgcontainer.StartEmbedded(ctx)
+		} else {
+			instance, err = pgcontainer.StartDocker(ctx, o.image)
+		}
+		if err != nil {
+			return nil, err
+		}
+		h.instance = instance
+		h.URI = instance.URI
+	}
+
+	db, err := sql.Open("pgx", h.URI)
+	if err == nil {
+		err = db.PingContext(ctx)
+	}
+	if err != nil {
+		h.stop(ctx)
+		return nil, err
+	}
+
+	h.db = db
+	h.adapter = sqladapter.New(db)
+	return h, nil
+}
+
+// Adapter returns the adapter connected to the instance
+func (h *Harness) Adapter() pgadapter.Adapter {
+	return h.adapter
+}
+
+// TableName generates the table name with the prefix that is unique for the harness instance
+func (h *Harness) TableName(prefix string) string {
+	return fmt.Sprintf("%s_%d_%d", prefix, time.Now().UnixNano(), atomic.AddInt64(&h.tables, 1))
+}
+
+// TokenStore creates token store with the uniquely named table, options are applied after the table name,
+// returned cleanup function closes the store and drops its table
+func (h *Harness) TokenStore(options ...pg.TokenStoreOption) (*pg.TokenStore, func(), error) {
+	tableName := h.TableName("oauth2_tokens")
+	store, err := pg.NewTokenStore(h.adapter, append([]pg.TokenStoreOption{pg.WithTokenStoreTableName(tableName)}, options...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return store, func() {
+		store.Close()
+		h.dropTable(tableName)
+	}, nil
+}
+
+// ClientStore creates client store with the uniquely named table, options are applied after the table name,
+// returned cleanup function drops the store table
+func (h *Harness) ClientStore(options ...pg.ClientStoreOption) (*pg.ClientStore, func(), error) {
+	tableName := h.TableName("oauth2_clients")
+	store, err := pg.NewClientStore(h.adapter, append([]pg.ClientStoreOption{pg.WithClientStoreTableName(tableName)}, options...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return store, func() {
+		h.dropTable(tableName)
+	}, nil
+}
+
+func (h *Harness) dropTable(tableName string) {
+	h.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName))
+}
+
+// Close closes the connection and stops the started instance
+func (h *Harness) Close(ctx context.Context) error {
+	err := h.db.Close()
+	if stopErr := h.stop(ctx); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+func (h *Harness) stop(ctx context.Context) error {
+	if h.instance == nil {
+		return nil
+	}
+	return h.instance.Stop(ctx)
+}
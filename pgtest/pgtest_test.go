@@ -0,0 +1,54 @@
+package pgtest
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-oauth2-pg"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestHarness(t *testing.T) {
+	ctx := context.Background()
+
+	var opts []Option
+	if uri := os.Getenv("PG_URI"); uri != "" {
+		opts = append(opts, WithURI(uri))
+	}
+	if os.Getenv("PG_EMBEDDED") != "" {
+		opts = append(opts, WithEmbeddedPostgres())
+	}
+
+	h, err := New(ctx, opts...)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, h.Close(ctx))
+	}()
+
+	assert.NotEqual(t, h.TableName("test"), h.TableName("test"))
+
+	tokenStore, cleanupTokens, err := h.TokenStore(pg.WithTokenStoreGCDisabled())
+	require.NoError(t, err)
+	defer cleanupTokens()
+
+	clientStore, cleanupClients, err := h.ClientStore()
+	require.NoError(t, err)
+	defer cleanupClients()
+
+	require.NoError(t, tokenStore.Create(&models.Token{ClientID: "c1", Access: "access", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour}))
+	token, err := tokenStore.GetByAccess("access")
+	require.NoError(t, err)
+	assert.Equal(t, "c1", token.GetClientID())
+
+	require.NoError(t, clientStore.Create(&models.Client{ID: "c1", Secret: "secret", Domain: "https://example.com"}))
+	client, err := clientStore.GetByID("c1")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", client.GetSecret())
+
+	assert.NoError(t, tokenStore.Check(ctx))
+	assert.NoError(t, clientStore.Check(ctx))
+}
@@ -0,0 +1,71 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/json-iterator/go"
+)
+
+// UserDataStore is the store PurgeUserData removes the user data from together with the tokens,
+// it is implemented by ClientStore and BackchannelRequestStore
+type UserDataStore interface {
+	// userDataCondition returns the store table and the condition matching the rows of the user
+	// passed as the param
+	userDataCondition(param string) (table, condition string)
+}
+
+// PurgeReport is the number of rows removed by PurgeUserData by table name
+type PurgeReport map[string]int64
+
+// userDataCondition matches the clients registered by the user
+func (s *ClientStore) userDataCondition(param string) (string, string) {
+	return s.tableName, "data->>'UserID' = " + param
+}
+
+// userDataCondition matches the backchannel authentication requests of the user
+func (s *BackchannelRequestStore) userDataCondition(param string) (string, string) {
+	return s.tableName, "user_id = " + param
+}
+
+// PurgeUserData removes all the tokens of the user and the user data of the stores, e.g. the clients registered
+// by the user, to satisfy the right to erasure request. All the rows are removed with the single statement, so
+// either all or none of them are removed, and the number of removed rows is reported by table. Store tables have
+// to be in the same database.
+func (s *TokenStore) PurgeUserData(ctx context.Context, userID string, stores ...UserDataStore) (_ PurgeReport, err error) {
+	defer s.reportError("PurgeUserData", &err)
+
+	if userID == "" {
+		return nil, errors.New("PurgeUserData requires user id")
+	}
+	if s.compressor != nil {
+		// compressed token data can not be matched by the user
+		return nil, errors.New("PurgeUserData is not supported with token data compression")
+	}
+
+	tables := []string{s.tableName}
+	deletes := []string{fmt.Sprintf("t0 AS (DELETE FROM %s WHERE %s = $1 RETURNING 1)", s.tableName, s.fieldExpr("UserID"))}
+	for i, store := range stores {
+		table, condition := store.userDataCondition("$1")
+		tables = append(tables, table)
+		deletes = append(deletes, fmt.Sprintf("t%d AS (DELETE FROM %s WHERE %s RETURNING 1)", i+1, table, condition))
+	}
+
+	counts := make([]string, len(tables))
+	for i, table := range tables {
+		counts[i] = fmt.Sprintf("'%s', (SELECT count(*) FROM t%d)", table, i)
+	}
+
+	var item struct {
+		Report []byte `db:"report"`
+	}
+	if err := s.selectOne(ctx, &item, fmt.Sprintf("WITH %s\nSELECT jsonb_build_object(%s) AS report", strings.Join(deletes, ",\n"), strings.Join(counts, ", ")), userID); err != nil {
+		return nil, err
+	}
+
+	report := make(PurgeReport, len(tables))
+	err = jsoniter.Unmarshal(item.Report, &report)
+	return report, err
+}
@@ -0,0 +1,45 @@
+package pg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenStore_PurgeUserData(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*struct {
+			Report []byte `db:"report"`
+		}).Report = []byte(`{"tokens": 3, "clients": 1, "backchannel": 0}`)
+		return nil
+	}
+
+	tokenStore, err := NewTokenStore(adapter, WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	clientStore, err := NewClientStore(adapter, WithClientStoreTableName("clients"), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	backchannelStore, err := NewBackchannelRequestStore(adapter, WithBackchannelRequestStoreTableName("backchannel"), WithBackchannelRequestStoreGCDisabled(), WithBackchannelRequestStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	report, err := tokenStore.PurgeUserData(context.Background(), "user", clientStore, backchannelStore)
+	require.NoError(t, err)
+	assert.Equal(t, PurgeReport{"tokens": 3, "clients": 1, "backchannel": 0}, report)
+
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, `WITH t0 AS (DELETE FROM tokens WHERE data->>'UserID' = $1 RETURNING 1),
+t1 AS (DELETE FROM clients WHERE data->>'UserID' = $1 RETURNING 1),
+t2 AS (DELETE FROM backchannel WHERE user_id = $1 RETURNING 1)
+SELECT jsonb_build_object('tokens', (SELECT count(*) FROM t0), 'clients', (SELECT count(*) FROM t1), 'backchannel', (SELECT count(*) FROM t2)) AS report`, adapter.selectOneCalls[0].query)
+	assert.Equal(t, []interface{}{"user"}, adapter.selectOneCalls[0].args)
+
+	_, err = tokenStore.PurgeUserData(context.Background(), "")
+	assert.EqualError(t, err, "PurgeUserData requires user id")
+
+	tokenStore, err = NewTokenStore(adapter, WithTokenStoreCompression(GzipCompressor{}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	_, err = tokenStore.PurgeUserData(context.Background(), "user")
+	assert.EqualError(t, err, "PurgeUserData is not supported with token data compression")
+}
@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Redactor removes the sensitive values, e.g. token values or client secrets, from the error message
+type Redactor func(message string) string
+
+// detailValues matches the column values PostgreSQL echoes in the error details, e.g. "Key (access)=(...)"
+var detailValues = regexp.MustCompile(`(\([^()]*\))=\([^()]*\)`)
+
+// DefaultRedactor replaces the column values of PostgreSQL error details, e.g. "Key (access)=(...) already exists"
+// of the unique violation error, with the redacted placeholder
+func DefaultRedactor(message string) string {
+	return detailValues.ReplaceAllString(message, "$1=("+redacted+")")
+}
+
+// redactMinLength is the length of the shortest query argument redacted in the error messages, shorter arguments
+// are not the tokens or secrets, and replacing them would garble the rest of the message
+const redactMinLength = 6
+
+// redactedError is the error with the redacted message, errors.Is and errors.As still match the original error
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e redactedError) Error() string {
+	return e.message
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError replaces the query arguments echoed in the error message, e.g. by the adapter, with the redacted
+// placeholder and applies the redactor on top, the error is returned as is when there is nothing to redact
+func redactError(err error, redactor Redactor, args []interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	redactedMessage := message
+	for _, arg := range args {
+		var value string
+		switch v := arg.(type) {
+		case string:
+			value = v
+		case []byte:
+			value = string(v)
+		}
+		if len(value) >= redactMinLength {
+			redactedMessage = strings.Replace(redactedMessage, value, redacted, -1)
+		}
+	}
+	if redactor != nil {
+		redactedMessage = redactor(redactedMessage)
+	}
+
+	if redactedMessage == message {
+		return err
+	}
+	return redactedError{err: err, message: redactedMessage}
+}
@@ -0,0 +1,106 @@
+package pg
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestDefaultRedactor(t *testing.T) {
+	assert.Equal(t,
+		`duplicate key value violates unique constraint "tokens_access_key": Key (access)=([REDACTED]) already exists`,
+		DefaultRedactor(`duplicate key value violates unique constraint "tokens_access_key": Key (access)=(b2c7f1e0) already exists`),
+	)
+	assert.Equal(t, "Key (code, access)=([REDACTED])", DefaultRedactor("Key (code, access)=(c0de, acce55)"))
+	assert.Equal(t, "token not found", DefaultRedactor("token not found"))
+}
+
+func TestRedactError(t *testing.T) {
+	assert.NoError(t, redactError(nil, DefaultRedactor, nil))
+
+	// nothing to redact
+	original := errors.New("connection refused")
+	assert.Equal(t, original, redactError(original, DefaultRedactor, []interface{}{"access-token"}))
+
+	driverErr := pgx.PgError{Severity: "ERROR", Code: "22P02", Message: `invalid input syntax for type json: "access-token"`}
+	err := redactError(fmt.Errorf("query failed: %w", driverErr), DefaultRedactor, []interface{}{"access-token", []byte("refresh-token"), "id", 42})
+	assert.EqualError(t, err, `query failed: ERROR: invalid input syntax for type json: "[REDACTED]" (SQLSTATE 22P02)`)
+	assert.Equal(t, "22P02", sqlState(err))
+	assert.True(t, errors.As(err, new(pgx.PgError)))
+
+	err = redactError(errors.New("bad value refresh-token"), nil, []interface{}{[]byte("refresh-token")})
+	assert.EqualError(t, err, "bad value [REDACTED]")
+
+	// short arguments are kept
+	err = redactError(errors.New("bad value id"), nil, []interface{}{"id"})
+	assert.EqualError(t, err, "bad value id")
+}
+
+func TestTokenStore_redact(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return fmt.Errorf("pq: bad token %s", args[0])
+	}
+	var handled []error
+
+	store, err := NewTokenStore(adapter, WithTokenStoreErrorHandler(func(op string, err error) {
+		handled = append(handled, err)
+	}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	_, err = store.GetByAccess("access-token")
+	assert.EqualError(t, err, "pq: bad token [REDACTED]")
+	require.Equal(t, 1, len(handled))
+	assert.EqualError(t, handled[0], "pq: bad token [REDACTED]")
+
+	// custom redactor is applied on top
+	store, err = NewTokenStore(adapter, WithTokenStoreRedactor(func(message string) string {
+		return "redacted: " + message
+	}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	_, err = store.GetByRefresh("refresh-token")
+	assert.EqualError(t, err, "redacted: pq: bad token [REDACTED]")
+}
+
+func TestClientStore_redact(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		// adapters echoing the error details
+		return fmt.Errorf("%w: Key (secret)=(%s) already exists", pgx.PgError{Severity: "ERROR", Code: "23505", Message: "duplicate key value"}, args[1])
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	err = store.Create(&models.Client{ID: "id", Secret: "client-secret"})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrClientAlreadyExists))
+	assert.Contains(t, err.Error(), "Key (secret)=([REDACTED]) already exists")
+	assert.NotContains(t, err.Error(), "client-secret")
+}
+
+func TestRedactError_noRows(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return pgadapter.ErrNoRows
+	}
+
+	// the argument matching the no rows error message redacts it
+	tokenStore, err := NewTokenStore(adapter, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	_, err = tokenStore.GetByAccess("result")
+	assert.EqualError(t, err, "token not found: sql: no rows in [REDACTED] set")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	clientStore, err := NewClientStore(adapter, WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	_, err = clientStore.GetByID("result")
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+	assert.Equal(t, ErrClientAlreadyExists, clientStore.Create(&models.Client{ID: "result", Secret: "secret"}))
+}
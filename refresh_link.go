@@ -0,0 +1,81 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+)
+
+// RefreshLink is the refresh token issued together with the access token, e.g. for the gateway
+// to decide whether the silent renewal is possible
+type RefreshLink struct {
+	// Exists is false when there was no refresh token issued with the access token or it is removed
+	Exists bool
+	// ExpiresAt is the refresh token expiration, zero for the refresh token without the expiration
+	ExpiresAt time.Time
+}
+
+// refreshLink returns the link to the refresh token of the token information
+func refreshLink(info oauth2.TokenInfo, exists bool) RefreshLink {
+	if !exists {
+		return RefreshLink{}
+	}
+
+	link := RefreshLink{Exists: true}
+	if info.GetRefreshExpiresIn() > 0 {
+		link.ExpiresAt = info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn())
+	}
+	return link
+}
+
+// GetByAccessWithRefresh works as GetByAccess and also returns the refresh token issued with the access token.
+// The refresh token is stored in the same row, so no additional query is made. Expired refresh tokens
+// are not reported as removed until garbage collection removes them, check ExpiresAt.
+func (s *TokenStore) GetByAccessWithRefresh(access string) (oauth2.TokenInfo, RefreshLink, error) {
+	info, err := s.GetByAccess(access)
+	if err != nil || info == nil {
+		return nil, RefreshLink{}, err
+	}
+	return info, refreshLink(info, info.GetRefresh() != ""), nil
+}
+
+// GetByAccessWithRefresh works as GetByAccess and also returns the refresh token issued with the access token,
+// the refresh table is checked for the refresh token with the same query as it may be removed separately
+func (s *SplitTokenStore) GetByAccessWithRefresh(access string) (oauth2.TokenInfo, RefreshLink, error) {
+	return s.access.getByAccessLinked(access, s.refresh)
+}
+
+// getByAccessLinked looks up the access token together with the refresh token row in the refresh token store table
+func (s *TokenStore) getByAccessLinked(access string, refresh *TokenStore) (_ oauth2.TokenInfo, _ RefreshLink, err error) {
+	defer s.reportError("GetByAccessWithRefresh", &err)
+
+	if access == "" {
+		return nil, RefreshLink{}, nil
+	}
+
+	condition := "r.refresh = a.refresh"
+	if refresh.refreshReuseDetection {
+		condition += " AND r.consumed_at IS NULL"
+	}
+
+	var item struct {
+		Data          []byte `db:"data"`
+		RefreshExists bool   `db:"refresh_exists"`
+	}
+	var info oauth2.TokenInfo
+	err = s.selectOne(context.Background(), &item, fmt.Sprintf(
+		"SELECT %s AS data, a.refresh <> '' AND EXISTS (SELECT 1 FROM %s AS r WHERE %s) AS refresh_exists FROM %s AS a WHERE %s%s",
+		s.dataExpr(), refresh.tableName, condition, s.tableName, s.lookupCondition("access"), s.activeCondition()), s.lookupArg(access))
+	if err == nil {
+		if info, err = s.toTokenInfo(item.Data); err == nil && tokenKindExpired(info, TokenKindAccess, s.clock.Now()) {
+			err = ErrTokenExpired
+		}
+	}
+
+	if info, err = s.accessLookupResult(access, info, err); err != nil {
+		return nil, RefreshLink{}, err
+	}
+	return info, refreshLink(info, item.RefreshExists), nil
+}
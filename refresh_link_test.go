@@ -0,0 +1,80 @@
+package pg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestTokenStore_GetByAccessWithRefresh(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	data, err := jsoniter.Marshal(&models.Token{
+		Access: "access", AccessCreateAt: clock.now, AccessExpiresIn: time.Hour,
+		Refresh: "refresh", RefreshCreateAt: clock.now, RefreshExpiresIn: 24 * time.Hour,
+	})
+	require.NoError(t, err)
+
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*tokenDataItem).Data = data
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreClock(clock), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	// refresh token is in the same row
+	info, link, err := store.GetByAccessWithRefresh("access")
+	require.NoError(t, err)
+	assert.Equal(t, "access", info.GetAccess())
+	assert.Equal(t, RefreshLink{Exists: true, ExpiresAt: clock.now.Add(24 * time.Hour)}, link)
+	assert.Equal(t, 1, len(adapter.selectOneCalls))
+
+	info, link, err = store.GetByAccessWithRefresh("")
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+	assert.False(t, link.Exists)
+}
+
+func TestSplitTokenStore_GetByAccessWithRefresh(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	data, err := jsoniter.Marshal(&models.Token{
+		Access: "access", AccessCreateAt: clock.now, AccessExpiresIn: time.Hour,
+		Refresh: "refresh", RefreshCreateAt: clock.now, RefreshExpiresIn: 24 * time.Hour,
+	})
+	require.NoError(t, err)
+
+	adapter := new(mockAdapter)
+	store, err := NewSplitTokenStore(adapter, WithSplitTokenStoreTablePrefix("tokens"), WithSplitTokenStoreOptions(WithTokenStoreClock(clock), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	exists := true
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		value := reflect.ValueOf(dst).Elem()
+		value.FieldByName("Data").SetBytes(data)
+		value.FieldByName("RefreshExists").SetBool(exists)
+		return nil
+	}
+
+	_, link, err := store.GetByAccessWithRefresh("access")
+	require.NoError(t, err)
+	assert.Equal(t, RefreshLink{Exists: true, ExpiresAt: clock.now.Add(24 * time.Hour)}, link)
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, "SELECT data AS data, a.refresh <> '' AND EXISTS (SELECT 1 FROM tokens_refresh AS r WHERE r.refresh = a.refresh) AS refresh_exists FROM tokens_access AS a WHERE access = $1", adapter.selectOneCalls[0].query)
+
+	// refresh token removed from the refresh table
+	exists = false
+	_, link, err = store.GetByAccessWithRefresh("access")
+	require.NoError(t, err)
+	assert.Equal(t, RefreshLink{}, link)
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	_, _, err = store.GetByAccessWithRefresh("access")
+	assert.Equal(t, ErrTokenExpired, err)
+}
@@ -0,0 +1,27 @@
+package pg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rowLevelSecurityDDL returns statements that add tenant column to the table and restrict the table rows
+// to the tenant set in the settingKey run-time parameter, e.g. with SET app.tenant_id = 'tenant'.
+// Tenant column defaults to the current setting value, so inserts do not need to set it explicitly.
+func rowLevelSecurityDDL(tableName, settingKey string) string {
+	setting := fmt.Sprintf("current_setting(%s, TRUE)", quoteLiteral(settingKey))
+
+	return fmt.Sprintf(`
+ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS tenant_id TEXT DEFAULT %[2]s;
+ALTER TABLE %[1]s ENABLE ROW LEVEL SECURITY;
+ALTER TABLE %[1]s FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS %[1]s_tenant_isolation ON %[1]s;
+CREATE POLICY %[1]s_tenant_isolation ON %[1]s USING (tenant_id = %[2]s) WITH CHECK (tenant_id = %[2]s);
+CREATE INDEX IF NOT EXISTS idx_%[1]s_tenant_id ON %[1]s (tenant_id);
+`, tableName, setting)
+}
+
+// quoteLiteral quotes the value as the SQL string literal
+func quoteLiteral(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
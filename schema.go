@@ -0,0 +1,176 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/json-iterator/go"
+)
+
+// SchemaError is returned by the schema verification when the existing table lacks columns or indexes
+// used by the store, or its column types differ from the expected ones in the strict schema mode
+type SchemaError struct {
+	Table             string
+	MissingColumns    []string
+	MissingIndexes    []string
+	MismatchedColumns []string
+}
+
+func (e *SchemaError) Error() string {
+	var problems []string
+	if len(e.MissingColumns) > 0 {
+		problems = append(problems, "missing columns: "+strings.Join(e.MissingColumns, ", "))
+	}
+	if len(e.MissingIndexes) > 0 {
+		problems = append(problems, "missing indexes: "+strings.Join(e.MissingIndexes, ", "))
+	}
+	if len(e.MismatchedColumns) > 0 {
+		problems = append(problems, "mismatched column types: "+strings.Join(e.MismatchedColumns, ", "))
+	}
+	return fmt.Sprintf("table %s schema is not compatible with the store configuration, %s", e.Table, strings.Join(problems, "; "))
+}
+
+// tableColumn is the table column definition used both for the table creation and for the upgrade
+// of the table created by the previous package versions
+type tableColumn struct {
+	name        string
+	dataType    string
+	constraints string
+}
+
+// addable returns true if the column can be added to the existing table that already has rows,
+// that is the column is nullable or has the default value
+func (c tableColumn) addable() bool {
+	return !strings.Contains(c.constraints, "NOT NULL") || strings.Contains(c.constraints, "DEFAULT")
+}
+
+// canonicalTypes maps column types to the names the information schema reports them with
+var canonicalTypes = map[string]string{
+	"TIMESTAMPTZ": "timestamp with time zone",
+	"BIGSERIAL":   "bigint",
+	"BOOLEAN":     "boolean",
+	"INT8":        "bigint",
+}
+
+// canonicalType returns the column type as the information schema reports it
+func (c tableColumn) canonicalType() string {
+	if t, ok := canonicalTypes[c.dataType]; ok {
+		return t
+	}
+	return strings.ToLower(c.dataType)
+}
+
+// createTableDDL returns statements that create the table with the columns and the primary key and add
+// the columns missing in the existing table, so package upgrades do not require manual schema changes.
+// Columns that can not be added to the table with rows are expected to exist since the table creation.
+// Storage clause, e.g. YugabyteDB SPLIT INTO, is appended to the table creation statement if not empty.
+func createTableDDL(tableName, primaryKey string, columns []tableColumn, storage string) string {
+	nameWidth := 0
+	for _, column := range columns {
+		if len(column.name) > nameWidth {
+			nameWidth = len(column.name)
+		}
+	}
+
+	var ddl strings.Builder
+	fmt.Fprintf(&ddl, "\nCREATE TABLE IF NOT EXISTS %s (\n", tableName)
+	for _, column := range columns {
+		fmt.Fprintf(&ddl, "  %s,\n", strings.TrimRight(fmt.Sprintf("%-*s %-11s %s", nameWidth, column.name, column.dataType, column.constraints), " "))
+	}
+	fmt.Fprintf(&ddl, "  CONSTRAINT %[1]s_pkey PRIMARY KEY (%[2]s)\n)", tableName, primaryKey)
+	if storage != "" {
+		fmt.Fprintf(&ddl, " %s", storage)
+	}
+	ddl.WriteString(";\n\n")
+
+	for _, column := range columns {
+		if column.name == primaryKey || !column.addable() {
+			continue
+		}
+		fmt.Fprintf(&ddl, "ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s;\n", tableName,
+			strings.TrimRight(fmt.Sprintf("%s %s %s", column.name, column.dataType, column.constraints), " "))
+	}
+
+	return ddl.String()
+}
+
+var createIndexRegexp = regexp.MustCompile(`CREATE INDEX IF NOT EXISTS (\S+) ON`)
+
+// ddlIndexNames returns names of the indexes created by the table initialization statements
+func ddlIndexNames(ddl string) []string {
+	var names []string
+	for _, match := range createIndexRegexp.FindAllStringSubmatch(ddl, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// schemaItem is the existing table schema read from the information schema and the indexes catalog view
+type schemaItem struct {
+	Columns []byte `db:"columns"`
+	Indexes []byte `db:"indexes"`
+}
+
+// verifySchema checks that the existing table has all the columns and indexes, in the strict mode column types
+// are compared as well. Table name may be schema-qualified, otherwise the table is looked up in the current schema.
+func verifySchema(ctx context.Context, selectOne selectOneFunc, tableName string, columns []tableColumn, indexes []string, strict bool) error {
+	schemaName, name := "", tableName
+	if i := strings.LastIndex(tableName, "."); i >= 0 {
+		schemaName, name = tableName[:i], tableName[i+1:]
+	}
+
+	var item schemaItem
+	if err := selectOne(ctx, &item, `SELECT
+  COALESCE((SELECT jsonb_object_agg(column_name, CASE WHEN data_type = 'ARRAY' THEN substr(udt_name, 2) || '[]' ELSE data_type END) FROM information_schema.columns WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2), '{}') AS columns,
+  COALESCE((SELECT jsonb_agg(indexname) FROM pg_indexes WHERE schemaname = COALESCE(NULLIF($1, ''), current_schema()) AND tablename = $2), '[]') AS indexes`,
+		schemaName, name); err != nil {
+		return err
+	}
+
+	var (
+		existingColumns map[string]string
+		existingIndexes []string
+	)
+	if err := jsoniter.Unmarshal(item.Columns, &existingColumns); err != nil {
+		return err
+	}
+	if err := jsoniter.Unmarshal(item.Indexes, &existingIndexes); err != nil {
+		return err
+	}
+	if len(existingColumns) == 0 {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	schemaErr := &SchemaError{Table: tableName}
+	for _, column := range columns {
+		existingType, ok := existingColumns[column.name]
+		switch {
+		case !ok:
+			schemaErr.MissingColumns = append(schemaErr.MissingColumns, column.name)
+		case strict && existingType != column.canonicalType():
+			schemaErr.MismatchedColumns = append(schemaErr.MismatchedColumns,
+				fmt.Sprintf("%s is %s instead of %s", column.name, existingType, column.canonicalType()))
+		}
+	}
+	for _, index := range indexes {
+		if !containsString(existingIndexes, index) {
+			schemaErr.MissingIndexes = append(schemaErr.MissingIndexes, index)
+		}
+	}
+
+	if len(schemaErr.MissingColumns) > 0 || len(schemaErr.MissingIndexes) > 0 || len(schemaErr.MismatchedColumns) > 0 {
+		return schemaErr
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
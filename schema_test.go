@@ -0,0 +1,132 @@
+package pg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTableDDL(t *testing.T) {
+	ddl := createTableDDL("items", "id", []tableColumn{
+		{"id", "TEXT", "NOT NULL"},
+		{"data", "JSONB", "NOT NULL"},
+		{"updated_at", "TIMESTAMPTZ", "NOT NULL DEFAULT now()"},
+		{"note", "TEXT", ""},
+	}, "")
+
+	assert.Equal(t, `
+CREATE TABLE IF NOT EXISTS items (
+  id         TEXT        NOT NULL,
+  data       JSONB       NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  note       TEXT,
+  CONSTRAINT items_pkey PRIMARY KEY (id)
+);
+
+ALTER TABLE items ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE items ADD COLUMN IF NOT EXISTS note TEXT;
+`, ddl)
+}
+
+func TestTokenStore_initTableUpgrade(t *testing.T) {
+	adapter := new(mockAdapter)
+	_, err := NewTokenStore(adapter, WithTokenStoreClientForeignKey("clients"), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	assert.NoError(t, err)
+
+	query := adapter.execCalls[0].query
+	assert.Contains(t, query, "  client_id             TEXT,\n")
+	assert.Contains(t, query, "ALTER TABLE tokens ADD COLUMN IF NOT EXISTS authorization_details JSONB;")
+	assert.Contains(t, query, "ALTER TABLE tokens ADD COLUMN IF NOT EXISTS client_id TEXT;")
+	// columns without defaults are expected to exist since the table creation
+	assert.NotContains(t, query, "ADD COLUMN IF NOT EXISTS data")
+}
+
+func TestTokenStore_VerifySchema(t *testing.T) {
+	existing := schemaItem{
+		Columns: []byte(`{"id": "text", "created_at": "text", "expires_at": "text", "code": "text", "access": "text", "data": "text", "updated_at": "text"}`),
+		Indexes: []byte(`["tokens_pkey", "idx_tokens_expires_at", "idx_tokens_code", "idx_tokens_access"]`),
+	}
+
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		*dst.(*schemaItem) = existing
+		return nil
+	}
+
+	_, err := NewTokenStore(adapter, WithTokenStoreSchemaVerification(), WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.Error(t, err)
+	assert.Equal(t, "table tokens schema is not compatible with the store configuration, missing columns: refresh, authorization_details; missing indexes: idx_tokens_refresh", err.Error())
+
+	schemaErr, ok := err.(*SchemaError)
+	require.True(t, ok)
+	assert.Equal(t, []string{"refresh", "authorization_details"}, schemaErr.MissingColumns)
+	assert.Equal(t, []string{"idx_tokens_refresh"}, schemaErr.MissingIndexes)
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, []interface{}{"", "tokens"}, adapter.selectOneCalls[0].args)
+
+	existing.Columns = []byte(`{"id": "text", "created_at": "text", "expires_at": "text", "code": "text", "access": "text", "refresh": "text", "data": "text", "updated_at": "text", "authorization_details": "text"}`)
+	existing.Indexes = []byte(`["tokens_pkey", "idx_tokens_expires_at", "idx_tokens_code", "idx_tokens_access", "idx_tokens_refresh"]`)
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("auth.tokens"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(adapter.selectOneCalls))
+
+	err = store.VerifySchema(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, []interface{}{"auth", "tokens"}, adapter.selectOneCalls[1].args)
+
+	existing.Columns = []byte(`{}`)
+	err = store.VerifySchema(context.Background())
+	assert.EqualError(t, err, "table auth.tokens does not exist")
+}
+
+func TestClientStore_VerifySchema(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*schemaItem).Columns = []byte(`{"id": "text", "secret": "text", "redirect_uris": "text", "allowed_scopes": "text", "grant_types": "text", "expires_at": "text", "disabled": "text", "secrets": "text", "data": "text", "created_at": "text", "updated_at": "text", "version": "text"}`)
+		dst.(*schemaItem).Indexes = []byte(`["oauth2_clients_pkey"]`)
+		return nil
+	}
+
+	store, err := NewClientStore(adapter, WithClientStoreSchemaVerification(), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(adapter.selectOneCalls))
+
+	store.rowLevelSecurity = true
+	store.rlsSettingKey = "app.tenant_id"
+	err = store.VerifySchema(context.Background())
+	assert.EqualError(t, err, "table oauth2_clients schema is not compatible with the store configuration, missing columns: tenant_id; missing indexes: idx_oauth2_clients_tenant_id")
+	// shared columns list is not modified by the row level security column
+	assert.Equal(t, 12, len(clientTableColumns))
+}
+
+func TestTokenStore_strictSchema(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*schemaItem).Columns = []byte(`{"id": "bigint", "created_at": "timestamp with time zone", "expires_at": "timestamp without time zone", "code": "text", "access": "text", "refresh": "text", "data": "json", "updated_at": "timestamp with time zone", "authorization_details": "jsonb"}`)
+		dst.(*schemaItem).Indexes = []byte(`["tokens_pkey", "idx_tokens_expires_at", "idx_tokens_code", "idx_tokens_access", "idx_tokens_refresh"]`)
+		return nil
+	}
+
+	_, err := NewTokenStore(adapter, WithTokenStoreSchemaVerification(), WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	_, err = NewTokenStore(adapter, WithTokenStoreStrictSchema(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	assert.EqualError(t, err, "table tokens schema is not compatible with the store configuration, mismatched column types: expires_at is timestamp without time zone instead of timestamp with time zone, data is json instead of jsonb")
+	// table is initialized before the verification
+	assert.Equal(t, 1, len(adapter.execCalls))
+}
+
+func TestClientStore_strictSchema(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*schemaItem).Columns = []byte(`{"id": "text", "secret": "text", "redirect_uris": "text[]", "allowed_scopes": "text[]", "grant_types": "text[]", "expires_at": "timestamp with time zone", "disabled": "boolean", "secrets": "jsonb", "data": "jsonb", "created_at": "timestamp with time zone", "updated_at": "timestamp with time zone", "version": "bigint"}`)
+		dst.(*schemaItem).Indexes = []byte(`["oauth2_clients_pkey"]`)
+		return nil
+	}
+
+	_, err := NewClientStore(adapter, WithClientStoreStrictSchema(), WithClientStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(adapter.selectOneCalls))
+}
@@ -0,0 +1,65 @@
+package pg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// SecretCipher encrypts client secrets before they are stored and decrypts the stored ones,
+// unlike SecretHasher the stored secret can still be returned to the client owner
+type SecretCipher interface {
+	Encrypt(secret string) (string, error)
+	Decrypt(encrypted string) (string, error)
+}
+
+// AESGCMSecretCipher is the SecretCipher implementation encrypting secrets with AES-GCM,
+// encrypted secret is base64 encoded random nonce followed by the sealed secret
+type AESGCMSecretCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMSecretCipher creates AES-GCM secret cipher, the key must be 16, 24 or 32 bytes long
+// to select AES-128, AES-192 or AES-256
+func NewAESGCMSecretCipher(key []byte) (*AESGCMSecretCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCMSecretCipher{aead: aead}, nil
+}
+
+// Encrypt returns the encrypted secret, the same secret is encrypted differently every time
+func (c *AESGCMSecretCipher) Encrypt(secret string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// Decrypt returns the secret encrypted with Encrypt, error is returned for the secret encrypted
+// with another key or modified after encryption
+func (c *AESGCMSecretCipher) Decrypt(encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+
+	nonce, sealed := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	secret, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,29 @@
+package pg
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// SecretHasher hashes client secrets before they are stored and verifies secrets against stored hashes
+type SecretHasher interface {
+	Hash(secret string) (string, error)
+	Verify(hashed, secret string) bool
+}
+
+// SHA256SecretHasher is the SecretHasher implementation suitable for high-entropy generated secrets,
+// use slow hashing algorithm like bcrypt for user-chosen secrets
+type SHA256SecretHasher struct{}
+
+// Hash returns hex encoded SHA-256 digest of the secret
+func (SHA256SecretHasher) Hash(secret string) (string, error) {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks in constant time if the secret digest matches the hashed one
+func (h SHA256SecretHasher) Verify(hashed, secret string) bool {
+	sum, _ := h.Hash(secret)
+	return subtle.ConstantTimeCompare([]byte(hashed), []byte(sum)) == 1
+}
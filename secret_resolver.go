@@ -0,0 +1,17 @@
+package pg
+
+import "context"
+
+// SecretResolver resolves the client secret reference stored instead of the secret, e.g. Vault path
+// or KMS-wrapped secret, into the secret itself
+type SecretResolver interface {
+	Resolve(ctx context.Context, reference string) (string, error)
+}
+
+// SecretResolverFunc is the function implementing SecretResolver
+type SecretResolverFunc func(ctx context.Context, reference string) (string, error)
+
+// Resolve calls f(ctx, reference)
+func (f SecretResolverFunc) Resolve(ctx context.Context, reference string) (string, error) {
+	return f(ctx, reference)
+}
@@ -0,0 +1,229 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3"
+)
+
+// ShardedTokenStore is the token store that distributes tokens across the number of tables by the hash
+// of the token value, so every table and its indexes stay small. Authorization codes are routed by the code,
+// other tokens by the access token, refresh token lookups and removals query all the shards.
+// Tokens are routed by the shards count, so it can not be changed without migrating the stored tokens.
+type ShardedTokenStore struct {
+	shards     []*TokenStore
+	gcStrategy GCStrategy
+}
+
+// ShardedTokenStoreOption is the configuration options type for sharded token store
+type ShardedTokenStoreOption func(c *shardedTokenStoreConfig)
+
+type shardedTokenStoreConfig struct {
+	tablePrefix string
+	gcDisabled  bool
+	gcInterval  time.Duration
+	options     []TokenStoreOption
+}
+
+// WithShardedTokenStoreTablePrefix returns option that sets sharded token store tables name prefix,
+// tables are named <prefix>_0 to <prefix>_<shards-1>, default prefix is oauth2_tokens
+func WithShardedTokenStoreTablePrefix(prefix string) ShardedTokenStoreOption {
+	return func(c *shardedTokenStoreConfig) {
+		c.tablePrefix = prefix
+	}
+}
+
+// WithShardedTokenStoreOptions returns option that applies token store options to all the shards,
+// GC is run by the sharded store itself, so the shards GC interval, strategy, schedule and creates count options
+// are refused, GC retention and run options apply to every shard cleaned by the sharded store
+func WithShardedTokenStoreOptions(options ...TokenStoreOption) ShardedTokenStoreOption {
+	return func(c *shardedTokenStoreConfig) {
+		c.options = append(c.options, options...)
+	}
+}
+
+// WithShardedTokenStoreGCInterval returns option that sets the interval of the garbage collection pass
+// that cleans all the shards one by one, default is 10 minutes
+func WithShardedTokenStoreGCInterval(interval time.Duration) ShardedTokenStoreOption {
+	return func(c *shardedTokenStoreConfig) {
+		c.gcInterval = interval
+	}
+}
+
+// WithShardedTokenStoreGCDisabled returns option that disables the garbage collection of all the shards
+func WithShardedTokenStoreGCDisabled() ShardedTokenStoreOption {
+	return func(c *shardedTokenStoreConfig) {
+		c.gcDisabled = true
+	}
+}
+
+// NewShardedTokenStore creates sharded token store instance with the number of shard tables
+func NewShardedTokenStore(adapter pgadapter.Adapter, shards int, options ...ShardedTokenStoreOption) (*ShardedTokenStore, error) {
+	config := &shardedTokenStoreConfig{
+		tablePrefix: "oauth2_tokens",
+		gcInterval:  10 * time.Minute,
+	}
+
+	for _, o := range options {
+		o(config)
+	}
+
+	switch {
+	case shards <= 0:
+		return nil, fmt.Errorf("invalid sharded token store configuration: shards count must be positive, got %d", shards)
+	case config.gcInterval <= 0:
+		return nil, fmt.Errorf("invalid sharded token store configuration: GC interval must be positive, got %s", config.gcInterval)
+	case shardsGCScheduled(config.options):
+		return nil, errors.New("invalid sharded token store configuration: GC of the shards is scheduled by the sharded store, use its GC options")
+	}
+
+	store := &ShardedTokenStore{shards: make([]*TokenStore, 0, shards)}
+	for i := 0; i < shards; i++ {
+		storeOptions := append([]TokenStoreOption{
+			WithTokenStoreTableName(fmt.Sprintf("%s_%d", config.tablePrefix, i)),
+			WithTokenStoreGCDisabled(),
+		}, config.options...)
+
+		shard, err := NewTokenStore(adapter, storeOptions...)
+		if err != nil {
+			store.closeShards(context.Background())
+			return nil, err
+		}
+		store.shards = append(store.shards, shard)
+	}
+
+	if !config.gcDisabled {
+		store.gcStrategy = &TickerGCStrategy{Interval: config.gcInterval}
+		store.gcStrategy.Start(store.clean)
+	}
+
+	return store, nil
+}
+
+// shardsGCScheduled returns true if the shards options schedule garbage collection of every shard
+func shardsGCScheduled(options []TokenStoreOption) bool {
+	probe := new(TokenStore)
+	for _, o := range options {
+		o(probe)
+	}
+	return probe.gcIntervalSet || probe.gcStrategy != nil || probe.gcEveryCreates != 0 || probe.gcBacklogCap != 0
+}
+
+// clean runs garbage collection pass over all the shards one by one, so only one shard is cleaned at a time
+func (s *ShardedTokenStore) clean() {
+	for _, shard := range s.shards {
+		shard.clean()
+	}
+}
+
+// TriggerGCForTest runs garbage collection pass over all the shards synchronously
+func (s *ShardedTokenStore) TriggerGCForTest() {
+	s.clean()
+}
+
+// Shards returns the underlying token stores of the shards, e.g. for statistics, search or export
+func (s *ShardedTokenStore) Shards() []*TokenStore {
+	return s.shards
+}
+
+// shard returns the shard of the token value
+func (s *ShardedTokenStore) shard(value string) *TokenStore {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Close stops garbage collection of all the shards
+func (s *ShardedTokenStore) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext stops garbage collection of all the shards and waits for in-flight operations
+func (s *ShardedTokenStore) CloseContext(ctx context.Context) error {
+	if s.gcStrategy != nil {
+		s.gcStrategy.Stop()
+	}
+	return s.closeShards(ctx)
+}
+
+func (s *ShardedTokenStore) closeShards(ctx context.Context) error {
+	var err error
+	for _, shard := range s.shards {
+		if closeErr := shard.CloseContext(ctx); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Create creates and stores the new token information in the shard of its authorization code or access token
+func (s *ShardedTokenStore) Create(info oauth2.TokenInfo) error {
+	if code := info.GetCode(); code != "" {
+		return s.shard(code).Create(info)
+	}
+	return s.shard(info.GetAccess()).Create(info)
+}
+
+// RemoveByCode deletes the authorization code
+func (s *ShardedTokenStore) RemoveByCode(code string) error {
+	return s.shard(code).RemoveByCode(code)
+}
+
+// RemoveByAccess uses the access token to delete the token information
+func (s *ShardedTokenStore) RemoveByAccess(access string) error {
+	return s.shard(access).RemoveByAccess(access)
+}
+
+// RemoveByRefresh uses the refresh token to delete the token information from all the shards
+func (s *ShardedTokenStore) RemoveByRefresh(refresh string) error {
+	for _, shard := range s.shards {
+		if err := shard.RemoveByRefresh(refresh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetByCode uses the authorization code for token information data
+func (s *ShardedTokenStore) GetByCode(code string) (oauth2.TokenInfo, error) {
+	return s.shard(code).GetByCode(code)
+}
+
+// GetByAccess uses the access token for token information data
+func (s *ShardedTokenStore) GetByAccess(access string) (oauth2.TokenInfo, error) {
+	return s.shard(access).GetByAccess(access)
+}
+
+// GetByRefresh uses the refresh token for token information data, shards are queried one by one until found
+func (s *ShardedTokenStore) GetByRefresh(refresh string) (oauth2.TokenInfo, error) {
+	var (
+		info oauth2.TokenInfo
+		err  error
+	)
+	for _, shard := range s.shards {
+		if info, err = shard.GetByRefresh(refresh); !isNotFound(info, err) {
+			return info, err
+		}
+	}
+	return info, err
+}
+
+// Check checks that the database is reachable and all the shard tables exist
+func (s *ShardedTokenStore) Check(ctx context.Context) error {
+	for _, shard := range s.shards {
+		if err := shard.Check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HealthCheck is the context-less Check version compatible with heptiolabs/healthcheck Check
+func (s *ShardedTokenStore) HealthCheck() error {
+	return s.Check(context.Background())
+}
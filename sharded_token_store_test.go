@@ -0,0 +1,135 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestShardedTokenStore(t *testing.T) {
+	_, err := NewShardedTokenStore(nil, 0)
+	assert.EqualError(t, err, "invalid sharded token store configuration: shards count must be positive, got 0")
+
+	// GC of the shards is run by the sharded store only
+	for _, option := range []TokenStoreOption{
+		WithTokenStoreGCInterval(time.Minute),
+		WithTokenStoreGCSchedule("0 3 * * *"),
+		WithTokenStoreGCEveryCreates(100),
+	} {
+		_, err = NewShardedTokenStore(nil, 2, WithShardedTokenStoreOptions(WithTokenStoreGCRetention(time.Hour), option))
+		assert.EqualError(t, err, "invalid sharded token store configuration: GC of the shards is scheduled by the sharded store, use its GC options")
+	}
+
+	adapter := new(mockAdapter)
+	store, err := NewShardedTokenStore(adapter, 4, WithShardedTokenStoreTablePrefix("tokens"), WithShardedTokenStoreGCDisabled())
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.Equal(t, 4, len(store.Shards()))
+	require.Equal(t, 4, len(adapter.execCalls))
+	for i, shard := range store.Shards() {
+		assert.Equal(t, fmt.Sprintf("tokens_%d", i), shard.tableName)
+		assert.Contains(t, adapter.execCalls[i].query, fmt.Sprintf("CREATE TABLE IF NOT EXISTS tokens_%d (", i))
+	}
+	adapter.execCalls = nil
+
+	// same values are always routed to the same shard
+	assert.Equal(t, store.shard("access"), store.shard("access"))
+	shards := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		shards[store.shard(fmt.Sprintf("access %d", i)).tableName] = true
+	}
+	assert.Equal(t, 4, len(shards))
+
+	token := models.NewToken()
+	token.SetAccess("access")
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Hour)
+	token.SetRefresh("refresh")
+	require.NoError(t, store.Create(token))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.True(t, strings.HasPrefix(adapter.selectOneCalls[0].query, fmt.Sprintf("INSERT INTO %s ", store.shard("access").tableName)))
+
+	code := models.NewToken()
+	code.SetCode("code")
+	require.NoError(t, store.Create(code))
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.True(t, strings.HasPrefix(adapter.selectOneCalls[1].query, fmt.Sprintf("INSERT INTO %s ", store.shard("code").tableName)))
+
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return pgadapter.ErrNoRows
+	}
+	_, err = store.GetByAccess("access")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	require.Equal(t, 3, len(adapter.selectOneCalls))
+	assert.True(t, strings.HasSuffix(adapter.selectOneCalls[2].query, fmt.Sprintf("FROM %s WHERE access = $1", store.shard("access").tableName)))
+
+	// refresh token is looked up and removed in all the shards
+	_, err = store.GetByRefresh("refresh")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	assert.Equal(t, 7, len(adapter.selectOneCalls))
+
+	require.NoError(t, store.RemoveByRefresh("refresh"))
+	require.Equal(t, 4, len(adapter.execCalls))
+	assert.Equal(t, "DELETE FROM tokens_3 WHERE refresh = $1", adapter.execCalls[3].query)
+
+	require.NoError(t, store.RemoveByAccess("access"))
+	require.Equal(t, 5, len(adapter.execCalls))
+	assert.Equal(t, fmt.Sprintf("DELETE FROM %s WHERE access = $1", store.shard("access").tableName), adapter.execCalls[4].query)
+
+	adapter.selectCallback = nil
+	store.TriggerGCForTest()
+	require.Equal(t, 11, len(adapter.selectOneCalls))
+	assert.Equal(t, "WITH deleted AS (DELETE FROM tokens_0 WHERE expires_at <= $1 RETURNING 1) SELECT count(*) AS count FROM deleted", adapter.selectOneCalls[7].query)
+}
+
+func runShardedTokenStoreTest(t *testing.T, store *ShardedTokenStore) {
+	code := fmt.Sprintf("code %s", time.Now().String())
+	access := fmt.Sprintf("access %s", time.Now().String())
+	refresh := fmt.Sprintf("refresh %s", time.Now().String())
+
+	tokenCode := models.NewToken()
+	tokenCode.SetCode(code)
+	tokenCode.SetCodeCreateAt(time.Now())
+	tokenCode.SetCodeExpiresIn(time.Minute)
+	require.NoError(t, store.Create(tokenCode))
+
+	token, err := store.GetByCode(code)
+	require.NoError(t, err)
+	assert.Equal(t, code, token.GetCode())
+
+	tokenAccess := models.NewToken()
+	tokenAccess.SetAccess(access)
+	tokenAccess.SetAccessCreateAt(time.Now())
+	tokenAccess.SetAccessExpiresIn(time.Minute)
+	tokenAccess.SetRefresh(refresh)
+	tokenAccess.SetRefreshCreateAt(time.Now())
+	tokenAccess.SetRefreshExpiresIn(time.Hour)
+	require.NoError(t, store.Create(tokenAccess))
+
+	token, err = store.GetByAccess(access)
+	require.NoError(t, err)
+	assert.Equal(t, refresh, token.GetRefresh())
+
+	token, err = store.GetByRefresh(refresh)
+	require.NoError(t, err)
+	assert.Equal(t, access, token.GetAccess())
+
+	require.NoError(t, store.RemoveByRefresh(refresh))
+
+	_, err = store.GetByAccess(access)
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	_, err = store.GetByRefresh(refresh)
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	store.TriggerGCForTest()
+	assert.NoError(t, store.Check(context.Background()))
+}
@@ -0,0 +1,213 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3"
+)
+
+// SplitTokenStore is the token store that keeps authorization codes, access tokens and refresh tokens
+// in separate tables with their own indexes and GC schedules instead of the single wide sparse table.
+// Token information with both access and refresh tokens is stored in both access and refresh tables,
+// each row expires with its own token, removing the token by either value removes both rows.
+type SplitTokenStore struct {
+	code    *TokenStore
+	access  *TokenStore
+	refresh *TokenStore
+}
+
+// SplitTokenStoreOption is the configuration options type for split token store
+type SplitTokenStoreOption func(c *splitTokenStoreConfig)
+
+type splitTokenStoreConfig struct {
+	tablePrefix string
+	options     map[TokenKind][]TokenStoreOption
+}
+
+// WithSplitTokenStoreTablePrefix returns option that sets split token store tables name prefix,
+// tables are named <prefix>_code, <prefix>_access and <prefix>_refresh, default prefix is oauth2_tokens
+func WithSplitTokenStoreTablePrefix(prefix string) SplitTokenStoreOption {
+	return func(c *splitTokenStoreConfig) {
+		c.tablePrefix = prefix
+	}
+}
+
+// WithSplitTokenStoreOptions returns option that applies token store options to the tables of all kinds
+func WithSplitTokenStoreOptions(options ...TokenStoreOption) SplitTokenStoreOption {
+	return func(c *splitTokenStoreConfig) {
+		for _, kind := range []TokenKind{TokenKindCode, TokenKindAccess, TokenKindRefresh} {
+			c.options[kind] = append(c.options[kind], options...)
+		}
+	}
+}
+
+// WithSplitTokenStoreKindOptions returns option that applies token store options to the table of the kind only,
+// e.g. to set GC interval for the refresh tokens
+func WithSplitTokenStoreKindOptions(kind TokenKind, options ...TokenStoreOption) SplitTokenStoreOption {
+	return func(c *splitTokenStoreConfig) {
+		c.options[kind] = append(c.options[kind], options...)
+	}
+}
+
+// NewSplitTokenStore creates split token store instance. Default GC intervals are one minute for authorization codes,
+// ten minutes for access tokens and one hour for refresh tokens.
+func NewSplitTokenStore(adapter pgadapter.Adapter, options ...SplitTokenStoreOption) (*SplitTokenStore, error) {
+	config := &splitTokenStoreConfig{
+		tablePrefix: "oauth2_tokens",
+		options: map[TokenKind][]TokenStoreOption{
+			TokenKindCode:    {withTokenStoreDefaultGCInterval(time.Minute)},
+			TokenKindAccess:  {withTokenStoreDefaultGCInterval(10 * time.Minute)},
+			TokenKindRefresh: {withTokenStoreDefaultGCInterval(time.Hour)},
+		},
+	}
+
+	for _, o := range options {
+		o(config)
+	}
+
+	newStore := func(kind TokenKind, lookupColumns ...string) (*TokenStore, error) {
+		storeOptions := append([]TokenStoreOption{
+			WithTokenStoreTableName(fmt.Sprintf("%s_%s", config.tablePrefix, kind)),
+			withTokenStoreSplitKind(kind, lookupColumns),
+		}, config.options[kind]...)
+		return NewTokenStore(adapter, storeOptions...)
+	}
+
+	store := new(SplitTokenStore)
+	var err error
+	if store.code, err = newStore(TokenKindCode, "code"); err != nil {
+		return nil, err
+	}
+	if store.access, err = newStore(TokenKindAccess, "access", "refresh"); err != nil {
+		store.code.Close()
+		return nil, err
+	}
+	if store.refresh, err = newStore(TokenKindRefresh, "refresh", "access"); err != nil {
+		store.code.Close()
+		store.access.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// withTokenStoreSplitKind returns option that makes the store expire rows by the token kind
+// and index only the looked up columns
+func withTokenStoreSplitKind(kind TokenKind, lookupColumns []string) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.expiryKind = kind
+		s.lookupColumns = lookupColumns
+	}
+}
+
+// withTokenStoreDefaultGCInterval returns option that changes default GC interval, unlike WithTokenStoreGCInterval
+// it can be combined with disabled GC or custom GC strategy
+func withTokenStoreDefaultGCInterval(interval time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcInterval = interval
+	}
+}
+
+// Store returns the underlying token store of the kind, e.g. for statistics, search or export
+func (s *SplitTokenStore) Store(kind TokenKind) *TokenStore {
+	switch kind {
+	case TokenKindCode:
+		return s.code
+	case TokenKindAccess:
+		return s.access
+	case TokenKindRefresh:
+		return s.refresh
+	}
+	return nil
+}
+
+// Close stops garbage collection of all the tables
+func (s *SplitTokenStore) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext stops garbage collection of all the tables and waits for in-flight operations
+func (s *SplitTokenStore) CloseContext(ctx context.Context) error {
+	var err error
+	for _, store := range []*TokenStore{s.code, s.access, s.refresh} {
+		if closeErr := store.CloseContext(ctx); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Create creates and stores the new token information in the tables of its kinds
+func (s *SplitTokenStore) Create(info oauth2.TokenInfo) error {
+	if info.GetCode() != "" {
+		return s.code.Create(info)
+	}
+
+	if err := s.access.Create(info); err != nil {
+		return err
+	}
+	if info.GetRefresh() == "" {
+		return nil
+	}
+
+	if err := s.refresh.Create(info); err != nil {
+		// do not leave access token without its refresh token
+		s.access.RemoveByAccess(info.GetAccess())
+		return err
+	}
+	return nil
+}
+
+// RemoveByCode deletes the authorization code
+func (s *SplitTokenStore) RemoveByCode(code string) error {
+	return s.code.RemoveByCode(code)
+}
+
+// RemoveByAccess uses the access token to delete the token information from access and refresh tables
+func (s *SplitTokenStore) RemoveByAccess(access string) error {
+	if err := s.access.RemoveByAccess(access); err != nil {
+		return err
+	}
+	return s.refresh.RemoveByAccess(access)
+}
+
+// RemoveByRefresh uses the refresh token to delete the token information from refresh and access tables
+func (s *SplitTokenStore) RemoveByRefresh(refresh string) error {
+	if err := s.refresh.RemoveByRefresh(refresh); err != nil {
+		return err
+	}
+	return s.access.RemoveByRefresh(refresh)
+}
+
+// GetByCode uses the authorization code for token information data
+func (s *SplitTokenStore) GetByCode(code string) (oauth2.TokenInfo, error) {
+	return s.code.GetByCode(code)
+}
+
+// GetByAccess uses the access token for token information data
+func (s *SplitTokenStore) GetByAccess(access string) (oauth2.TokenInfo, error) {
+	return s.access.GetByAccess(access)
+}
+
+// GetByRefresh uses the refresh token for token information data
+func (s *SplitTokenStore) GetByRefresh(refresh string) (oauth2.TokenInfo, error) {
+	return s.refresh.GetByRefresh(refresh)
+}
+
+// Check checks that the database is reachable and all the store tables exist
+func (s *SplitTokenStore) Check(ctx context.Context) error {
+	for _, store := range []*TokenStore{s.code, s.access, s.refresh} {
+		if err := store.Check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HealthCheck is the context-less Check version compatible with heptiolabs/healthcheck Check
+func (s *SplitTokenStore) HealthCheck() error {
+	return s.Check(context.Background())
+}
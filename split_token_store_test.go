@@ -0,0 +1,129 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/oauth2.v3/models"
+)
+
+func TestSplitTokenStore(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewSplitTokenStore(
+		adapter,
+		WithSplitTokenStoreTablePrefix("tokens"),
+		WithSplitTokenStoreOptions(WithTokenStoreGCDisabled()),
+	)
+	require.NoError(t, err)
+	defer store.Close()
+
+	assert.Equal(t, "tokens_code", store.Store(TokenKindCode).tableName)
+	assert.Equal(t, "tokens_access", store.Store(TokenKindAccess).tableName)
+	assert.Equal(t, "tokens_refresh", store.Store(TokenKindRefresh).tableName)
+	assert.Nil(t, store.Store("unknown"))
+
+	// every table indexes its lookup columns only
+	require.Equal(t, 3, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "idx_tokens_code_code ON")
+	assert.NotContains(t, adapter.execCalls[0].query, "idx_tokens_code_access ON")
+	assert.Contains(t, adapter.execCalls[1].query, "idx_tokens_access_access ON")
+	assert.Contains(t, adapter.execCalls[1].query, "idx_tokens_access_refresh ON")
+	assert.NotContains(t, adapter.execCalls[1].query, "idx_tokens_access_code ON")
+	assert.Contains(t, adapter.execCalls[2].query, "idx_tokens_refresh_refresh ON")
+	adapter.execCalls = nil
+
+	now := time.Now()
+	token := models.NewToken()
+	token.SetAccess("access")
+	token.SetAccessCreateAt(now)
+	token.SetAccessExpiresIn(time.Hour)
+	token.SetRefresh("refresh")
+	token.SetRefreshCreateAt(now)
+	token.SetRefreshExpiresIn(24 * time.Hour)
+	require.NoError(t, store.Create(token))
+
+	// access and refresh rows expire with their own tokens
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.True(t, strings.HasPrefix(adapter.selectOneCalls[0].query, "INSERT INTO tokens_access "))
+	assert.Equal(t, now.Add(time.Hour), adapter.selectOneCalls[0].args[1])
+	assert.True(t, strings.HasPrefix(adapter.selectOneCalls[1].query, "INSERT INTO tokens_refresh "))
+	assert.Equal(t, now.Add(24*time.Hour), adapter.selectOneCalls[1].args[1])
+
+	code := models.NewToken()
+	code.SetCode("code")
+	code.SetCodeCreateAt(now)
+	code.SetCodeExpiresIn(time.Minute)
+	require.NoError(t, store.Create(code))
+	require.Equal(t, 3, len(adapter.selectOneCalls))
+	assert.True(t, strings.HasPrefix(adapter.selectOneCalls[2].query, "INSERT INTO tokens_code "))
+
+	require.NoError(t, store.RemoveByRefresh("refresh"))
+	require.Equal(t, 2, len(adapter.execCalls))
+	assert.Equal(t, "DELETE FROM tokens_refresh WHERE refresh = $1", adapter.execCalls[0].query)
+	assert.Equal(t, "DELETE FROM tokens_access WHERE refresh = $1", adapter.execCalls[1].query)
+
+	// mock returns no data, only the query matters
+	store.GetByAccess("access")
+	require.Equal(t, 4, len(adapter.selectOneCalls))
+	assert.True(t, strings.HasSuffix(adapter.selectOneCalls[3].query, "FROM tokens_access WHERE access = $1"))
+}
+
+func runSplitTokenStoreTest(t *testing.T, store *SplitTokenStore) {
+	code := fmt.Sprintf("code %s", time.Now().String())
+	access := fmt.Sprintf("access %s", time.Now().String())
+	refresh := fmt.Sprintf("refresh %s", time.Now().String())
+
+	tokenCode := models.NewToken()
+	tokenCode.SetCode(code)
+	tokenCode.SetCodeCreateAt(time.Now())
+	tokenCode.SetCodeExpiresIn(time.Minute)
+	require.NoError(t, store.Create(tokenCode))
+
+	token, err := store.GetByCode(code)
+	require.NoError(t, err)
+	assert.Equal(t, code, token.GetCode())
+
+	tokenAccess := models.NewToken()
+	tokenAccess.SetAccess(access)
+	tokenAccess.SetAccessCreateAt(time.Now())
+	tokenAccess.SetAccessExpiresIn(time.Minute)
+	tokenAccess.SetRefresh(refresh)
+	tokenAccess.SetRefreshCreateAt(time.Now())
+	tokenAccess.SetRefreshExpiresIn(time.Hour)
+	require.NoError(t, store.Create(tokenAccess))
+
+	token, err = store.GetByAccess(access)
+	require.NoError(t, err)
+	assert.Equal(t, refresh, token.GetRefresh())
+
+	token, err = store.GetByRefresh(refresh)
+	require.NoError(t, err)
+	assert.Equal(t, access, token.GetAccess())
+
+	_, link, err := store.GetByAccessWithRefresh(access)
+	require.NoError(t, err)
+	assert.True(t, link.Exists)
+	assert.Equal(t, tokenAccess.GetRefreshCreateAt().Add(time.Hour), link.ExpiresAt)
+
+	// refresh token removed from its table only is reported as removed
+	require.NoError(t, store.Store(TokenKindRefresh).RemoveByRefresh(refresh))
+	_, link, err = store.GetByAccessWithRefresh(access)
+	require.NoError(t, err)
+	assert.False(t, link.Exists)
+
+	require.NoError(t, store.RemoveByAccess(access))
+
+	_, err = store.GetByAccess(access)
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	_, err = store.GetByRefresh(refresh)
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	assert.NoError(t, store.Check(context.Background()))
+}
@@ -0,0 +1,80 @@
+package pg
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"gopkg.in/oauth2.v3"
+)
+
+// TokenStorer is the full TokenStore method set, implemented by TokenStore and pgmock.TokenStore,
+// so stores can be decorated or composed and replaced by fakes in tests
+type TokenStorer interface {
+	oauth2.TokenStore
+	io.Closer
+
+	CloseContext(ctx context.Context) error
+	Drain(ctx context.Context) error
+	VerifySchema(ctx context.Context) error
+	Check(ctx context.Context) error
+	HealthCheck() error
+
+	CreateWithID(ctx context.Context, info oauth2.TokenInfo) (int64, error)
+	CreateWithKey(ctx context.Context, info oauth2.TokenInfo) (string, error)
+	Rotate(ctx context.Context, refresh string, info oauth2.TokenInfo) error
+	ExtendAccess(access string, d time.Duration) error
+	ExtendRefresh(refresh string, d time.Duration) error
+	CreateExchanged(ctx context.Context, parent, info oauth2.TokenInfo, actor string) error
+	FamilyID(refresh string) (string, error)
+	RemoveFamily(familyID string) error
+
+	GetByAccessWithRefresh(access string) (oauth2.TokenInfo, RefreshLink, error)
+	FindByClaim(path string, value interface{}) ([]oauth2.TokenInfo, error)
+	Search(filter TokenFilter, page Pagination) ([]oauth2.TokenInfo, error)
+	ListExpiringWithin(d time.Duration, page Pagination) ([]oauth2.TokenInfo, error)
+	ForEach(ctx context.Context, filter TokenFilter, fn func(oauth2.TokenInfo) error) error
+	RemoveWhere(filter TokenFilter) (int64, error)
+	RemoveIdleSince(idle time.Duration) (int64, error)
+	Statistics(ctx context.Context) ([]TokenStatistics, error)
+	ExpiredBacklog(ctx context.Context) (int64, error)
+	Export(ctx context.Context, w io.Writer, format ExportFormat) error
+	Import(ctx context.Context, src TokenSource) (int64, error)
+}
+
+// ClientStorer is the full ClientStore method set, implemented by ClientStore and pgmock.ClientStore,
+// so stores can be decorated or composed and replaced by fakes in tests. DeleteWithTokens is not the part
+// of the interface as it requires both stores to be in the same database.
+type ClientStorer interface {
+	oauth2.ClientStore
+
+	VerifySchema(ctx context.Context) error
+	Check(ctx context.Context) error
+	HealthCheck() error
+
+	Create(info oauth2.ClientInfo) error
+	CreateIfNotExists(info oauth2.ClientInfo) (bool, error)
+	EnsureClients(clients []oauth2.ClientInfo) ([]ClientSeedResult, error)
+	ImportJSON(ctx context.Context, r io.Reader) ([]ClientSeedResult, error)
+	GetWithVersion(id string) (oauth2.ClientInfo, int64, error)
+	Update(info oauth2.ClientInfo, version int64) (int64, error)
+	Delete(id string) error
+	Disable(id string) error
+	Enable(id string) error
+
+	ValidateSecret(id, secret string) (oauth2.ClientInfo, error)
+	Secrets(id string) ([]ClientSecret, error)
+	RotateSecret(id string) (string, error)
+	ValidateRedirectURI(id, uri string) (bool, error)
+	CheckScope(clientID string, scope string) (bool, error)
+	AllowedGrantTypes(id string) ([]oauth2.GrantType, error)
+	CheckGrantType(clientID string, grant oauth2.GrantType) (bool, error)
+
+	Export(ctx context.Context, w io.Writer, format ExportFormat) error
+	Import(ctx context.Context, src ClientSource) (int64, error)
+}
+
+var (
+	_ TokenStorer  = (*TokenStore)(nil)
+	_ ClientStorer = (*ClientStore)(nil)
+)
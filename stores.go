@@ -0,0 +1,206 @@
+package pg
+
+import (
+	"time"
+
+	"github.com/vgarvardt/go-pg-adapter"
+)
+
+// StoresOption is the configuration options type for the stores created together with NewStores
+type StoresOption func(c *storesConfig)
+
+type storesConfig struct {
+	logger             Logger
+	clock              Clock
+	initTableDisabled  bool
+	lazyInit           bool
+	schemaVerification bool
+	strictSchema       bool
+	initTimeout        time.Duration
+	batchSize          int
+	rlsSettingKey      string
+	clientForeignKey   bool
+
+	tokenOptions  []TokenStoreOption
+	clientOptions []ClientStoreOption
+}
+
+// WithStoresLogger returns option that sets logger implementation of both stores
+func WithStoresLogger(logger Logger) StoresOption {
+	return func(c *storesConfig) {
+		c.logger = logger
+	}
+}
+
+// WithStoresClock returns option that sets clock of both stores
+func WithStoresClock(clock Clock) StoresOption {
+	return func(c *storesConfig) {
+		c.clock = clock
+	}
+}
+
+// WithStoresInitTableDisabled returns option that disables tables creation on both stores instantiation
+func WithStoresInitTableDisabled() StoresOption {
+	return func(c *storesConfig) {
+		c.initTableDisabled = true
+	}
+}
+
+// WithStoresLazyInit returns option that defers the tables initialization of both stores until their first operation
+func WithStoresLazyInit() StoresOption {
+	return func(c *storesConfig) {
+		c.lazyInit = true
+	}
+}
+
+// WithStoresSchemaVerification returns option that verifies the existing tables schema on both stores instantiation
+// when tables creation is disabled
+func WithStoresSchemaVerification() StoresOption {
+	return func(c *storesConfig) {
+		c.schemaVerification = true
+	}
+}
+
+// WithStoresStrictSchema returns option that refuses both stores instantiation when the existing tables column types
+// differ from the expected ones
+func WithStoresStrictSchema() StoresOption {
+	return func(c *storesConfig) {
+		c.strictSchema = true
+	}
+}
+
+// WithStoresInitTimeout returns option that bounds the table initialization and the schema verification of each store
+func WithStoresInitTimeout(timeout time.Duration) StoresOption {
+	return func(c *storesConfig) {
+		c.initTimeout = timeout
+	}
+}
+
+// WithStoresBatchSize returns option that sets the number of entries loaded at once by batch operations of both stores
+func WithStoresBatchSize(batchSize int) StoresOption {
+	return func(c *storesConfig) {
+		c.batchSize = batchSize
+	}
+}
+
+// WithStoresRowLevelSecurity returns option that enables row level security on both tables
+// with the tenant set in the settingKey run-time parameter, e.g. app.tenant_id
+func WithStoresRowLevelSecurity(settingKey string) StoresOption {
+	return func(c *storesConfig) {
+		c.rlsSettingKey = settingKey
+	}
+}
+
+// WithStoresClientForeignKey returns option that references the client table from the token table,
+// see WithTokenStoreClientForeignKey
+func WithStoresClientForeignKey() StoresOption {
+	return func(c *storesConfig) {
+		c.clientForeignKey = true
+	}
+}
+
+// WithStoresTokenStoreOptions returns option that applies the token store options after the shared ones
+func WithStoresTokenStoreOptions(options ...TokenStoreOption) StoresOption {
+	return func(c *storesConfig) {
+		c.tokenOptions = append(c.tokenOptions, options...)
+	}
+}
+
+// WithStoresClientStoreOptions returns option that applies the client store options after the shared ones
+func WithStoresClientStoreOptions(options ...ClientStoreOption) StoresOption {
+	return func(c *storesConfig) {
+		c.clientOptions = append(c.clientOptions, options...)
+	}
+}
+
+// NewStores creates token and client store instances sharing the configuration, the client store is created first,
+// so the token table can reference it
+func NewStores(adapter pgadapter.Adapter, options ...StoresOption) (*TokenStore, *ClientStore, error) {
+	c := new(storesConfig)
+	for _, o := range options {
+		o(c)
+	}
+
+	clientStore, err := NewClientStore(adapter, append(c.sharedClientOptions(), c.clientOptions...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenOptions := c.sharedTokenOptions()
+	if c.clientForeignKey {
+		tokenOptions = append(tokenOptions, WithTokenStoreClientForeignKey(clientStore.tableName))
+	}
+	tokenStore, err := NewTokenStore(adapter, append(tokenOptions, c.tokenOptions...)...)
+	if err != nil {
+		if tokenStore != nil {
+			tokenStore.Close()
+		}
+		return nil, nil, err
+	}
+
+	return tokenStore, clientStore, nil
+}
+
+func (c *storesConfig) sharedTokenOptions() []TokenStoreOption {
+	var options []TokenStoreOption
+	if c.logger != nil {
+		options = append(options, WithTokenStoreLogger(c.logger))
+	}
+	if c.clock != nil {
+		options = append(options, WithTokenStoreClock(c.clock))
+	}
+	if c.initTableDisabled {
+		options = append(options, WithTokenStoreInitTableDisabled())
+	}
+	if c.lazyInit {
+		options = append(options, WithTokenStoreLazyInit())
+	}
+	if c.schemaVerification {
+		options = append(options, WithTokenStoreSchemaVerification())
+	}
+	if c.strictSchema {
+		options = append(options, WithTokenStoreStrictSchema())
+	}
+	if c.initTimeout != 0 {
+		options = append(options, WithTokenStoreInitTimeout(c.initTimeout))
+	}
+	if c.batchSize != 0 {
+		options = append(options, WithTokenStoreBatchSize(c.batchSize))
+	}
+	if c.rlsSettingKey != "" {
+		options = append(options, WithTokenStoreRowLevelSecurity(c.rlsSettingKey))
+	}
+	return options
+}
+
+func (c *storesConfig) sharedClientOptions() []ClientStoreOption {
+	var options []ClientStoreOption
+	if c.logger != nil {
+		options = append(options, WithClientStoreLogger(c.logger))
+	}
+	if c.clock != nil {
+		options = append(options, WithClientStoreClock(c.clock))
+	}
+	if c.initTableDisabled {
+		options = append(options, WithClientStoreInitTableDisabled())
+	}
+	if c.lazyInit {
+		options = append(options, WithClientStoreLazyInit())
+	}
+	if c.schemaVerification {
+		options = append(options, WithClientStoreSchemaVerification())
+	}
+	if c.strictSchema {
+		options = append(options, WithClientStoreStrictSchema())
+	}
+	if c.initTimeout != 0 {
+		options = append(options, WithClientStoreInitTimeout(c.initTimeout))
+	}
+	if c.batchSize != 0 {
+		options = append(options, WithClientStoreBatchSize(c.batchSize))
+	}
+	if c.rlsSettingKey != "" {
+		options = append(options, WithClientStoreRowLevelSecurity(c.rlsSettingKey))
+	}
+	return options
+}
@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStores(t *testing.T) {
+	adapter := new(mockAdapter)
+	l := new(memoryLogger)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	tokenStore, clientStore, err := NewStores(
+		adapter,
+		WithStoresLogger(l),
+		WithStoresClock(clock),
+		WithStoresBatchSize(10),
+		WithStoresInitTimeout(time.Second),
+		WithStoresRowLevelSecurity("app.tenant_id"),
+		WithStoresClientForeignKey(),
+		WithStoresClientStoreOptions(WithClientStoreTableName("clients")),
+		WithStoresTokenStoreOptions(WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreBatchSize(20)),
+	)
+	require.NoError(t, err)
+	defer tokenStore.Close()
+
+	assert.Equal(t, l, tokenStore.logger)
+	assert.Equal(t, l, clientStore.logger)
+	assert.Equal(t, clock, tokenStore.clock)
+	assert.Equal(t, clock, clientStore.clock)
+	assert.Equal(t, time.Second, tokenStore.initTimeout)
+	assert.Equal(t, time.Second, clientStore.initTimeout)
+	assert.Equal(t, "app.tenant_id", tokenStore.rlsSettingKey)
+	assert.Equal(t, "app.tenant_id", clientStore.rlsSettingKey)
+	// store options are applied after the shared ones
+	assert.Equal(t, 20, tokenStore.batchSize)
+	assert.Equal(t, 10, clientStore.batchSize)
+
+	// client table is created first and referenced by the token table
+	require.Equal(t, 2, len(adapter.execCalls))
+	assert.True(t, strings.Contains(adapter.execCalls[0].query, "CREATE TABLE IF NOT EXISTS clients ("))
+	assert.True(t, strings.Contains(adapter.execCalls[1].query, "REFERENCES clients (id) ON DELETE CASCADE"))
+
+	tokenStore, clientStore, err = NewStores(adapter, WithStoresLazyInit(), WithStoresTokenStoreOptions(WithTokenStoreGCDisabled()))
+	require.NoError(t, err)
+	assert.True(t, tokenStore.lazyInit)
+	assert.True(t, clientStore.lazyInit)
+	assert.Equal(t, 2, len(adapter.execCalls))
+
+	_, _, err = NewStores(adapter, WithStoresBatchSize(-1), WithStoresInitTableDisabled())
+	assert.EqualError(t, err, "invalid client store configuration: batch size must be positive, got -1")
+
+	// failed token table init is returned, the token store is closed
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		if strings.Contains(query, "REFERENCES") {
+			return errors.New("relation \"clients\" does not exist")
+		}
+		return nil
+	}
+	_, _, err = NewStores(adapter, WithStoresClientForeignKey(), WithStoresClientStoreOptions(WithClientStoreTableName("clients")))
+	assert.EqualError(t, err, "relation \"clients\" does not exist")
+}
@@ -0,0 +1,45 @@
+package pg
+
+import (
+	"fmt"
+	"time"
+)
+
+// hypertableDDL returns the statement that converts the table into TimescaleDB hypertable chunked on expires_at,
+// the table is left as is when it is already the hypertable. Expiry index is created by the store, so default
+// hypertable indexes are not created.
+func hypertableDDL(tableName string, chunkInterval time.Duration) string {
+	return fmt.Sprintf(
+		"SELECT create_hypertable(%s, 'expires_at', chunk_time_interval => INTERVAL '%d seconds', if_not_exists => TRUE, create_default_indexes => FALSE);\n",
+		quoteLiteral(tableName), int64(chunkInterval/time.Second),
+	)
+}
+
+// dropChunksQuery is the hypertable garbage collection query returning the number of dropped chunks, dropping
+// the whole chunks is much cheaper than deleting the rows, expired tokens of the chunk are dropped once all
+// of the chunk tokens expire
+const dropChunksQuery = "SELECT count(*) AS count FROM drop_chunks($1::regclass, older_than => $2::timestamptz)"
+
+// hypertableDDL returns the hypertable conversion statement if the token table is the hypertable
+func (s *TokenStore) hypertableDDL() string {
+	if s.hypertableChunk == 0 {
+		return ""
+	}
+	return hypertableDDL(s.tableName, s.hypertableChunk)
+}
+
+// hypertableProblem returns the hypertable configuration problem or empty string
+func (s *TokenStore) hypertableProblem() string {
+	switch {
+	case s.hypertableChunk == 0:
+		return ""
+	case s.hypertableChunk < time.Second:
+		return fmt.Sprintf("hypertable chunk interval must be at least one second, got %s", s.hypertableChunk)
+	case s.dialect != DialectPostgres:
+		return fmt.Sprintf("hypertable is not supported by %s dialect", s.dialect)
+	case s.exchangeLineage:
+		// exchanged tokens reference the parent token id that is not unique in the hypertable
+		return "hypertable does not support exchange lineage"
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package pg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTokenStoreTimescaleHypertable(t *testing.T) {
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreTimescaleHypertable(24*time.Hour), WithTokenStoreGCDisabled(), WithTokenStoreClock(clock), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "  CONSTRAINT tokens_pkey PRIMARY KEY (id, expires_at)\n);\n")
+	assert.Contains(t, adapter.execCalls[0].query, "SELECT create_hypertable('tokens', 'expires_at', chunk_time_interval => INTERVAL '86400 seconds', if_not_exists => TRUE, create_default_indexes => FALSE);\n")
+
+	// expired chunks are dropped instead of deleting the rows
+	store.TriggerGCForTest()
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, "SELECT count(*) AS count FROM drop_chunks($1::regclass, older_than => $2::timestamptz)", adapter.selectOneCalls[0].query)
+	assert.Equal(t, []interface{}{"tokens", clock.now}, adapter.selectOneCalls[0].args)
+
+	_, err = NewTokenStore(adapter, WithTokenStoreTimescaleHypertable(time.Millisecond), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: hypertable chunk interval must be at least one second, got 1ms")
+	_, err = NewTokenStore(adapter, WithTokenStoreTimescaleHypertable(time.Hour), WithTokenStoreDialect(DialectCockroach), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: hypertable is not supported by cockroach dialect")
+	_, err = NewTokenStore(adapter, WithTokenStoreTimescaleHypertable(time.Hour), WithTokenStoreExchangeLineage(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: hypertable does not support exchange lineage")
+}
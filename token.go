@@ -0,0 +1,49 @@
+package pg
+
+import (
+	"encoding/json"
+
+	"gopkg.in/oauth2.v3"
+	"gopkg.in/oauth2.v3/models"
+)
+
+// Token is the token information model that keeps RFC 9396 rich authorization request details.
+// Store getters return *Token for tokens created with authorization details and *models.Token otherwise.
+type Token struct {
+	models.Token
+
+	AuthorizationDetails json.RawMessage `json:",omitempty"`
+}
+
+// NewToken creates new token information model instance
+func NewToken() *Token {
+	return &Token{}
+}
+
+// New creates new token information model instance
+func (t *Token) New() oauth2.TokenInfo {
+	return NewToken()
+}
+
+// GetAuthorizationDetails returns authorization details JSON array, nil if there are no details
+func (t *Token) GetAuthorizationDetails() json.RawMessage {
+	return t.AuthorizationDetails
+}
+
+// SetAuthorizationDetails sets authorization details JSON array
+func (t *Token) SetAuthorizationDetails(details json.RawMessage) {
+	t.AuthorizationDetails = details
+}
+
+// authorizationDetailsGetter is implemented by token information models that keep authorization details
+type authorizationDetailsGetter interface {
+	GetAuthorizationDetails() json.RawMessage
+}
+
+// tokenAuthorizationDetails returns token authorization details column value
+func tokenAuthorizationDetails(info oauth2.TokenInfo) interface{} {
+	if g, ok := info.(authorizationDetailsGetter); ok && len(g.GetAuthorizationDetails()) > 0 {
+		return []byte(g.GetAuthorizationDetails())
+	}
+	return nil
+}
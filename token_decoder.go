@@ -0,0 +1,63 @@
+package pg
+
+import (
+	"io"
+	"time"
+	"unsafe"
+
+	"github.com/json-iterator/go"
+	"github.com/modern-go/reflect2"
+	"gopkg.in/oauth2.v3"
+)
+
+// tokenJSON is the jsoniter configuration for the token data decoding on the read path,
+// it is the default configuration with the allocation-free time decoder
+var tokenJSON = func() jsoniter.API {
+	api := jsoniter.Config{EscapeHTML: true}.Froze()
+	api.RegisterExtension(&timeDecoderExtension{})
+	return api
+}()
+
+var timeType = reflect2.TypeOf(time.Time{})
+
+type timeDecoderExtension struct {
+	jsoniter.DummyExtension
+}
+
+func (*timeDecoderExtension) CreateDecoder(typ reflect2.Type) jsoniter.ValDecoder {
+	if typ == timeType {
+		return timeDecoder{}
+	}
+	return nil
+}
+
+// timeDecoder parses the time right from the iterator buffer instead of capturing the raw value
+// for time.Time.UnmarshalJSON
+type timeDecoder struct{}
+
+func (timeDecoder) Decode(ptr unsafe.Pointer, iter *jsoniter.Iterator) {
+	if iter.ReadNil() {
+		return
+	}
+	// formatted time never contains escaped characters, so the slice of the buffer can be used
+	if err := (*time.Time)(ptr).UnmarshalText(iter.ReadStringAsSlice()); err != nil {
+		iter.ReportError("decode time.Time", err.Error())
+	}
+}
+
+func unmarshalToken(data []byte) (oauth2.TokenInfo, error) {
+	iter := tokenJSON.BorrowIterator(data)
+	defer tokenJSON.ReturnIterator(iter)
+
+	tm := new(Token)
+	iter.ReadVal(tm)
+	if iter.Error != nil && iter.Error != io.EOF {
+		return nil, iter.Error
+	}
+
+	// columns storage mode produces null for the tokens without authorization details
+	if len(tm.AuthorizationDetails) == 0 || string(tm.AuthorizationDetails) == "null" {
+		return &tm.Token, nil
+	}
+	return tm, nil
+}
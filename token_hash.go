@@ -0,0 +1,152 @@
+package pg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/json-iterator/go"
+	"gopkg.in/oauth2.v3"
+)
+
+// hashedTokenPrefix marks the token values in the stored data that are replaced with their digests
+const hashedTokenPrefix = "$hash:"
+
+// SHA256TokenHash is the SHA-256 token values hash function for WithTokenStoreHashedLookups
+func SHA256TokenHash(value []byte) []byte {
+	sum := sha256.Sum256(value)
+	return sum[:]
+}
+
+// TokenHashKey is the HMAC key for WithTokenStoreHMACLookups, key id is stored as the digest prefix
+// to find the key the digest was produced with
+type TokenHashKey struct {
+	ID  string
+	Key []byte
+}
+
+// ParseTokenHashKeys parses comma-separated list of "<id>:<base64 key>" HMAC keys, e.g. loaded from the environment
+// or decrypted with KMS, the first key is the current one
+func ParseTokenHashKeys(value string) ([]TokenHashKey, error) {
+	var keys []TokenHashKey
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// entry contains secret key, so it is never included into the errors
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("token hash key #%d must be in <id>:<base64 key> format", i+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("could not decode token hash key %q: %v", parts[0], err)
+		}
+		keys = append(keys, TokenHashKey{ID: parts[0], Key: key})
+	}
+	return keys, nil
+}
+
+func tokenHashKeysProblem(keys []TokenHashKey) string {
+	ids := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		switch {
+		case key.ID == "" || strings.Contains(key.ID, ":"):
+			return fmt.Sprintf("invalid token hash key id %q", key.ID)
+		case len(key.Key) == 0:
+			return fmt.Sprintf("empty token hash key %q", key.ID)
+		case ids[key.ID]:
+			return fmt.Sprintf("duplicate token hash key id %q", key.ID)
+		}
+		ids[key.ID] = true
+	}
+	return ""
+}
+
+func (s *TokenStore) hashedLookups() bool {
+	return s.lookupHash != nil || len(s.hashKeys) > 0
+}
+
+func hmacDigest(key TokenHashKey, value string) string {
+	mac := hmac.New(sha256.New, key.Key)
+	mac.Write([]byte(value))
+	return key.ID + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// lookupValue returns the value stored in the lookup column for the token value: digest produced with the hash
+// function or the current HMAC key when hashed lookups are enabled and the value itself otherwise.
+// Digest values returned by the store for the tokens that were not looked up are accepted as is.
+func (s *TokenStore) lookupValue(value string) string {
+	if !s.hashedLookups() || value == "" {
+		return value
+	}
+	if strings.HasPrefix(value, hashedTokenPrefix) {
+		return value[len(hashedTokenPrefix):]
+	}
+	if len(s.hashKeys) > 0 {
+		return hmacDigest(s.hashKeys[0], value)
+	}
+	return hex.EncodeToString(s.lookupHash([]byte(value)))
+}
+
+// lookupCondition returns the lookup column condition for the lookupArg query argument,
+// tokens have to be matched against digests of all the HMAC keys while keys are rotated
+func (s *TokenStore) lookupCondition(column string) string {
+	return s.lookupConditionParam(column, "$1")
+}
+
+// lookupConditionParam is the lookupCondition with the custom query parameter
+func (s *TokenStore) lookupConditionParam(column, param string) string {
+	if len(s.hashKeys) > 1 {
+		return fmt.Sprintf("%s = ANY(%s)", column, textArray(param))
+	}
+	return column + " = " + param
+}
+
+// lookupArg returns the query argument for the lookupCondition
+func (s *TokenStore) lookupArg(value string) interface{} {
+	if len(s.hashKeys) <= 1 {
+		return s.lookupValue(value)
+	}
+	return jsonArray(s.lookupValues(value))
+}
+
+// lookupValues returns all the values the token may be stored with in the lookup column,
+// the digests of all the HMAC keys while keys are rotated
+func (s *TokenStore) lookupValues(value string) []string {
+	if len(s.hashKeys) <= 1 || strings.HasPrefix(value, hashedTokenPrefix) {
+		return []string{s.lookupValue(value)}
+	}
+
+	digests := make([]string, len(s.hashKeys))
+	for i, key := range s.hashKeys {
+		digests[i] = hmacDigest(key, value)
+	}
+	return digests
+}
+
+// hashDataTokens replaces token values in the serialized token information with the prefixed digests
+func (s *TokenStore) hashDataTokens(data []byte, info oauth2.TokenInfo) ([]byte, error) {
+	var fields map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for field, value := range map[string]string{"Code": info.GetCode(), "Access": info.GetAccess(), "Refresh": info.GetRefresh()} {
+		if value == "" {
+			continue
+		}
+		encoded, err := jsoniter.Marshal(hashedTokenPrefix + s.lookupValue(value))
+		if err != nil {
+			return nil, err
+		}
+		fields[field] = encoded
+	}
+
+	return jsoniter.Marshal(fields)
+}
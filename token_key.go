@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+// TokenKeyType is the token table primary key type
+type TokenKeyType int
+
+// Supported token key types
+const (
+	// TokenKeyBigSerial is the sequence generated BIGSERIAL key
+	TokenKeyBigSerial TokenKeyType = iota
+	// TokenKeyUUIDv4 is the random UUID key generated by the store
+	TokenKeyUUIDv4
+	// TokenKeyUUIDv7 is the time-ordered UUID key generated by the store, keeps index locality of sequential keys
+	TokenKeyUUIDv7
+)
+
+func (t TokenKeyType) valid() bool {
+	return t >= TokenKeyBigSerial && t <= TokenKeyUUIDv7
+}
+
+func (t TokenKeyType) columnType() string {
+	if t == TokenKeyBigSerial {
+		return "BIGSERIAL"
+	}
+	return "UUID"
+}
+
+// referenceType returns the type of the columns referencing the key
+func (t TokenKeyType) referenceType() string {
+	if t == TokenKeyBigSerial {
+		return "BIGINT"
+	}
+	return "UUID"
+}
+
+// minKey returns the key that is less than any of the generated keys, keyset iteration starts from it
+func (t TokenKeyType) minKey() interface{} {
+	if t == TokenKeyBigSerial {
+		return int64(0)
+	}
+	return "00000000-0000-0000-0000-000000000000"
+}
+
+// parseKey parses the key serialized by jsonb_build_object
+func (t TokenKeyType) parseKey(data []byte) (interface{}, error) {
+	if t == TokenKeyBigSerial {
+		var id int64
+		err := jsoniter.Unmarshal(data, &id)
+		return id, err
+	}
+
+	var key string
+	err := jsoniter.Unmarshal(data, &key)
+	return key, err
+}
+
+// creationOrder returns ORDER BY expression that orders rows by creation
+func (t TokenKeyType) creationOrder() string {
+	if t == TokenKeyUUIDv4 {
+		return "created_at, id"
+	}
+	return "id"
+}
+
+// newUUID generates random UUIDv4 or time-ordered UUIDv7 with the millisecond precision timestamp
+func newUUID(t TokenKeyType, now time.Time) (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+
+	version := byte(4)
+	if t == TokenKeyUUIDv7 {
+		version = 7
+		var ts [8]byte
+		binary.BigEndian.PutUint64(ts[:], uint64(now.UnixNano()/int64(time.Millisecond)))
+		copy(u[0:6], ts[2:8])
+	}
+
+	u[6] = u[6]&0x0f | version<<4
+	u[8] = u[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
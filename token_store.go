@@ -1,28 +1,158 @@
 package pg
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/json-iterator/go"
 	"github.com/vgarvardt/go-pg-adapter"
 	"gopkg.in/oauth2.v3"
-	"gopkg.in/oauth2.v3/models"
 )
 
 // TokenStore PostgreSQL token store
 type TokenStore struct {
+	// accessed atomically, must be the first field for 64-bit alignment on 32-bit platforms
+	inflight  int64
+	creates   int64
+	draining  int32
+	closed    int32
+	gcPaused  int32
+	gcRunning int32
+
 	adapter   pgadapter.Adapter
 	tableName string
 	logger    Logger
+	clock     Clock
+
+	// pool is opened by NewTokenStoreFromDSN and closed with the store
+	pool              *ownedPool
+	reconnectInterval time.Duration
+	acquireTimeout    time.Duration
+
+	gcDisabled      bool
+	gcInterval      time.Duration
+	gcIntervalSet   bool
+	gcStrategy      GCStrategy
+	gcRetention     time.Duration
+	gcKindRetention map[TokenKind]time.Duration
+	gcLogAlways     bool
+	gcObserver      func(GCStats)
+	gcBacklogCap    int64
+	gcEveryCreates  int
+	cleanupOnRead   bool
+
+	gcMaxDuration          time.Duration
+	gcAnalyzeThreshold     int64
+	gcMaintenanceThreshold int64
+	gcMaintenanceHook      func(ctx context.Context, stats GCStats) error
+
+	lastUsedInterval time.Duration
+	lastUsed         *lastUsedTracker
+
+	errorHandler func(op string, err error)
+	redactor     Redactor
+
+	initTableDisabled  bool
+	lazyInit           bool
+	schemaVerification bool
+	strictSchema       bool
+	initTimeout        time.Duration
+	queryTimeout       time.Duration
+	slowQueryThreshold time.Duration
+	expiryFilter       bool
+	dialect            Dialect
+	tablets            int
+	hypertableChunk    time.Duration
+	distributionColumn string
+	columnsStorage     bool
+	brinExpiryIndex    bool
+	hashIndexes        bool
+
+	// split layout tables expire rows by their own token kind and index only the looked up columns
+	expiryKind    TokenKind
+	lookupColumns []string
+
+	lookupHash func([]byte) []byte
+	hashKeys   []TokenHashKey
+
+	keyType TokenKeyType
+
+	clientForeignKey string
+	exchangeLineage  bool
+	refreshFamilies  bool
+	accessExpiration bool
+
+	refreshReuseDetection bool
+
+	rowLevelSecurity bool
+	rlsSettingKey    string
+
+	compressor  Compressor
+	compressors map[string]Compressor
+
+	batchSize int
+
+	// Get* queries are built once, they are on the hot path
+	getByCodeQuery    string
+	getByAccessQuery  string
+	getByRefreshQuery string
+}
+
+// TokenKind is the kind of the stored token
+type TokenKind string
+
+// Stored token kinds
+const (
+	TokenKindCode    TokenKind = "code"
+	TokenKindAccess  TokenKind = "access"
+	TokenKindRefresh TokenKind = "refresh"
+)
+
+// TokenStatistics is the number of active and expired tokens of the kind issued to the client
+type TokenStatistics struct {
+	ClientID string    `json:"client_id"`
+	Kind     TokenKind `json:"kind"`
+	Active   int64     `json:"active"`
+	Expired  int64     `json:"expired"`
+}
+
+// TokenFilter is the tokens filter, empty fields are ignored and non-empty fields are combined with AND
+type TokenFilter struct {
+	ClientID string
+	UserID   string
+	// Scope matches tokens that have the scope in their space-separated scopes list
+	Scope         string
+	CreatedBefore time.Time
+	ExpiresAfter  time.Time
+	ExpiresBefore time.Time
+}
 
-	gcDisabled bool
-	gcInterval time.Duration
-	ticker     *time.Ticker
+// IsEmpty checks if the filter has no criteria
+func (f TokenFilter) IsEmpty() bool {
+	return f.ClientID == "" && f.UserID == "" && f.Scope == "" &&
+		f.CreatedBefore.IsZero() && f.ExpiresAfter.IsZero() && f.ExpiresBefore.IsZero()
+}
+
+// Pagination is the page of the search results, zero limit means default page size of 100 entries
+type Pagination struct {
+	Limit  int
+	Offset int
+}
 
-	initTableDisabled bool
+func (p Pagination) limit() int {
+	if p.Limit <= 0 {
+		return 100
+	}
+	return p.Limit
 }
 
 // TokenStoreItem data item
@@ -42,179 +172,1714 @@ func NewTokenStore(adapter pgadapter.Adapter, options ...TokenStoreOption) (*Tok
 		adapter:    adapter,
 		tableName:  "oauth2_tokens",
 		logger:     log.New(os.Stderr, "[OAUTH2-PG-ERROR]", log.LstdFlags),
+		clock:      systemClock{},
+		redactor:   DefaultRedactor,
 		gcInterval: 10 * time.Minute,
+		dialect:    DialectPostgres,
+
+		compressors: map[string]Compressor{"gzip": GzipCompressor{}},
+
+		batchSize: 1000,
+
+		lookupColumns: []string{"code", "access", "refresh"},
 	}
 
 	for _, o := range options {
 		o(store)
 	}
 
-	var err error
-	if !store.initTableDisabled {
-		err = store.initTable()
+	if err := store.validate(); err != nil {
+		return nil, err
 	}
 
-	if err != nil {
+	if store.compressor != nil {
+		store.compressors[store.compressor.Name()] = store.compressor
+	}
+
+	activeCondition := store.activeCondition()
+	store.getByCodeQuery = fmt.Sprintf("SELECT %s AS data FROM %s WHERE %s%s", store.dataExpr(), store.tableName, store.lookupCondition("code"), activeCondition)
+	store.getByAccessQuery = fmt.Sprintf("SELECT %s AS data FROM %s WHERE %s%s", store.dataExpr(), store.tableName, store.lookupCondition("access"), activeCondition)
+	store.getByRefreshQuery = fmt.Sprintf("SELECT %s AS data FROM %s WHERE %s%s", store.dataExpr(), store.tableName, store.lookupCondition("refresh"), activeCondition)
+
+	// the store returned with the init error is closed by the caller, so it needs the strategy to stop
+	if store.gcStrategy == nil {
+		store.gcStrategy = &TickerGCStrategy{Interval: store.gcInterval}
+	}
+
+	if store.lazyInit {
+		store.adapter = newLazyInitAdapter(store.adapter, store.init)
+	} else if err := store.init(context.Background()); err != nil {
 		return store, err
 	}
 
 	if !store.gcDisabled {
-		store.ticker = time.NewTicker(store.gcInterval)
-		go store.gc()
+		store.gcStrategy.Start(store.clean)
+	}
+
+	if store.lastUsedInterval > 0 {
+		store.lastUsed = &lastUsedTracker{uses: make(map[string]time.Time), stop: make(chan struct{})}
+		go store.runLastUsedFlush()
+	}
+
+	return store, nil
+}
+
+// activeCondition returns the lookup condition suffix matching only the valid tokens rows,
+// rotated tokens are kept for the refresh reuse detection, but they are not valid anymore
+func (s *TokenStore) activeCondition() string {
+	var condition string
+	if s.refreshReuseDetection {
+		condition = " AND consumed_at IS NULL"
+	}
+	if s.expiryFilter {
+		condition += " AND expires_at > now()"
+	}
+	return condition
+}
+
+// init creates the table and verifies its schema if configured
+func (s *TokenStore) init(ctx context.Context) error {
+	ctx, cancel := initContext(ctx, s.initTimeout)
+	defer cancel()
+
+	var err error
+	if !s.initTableDisabled {
+		err = s.initTable(ctx)
+	}
+	if err == nil && (s.strictSchema || s.initTableDisabled && s.schemaVerification) {
+		err = s.VerifySchema(ctx)
+	}
+	return err
+}
+
+func (s *TokenStore) validate() error {
+	var problem string
+	switch {
+	case s.tableName == "":
+		problem = "empty table name"
+	case s.gcInterval <= 0:
+		problem = fmt.Sprintf("GC interval must be positive, got %s", s.gcInterval)
+	case s.gcDisabled && s.gcIntervalSet:
+		problem = "GC interval is set while GC is disabled"
+	case s.gcStrategy != nil && s.gcIntervalSet && !s.gcBacklogCapped():
+		problem = "GC interval is set together with GC strategy"
+	case s.gcBacklogCap < 0:
+		problem = fmt.Sprintf("GC backlog cap must not be negative, got %d", s.gcBacklogCap)
+	case s.gcBacklogCap > 0 && !s.gcScheduled():
+		problem = "GC backlog cap requires GC schedule"
+	case s.gcMaxDuration < 0:
+		problem = fmt.Sprintf("GC max duration must not be negative, got %s", s.gcMaxDuration)
+	case s.gcMaxDuration > 0 && s.hypertableChunk > 0:
+		problem = "GC max duration is not supported with hypertable"
+	case s.gcAnalyzeThreshold < 0:
+		problem = fmt.Sprintf("GC analyze threshold must not be negative, got %d", s.gcAnalyzeThreshold)
+	case s.gcMaintenanceThreshold < 0:
+		problem = fmt.Sprintf("GC maintenance threshold must not be negative, got %d", s.gcMaintenanceThreshold)
+	case s.lastUsedInterval < 0:
+		problem = fmt.Sprintf("last used flush interval must not be negative, got %s", s.lastUsedInterval)
+	case s.gcEveryCreates < 0:
+		problem = fmt.Sprintf("GC creates count must not be negative, got %d", s.gcEveryCreates)
+	case s.gcRetention < 0:
+		problem = fmt.Sprintf("GC retention must not be negative, got %s", s.gcRetention)
+	case len(s.gcKindRetention) > 0 && s.hypertableChunk > 0:
+		problem = "GC retention by token kind is not supported with hypertable"
+	case s.accessExpiration && s.compressor != nil:
+		problem = "access expiration is not supported with token data compression"
+	case s.accessExpiration && s.expiryKind != "":
+		problem = "access expiration is not supported with split token store"
+	case s.accessExpiration && s.gcPGCron():
+		problem = "access expiration is not supported with pg_cron GC strategy"
+	case s.batchSize <= 0:
+		problem = fmt.Sprintf("batch size must be positive, got %d", s.batchSize)
+	case s.hashedLookups() && s.columnsStorage:
+		problem = "hashed lookups are not supported with columns storage"
+	case !s.keyType.valid():
+		problem = fmt.Sprintf("unknown token key type %d", s.keyType)
+	case s.lookupHash != nil && len(s.hashKeys) > 0:
+		problem = "hashed lookups are set together with HMAC lookups"
+	case s.refreshReuseDetection && !s.refreshFamilies:
+		problem = "refresh reuse detection requires refresh families"
+	case s.rowLevelSecurity && s.rlsSettingKey == "":
+		problem = "empty row level security setting key"
+	case s.initTimeout < 0:
+		problem = fmt.Sprintf("init timeout must not be negative, got %s", s.initTimeout)
+	case s.queryTimeout < 0:
+		problem = fmt.Sprintf("query timeout must not be negative, got %s", s.queryTimeout)
+	case s.slowQueryThreshold < 0:
+		problem = fmt.Sprintf("slow query threshold must not be negative, got %s", s.slowQueryThreshold)
+	case s.reconnectInterval < 0:
+		problem = fmt.Sprintf("reconnect interval must not be negative, got %s", s.reconnectInterval)
+	case s.reconnectInterval > 0 && s.pool == nil:
+		problem = "reconnect interval requires the store created with NewTokenStoreFromDSN"
+	case s.acquireTimeout < 0:
+		problem = fmt.Sprintf("acquire timeout must not be negative, got %s", s.acquireTimeout)
+	case s.acquireTimeout > 0 && s.pool == nil:
+		problem = "acquire timeout requires the store created with NewTokenStoreFromDSN"
+	case !s.dialect.valid():
+		problem = fmt.Sprintf("unknown dialect %q", s.dialect)
+	default:
+		problem = tokenHashKeysProblem(s.hashKeys)
+	}
+	if problem == "" {
+		problem = s.gcKindRetentionProblem()
+	}
+	if problem == "" && s.gcScheduled() {
+		problem = s.gcStrategy.(*cronGCStrategy).problem()
+	}
+	if problem == "" {
+		problem = s.dialectProblem()
+	}
+	if problem == "" {
+		problem = s.hypertableProblem()
+	}
+	if problem == "" {
+		problem = s.distributionProblem()
+	}
+
+	if problem == "" {
+		return nil
 	}
 
-	return store, err
+	return fmt.Errorf("invalid token store configuration: %s", problem)
 }
 
-// Close close the store
+// gcKindRetentionProblem returns GC retention by token kind problem or empty string
+func (s *TokenStore) gcKindRetentionProblem() string {
+	for kind, retention := range s.gcKindRetention {
+		switch {
+		case kind != TokenKindCode && kind != TokenKindAccess && kind != TokenKindRefresh:
+			return fmt.Sprintf("unknown token kind %q of GC retention", kind)
+		case retention < 0:
+			return fmt.Sprintf("GC retention of %s tokens must not be negative, got %s", kind, retention)
+		}
+	}
+	return ""
+}
+
+// Close close the store, waits for in-flight store operations to finish
 func (s *TokenStore) Close() error {
-	if !s.gcDisabled {
-		s.ticker.Stop()
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext close the store, waits for in-flight store operations to finish or the context to be done.
+// The connection pool opened by NewTokenStoreFromDSN is closed then. Second and subsequent calls are no-op.
+func (s *TokenStore) CloseContext(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		return nil
+	}
+	err := s.Drain(ctx)
+	if s.pool != nil {
+		s.pool.Close()
+	}
+	return err
+}
+
+// Drain stops garbage collection, writes the token uses remembered since the last flush and waits for garbage
+// collection goroutine and in-flight store operations to finish or the context to be done, suitable for the shutdown
+// hooks, e.g. Kubernetes preStop
+func (s *TokenStore) Drain(ctx context.Context) error {
+	if atomic.CompareAndSwapInt32(&s.draining, 0, 1) {
+		if !s.gcDisabled {
+			s.gcStrategy.Stop()
+		}
+		s.stopLastUsedFlush(ctx)
+	}
+	if waiter, ok := s.gcStrategy.(gcWaiter); ok && !s.gcDisabled {
+		if err := waiter.wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&s.inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
+
 	return nil
 }
 
-func (s *TokenStore) gc() {
-	for range s.ticker.C {
-		s.clean()
+func (s *TokenStore) exec(ctx context.Context, query string, args ...interface{}) error {
+	atomic.AddInt64(&s.inflight, 1)
+	defer atomic.AddInt64(&s.inflight, -1)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	defer s.logSlowQuery(time.Now(), query)
+
+	return redactError(s.dialect.retry(ctx, func() error {
+		return execContext(ctx, s.adapter, query, args...)
+	}), s.redactor, args)
+}
+
+func (s *TokenStore) selectOne(ctx context.Context, dst interface{}, query string, args ...interface{}) error {
+	atomic.AddInt64(&s.inflight, 1)
+	defer atomic.AddInt64(&s.inflight, -1)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	defer s.logSlowQuery(time.Now(), query)
+
+	return wrapNoRows(redactError(s.dialect.retry(ctx, func() error {
+		return selectOneContext(ctx, s.adapter, dst, query, args...)
+	}), s.redactor, args), ErrTokenNotFound)
+}
+
+// queryContext bounds the query context with the query timeout if it is set
+func (s *TokenStore) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// logSlowQuery logs the query that took longer than the slow query threshold, query arguments are never logged
+// as they contain token values
+func (s *TokenStore) logSlowQuery(start time.Time, query string) {
+	if s.slowQueryThreshold == 0 {
+		return
 	}
+	if duration := time.Since(start); duration >= s.slowQueryThreshold {
+		s.logger.Printf("Slow token store query took %s: %s", duration, sanitizeQuery(query))
+	}
+}
+
+// initTable is bounded by the init timeout only, table initialization may take longer than the regular queries
+func (s *TokenStore) initTable(ctx context.Context) error {
+	return s.dialect.initTable(ctx, s.adapter, s.tableName, s.initTimeout, s.tableDDL())
+}
+
+// tableDDL returns token table and its indexes creation statements
+func (s *TokenStore) tableDDL() string {
+	return createTableDDL(s.tableName, s.primaryKey(), s.tableColumns(), s.dialect.storageDDL(s.tablets)) + s.hypertableDDL() +
+		s.distributionDDL() + "\n" + s.indexesDDL() + s.clientForeignKeyDDL() + s.exchangeLineageDDL() + s.refreshFamiliesDDL() + s.accessExpirationDDL() + s.lastUsedDDL() + s.rowLevelSecurityDDL()
+}
+
+// primaryKey returns the token table primary key columns, unique constraints of the hypertable and the distributed
+// table have to include the time column and the distribution column respectively
+func (s *TokenStore) primaryKey() string {
+	switch {
+	case s.hypertableChunk > 0:
+		return "id, expires_at"
+	case s.distributionColumn != "":
+		return "id, " + s.distributionColumn
+	}
+	return "id"
+}
+
+// VerifySchema checks that the existing token table has all the columns and indexes used with the store
+// configuration, column types are compared too in the strict schema mode. The returned *SchemaError lists the problems.
+func (s *TokenStore) VerifySchema(ctx context.Context) error {
+	columns := s.tableColumns()
+	if s.rowLevelSecurity {
+		columns = append(columns, tableColumn{name: "tenant_id", dataType: "TEXT"})
+	}
+	return verifySchema(ctx, s.selectOne, s.tableName, columns, append([]string{s.tableName + "_pkey"}, ddlIndexNames(s.tableDDL())...), s.strictSchema)
+}
+
+// tableColumns returns token table columns for the configured storage mode
+func (s *TokenStore) tableColumns() []tableColumn {
+	columns := []tableColumn{
+		s.dialect.keyColumn(s.keyType),
+		{"created_at", "TIMESTAMPTZ", "NOT NULL"},
+		{"expires_at", "TIMESTAMPTZ", "NOT NULL"},
+	}
+
+	if s.columnsStorage {
+		columns = append(columns,
+			tableColumn{"client_id", "TEXT", "NOT NULL"},
+			tableColumn{"user_id", "TEXT", "NOT NULL"},
+			tableColumn{"redirect_uri", "TEXT", "NOT NULL"},
+			tableColumn{"scope", "TEXT", "NOT NULL"},
+			tableColumn{"code", "TEXT", "NOT NULL"},
+			tableColumn{"code_created_at", "TIMESTAMPTZ", ""},
+			tableColumn{"code_expires_in", "BIGINT", "NOT NULL"},
+			tableColumn{"access", "TEXT", "NOT NULL"},
+			tableColumn{"access_created_at", "TIMESTAMPTZ", ""},
+			tableColumn{"access_expires_in", "BIGINT", "NOT NULL"},
+			tableColumn{"refresh", "TEXT", "NOT NULL"},
+			tableColumn{"refresh_created_at", "TIMESTAMPTZ", ""},
+			tableColumn{"refresh_expires_in", "BIGINT", "NOT NULL"},
+		)
+	} else {
+		columns = append(columns,
+			tableColumn{"code", "TEXT", "NOT NULL"},
+			tableColumn{"access", "TEXT", "NOT NULL"},
+			tableColumn{"refresh", "TEXT", "NOT NULL"},
+			tableColumn{"data", "JSONB", "NOT NULL"},
+		)
+	}
+
+	columns = append(columns,
+		tableColumn{"updated_at", "TIMESTAMPTZ", "NOT NULL DEFAULT now()"},
+		tableColumn{"authorization_details", "JSONB", ""},
+	)
+
+	if s.clientForeignKey != "" && !s.columnsStorage {
+		columns = append(columns, tableColumn{"client_id", "TEXT", ""})
+	}
+	if s.exchangeLineage {
+		columns = append(columns,
+			tableColumn{"parent_token_id", s.keyType.referenceType(), fmt.Sprintf("REFERENCES %s (id) ON DELETE CASCADE", s.tableName)},
+			tableColumn{"actor", "TEXT", ""},
+		)
+	}
+	if s.refreshFamilies {
+		columns = append(columns, tableColumn{"family_id", "TEXT", ""})
+	}
+	if s.refreshReuseDetection {
+		columns = append(columns, tableColumn{"consumed_at", "TIMESTAMPTZ", ""})
+	}
+	if s.accessExpiration {
+		columns = append(columns, tableColumn{"access_expires_at", "TIMESTAMPTZ", ""})
+	}
+	if s.lastUsedInterval > 0 {
+		columns = append(columns, tableColumn{"last_used_at", "TIMESTAMPTZ", ""})
+	}
+
+	return columns
+}
+
+// rowLevelSecurityDDL returns token table row level security statements if it is enabled
+func (s *TokenStore) rowLevelSecurityDDL() string {
+	if !s.rowLevelSecurity {
+		return ""
+	}
+	return rowLevelSecurityDDL(s.tableName, s.rlsSettingKey)
 }
 
-func (s *TokenStore) initTable() error {
-	return s.adapter.Exec(fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS %[1]s (
-  id         BIGSERIAL   NOT NULL,
-  created_at TIMESTAMPTZ NOT NULL,
-  expires_at TIMESTAMPTZ NOT NULL,
-  code       TEXT        NOT NULL,
-  access     TEXT        NOT NULL,
-  refresh    TEXT        NOT NULL,
-  data       JSONB       NOT NULL,
-  CONSTRAINT %[1]s_pkey PRIMARY KEY (id)
-);
+// indexesDDL returns token table indexes creation statements
+func (s *TokenStore) indexesDDL() string {
+	expiresAtIndex := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s (expires_at);", s.tableName)
+	if s.brinExpiryIndex {
+		expiresAtIndex = fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at_brin ON %[1]s USING BRIN (expires_at);", s.tableName)
+	}
+
+	lookupIndex := "CREATE INDEX IF NOT EXISTS idx_%[1]s_%[2]s ON %[1]s (%[2]s);"
+	if s.hashIndexes {
+		lookupIndex = "CREATE INDEX IF NOT EXISTS idx_%[1]s_%[2]s_hash ON %[1]s USING HASH (%[2]s);"
+	}
+
+	ddl := []string{expiresAtIndex}
+	for _, column := range s.lookupColumns {
+		ddl = append(ddl, fmt.Sprintf(lookupIndex, s.tableName, column))
+	}
+
+	return strings.Join(ddl, "\n") + "\n"
+}
 
-CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s (expires_at);
-CREATE INDEX IF NOT EXISTS idx_%[1]s_code ON %[1]s (code);
-CREATE INDEX IF NOT EXISTS idx_%[1]s_access ON %[1]s (access);
-CREATE INDEX IF NOT EXISTS idx_%[1]s_refresh ON %[1]s (refresh);
-`, s.tableName))
+// GCStats is the result of the garbage collection run
+type GCStats struct {
+	TableName string
+	// Deleted is the number of removed expired tokens, or the number of dropped chunks of the hypertable
+	Deleted int64
+	// Cleared is the number of expired access tokens cleared from the rows with valid refresh token,
+	// see WithTokenStoreAccessExpiration
+	Cleared  int64
+	Duration time.Duration
 }
 
 func (s *TokenStore) clean() {
-	now := time.Now()
-	err := s.adapter.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires_at <= $1", s.tableName), now)
+	if s.GCPaused() {
+		return
+	}
+
+	start := time.Now()
+	condition, args := s.gcArgsCondition(s.clock.Now(), nil)
+
+	var deleted int64
+	var err error
+	if s.gcMaxDuration > 0 {
+		deleted, err = s.cleanBatches(condition, args)
+	} else {
+		query := fmt.Sprintf("WITH deleted AS (DELETE FROM %s WHERE %s RETURNING 1) SELECT count(*) AS count FROM deleted", s.tableName, condition)
+		if s.hypertableChunk > 0 {
+			query, args = dropChunksQuery, []interface{}{s.tableName, s.clock.Now().Add(-s.gcRetention)}
+		}
+
+		var item struct {
+			Count int64 `db:"count"`
+		}
+		err = s.selectOne(context.Background(), &item, query, args...)
+		deleted = item.Count
+	}
+	var cleared int64
+	if err == nil && s.accessExpiration {
+		cleared, err = s.clearExpiredAccess()
+	}
 	if err != nil {
 		s.logger.Printf("Error while cleaning out outdated entities: %+v", err)
+		s.reportError("GC", &err)
+		return
+	}
+
+	stats := GCStats{TableName: s.tableName, Deleted: deleted, Cleared: cleared, Duration: time.Since(start)}
+	if s.gcObserver != nil {
+		s.gcObserver(stats)
+	}
+	if stats.Deleted > 0 || s.gcLogAlways {
+		s.logger.Printf("Token store GC finished: table=%s deleted=%d duration=%s", stats.TableName, stats.Deleted, stats.Duration)
 	}
+	s.maintain(stats)
 }
 
-// Create creates and stores the new token information
-func (s *TokenStore) Create(info oauth2.TokenInfo) error {
-	buf, err := jsoniter.Marshal(info)
-	if err != nil {
-		return err
+// clearExpiredAccess clears the access tokens expired for longer than the access tokens GC retention from the rows
+// with valid refresh token, the rows stay until the refresh token expires
+func (s *TokenStore) clearExpiredAccess() (int64, error) {
+	retention, ok := s.gcKindRetention[TokenKindAccess]
+	if !ok {
+		retention = s.gcRetention
 	}
 
-	item := &TokenStoreItem{
-		Data:      buf,
-		CreatedAt: time.Now(),
+	set := "access = '', access_expires_at = NULL"
+	if !s.columnsStorage {
+		set += `, data = jsonb_set(data, '{Access}', '""')`
 	}
 
-	if code := info.GetCode(); code != "" {
-		item.Code = code
-		item.ExpiresAt = info.GetCodeCreateAt().Add(info.GetCodeExpiresIn())
-	} else {
-		item.Access = info.GetAccess()
-		item.ExpiresAt = info.GetAccessCreateAt().Add(info.GetAccessExpiresIn())
+	var item struct {
+		Count int64 `db:"count"`
+	}
+	err := s.selectOne(context.Background(), &item, fmt.Sprintf(
+		"WITH cleared AS (UPDATE %s SET %s, updated_at = now() WHERE access <> '' AND refresh <> '' AND access_expires_at <= $1 RETURNING 1) SELECT count(*) AS count FROM cleared",
+		s.tableName, set), s.clock.Now().Add(-retention))
+	return item.Count, err
+}
+
+// gcCondition returns the condition matching the tokens garbage collection removes, cutoff returns the SQL expression
+// of the time the tokens expired before are removed for the retention. Tokens of the kinds with own GC retention are
+// kept for it instead of the store one, the condition on the shortest retention keeps the expiry index usable.
+func (s *TokenStore) gcCondition(cutoff func(retention time.Duration) string) string {
+	if len(s.gcKindRetention) == 0 {
+		return "expires_at <= " + cutoff(s.gcRetention)
+	}
 
-		if refresh := info.GetRefresh(); refresh != "" {
-			item.Refresh = info.GetRefresh()
-			item.ExpiresAt = info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn())
+	shortest := s.gcRetention
+	for _, retention := range s.gcKindRetention {
+		if retention < shortest {
+			shortest = retention
 		}
 	}
 
-	return s.adapter.Exec(
-		fmt.Sprintf("INSERT INTO %s (created_at, expires_at, code, access, refresh, data) VALUES ($1, $2, $3, $4, $5, $6)", s.tableName),
-		item.CreatedAt,
-		item.ExpiresAt,
-		item.Code,
-		item.Access,
-		item.Refresh,
-		item.Data,
-	)
+	// arguments are numbered in the order they appear in the condition
+	condition := fmt.Sprintf("expires_at <= %s AND CASE %s", cutoff(shortest), kindExpr)
+	for _, kind := range []TokenKind{TokenKindCode, TokenKindAccess, TokenKindRefresh} {
+		if retention, ok := s.gcKindRetention[kind]; ok {
+			condition += fmt.Sprintf(" WHEN '%s' THEN expires_at <= %s", kind, cutoff(retention))
+		}
+	}
+	return condition + fmt.Sprintf(" ELSE expires_at <= %s END", cutoff(s.gcRetention))
 }
 
-// RemoveByCode deletes the authorization code
-func (s *TokenStore) RemoveByCode(code string) error {
-	err := s.adapter.Exec(fmt.Sprintf("DELETE FROM %s WHERE code = $1", s.tableName), code)
-	if err == pgadapter.ErrNoRows {
-		return nil
+// gcArgsCondition returns gcCondition with the cutoff times relative to now appended to the query arguments
+func (s *TokenStore) gcArgsCondition(now time.Time, args []interface{}) (string, []interface{}) {
+	condition := s.gcCondition(func(retention time.Duration) string {
+		args = append(args, now.Add(-retention))
+		return fmt.Sprintf("$%d", len(args))
+	})
+	return condition, args
+}
+
+// cleanBatches removes the tokens matching the GC condition in batches until there are no more of them or GC max
+// duration is spent, the query running when the time is up is cancelled and the rest of the backlog is left for the
+// next run
+func (s *TokenStore) cleanBatches(condition string, args []interface{}) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.gcMaxDuration)
+	defer cancel()
+
+	query := fmt.Sprintf("WITH deleted AS (DELETE FROM %[1]s WHERE id IN (SELECT id FROM %[1]s WHERE %[2]s LIMIT $%[3]d) RETURNING 1) SELECT count(*) AS count FROM deleted", s.tableName, condition, len(args)+1)
+	args = append(args, s.batchSize)
+
+	var total int64
+	for {
+		var item struct {
+			Count int64 `db:"count"`
+		}
+		if err := s.selectOne(ctx, &item, query, args...); err != nil {
+			if ctx.Err() != nil {
+				return total, nil
+			}
+			return total, err
+		}
+
+		total += item.Count
+		if item.Count < int64(s.batchSize) || ctx.Err() != nil {
+			return total, nil
+		}
 	}
-	return err
 }
 
-// RemoveByAccess uses the access token to delete the token information
-func (s *TokenStore) RemoveByAccess(access string) error {
-	err := s.adapter.Exec(fmt.Sprintf("DELETE FROM %s WHERE access = $1", s.tableName), access)
-	if err == pgadapter.ErrNoRows {
-		return nil
+// maintain runs the table maintenance after the garbage collection run removed many tokens, ANALYZE refreshes
+// the planner statistics left stale by the large delete, errors are logged with the store logger
+func (s *TokenStore) maintain(stats GCStats) {
+	if s.gcAnalyzeThreshold > 0 && stats.Deleted > s.gcAnalyzeThreshold {
+		if err := s.exec(context.Background(), fmt.Sprintf("ANALYZE %s", s.tableName)); err != nil {
+			s.logger.Printf("Error while analyzing table after GC: %+v", err)
+			s.reportError("GC", &err)
+		}
+	}
+
+	if s.gcMaintenanceHook != nil && stats.Deleted > s.gcMaintenanceThreshold {
+		if err := s.gcMaintenanceHook(context.Background(), stats); err != nil {
+			s.logger.Printf("Error while running GC maintenance hook: %+v", err)
+			s.reportError("GC", &err)
+		}
 	}
-	return err
 }
 
-// RemoveByRefresh uses the refresh token to delete the token information
-func (s *TokenStore) RemoveByRefresh(refresh string) error {
-	err := s.adapter.Exec(fmt.Sprintf("DELETE FROM %s WHERE refresh = $1", s.tableName), refresh)
-	if err == pgadapter.ErrNoRows {
-		return nil
+// reportError calls the error handler with the failed operation error, the token lookups that found
+// no valid token are not failures
+func (s *TokenStore) reportError(op string, err *error) {
+	if s.errorHandler == nil || *err == nil || errors.Is(*err, ErrTokenNotFound) || errors.Is(*err, ErrTokenExpired) {
+		return
+	}
+	s.errorHandler(op, *err)
+}
+
+// PauseGC pauses garbage collection, e.g. for the database maintenance window, the GC runs scheduled while
+// paused are skipped and the run already in progress is not interrupted. The pg_cron job runs on the server
+// and is not paused.
+func (s *TokenStore) PauseGC() {
+	if atomic.CompareAndSwapInt32(&s.gcPaused, 0, 1) {
+		s.logger.Printf("Token store GC paused: table=%s", s.tableName)
+	}
+}
+
+// ResumeGC resumes garbage collection paused with PauseGC, expired tokens are removed with the next scheduled run
+func (s *TokenStore) ResumeGC() {
+	if atomic.CompareAndSwapInt32(&s.gcPaused, 1, 0) {
+		s.logger.Printf("Token store GC resumed: table=%s", s.tableName)
 	}
+}
+
+// GCPaused checks if garbage collection is paused with PauseGC
+func (s *TokenStore) GCPaused() bool {
+	return atomic.LoadInt32(&s.gcPaused) == 1
+}
+
+// TriggerGCForTest runs garbage collection pass synchronously regardless of the GC strategy,
+// together with the clock option allows to test GC behaviour without waiting for the interval
+func (s *TokenStore) TriggerGCForTest() {
+	s.clean()
+}
+
+// Create creates and stores the new token information
+func (s *TokenStore) Create(info oauth2.TokenInfo) (err error) {
+	defer s.reportError("Create", &err)
+
+	_, _, err = s.create(context.Background(), info, "")
 	return err
 }
 
-func (s *TokenStore) toTokenInfo(data []byte) (oauth2.TokenInfo, error) {
-	var tm models.Token
-	err := jsoniter.Unmarshal(data, &tm)
-	return &tm, err
+// CreateWithID creates and stores the new token information with the single round-trip
+// and returns the generated row id, requires TokenKeyBigSerial key type
+func (s *TokenStore) CreateWithID(ctx context.Context, info oauth2.TokenInfo) (_ int64, err error) {
+	defer s.reportError("CreateWithID", &err)
+
+	if s.keyType != TokenKeyBigSerial {
+		return 0, errors.New("CreateWithID requires BIGSERIAL token keys, use CreateWithKey")
+	}
+
+	id, _, err := s.create(ctx, info, "")
+	return id, err
 }
 
-// GetByCode uses the authorization code for token information data
-func (s *TokenStore) GetByCode(code string) (oauth2.TokenInfo, error) {
-	if code == "" {
-		return nil, nil
+// CreateWithKey creates and stores the new token information with the single round-trip
+// and returns the row key as text for any key type
+func (s *TokenStore) CreateWithKey(ctx context.Context, info oauth2.TokenInfo) (_ string, err error) {
+	defer s.reportError("CreateWithKey", &err)
+
+	_, key, err := s.create(ctx, info, "")
+	return key, err
+}
+
+// create inserts the token row, extraColumns are set to the extraArgs values
+func (s *TokenStore) create(ctx context.Context, info oauth2.TokenInfo, extraColumns string, extraArgs ...interface{}) (int64, string, error) {
+	id, key, err := s.insert(ctx, info, extraColumns, extraArgs...)
+	if err == nil {
+		s.afterCreate()
 	}
+	return id, key, err
+}
 
-	var item TokenStoreItem
-	if err := s.adapter.SelectOne(&item, fmt.Sprintf("SELECT * FROM %s WHERE code = $1", s.tableName), code); err != nil {
-		return nil, err
+// afterCreate runs write-triggered garbage collection pass in the background every configured number of created
+// tokens, the pass is skipped while the previous one is still running or the store is draining
+func (s *TokenStore) afterCreate() {
+	if s.gcEveryCreates == 0 || atomic.AddInt64(&s.creates, 1)%int64(s.gcEveryCreates) != 0 {
+		return
+	}
+	if atomic.LoadInt32(&s.draining) == 1 || !atomic.CompareAndSwapInt32(&s.gcRunning, 0, 1) {
+		return
 	}
 
-	return s.toTokenInfo(item.Data)
+	// the pass is in-flight operation, so Drain waits for it
+	atomic.AddInt64(&s.inflight, 1)
+	go func() {
+		defer atomic.AddInt64(&s.inflight, -1)
+		defer atomic.StoreInt32(&s.gcRunning, 0)
+		s.clean()
+	}()
 }
 
-// GetByAccess uses the access token for token information data
-func (s *TokenStore) GetByAccess(access string) (oauth2.TokenInfo, error) {
-	if access == "" {
-		return nil, nil
+func (s *TokenStore) insert(ctx context.Context, info oauth2.TokenInfo, extraColumns string, extraArgs ...interface{}) (int64, string, error) {
+	item, columns, args, err := s.insertValues(info)
+	if err != nil {
+		return 0, "", err
+	}
+	if s.refreshFamilies && info.GetRefresh() != "" {
+		familyID, err := newUUID(TokenKeyUUIDv4, item.CreatedAt)
+		if err != nil {
+			return 0, "", err
+		}
+		columns += ", family_id"
+		args = append(args, familyID)
+	}
+	if extraColumns != "" {
+		columns += ", " + extraColumns
+		args = append(args, extraArgs...)
 	}
 
-	var item TokenStoreItem
-	if err := s.adapter.SelectOne(&item, fmt.Sprintf("SELECT * FROM %s WHERE access = $1", s.tableName), access); err != nil {
-		return nil, err
+	// created_at is always the first argument, new rows have it as updated_at as well
+	if s.keyType == TokenKeyBigSerial {
+		err := s.selectOne(ctx, item, fmt.Sprintf("INSERT INTO %s (%s, updated_at) VALUES (%s, $1) RETURNING id", s.tableName, columns, placeholders(len(args))), args...)
+		return item.ID, strconv.FormatInt(item.ID, 10), err
 	}
 
-	return s.toTokenInfo(item.Data)
+	// UUID keys are generated by the store, so there is nothing to return from the database
+	key, err := newUUID(s.keyType, item.CreatedAt)
+	if err != nil {
+		return 0, "", err
+	}
+	args = append(args, key)
+	err = s.exec(ctx, fmt.Sprintf("INSERT INTO %s (%s, id, updated_at) VALUES (%s, $1)", s.tableName, columns, placeholders(len(args))), args...)
+	return 0, key, err
 }
 
-// GetByRefresh uses the refresh token for token information data
-func (s *TokenStore) GetByRefresh(refresh string) (oauth2.TokenInfo, error) {
-	if refresh == "" {
-		return nil, nil
+// insertValues returns the token row item, the columns list and the values for the insert
+func (s *TokenStore) insertValues(info oauth2.TokenInfo) (*TokenStoreItem, string, []interface{}, error) {
+	item := &TokenStoreItem{
+		CreatedAt: s.clock.Now(),
 	}
 
-	var item TokenStoreItem
-	if err := s.adapter.SelectOne(&item, fmt.Sprintf("SELECT * FROM %s WHERE refresh = $1", s.tableName), refresh); err != nil {
-		return nil, err
+	item.ExpiresAt = s.expiresAt(info)
+	if code := info.GetCode(); code != "" {
+		item.Code = s.lookupValue(code)
+	} else {
+		item.Access = s.lookupValue(info.GetAccess())
+		item.Refresh = s.lookupValue(info.GetRefresh())
+	}
+
+	var (
+		columns string
+		args    []interface{}
+	)
+	if s.columnsStorage {
+		columns = `
+  created_at, expires_at, client_id, user_id, redirect_uri, scope,
+  code, code_created_at, code_expires_in,
+  access, access_created_at, access_expires_in,
+  refresh, refresh_created_at, refresh_expires_in, authorization_details`
+		args = []interface{}{
+			item.CreatedAt,
+			item.ExpiresAt,
+			info.GetClientID(),
+			info.GetUserID(),
+			info.GetRedirectURI(),
+			info.GetScope(),
+			item.Code,
+			nullTime(info.GetCodeCreateAt()),
+			int64(info.GetCodeExpiresIn()),
+			item.Access,
+			nullTime(info.GetAccessCreateAt()),
+			int64(info.GetAccessExpiresIn()),
+			item.Refresh,
+			nullTime(info.GetRefreshCreateAt()),
+			int64(info.GetRefreshExpiresIn()),
+			tokenAuthorizationDetails(info),
+		}
+	} else {
+		buf, err := jsoniter.Marshal(info)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if s.hashedLookups() {
+			if buf, err = s.hashDataTokens(buf, info); err != nil {
+				return nil, "", nil, err
+			}
+		}
+		if s.compressor != nil {
+			if buf, err = compress(s.compressor, buf); err != nil {
+				return nil, "", nil, err
+			}
+		}
+		item.Data = buf
+
+		columns = "created_at, expires_at, code, access, refresh, data, authorization_details"
+		args = []interface{}{item.CreatedAt, item.ExpiresAt, item.Code, item.Access, item.Refresh, item.Data, tokenAuthorizationDetails(info)}
+
+		// data storage mode has the client column only for the foreign key
+		if s.clientForeignKey != "" {
+			var clientID interface{}
+			if info.GetClientID() != "" {
+				clientID = info.GetClientID()
+			}
+			columns += ", client_id"
+			args = append(args, clientID)
+		}
+	}
+
+	if s.accessExpiration {
+		var accessExpiresAt time.Time
+		if info.GetAccess() != "" && info.GetAccessExpiresIn() > 0 {
+			accessExpiresAt = info.GetAccessCreateAt().Add(info.GetAccessExpiresIn())
+		}
+		columns += ", access_expires_at"
+		args = append(args, nullTime(accessExpiresAt))
+	}
+
+	return item, columns, args, nil
+}
+
+// Rotate replaces the token issued with the refresh token by the new token information with the single statement,
+// the new token inherits the refresh token family. ErrTokenNotFound is returned when there is no such refresh token,
+// e.g. it was already rotated, and ErrTokenExpired is returned when the refresh token is expired.
+func (s *TokenStore) Rotate(ctx context.Context, refresh string, info oauth2.TokenInfo) (err error) {
+	defer s.reportError("Rotate", &err)
+
+	item, columns, args, err := s.insertValues(info)
+	if err != nil {
+		return err
+	}
+	values := placeholders(len(args))
+
+	returning := "1"
+	if s.refreshFamilies {
+		returning = "family_id"
+		columns += ", family_id"
+		values += ", old.family_id"
+	}
+	if s.keyType != TokenKeyBigSerial {
+		key, err := newUUID(s.keyType, item.CreatedAt)
+		if err != nil {
+			return err
+		}
+		args = append(args, key)
+		columns += ", id"
+		values += fmt.Sprintf(", $%d", len(args))
+	}
+	args = append(args, s.lookupArg(refresh), s.clock.Now())
+	condition := fmt.Sprintf("%s AND expires_at > $%d", s.lookupConditionParam("refresh", fmt.Sprintf("$%d", len(args)-1)), len(args))
+
+	// with the reuse detection rotated token is marked as consumed instead of being removed
+	old := fmt.Sprintf("DELETE FROM %s WHERE %s", s.tableName, condition)
+	if s.refreshReuseDetection {
+		old = fmt.Sprintf("UPDATE %s SET consumed_at = $1, updated_at = $1 WHERE %s AND consumed_at IS NULL", s.tableName, condition)
 	}
 
-	return s.toTokenInfo(item.Data)
+	var rotated struct {
+		Rotated bool `db:"rotated"`
+	}
+	err = s.selectOne(ctx, &rotated, fmt.Sprintf(`
+WITH old AS (%[1]s RETURNING %[2]s)
+INSERT INTO %[3]s (%[4]s, updated_at) SELECT %[5]s, $1 FROM old
+RETURNING TRUE AS rotated
+`, old, returning, s.tableName, columns, values), args...)
+	if err == nil {
+		// rotated token is the created one for the write-triggered garbage collection
+		s.afterCreate()
+		return nil
+	}
+	if !errors.Is(err, ErrTokenNotFound) {
+		return err
+	}
+
+	if s.refreshReuseDetection {
+		if err := s.detectRefreshReuse(ctx, refresh); !errors.Is(err, ErrTokenNotFound) {
+			return err
+		}
+	}
+	return s.expiredOrNotFound(ctx, "refresh", refresh)
+}
+
+// expiredOrNotFound returns ErrTokenExpired if the token that was not found among the valid tokens is still stored,
+// ErrTokenNotFound is returned otherwise. Rotated tokens kept for the refresh reuse detection are not expired ones.
+func (s *TokenStore) expiredOrNotFound(ctx context.Context, column, value string) error {
+	condition := s.lookupCondition(column)
+	if s.refreshReuseDetection {
+		condition += " AND consumed_at IS NULL"
+	}
+
+	var item struct {
+		Expired bool `db:"expired"`
+	}
+	if err := s.selectOne(ctx, &item, fmt.Sprintf("SELECT TRUE AS expired FROM %s WHERE %s", s.tableName, condition), s.lookupArg(value)); err != nil {
+		return err
+	}
+	return ErrTokenExpired
+}
+
+// detectRefreshReuse checks if the refresh token that was not found among the active tokens was already rotated,
+// reuse of the rotated token means it was stolen, so the whole token family is revoked and ErrRefreshReuseDetected
+// is returned, ErrTokenNotFound is returned otherwise
+func (s *TokenStore) detectRefreshReuse(ctx context.Context, refresh string) error {
+	var item struct {
+		FamilyID string `db:"family_id"`
+	}
+	err := s.selectOne(
+		ctx,
+		&item,
+		fmt.Sprintf("SELECT family_id FROM %s WHERE %s AND consumed_at IS NOT NULL", s.tableName, s.lookupCondition("refresh")),
+		s.lookupArg(refresh),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := s.RemoveFamily(item.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshReuseDetected
+}
+
+// FamilyID returns the family of the refresh token, requires WithTokenStoreRefreshFamilies option
+func (s *TokenStore) FamilyID(refresh string) (_ string, err error) {
+	defer s.reportError("FamilyID", &err)
+
+	if !s.refreshFamilies {
+		return "", errors.New("FamilyID requires WithTokenStoreRefreshFamilies option")
+	}
+
+	var item struct {
+		FamilyID string `db:"family_id"`
+	}
+	err = s.selectOne(context.Background(), &item, fmt.Sprintf("SELECT family_id FROM %s WHERE %s", s.tableName, s.lookupCondition("refresh")), s.lookupArg(refresh))
+	return item.FamilyID, err
+}
+
+// RemoveFamily deletes all the tokens of the refresh token family, i.e. the whole session chain,
+// requires WithTokenStoreRefreshFamilies option
+func (s *TokenStore) RemoveFamily(familyID string) (err error) {
+	defer s.reportError("RemoveFamily", &err)
+
+	if !s.refreshFamilies {
+		return errors.New("RemoveFamily requires WithTokenStoreRefreshFamilies option")
+	}
+
+	err = s.exec(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE family_id = $1", s.tableName), familyID)
+	if errors.Is(err, pgadapter.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// refreshFamiliesDDL returns refresh token family index creation statement if families are enabled
+func (s *TokenStore) refreshFamiliesDDL() string {
+	if !s.refreshFamilies {
+		return ""
+	}
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_family_id ON %[1]s (family_id);\n", s.tableName)
+}
+
+// accessExpirationDDL returns access token expiration index creation statement if it is enabled, only the rows
+// with both access and refresh tokens are indexed as the other rows expire by themselves
+func (s *TokenStore) accessExpirationDDL() string {
+	if !s.accessExpiration {
+		return ""
+	}
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_access_expires_at ON %[1]s (access_expires_at) WHERE access <> '' AND refresh <> '';\n", s.tableName)
+}
+
+// CreateExchanged creates and stores the token issued by RFC 8693 token exchange for the parent subject token,
+// actor is the acting party identifier or empty string. Exchanged tokens are removed together with the parent token,
+// GC removal of the expired parent included, so they are not valid longer than the subject token.
+// ErrTokenNotFound or ErrTokenExpired is returned for unknown or expired parent token.
+// Requires WithTokenStoreExchangeLineage option.
+func (s *TokenStore) CreateExchanged(ctx context.Context, parent, info oauth2.TokenInfo, actor string) (err error) {
+	defer s.reportError("CreateExchanged", &err)
+
+	if !s.exchangeLineage {
+		return errors.New("CreateExchanged requires WithTokenStoreExchangeLineage option")
+	}
+
+	column, value := "access", parent.GetAccess()
+	if value == "" {
+		column, value = "refresh", parent.GetRefresh()
+	}
+
+	var item struct {
+		ID      []byte `db:"id"`
+		Expired bool   `db:"expired"`
+	}
+	if err := s.selectOne(
+		ctx,
+		&item,
+		fmt.Sprintf("SELECT to_jsonb(id) AS id, expires_at <= $2 AS expired FROM %s WHERE %s", s.tableName, s.lookupCondition(column)),
+		s.lookupArg(value),
+		s.clock.Now(),
+	); err != nil {
+		return err
+	}
+	if item.Expired {
+		return ErrTokenExpired
+	}
+	parentKey, err := s.keyType.parseKey(item.ID)
+	if err != nil {
+		return err
+	}
+
+	var actorArg interface{}
+	if actor != "" {
+		actorArg = actor
+	}
+	_, _, err = s.create(ctx, info, "parent_token_id, actor", parentKey, actorArg)
+	return err
+}
+
+// clientForeignKeyDDL returns the client foreign key creation statements if it is enabled
+func (s *TokenStore) clientForeignKeyDDL() string {
+	if s.clientForeignKey == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%[1]s_client_id ON %[1]s (client_id);
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = '%[1]s'::regclass AND conname = '%[1]s_client_id_fkey') THEN
+    ALTER TABLE %[1]s ADD CONSTRAINT %[1]s_client_id_fkey FOREIGN KEY (client_id) REFERENCES %[2]s (id) ON DELETE CASCADE;
+  END IF;
+END $$;
+`, s.tableName, s.clientForeignKey)
+}
+
+// exchangeLineageDDL returns token exchange lineage index creation statement if lineage is enabled
+func (s *TokenStore) exchangeLineageDDL() string {
+	if !s.exchangeLineage {
+		return ""
+	}
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_parent_token_id ON %[1]s (parent_token_id);\n", s.tableName)
+}
+
+// placeholders returns comma-separated list of n query placeholders
+func placeholders(n int) string {
+	return placeholdersFrom(0, n)
+}
+
+// placeholdersFrom returns n query placeholders following the first offset ones
+func placeholdersFrom(offset, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("$%d", offset+i+1)
+	}
+	return strings.Join(list, ", ")
+}
+
+// expiresAt returns the time when the stored token row becomes outdated depending on the store expiry kind
+func (s *TokenStore) expiresAt(info oauth2.TokenInfo) time.Time {
+	switch s.expiryKind {
+	case TokenKindAccess:
+		return info.GetAccessCreateAt().Add(info.GetAccessExpiresIn())
+	case TokenKindRefresh:
+		return info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn())
+	}
+	return tokenExpiresAt(info)
+}
+
+// tokenExpiresAt returns the time when the stored token row becomes outdated
+func tokenExpiresAt(info oauth2.TokenInfo) time.Time {
+	if info.GetCode() != "" {
+		return info.GetCodeCreateAt().Add(info.GetCodeExpiresIn())
+	}
+	if info.GetRefresh() != "" {
+		return info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn())
+	}
+	return info.GetAccessCreateAt().Add(info.GetAccessExpiresIn())
+}
+
+// tokenKindExpired returns true if the token of the kind is expired, tokens without the expiration never expire
+func tokenKindExpired(info oauth2.TokenInfo, kind TokenKind, now time.Time) bool {
+	createdAt, expiresIn := info.GetAccessCreateAt(), info.GetAccessExpiresIn()
+	switch kind {
+	case TokenKindCode:
+		createdAt, expiresIn = info.GetCodeCreateAt(), info.GetCodeExpiresIn()
+	case TokenKindRefresh:
+		createdAt, expiresIn = info.GetRefreshCreateAt(), info.GetRefreshExpiresIn()
+	}
+	return expiresIn > 0 && !createdAt.Add(expiresIn).After(now)
+}
+
+// tokenColumnsData is the SQL expression that reconstructs serialized token data from the typed columns
+const tokenColumnsData = `jsonb_build_object(
+  'ClientID', client_id, 'UserID', user_id, 'RedirectURI', redirect_uri, 'Scope', scope,
+  'Code', code, 'CodeCreateAt', code_created_at, 'CodeExpiresIn', code_expires_in,
+  'Access', access, 'AccessCreateAt', access_created_at, 'AccessExpiresIn', access_expires_in,
+  'Refresh', refresh, 'RefreshCreateAt', refresh_created_at, 'RefreshExpiresIn', refresh_expires_in,
+  'AuthorizationDetails', authorization_details
+)`
+
+// dataExpr returns SQL expression for the serialized token data depending on the storage mode
+func (s *TokenStore) dataExpr() string {
+	if s.columnsStorage {
+		return tokenColumnsData
+	}
+	return "data"
+}
+
+// fieldExpr returns SQL expression for the serialized token data field depending on the storage mode
+func (s *TokenStore) fieldExpr(field string) string {
+	if s.columnsStorage {
+		return tokenColumns[field]
+	}
+	return fmt.Sprintf("data->>'%s'", field)
+}
+
+// tokenColumns maps serialized token data fields to the typed columns of the columns-only storage mode
+var tokenColumns = map[string]string{
+	"ClientID":    "client_id",
+	"UserID":      "user_id",
+	"RedirectURI": "redirect_uri",
+	"Scope":       "scope",
+	"Code":        "code",
+	"Access":      "access",
+	"Refresh":     "refresh",
+}
+
+// kindExpr is the SQL expression for the token kind
+const kindExpr = "CASE WHEN code <> '' THEN 'code' WHEN refresh <> '' THEN 'refresh' ELSE 'access' END"
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// RemoveByCode deletes the authorization code
+func (s *TokenStore) RemoveByCode(code string) (err error) {
+	defer s.reportError("RemoveByCode", &err)
+
+	if code == "" {
+		return nil
+	}
+
+	err = s.exec(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE %s", s.tableName, s.lookupCondition("code")), s.lookupArg(code))
+	if errors.Is(err, pgadapter.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// RemoveByAccess uses the access token to delete the token information
+func (s *TokenStore) RemoveByAccess(access string) (err error) {
+	defer s.reportError("RemoveByAccess", &err)
+
+	// empty value matches the rows without the token, e.g. the access tokens cleared by GC
+	if access == "" {
+		return nil
+	}
+
+	err = s.exec(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE %s", s.tableName, s.lookupCondition("access")), s.lookupArg(access))
+	if errors.Is(err, pgadapter.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// RemoveByRefresh uses the refresh token to delete the token information
+func (s *TokenStore) RemoveByRefresh(refresh string) (err error) {
+	defer s.reportError("RemoveByRefresh", &err)
+
+	if refresh == "" {
+		return nil
+	}
+
+	err = s.exec(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE %s", s.tableName, s.lookupCondition("refresh")), s.lookupArg(refresh))
+	if errors.Is(err, pgadapter.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+func (s *TokenStore) toTokenInfo(data []byte) (oauth2.TokenInfo, error) {
+	data, err := decompress(s.compressors, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalToken(data)
+}
+
+// tokenDataItem is the Get* queries destination, items are reused to not allocate them on every token lookup
+type tokenDataItem struct {
+	Data []byte `db:"data"`
+}
+
+var tokenDataItemPool = sync.Pool{
+	New: func() interface{} {
+		return new(tokenDataItem)
+	},
+}
+
+// getBy returns the token information found by the query, ErrTokenExpired is returned when the token of the kind
+// is found but already expired and is not removed by the garbage collection yet
+func (s *TokenStore) getBy(kind TokenKind, query string, value interface{}) (oauth2.TokenInfo, error) {
+	item := tokenDataItemPool.Get().(*tokenDataItem)
+	defer func() {
+		item.Data = nil
+		tokenDataItemPool.Put(item)
+	}()
+
+	if err := s.selectOne(context.Background(), item, query, value); err != nil {
+		return nil, err
+	}
+
+	info, err := s.toTokenInfo(item.Data)
+	if err != nil {
+		return nil, err
+	}
+	if tokenKindExpired(info, kind, s.clock.Now()) {
+		return nil, ErrTokenExpired
+	}
+	return info, nil
+}
+
+// removeExpired deletes the token row found expired by the lookup when the cleanup on read is enabled. The row is
+// deleted only when it matches the GC condition, so the tokens are kept for GC retention the same way garbage collection
+// does, errors are logged as the lookup result does not depend on them.
+func (s *TokenStore) removeExpired(err error, column, value string) {
+	if !s.cleanupOnRead || !errors.Is(err, ErrTokenExpired) {
+		return
+	}
+
+	condition, args := s.gcArgsCondition(s.clock.Now(), []interface{}{s.lookupArg(value)})
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s AND %s", s.tableName, s.lookupCondition(column), condition)
+	if err := s.exec(context.Background(), query, args...); err != nil && !errors.Is(err, pgadapter.ErrNoRows) {
+		s.logger.Printf("Error while removing expired token on read: %+v", err)
+	}
+}
+
+// GetByCode uses the authorization code for token information data, ErrTokenExpired is returned for the expired code
+func (s *TokenStore) GetByCode(code string) (_ oauth2.TokenInfo, err error) {
+	defer s.reportError("GetByCode", &err)
+
+	if code == "" {
+		return nil, nil
+	}
+
+	info, err := s.getBy(TokenKindCode, s.getByCodeQuery, s.lookupArg(code))
+	if errors.Is(err, ErrTokenNotFound) && s.expiryFilter {
+		err = s.expiredOrNotFound(context.Background(), "code", code)
+	}
+	if err != nil {
+		s.removeExpired(err, "code", code)
+		return nil, err
+	}
+	if s.hashedLookups() {
+		// stored data has the digest instead of the plain token value
+		info.SetCode(code)
+	}
+	return info, nil
+}
+
+// GetByAccess uses the access token for token information data, ErrTokenExpired is returned for the expired token
+func (s *TokenStore) GetByAccess(access string) (_ oauth2.TokenInfo, err error) {
+	defer s.reportError("GetByAccess", &err)
+
+	if access == "" {
+		return nil, nil
+	}
+
+	info, err := s.getBy(TokenKindAccess, s.getByAccessQuery, s.lookupArg(access))
+	return s.accessLookupResult(access, info, err)
+}
+
+// accessLookupResult completes the access token lookup result the same way for all the access token lookups
+func (s *TokenStore) accessLookupResult(access string, info oauth2.TokenInfo, err error) (oauth2.TokenInfo, error) {
+	if errors.Is(err, ErrTokenNotFound) && s.expiryFilter {
+		err = s.expiredOrNotFound(context.Background(), "access", access)
+	}
+	if err != nil {
+		s.removeExpired(err, "access", access)
+		return nil, err
+	}
+	if s.hashedLookups() {
+		// stored data has the digest instead of the plain token value
+		info.SetAccess(access)
+	}
+	s.touch(access)
+	return info, nil
+}
+
+// GetByRefresh uses the refresh token for token information data, ErrTokenExpired is returned for the expired token
+func (s *TokenStore) GetByRefresh(refresh string) (_ oauth2.TokenInfo, err error) {
+	defer s.reportError("GetByRefresh", &err)
+
+	if refresh == "" {
+		return nil, nil
+	}
+
+	info, err := s.getBy(TokenKindRefresh, s.getByRefreshQuery, s.lookupArg(refresh))
+	if errors.Is(err, ErrTokenNotFound) && s.refreshReuseDetection {
+		err = s.detectRefreshReuse(context.Background(), refresh)
+	}
+	if errors.Is(err, ErrTokenNotFound) && s.expiryFilter {
+		err = s.expiredOrNotFound(context.Background(), "refresh", refresh)
+	}
+	if err != nil {
+		s.removeExpired(err, "refresh", refresh)
+		return nil, err
+	}
+	if s.hashedLookups() {
+		// stored data has the digest instead of the plain token value
+		info.SetRefresh(refresh)
+	}
+	return info, err
+}
+
+// FindByClaim returns all tokens which serialized data field defined by the dot-separated path
+// (e.g. "Scope" or "Extension.tenant") equals to the value, uses JSONB containment operator.
+// Not supported with token data compression.
+func (s *TokenStore) FindByClaim(path string, value interface{}) (_ []oauth2.TokenInfo, err error) {
+	defer s.reportError("FindByClaim", &err)
+
+	if s.compressor != nil {
+		// compressed token data can not be matched by the claim
+		return nil, errors.New("FindByClaim is not supported with token data compression")
+	}
+
+	keys := strings.Split(path, ".")
+	var claim interface{} = value
+	for i := len(keys) - 1; i >= 0; i-- {
+		claim = map[string]interface{}{keys[i]: claim}
+	}
+
+	buf, err := jsoniter.Marshal(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.selectTokens(context.Background(), fmt.Sprintf("SELECT COALESCE(jsonb_agg(%[1]s), '[]') AS data FROM %[2]s WHERE %[1]s @> $1::jsonb", s.dataExpr(), s.tableName), buf)
+}
+
+// selectTokens runs the query that aggregates token data into the single JSON array
+func (s *TokenStore) selectTokens(ctx context.Context, query string, args ...interface{}) ([]oauth2.TokenInfo, error) {
+	var item struct {
+		Data []byte `db:"data"`
+	}
+	if err := s.selectOne(ctx, &item, query, args...); err != nil {
+		return nil, err
+	}
+
+	var rows []jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(item.Data, &rows); err != nil {
+		return nil, err
+	}
+
+	tokens := make([]oauth2.TokenInfo, len(rows))
+	for i := range rows {
+		token, err := s.toTokenInfo(rows[i])
+		if err != nil {
+			return nil, err
+		}
+		tokens[i] = token
+	}
+
+	return tokens, nil
+}
+
+// Statistics returns active and expired tokens counts grouped by client id and token kind,
+// not supported with token data compression
+func (s *TokenStore) Statistics(ctx context.Context) (_ []TokenStatistics, err error) {
+	defer s.reportError("Statistics", &err)
+
+	if s.compressor != nil {
+		// compressed token data can not be grouped by the client
+		return nil, errors.New("Statistics is not supported with token data compression")
+	}
+
+	var item struct {
+		Data []byte `db:"data"`
+	}
+	if err := s.selectOne(ctx, &item, fmt.Sprintf(`
+SELECT COALESCE(jsonb_agg(jsonb_build_object('client_id', client_id, 'kind', kind, 'active', active, 'expired', expired)), '[]') AS data
+FROM (
+  SELECT COALESCE(%s, '') AS client_id, %s AS kind,
+    count(*) FILTER (WHERE expires_at > $1) AS active,
+    count(*) FILTER (WHERE expires_at <= $1) AS expired
+  FROM %s
+  GROUP BY 1, 2
+) AS stats
+`, s.fieldExpr("ClientID"), kindExpr, s.tableName), s.clock.Now()); err != nil {
+		return nil, err
+	}
+
+	var stats []TokenStatistics
+	err = jsoniter.Unmarshal(item.Data, &stats)
+	return stats, err
+}
+
+// backlogExactRows is the planner row estimate below which the expired backlog is counted exactly,
+// larger tables are sampled with backlogSamplePercent of their pages
+const (
+	backlogExactRows     = 10000
+	backlogSamplePercent = 1
+)
+
+// ExpiredBacklog returns the approximate number of expired tokens awaiting the garbage collection. Small tables
+// are counted exactly, for larger ones the planner row estimate is multiplied by the expired tokens share
+// in the table sample, so the value is cheap enough to be exported as a gauge.
+// CockroachDB and YugabyteDB have no table sampling, so the expired tokens are always counted with the expiry index there.
+func (s *TokenStore) ExpiredBacklog(ctx context.Context) (_ int64, err error) {
+	defer s.reportError("ExpiredBacklog", &err)
+
+	var item struct {
+		Backlog int64 `db:"backlog"`
+	}
+	if s.dialect != DialectPostgres {
+		err := s.selectOne(ctx, &item, fmt.Sprintf("SELECT count(*) AS backlog FROM %s WHERE expires_at <= $1", s.tableName), s.clock.Now())
+		return item.Backlog, err
+	}
+
+	err = s.selectOne(ctx, &item, fmt.Sprintf(`
+WITH estimate AS (SELECT reltuples FROM pg_class WHERE oid = $2::regclass)
+SELECT CASE
+  WHEN (SELECT reltuples FROM estimate) < %[2]d THEN (SELECT count(*) FROM %[1]s WHERE expires_at <= $1)
+  ELSE ((SELECT reltuples FROM estimate) * (SELECT COALESCE(avg((expires_at <= $1)::int), 0) FROM %[1]s TABLESAMPLE SYSTEM (%[3]d)))::bigint
+END AS backlog
+`, s.tableName, backlogExactRows, backlogSamplePercent), s.clock.Now(), s.tableName)
+	return item.Backlog, err
+}
+
+// RemoveWhere deletes all the tokens matching the filter with the single query and returns the number of deleted tokens,
+// returns ErrEmptyTokenFilter for the filter without criteria
+func (s *TokenStore) RemoveWhere(filter TokenFilter) (_ int64, err error) {
+	defer s.reportError("RemoveWhere", &err)
+
+	if filter.IsEmpty() {
+		return 0, ErrEmptyTokenFilter
+	}
+	if err := s.checkFilter("RemoveWhere", filter); err != nil {
+		return 0, err
+	}
+
+	where, args := s.filterWhere(filter, nil)
+
+	var item struct {
+		Count int64 `db:"count"`
+	}
+	if err := s.selectOne(
+		context.Background(),
+		&item,
+		fmt.Sprintf("WITH deleted AS (DELETE FROM %s WHERE %s RETURNING 1) SELECT count(*) AS count FROM deleted", s.tableName, where),
+		args...,
+	); err != nil {
+		return 0, err
+	}
+
+	return item.Count, nil
+}
+
+// Search returns the page of the tokens matching the filter ordered by creation
+func (s *TokenStore) Search(filter TokenFilter, page Pagination) (_ []oauth2.TokenInfo, err error) {
+	defer s.reportError("Search", &err)
+
+	if err := s.checkFilter("Search", filter); err != nil {
+		return nil, err
+	}
+
+	where, args := s.filterWhere(filter, nil)
+	args = append(args, page.limit(), page.Offset)
+
+	return s.selectTokens(context.Background(), fmt.Sprintf(`
+SELECT COALESCE(jsonb_agg(data ORDER BY %[1]s), '[]') AS data
+FROM (SELECT id, created_at, %[2]s AS data FROM %[3]s WHERE %[4]s ORDER BY %[1]s LIMIT $%[5]d OFFSET $%[6]d) AS page
+`, s.keyType.creationOrder(), s.dataExpr(), s.tableName, where, len(args)-1, len(args)), args...)
+}
+
+// ListExpiringWithin returns the page of the valid tokens that expire within the duration ordered by expiration,
+// e.g. to notify the owners of the long-lived tokens before they lapse. Authorization codes are not listed.
+func (s *TokenStore) ListExpiringWithin(d time.Duration, page Pagination) (_ []oauth2.TokenInfo, err error) {
+	defer s.reportError("ListExpiringWithin", &err)
+
+	if d <= 0 {
+		return nil, fmt.Errorf("expiration window must be positive, got %s", d)
+	}
+
+	var consumed string
+	if s.refreshReuseDetection {
+		consumed = " AND consumed_at IS NULL"
+	}
+
+	now := s.clock.Now()
+	return s.selectTokens(context.Background(), fmt.Sprintf(`
+SELECT COALESCE(jsonb_agg(data ORDER BY expires_at, id), '[]') AS data
+FROM (SELECT id, expires_at, %s AS data FROM %s WHERE code = '' AND expires_at > $1 AND expires_at <= $2%s ORDER BY expires_at, id LIMIT $3 OFFSET $4) AS page
+`, s.dataExpr(), s.tableName, consumed), now, now.Add(d), page.limit(), page.Offset)
+}
+
+// ForEach calls fn for every token matching the filter, tokens are loaded in batches ordered by id
+// to keep memory usage bounded, iteration stops on the first fn or context error
+func (s *TokenStore) ForEach(ctx context.Context, filter TokenFilter, fn func(oauth2.TokenInfo) error) (err error) {
+	defer s.reportError("ForEach", &err)
+
+	if err := s.checkFilter("ForEach", filter); err != nil {
+		return err
+	}
+
+	lastKey := s.keyType.minKey()
+	for {
+		where, args := s.filterWhere(filter, []interface{}{lastKey, s.batchSize})
+
+		var item struct {
+			Data []byte `db:"data"`
+		}
+		if err := s.selectOne(ctx, &item, fmt.Sprintf(`
+SELECT COALESCE(jsonb_agg(jsonb_build_object('id', id, 'data', data) ORDER BY id), '[]') AS data
+FROM (SELECT id, %s AS data FROM %s WHERE id > $1 AND %s ORDER BY id LIMIT $2) AS batch
+`, s.dataExpr(), s.tableName, where), args...); err != nil {
+			return err
+		}
+
+		var rows []struct {
+			ID   jsoniter.RawMessage `json:"id"`
+			Data jsoniter.RawMessage `json:"data"`
+		}
+		if err := jsoniter.Unmarshal(item.Data, &rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			token, err := s.toTokenInfo(row.Data)
+			if err != nil {
+				return err
+			}
+			if err := fn(token); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < s.batchSize {
+			return nil
+		}
+		var err error
+		if lastKey, err = s.keyType.parseKey(rows[len(rows)-1].ID); err != nil {
+			return err
+		}
+	}
+}
+
+// Export writes all the tokens to w in the format
+func (s *TokenStore) Export(ctx context.Context, w io.Writer, format ExportFormat) (err error) {
+	defer s.reportError("Export", &err)
+
+	return s.ForEach(ctx, TokenFilter{}, func(info oauth2.TokenInfo) error {
+		if format == ExportJSONLinesRedacted {
+			redactToken(info)
+		}
+		return writeJSONLine(w, info)
+	})
+}
+
+// importBatchMaxRows bounds the rows inserted with the single import statement, so the statement stays within
+// the limit of 65535 bind parameters with all the optional columns
+const importBatchMaxRows = 3000
+
+// Import copies all the tokens from the source into the store and returns the number of imported tokens. Tokens
+// are inserted in batches of the configured batch size with the single statement per batch, already expired tokens
+// and the ones with the code, access or refresh token that is already stored are skipped, so the import can be rerun.
+func (s *TokenStore) Import(ctx context.Context, src TokenSource) (_ int64, err error) {
+	defer s.reportError("Import", &err)
+
+	size := s.batchSize
+	if size > importBatchMaxRows {
+		size = importBatchMaxRows
+	}
+
+	var imported int64
+	batch := make([]oauth2.TokenInfo, 0, size)
+	flush := func() error {
+		n, err := s.importBatch(ctx, batch)
+		imported += n
+		batch = batch[:0]
+		return err
+	}
+
+	err = src.ForEach(ctx, func(info oauth2.TokenInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.expiresAt(info).Before(s.clock.Now()) {
+			return nil
+		}
+		if batch = append(batch, info); len(batch) < size {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+
+	return imported, err
+}
+
+// importBatch inserts the tokens with the single statement and returns the number of inserted tokens, the tokens
+// with the code, access or refresh token that is already stored or repeated in the batch are skipped
+func (s *TokenStore) importBatch(ctx context.Context, batch []oauth2.TokenInfo) (int64, error) {
+	// parameters of the VALUES list have no type to be inferred from, so they are cast to the column types
+	types := make(map[string]string)
+	for _, column := range s.tableColumns() {
+		types[column.name] = column.dataType
+	}
+
+	var (
+		columns string
+		values  = make([]string, 0, len(batch))
+		args    []interface{}
+		seen    = make(map[string]bool)
+	)
+	for _, info := range batch {
+		item, rowColumns, rowArgs, err := s.insertValues(info)
+		if err != nil {
+			return 0, err
+		}
+		if s.importedBefore(seen, item) {
+			continue
+		}
+		// all the rows have the same columns, so the tokens without refresh token have no family
+		if s.refreshFamilies {
+			var familyID interface{}
+			if info.GetRefresh() != "" {
+				if familyID, err = newUUID(TokenKeyUUIDv4, item.CreatedAt); err != nil {
+					return 0, err
+				}
+			}
+			rowColumns += ", family_id"
+			rowArgs = append(rowArgs, familyID)
+		}
+		if s.keyType != TokenKeyBigSerial {
+			key, err := newUUID(s.keyType, item.CreatedAt)
+			if err != nil {
+				return 0, err
+			}
+			rowColumns += ", id"
+			rowArgs = append(rowArgs, key)
+		}
+
+		names := strings.Split(rowColumns, ",")
+		row := make([]string, len(names))
+		for i, name := range names {
+			row[i] = fmt.Sprintf("$%d::%s", len(args)+i+1, types[strings.TrimSpace(name)])
+		}
+		columns = strings.Join(names, ",")
+		values = append(values, "("+strings.Join(row, ", ")+")")
+		args = append(args, rowArgs...)
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	// the table has no unique constraints, so the stored tokens are looked up with the lookup column indexes
+	conditions := make([]string, len(s.lookupColumns))
+	for i, column := range s.lookupColumns {
+		conditions[i] = fmt.Sprintf("(input.%[1]s = '' OR NOT EXISTS (SELECT 1 FROM %[2]s AS stored WHERE stored.%[1]s = input.%[1]s))", column, s.tableName)
+	}
+
+	// created_at is the first value of the row, new rows have it as updated_at as well
+	var item struct {
+		Count int64 `db:"count"`
+	}
+	if err := s.selectOne(ctx, &item, fmt.Sprintf(`
+WITH inserted AS (
+  INSERT INTO %[1]s (%[2]s, updated_at)
+  SELECT %[2]s, created_at FROM (VALUES %[3]s) AS input (%[2]s)
+  WHERE %[4]s
+  RETURNING 1
+)
+SELECT count(*) AS count FROM inserted
+`, s.tableName, columns, strings.Join(values, ", "), strings.Join(conditions, " AND ")), args...); err != nil {
+		return 0, err
+	}
+
+	for i := int64(0); i < item.Count; i++ {
+		s.afterCreate()
+	}
+	return item.Count, nil
+}
+
+// importedBefore checks if the token row has the lookup value of the row seen before in the import batch
+// and remembers its lookup values otherwise
+func (s *TokenStore) importedBefore(seen map[string]bool, item *TokenStoreItem) bool {
+	values := map[string]string{"code": item.Code, "access": item.Access, "refresh": item.Refresh}
+
+	var keys []string
+	for _, column := range s.lookupColumns {
+		if value := values[column]; value != "" {
+			key := column + ":" + value
+			if seen[key] {
+				return true
+			}
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		seen[key] = true
+	}
+	return false
+}
+
+// checkFilter returns the error for the filter matching the token data fields with token data compression enabled,
+// compressed token data can not be matched by the client, user or scope, so no token would match
+func (s *TokenStore) checkFilter(op string, filter TokenFilter) error {
+	if s.compressor != nil && (filter.ClientID != "" || filter.UserID != "" || filter.Scope != "") {
+		return fmt.Errorf("%s by client, user or scope is not supported with token data compression", op)
+	}
+	return nil
+}
+
+// filterWhere builds WHERE clause for the filter, filter parameters are appended to the args
+func (s *TokenStore) filterWhere(filter TokenFilter, args []interface{}) (string, []interface{}) {
+	conditions := []string{"TRUE"}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ClientID != "" {
+		addCondition(s.fieldExpr("ClientID")+" = $%d", filter.ClientID)
+	}
+	if filter.UserID != "" {
+		addCondition(s.fieldExpr("UserID")+" = $%d", filter.UserID)
+	}
+	if filter.Scope != "" {
+		addCondition("$%d = ANY(string_to_array("+s.fieldExpr("Scope")+", ' '))", filter.Scope)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		addCondition("created_at < $%d", filter.CreatedBefore)
+	}
+	if !filter.ExpiresAfter.IsZero() {
+		addCondition("expires_at > $%d", filter.ExpiresAfter)
+	}
+	if !filter.ExpiresBefore.IsZero() {
+		addCondition("expires_at <= $%d", filter.ExpiresBefore)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Check checks that the database is reachable and the store table exists,
+// compatible with hellofresh/health-go CheckFunc
+func (s *TokenStore) Check(ctx context.Context) (err error) {
+	defer s.reportError("Check", &err)
+
+	return checkTable(ctx, s.selectOne, s.tableName)
+}
+
+// HealthCheck is the context-less Check version compatible with heptiolabs/healthcheck Check
+func (s *TokenStore) HealthCheck() error {
+	return s.Check(context.Background())
 }
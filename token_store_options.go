@@ -1,6 +1,9 @@
 package pg
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // TokenStoreOption is the configuration options type for token store
 type TokenStoreOption func(s *TokenStore)
@@ -16,6 +19,151 @@ func WithTokenStoreTableName(tableName string) TokenStoreOption {
 func WithTokenStoreGCInterval(gcInterval time.Duration) TokenStoreOption {
 	return func(s *TokenStore) {
 		s.gcInterval = gcInterval
+		s.gcIntervalSet = true
+	}
+}
+
+// WithTokenStoreGCStrategy returns option that sets token store garbage collection strategy,
+// garbage collection interval is ignored when the strategy is set
+func WithTokenStoreGCStrategy(strategy GCStrategy) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcStrategy = strategy
+	}
+}
+
+// WithTokenStoreGCPGCron returns option that delegates token store garbage collection to the pg_cron
+// extension job running with the cron schedule, e.g. "*/10 * * * *", instead of the client-side ticker.
+// The job is installed or updated on store instantiation and requires pg_cron 1.3+.
+func WithTokenStoreGCPGCron(schedule string) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcStrategy = &pgCronGCStrategy{store: s, schedule: schedule}
+	}
+}
+
+// WithTokenStoreGCSchedule returns option that runs token store garbage collection on the cron schedule,
+// e.g. "0 3 * * *" to clean up off-peak only, instead of the fixed interval. The schedule is the standard five
+// fields expression in the store clock time zone.
+func WithTokenStoreGCSchedule(schedule string) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcStrategy = &cronGCStrategy{store: s, expr: schedule}
+	}
+}
+
+// WithTokenStoreGCBacklogCap returns option that sets the safety cap of the expired tokens backlog for the GC
+// schedule: the backlog is checked every GC interval and garbage collection runs between the scheduled runs
+// once the backlog exceeds the cap
+func WithTokenStoreGCBacklogCap(limit int64) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcBacklogCap = limit
+	}
+}
+
+// WithTokenStoreGCEveryCreates returns option that also runs garbage collection pass in the background after every
+// n created tokens, so the short-lived processes, e.g. CLIs or batch jobs, clean up before the GC interval elapses.
+// Tokens created with Rotate are counted too. The pass is skipped while the previous one is still running.
+func WithTokenStoreGCEveryCreates(n int) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcEveryCreates = n
+	}
+}
+
+// WithTokenStoreCleanupOnRead returns option that makes the token lookups delete the expired token row inline,
+// so the cleanup cost is spread across the reads and the indexes stay small between garbage collection runs.
+// The row is deleted only when all its tokens are expired, lookups still return ErrTokenExpired.
+func WithTokenStoreCleanupOnRead() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.cleanupOnRead = true
+	}
+}
+
+// WithTokenStoreGCMaxDuration returns option that bounds every garbage collection run with the time budget:
+// expired tokens are removed in batches of the batch size until the budget is spent, and the rest of the backlog
+// is removed with the next runs, so the huge backlog does not hold the connection for hours
+func WithTokenStoreGCMaxDuration(d time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcMaxDuration = d
+	}
+}
+
+// WithTokenStoreGCAnalyze returns option that runs ANALYZE on the token table after the garbage collection run
+// removed more than threshold tokens, or dropped more than threshold chunks of the hypertable, so the lookups
+// are not planned with the stale statistics
+func WithTokenStoreGCAnalyze(threshold int64) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcAnalyzeThreshold = threshold
+	}
+}
+
+// WithTokenStoreGCMaintenanceHook returns option that sets the function called after the garbage collection run
+// removed more than threshold tokens, e.g. to orchestrate VACUUM of the token table, errors are logged
+func WithTokenStoreGCMaintenanceHook(threshold int64, hook func(ctx context.Context, stats GCStats) error) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcMaintenanceThreshold = threshold
+		s.gcMaintenanceHook = hook
+	}
+}
+
+// WithTokenStoreGCRetention returns option that makes garbage collection delete only the tokens
+// expired for longer than the retention window
+func WithTokenStoreGCRetention(retention time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcRetention = retention
+	}
+}
+
+// WithTokenStoreGCKindRetention returns option that sets GC retention of the tokens of the kind instead of the store
+// one, e.g. to remove authorization codes right after the expiration and keep refresh tokens for 90 days.
+// The row kind is code for authorization codes, refresh for the tokens with refresh token and access otherwise.
+func WithTokenStoreGCKindRetention(kind TokenKind, retention time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		if s.gcKindRetention == nil {
+			s.gcKindRetention = make(map[TokenKind]time.Duration)
+		}
+		s.gcKindRetention[kind] = retention
+	}
+}
+
+// WithTokenStoreAccessExpiration returns option that records access token expiration of the tokens with refresh token
+// in access_expires_at column, garbage collection clears the expired access tokens of such rows after the access
+// tokens GC retention instead of keeping them until the refresh token expires. Authorization codes are stored
+// in their own rows and expire by themselves. Use SplitTokenStore to remove the rows of each kind separately.
+func WithTokenStoreAccessExpiration() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.accessExpiration = true
+	}
+}
+
+// WithTokenStoreLastUsed returns option that records the access token last use time in last_used_at column
+// for RemoveIdleSince. GetByAccess only remembers the use, the uses are written with the single statement every
+// flush interval and when the store is drained, so the lookups cause no writes.
+func WithTokenStoreLastUsed(flushInterval time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.lastUsedInterval = flushInterval
+	}
+}
+
+// WithTokenStoreGCLogAlways returns option that logs every garbage collection run,
+// by default only the runs that removed expired tokens are logged
+func WithTokenStoreGCLogAlways() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcLogAlways = true
+	}
+}
+
+// WithTokenStoreGCObserver returns option that sets the function called with the stats of every successful
+// garbage collection run, e.g. to export the number of removed tokens and the run duration as metrics
+func WithTokenStoreGCObserver(observer func(GCStats)) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.gcObserver = observer
+	}
+}
+
+// WithTokenStoreErrorHandler returns option that sets the function called with the operation name, e.g. GetByAccess,
+// and the error of every failed store operation and garbage collection run, e.g. to count the errors as metrics.
+// Lookups of the missing and expired tokens are not failures and do not call the handler.
+func WithTokenStoreErrorHandler(handler func(op string, err error)) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.errorHandler = handler
 	}
 }
 
@@ -26,6 +174,13 @@ func WithTokenStoreLogger(logger Logger) TokenStoreOption {
 	}
 }
 
+// WithTokenStoreClock returns option that sets token store clock used for expiration time and garbage collection
+func WithTokenStoreClock(clock Clock) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.clock = clock
+	}
+}
+
 // WithTokenStoreGCDisabled returns option that disables token store garbage collection
 func WithTokenStoreGCDisabled() TokenStoreOption {
 	return func(s *TokenStore) {
@@ -39,3 +194,240 @@ func WithTokenStoreInitTableDisabled() TokenStoreOption {
 		s.initTableDisabled = true
 	}
 }
+
+// WithTokenStoreLazyInit returns option that defers the table initialization and the schema verification
+// until the first store operation, so the store can be created while the database is not available yet,
+// e.g. on serverless cold start. Failed initialization fails the operation and is run again by the next one.
+func WithTokenStoreLazyInit() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.lazyInit = true
+	}
+}
+
+// WithTokenStoreReconnectInterval returns option that checks the connection of the pool opened by
+// NewTokenStoreFromDSN with the interval and opens the new pool when the connection is lost, e.g. after
+// the database failover, so the queries stop failing on the stale connections without the service restart
+func WithTokenStoreReconnectInterval(interval time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.reconnectInterval = interval
+	}
+}
+
+// WithTokenStoreAcquireTimeout returns option that bounds how long the queries wait for the free connection
+// of the exhausted pool opened by NewTokenStoreFromDSN, the queries that timed out fail with ErrStoreBusy.
+// Acquisition timeout errors of the pgx pools passed with the adapter are returned as ErrStoreBusy too.
+func WithTokenStoreAcquireTimeout(timeout time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.acquireTimeout = timeout
+	}
+}
+
+// WithTokenStoreSchemaVerification returns option that verifies the existing table schema on token store
+// instantiation when table creation is disabled, see TokenStore.VerifySchema
+func WithTokenStoreSchemaVerification() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.schemaVerification = true
+	}
+}
+
+// WithTokenStoreStrictSchema returns option that refuses token store instantiation when the existing table
+// column types differ from the expected ones, e.g. expires_at is timestamp without time zone,
+// the schema is verified after the table initialization
+func WithTokenStoreStrictSchema() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.strictSchema = true
+	}
+}
+
+// WithTokenStoreInitTimeout returns option that bounds how long the table initialization and the schema verification
+// may take on token store instantiation, so a locked catalog or unreachable database fails the constructor fast
+func WithTokenStoreInitTimeout(timeout time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.initTimeout = timeout
+	}
+}
+
+// WithTokenStoreQueryTimeout returns option that applies the deadline to every token store query. The running query
+// is cancelled with the adapter implementing ContextAdapter, e.g. the pool of the store created with
+// NewTokenStoreFromDSN. With other adapters the query returns context.DeadlineExceeded once the deadline is exceeded,
+// while the server finishes it in the background.
+func WithTokenStoreQueryTimeout(timeout time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.queryTimeout = timeout
+	}
+}
+
+// WithTokenStoreSlowQueryThreshold returns option that logs token store queries taking longer than the threshold
+// with the configured logger, logged SQL does not include the query arguments
+func WithTokenStoreSlowQueryThreshold(threshold time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.slowQueryThreshold = threshold
+	}
+}
+
+// WithTokenStoreColumnsStorage returns option that stores all token fields in typed columns instead of
+// the JSONB data blob, token information is reconstructed from the columns on read
+func WithTokenStoreColumnsStorage() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.columnsStorage = true
+	}
+}
+
+// WithTokenStoreBRINExpiryIndex returns option that creates BRIN index on expires_at instead of btree one,
+// BRIN index is much smaller for append-mostly token tables and still serves GC range scans.
+// Existing btree index is not dropped when the option is enabled for the existing table.
+func WithTokenStoreBRINExpiryIndex() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.brinExpiryIndex = true
+	}
+}
+
+// WithTokenStoreHashIndexes returns option that creates hash indexes on code, access and refresh columns
+// instead of btree ones, tokens are only looked up by equality and hash indexes are smaller for long random values.
+// Hash indexes are crash-safe starting from PostgreSQL 10. Existing btree indexes are not dropped when the option
+// is enabled for the existing table.
+func WithTokenStoreHashIndexes() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.hashIndexes = true
+	}
+}
+
+// WithTokenStoreHashedLookups returns option that stores and queries code, access and refresh token values
+// as hex encoded digests produced by the hash function, e.g. SHA256TokenHash, so the database dump can not be
+// replayed as live tokens. Token information returned by Get* methods has the plain value of the looked up token
+// and the prefixed digests of the others, digests are accepted by Remove* methods. Hashed lookups are not supported
+// with columns storage, FindByClaim and other data queries do not match on token values.
+func WithTokenStoreHashedLookups(hash func([]byte) []byte) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.lookupHash = hash
+	}
+}
+
+// WithTokenStoreHMACLookups returns option that works as WithTokenStoreHashedLookups, but token values are stored
+// as HMAC-SHA256 digests prefixed with the key id. The first key is the current one used for the new tokens,
+// the rest are previous keys the existing tokens are still looked up with during the key rotation.
+func WithTokenStoreHMACLookups(keys ...TokenHashKey) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.hashKeys = keys
+	}
+}
+
+// WithTokenStoreKeyType returns option that sets the token table primary key type, default is TokenKeyBigSerial.
+// UUID keys are generated by the store, use CreateWithKey to get the key of the created token.
+func WithTokenStoreKeyType(keyType TokenKeyType) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.keyType = keyType
+	}
+}
+
+// WithTokenStoreClientForeignKey returns option that references the client store table from the token table client_id
+// with ON DELETE CASCADE foreign key, so the client removal removes its tokens. Both tables have to be in the same
+// database and the client store has to be created first. Tokens without client id do not reference any client
+// in the default storage mode, columns storage mode requires all the tokens to have existing client id.
+func WithTokenStoreClientForeignKey(clientTableName string) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.clientForeignKey = clientTableName
+	}
+}
+
+// WithTokenStoreExchangeLineage returns option that adds parent_token_id and actor columns used by CreateExchanged
+// to record the provenance of the tokens issued by RFC 8693 token exchange
+func WithTokenStoreExchangeLineage() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.exchangeLineage = true
+	}
+}
+
+// WithTokenStoreRefreshFamilies returns option that records family_id of the tokens with refresh token,
+// Rotate propagates the family to the new token and RemoveFamily revokes the whole session chain at once
+func WithTokenStoreRefreshFamilies() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.refreshFamilies = true
+	}
+}
+
+// WithTokenStoreRefreshReuseDetection returns option that keeps the rotated tokens marked as consumed until they expire,
+// presenting the rotated refresh token to Rotate or GetByRefresh again revokes the whole token family
+// and returns ErrRefreshReuseDetected. Requires WithTokenStoreRefreshFamilies option.
+func WithTokenStoreRefreshReuseDetection() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.refreshReuseDetection = true
+	}
+}
+
+// WithTokenStoreRowLevelSecurity returns option that enables row level security on the token table and installs
+// the policy that limits rows to the tenant set in the settingKey run-time parameter, e.g. app.tenant_id.
+// GC removes only the rows visible to the current tenant, so run it with the role that bypasses row level security.
+func WithTokenStoreRowLevelSecurity(settingKey string) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.rowLevelSecurity = true
+		s.rlsSettingKey = settingKey
+	}
+}
+
+// WithTokenStoreCompression returns option that compresses serialized token data before insert,
+// compressed data is decompressed transparently on read
+func WithTokenStoreCompression(compressor Compressor) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.compressor = compressor
+	}
+}
+
+// WithTokenStoreBatchSize returns option that sets the number of tokens loaded at once by batch operations, e.g. ForEach,
+// and the number of tokens removed at once by garbage collection bounded with WithTokenStoreGCMaxDuration
+func WithTokenStoreBatchSize(batchSize int) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.batchSize = batchSize
+	}
+}
+
+// WithTokenStoreExpiryFilter returns option that filters out expired token rows right in the GetByCode, GetByAccess
+// and GetByRefresh queries, so tokens expired before the next GC run are never returned
+func WithTokenStoreExpiryFilter() TokenStoreOption {
+	return func(s *TokenStore) {
+		s.expiryFilter = true
+	}
+}
+
+// WithTokenStoreDialect returns option that adapts the store to the database server speaking PostgreSQL wire protocol,
+// e.g. DialectCockroach or DialectYugabyte, default is DialectPostgres
+func WithTokenStoreDialect(dialect Dialect) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.dialect = dialect
+	}
+}
+
+// WithTokenStoreTablets returns option that pre-splits the new token table into the number of tablets,
+// requires DialectYugabyte. Existing table is not re-split.
+func WithTokenStoreTablets(tablets int) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.tablets = tablets
+	}
+}
+
+// WithTokenStoreTimescaleHypertable returns option that converts the new token table into TimescaleDB 2 hypertable
+// chunked on expires_at with the chunk interval, and makes GC drop the expired chunks instead of deleting the rows.
+// Hypertable primary key includes expires_at, so the existing table created without the option has to be recreated.
+func WithTokenStoreTimescaleHypertable(chunkInterval time.Duration) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.hypertableChunk = chunkInterval
+	}
+}
+
+// WithTokenStoreCitusDistribution returns option that distributes the new token table across Citus worker nodes
+// by the column, one of code, access or refresh, so the token lookups and removals by the column are routed
+// to the single shard, while the lookups by the other token values query all the shards.
+// Distributed table primary key includes the column, so the existing table created without the option has to be recreated.
+func WithTokenStoreCitusDistribution(column string) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.distributionColumn = column
+	}
+}
+
+// WithTokenStoreRedactor returns option that sets the redactor applied to the query error messages on top of the
+// query arguments redaction, so the token values are never logged or returned in errors, default is DefaultRedactor
+func WithTokenStoreRedactor(redactor Redactor) TokenStoreOption {
+	return func(s *TokenStore) {
+		s.redactor = redactor
+	}
+}
@@ -1,12 +1,21 @@
 package pg
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"math/rand"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-pg-adapter"
+	"gopkg.in/oauth2.v3/models"
 )
 
 func TestWithTokenStoreGCDisabled(t *testing.T) {
@@ -27,9 +36,411 @@ func TestWithTokenStoreTableName(t *testing.T) {
 func TestWithTokenStoreGCInterval(t *testing.T) {
 	randomInterval := time.Duration(rand.Int63())
 
-	store, err := NewTokenStore(nil, WithTokenStoreGCInterval(randomInterval), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	store, err := NewTokenStore(nil, WithTokenStoreGCInterval(randomInterval), WithTokenStoreInitTableDisabled())
 	require.NoError(t, err)
 	assert.Equal(t, randomInterval, store.gcInterval)
+	assert.NoError(t, store.Close())
+}
+
+func TestTokenStore_validate(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreTableName(""), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: empty table name")
+
+	_, err = NewTokenStore(nil, WithTokenStoreGCInterval(0), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC interval must be positive, got 0s")
+
+	_, err = NewTokenStore(nil, WithTokenStoreGCInterval(time.Minute), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC interval is set while GC is disabled")
+
+	_, err = NewTokenStore(nil, WithTokenStoreGCInterval(time.Minute), WithTokenStoreGCStrategy(NoopGCStrategy{}), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC interval is set together with GC strategy")
+
+	_, err = NewTokenStore(nil, WithTokenStoreGCRetention(-time.Minute), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC retention must not be negative, got -1m0s")
+
+	_, err = NewTokenStore(nil, WithTokenStoreBatchSize(0), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: batch size must be positive, got 0")
+}
+
+func TestWithTokenStoreColumnsStorage(t *testing.T) {
+	store, err := NewTokenStore(nil, WithTokenStoreColumnsStorage(), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.True(t, store.columnsStorage)
+	assert.Equal(t, tokenColumnsData, store.dataExpr())
+}
+
+func TestWithTokenStoreBRINExpiryIndex(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewTokenStore(adapter, WithTokenStoreBRINExpiryIndex(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+	assert.True(t, store.brinExpiryIndex)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "CREATE INDEX IF NOT EXISTS idx_tokens_expires_at_brin ON tokens USING BRIN (expires_at);")
+	assert.NotContains(t, adapter.execCalls[0].query, "idx_tokens_expires_at ON")
+}
+
+func TestWithTokenStoreHashIndexes(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewTokenStore(adapter, WithTokenStoreHashIndexes(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+	assert.True(t, store.hashIndexes)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	for _, column := range []string{"code", "access", "refresh"} {
+		assert.Contains(t, adapter.execCalls[0].query, fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_tokens_%[1]s_hash ON tokens USING HASH (%[1]s);", column))
+	}
+	assert.Contains(t, adapter.execCalls[0].query, "CREATE INDEX IF NOT EXISTS idx_tokens_expires_at ON tokens (expires_at);")
+}
+
+func TestWithTokenStoreClientForeignKey(t *testing.T) {
+	adapter := new(mockAdapter)
+	store, err := NewTokenStore(adapter, WithTokenStoreClientForeignKey("clients"), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	query := adapter.execCalls[0].query
+	assert.Contains(t, query, "ALTER TABLE tokens ADD COLUMN IF NOT EXISTS client_id TEXT;")
+	assert.Contains(t, query, "ALTER TABLE tokens ADD CONSTRAINT tokens_client_id_fkey FOREIGN KEY (client_id) REFERENCES clients (id) ON DELETE CASCADE;")
+
+	require.NoError(t, store.Create(&models.Token{ClientID: "client", Access: "access", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour}))
+	require.NoError(t, store.Create(&models.Token{Access: "access", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour}))
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[0].query, "authorization_details, client_id, updated_at)")
+	assert.Equal(t, "client", adapter.selectOneCalls[0].args[7])
+	assert.Nil(t, adapter.selectOneCalls[1].args[7])
+
+	adapter = new(mockAdapter)
+	_, err = NewTokenStore(adapter, WithTokenStoreClientForeignKey("clients"), WithTokenStoreColumnsStorage(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+	assert.NotContains(t, adapter.execCalls[0].query, "ADD COLUMN IF NOT EXISTS client_id")
+}
+
+func TestWithTokenStoreExchangeLineage(t *testing.T) {
+	store, err := NewTokenStore(nil, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.EqualError(t, store.CreateExchanged(context.Background(), models.NewToken(), models.NewToken(), ""), "CreateExchanged requires WithTokenStoreExchangeLineage option")
+
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if item, ok := dst.(*struct {
+			ID      []byte `db:"id"`
+			Expired bool   `db:"expired"`
+		}); ok {
+			item.ID = []byte("42")
+			item.Expired = query == "SELECT to_jsonb(id) AS id, expires_at <= $2 AS expired FROM tokens WHERE access = $1" && args[0] == "expired"
+		}
+		return nil
+	}
+	store, err = NewTokenStore(adapter, WithTokenStoreExchangeLineage(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "ALTER TABLE tokens ADD COLUMN IF NOT EXISTS parent_token_id BIGINT REFERENCES tokens (id) ON DELETE CASCADE;")
+
+	parent := &models.Token{Access: "parent"}
+	info := &models.Token{Access: "exchanged", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour}
+	require.NoError(t, store.CreateExchanged(context.Background(), parent, info, "actor"))
+
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Equal(t, "SELECT to_jsonb(id) AS id, expires_at <= $2 AS expired FROM tokens WHERE access = $1", adapter.selectOneCalls[0].query)
+	assert.Equal(t, "parent", adapter.selectOneCalls[0].args[0])
+	assert.Contains(t, adapter.selectOneCalls[1].query, "authorization_details, parent_token_id, actor, updated_at)")
+	args := adapter.selectOneCalls[1].args
+	assert.Equal(t, []interface{}{int64(42), "actor"}, args[len(args)-2:])
+
+	assert.Equal(t, ErrTokenExpired, store.CreateExchanged(context.Background(), &models.Token{Access: "expired"}, info, ""))
+	assert.Equal(t, 3, len(adapter.selectOneCalls))
+}
+
+func TestWithTokenStoreRefreshFamilies(t *testing.T) {
+	store, err := NewTokenStore(nil, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.EqualError(t, store.RemoveFamily("family"), "RemoveFamily requires WithTokenStoreRefreshFamilies option")
+
+	adapter := new(mockAdapter)
+	store, err = NewTokenStore(adapter, WithTokenStoreRefreshFamilies(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family_id TEXT;")
+
+	info := &models.Token{Access: "access", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour, Refresh: "refresh", RefreshCreateAt: time.Now(), RefreshExpiresIn: time.Hour}
+	require.NoError(t, store.Create(info))
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[0].query, "authorization_details, family_id, updated_at)")
+	args := adapter.selectOneCalls[0].args
+	assert.Len(t, args[len(args)-1], 36)
+
+	require.NoError(t, store.Rotate(context.Background(), "old refresh", info))
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	query := adapter.selectOneCalls[1].query
+	assert.Contains(t, query, "WITH old AS (DELETE FROM tokens WHERE refresh = $8 AND expires_at > $9 RETURNING family_id)")
+	assert.Contains(t, query, "SELECT $1, $2, $3, $4, $5, $6, $7, old.family_id, $1 FROM old")
+	args = adapter.selectOneCalls[1].args
+	assert.Equal(t, "old refresh", args[len(args)-2])
+
+	require.NoError(t, store.RemoveFamily("family"))
+	require.Equal(t, 2, len(adapter.execCalls))
+	assert.Equal(t, "DELETE FROM tokens WHERE family_id = $1", adapter.execCalls[1].query)
+}
+
+func TestWithTokenStoreRefreshReuseDetection(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreRefreshReuseDetection(), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: refresh reuse detection requires refresh families")
+
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if strings.HasPrefix(query, "SELECT family_id") {
+			dst.(*struct {
+				FamilyID string `db:"family_id"`
+			}).FamilyID = "family"
+			return nil
+		}
+		return pgadapter.ErrNoRows
+	}
+	store, err := NewTokenStore(adapter, WithTokenStoreRefreshFamilies(), WithTokenStoreRefreshReuseDetection(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+	assert.Contains(t, adapter.execCalls[0].query, "ALTER TABLE tokens ADD COLUMN IF NOT EXISTS consumed_at TIMESTAMPTZ;")
+	assert.Equal(t, "SELECT data AS data FROM tokens WHERE access = $1 AND consumed_at IS NULL", store.getByAccessQuery)
+
+	_, err = store.GetByRefresh("rotated")
+	assert.Equal(t, ErrRefreshReuseDetected, err)
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Equal(t, "SELECT family_id FROM tokens WHERE refresh = $1 AND consumed_at IS NOT NULL", adapter.selectOneCalls[1].query)
+	require.Equal(t, 2, len(adapter.execCalls))
+	assert.Equal(t, []interface{}{"family"}, adapter.execCalls[1].args)
+
+	err = store.Rotate(context.Background(), "rotated", &models.Token{Access: "access", Refresh: "refresh"})
+	assert.Equal(t, ErrRefreshReuseDetected, err)
+	assert.Contains(t, adapter.selectOneCalls[2].query, "UPDATE tokens SET consumed_at = $1, updated_at = $1 WHERE refresh = $8 AND expires_at > $9 AND consumed_at IS NULL RETURNING family_id")
+}
+
+func TestWithTokenStoreRowLevelSecurity(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreRowLevelSecurity(""), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: empty row level security setting key")
+
+	adapter := new(mockAdapter)
+	_, err = NewTokenStore(adapter, WithTokenStoreRowLevelSecurity("app.tenant_id"), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	query := adapter.execCalls[0].query
+	assert.Contains(t, query, "ALTER TABLE tokens ADD COLUMN IF NOT EXISTS tenant_id TEXT DEFAULT current_setting('app.tenant_id', TRUE);")
+	assert.Contains(t, query, "ALTER TABLE tokens ENABLE ROW LEVEL SECURITY;")
+	assert.Contains(t, query, "CREATE POLICY tokens_tenant_isolation ON tokens USING (tenant_id = current_setting('app.tenant_id', TRUE))")
+}
+
+func TestWithTokenStoreHashedLookups(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreHashedLookups(SHA256TokenHash), WithTokenStoreColumnsStorage(), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: hashed lookups are not supported with columns storage")
+
+	var data []byte
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if item, ok := dst.(*tokenDataItem); ok {
+			item.Data = data
+		}
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreHashedLookups(SHA256TokenHash), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	token := models.NewToken()
+	token.SetAccess("access")
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Minute)
+	token.SetRefresh("refresh")
+	token.SetRefreshCreateAt(time.Now())
+	token.SetRefreshExpiresIn(time.Hour)
+	require.NoError(t, store.Create(token))
+
+	accessDigest := hex.EncodeToString(SHA256TokenHash([]byte("access")))
+	refreshDigest := hex.EncodeToString(SHA256TokenHash([]byte("refresh")))
+
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	args := adapter.selectOneCalls[0].args
+	assert.Equal(t, "", args[2])
+	assert.Equal(t, accessDigest, args[3])
+	assert.Equal(t, refreshDigest, args[4])
+	data = args[5].([]byte)
+	assert.NotContains(t, string(data), `"access"`)
+	assert.NotContains(t, string(data), `"refresh"`)
+
+	info, err := store.GetByAccess("access")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{accessDigest}, adapter.selectOneCalls[1].args)
+	assert.Equal(t, "access", info.GetAccess())
+	assert.Equal(t, hashedTokenPrefix+refreshDigest, info.GetRefresh())
+
+	// digests returned by the store are accepted as is
+	require.NoError(t, store.RemoveByRefresh(info.GetRefresh()))
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Equal(t, []interface{}{refreshDigest}, adapter.execCalls[0].args)
+}
+
+func TestWithTokenStoreHMACLookups(t *testing.T) {
+	for _, keys := range [][]TokenHashKey{
+		{{ID: "", Key: []byte("secret")}},
+		{{ID: "k:1", Key: []byte("secret")}},
+		{{ID: "k1"}},
+		{{ID: "k1", Key: []byte("secret")}, {ID: "k1", Key: []byte("secret")}},
+	} {
+		_, err := NewTokenStore(nil, WithTokenStoreHMACLookups(keys...), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+		assert.Error(t, err)
+	}
+
+	_, err := NewTokenStore(nil, WithTokenStoreHMACLookups(TokenHashKey{ID: "k1", Key: []byte("secret")}), WithTokenStoreHashedLookups(SHA256TokenHash), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: hashed lookups are set together with HMAC lookups")
+
+	adapter := new(mockAdapter)
+	current := TokenHashKey{ID: "k2", Key: []byte("secret2")}
+	previous := TokenHashKey{ID: "k1", Key: []byte("secret1")}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreHMACLookups(current), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, "access = $1", store.lookupCondition("access"))
+
+	token := models.NewToken()
+	token.SetAccess("access")
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Minute)
+	require.NoError(t, store.Create(token))
+
+	digest := adapter.selectOneCalls[0].args[3].(string)
+	assert.Equal(t, hmacDigest(current, "access"), digest)
+	assert.True(t, strings.HasPrefix(digest, "k2:"))
+	assert.NotEqual(t, hmacDigest(previous, "access"), digest)
+
+	// tokens are looked up with all the keys while the keys are rotated
+	store, err = NewTokenStore(adapter, WithTokenStoreHMACLookups(current, previous), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, "access = ANY(ARRAY(SELECT jsonb_array_elements_text($1::jsonb)))", store.lookupCondition("access"))
+
+	require.NoError(t, store.RemoveByAccess("access"))
+	expected := jsonArray([]string{hmacDigest(current, "access"), hmacDigest(previous, "access")})
+	assert.Equal(t, []interface{}{expected}, adapter.execCalls[0].args)
+
+	require.NoError(t, store.RemoveByAccess(hashedTokenPrefix+digest))
+	assert.Equal(t, []interface{}{jsonArray([]string{digest})}, adapter.execCalls[1].args)
+}
+
+func TestWithTokenStoreCompression(t *testing.T) {
+	store, err := NewTokenStore(nil, WithTokenStoreCompression(GzipCompressor{Level: 9}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, GzipCompressor{Level: 9}, store.compressor)
+	assert.Equal(t, GzipCompressor{Level: 9}, store.compressors["gzip"])
+}
+
+func TestWithTokenStoreGCStrategy(t *testing.T) {
+	store, err := NewTokenStore(nil, WithTokenStoreGCStrategy(NoopGCStrategy{}), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, NoopGCStrategy{}, store.gcStrategy)
+	assert.NoError(t, store.Close())
+
+	store, err = NewTokenStore(nil, WithTokenStoreGCInterval(time.Hour), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, store.gcStrategy.(*TickerGCStrategy).Interval)
+	assert.NoError(t, store.Close())
+}
+
+func TestWithTokenStoreGCRetention(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCRetention(time.Hour), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, store.gcRetention)
+
+	store.clean()
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.True(t, adapter.selectOneCalls[0].args[0].(time.Time).Before(time.Now().Add(-59*time.Minute)))
+}
+
+func TestWithTokenStoreGCKindRetention(t *testing.T) {
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCRetention(time.Hour), WithTokenStoreGCKindRetention(TokenKindCode, 0), WithTokenStoreGCKindRetention(TokenKindRefresh, 90*24*time.Hour), WithTokenStoreClock(clock), WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	store.clean()
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, "WITH deleted AS (DELETE FROM tokens WHERE expires_at <= $1 AND CASE "+kindExpr+" WHEN 'code' THEN expires_at <= $2 WHEN 'refresh' THEN expires_at <= $3 ELSE expires_at <= $4 END RETURNING 1) SELECT count(*) AS count FROM deleted", adapter.selectOneCalls[0].query)
+	assert.Equal(t, []interface{}{clock.now, clock.now, clock.now.Add(-90 * 24 * time.Hour), clock.now.Add(-time.Hour)}, adapter.selectOneCalls[0].args)
+
+	// pg_cron job removes the tokens by kind as well
+	adapter.execCalls = nil
+	store, err = NewTokenStore(adapter, WithTokenStoreGCKindRetention(TokenKindCode, time.Hour), WithTokenStoreGCPGCron("*/5 * * * *"), WithTokenStoreTableName("tokens"), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Equal(t, "DELETE FROM tokens WHERE expires_at <= now() - interval '0 seconds' AND CASE "+kindExpr+" WHEN 'code' THEN expires_at <= now() - interval '3600 seconds' ELSE expires_at <= now() - interval '0 seconds' END", adapter.execCalls[0].args[2])
+	require.NoError(t, store.Close())
+
+	_, err = NewTokenStore(adapter, WithTokenStoreGCKindRetention("id_token", time.Hour), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, `invalid token store configuration: unknown token kind "id_token" of GC retention`)
+	_, err = NewTokenStore(adapter, WithTokenStoreGCKindRetention(TokenKindAccess, -time.Hour), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC retention of access tokens must not be negative, got -1h0m0s")
+	_, err = NewTokenStore(adapter, WithTokenStoreGCKindRetention(TokenKindAccess, time.Hour), WithTokenStoreTimescaleHypertable(time.Hour), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC retention by token kind is not supported with hypertable")
+}
+
+func TestWithTokenStoreAccessExpiration(t *testing.T) {
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreAccessExpiration(), WithTokenStoreGCKindRetention(TokenKindAccess, time.Minute), WithTokenStoreClock(clock), WithTokenStoreTableName("tokens"), WithTokenStoreKeyType(TokenKeyUUIDv4), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Contains(t, store.tableDDL(), "access_expires_at TIMESTAMPTZ")
+	assert.Contains(t, store.tableDDL(), "CREATE INDEX IF NOT EXISTS idx_tokens_access_expires_at ON tokens (access_expires_at) WHERE access <> '' AND refresh <> '';")
+
+	require.NoError(t, store.Create(&models.Token{Access: "access", AccessCreateAt: clock.now, AccessExpiresIn: time.Hour, Refresh: "refresh", RefreshCreateAt: clock.now, RefreshExpiresIn: 24 * time.Hour}))
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, ", access_expires_at, id, updated_at")
+	assert.Equal(t, clock.now.Add(time.Hour), adapter.execCalls[0].args[7])
+
+	store.clean()
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Equal(t, `WITH cleared AS (UPDATE tokens SET access = '', access_expires_at = NULL, data = jsonb_set(data, '{Access}', '""'), updated_at = now() WHERE access <> '' AND refresh <> '' AND access_expires_at <= $1 RETURNING 1) SELECT count(*) AS count FROM cleared`, adapter.selectOneCalls[1].query)
+	assert.Equal(t, []interface{}{clock.now.Add(-time.Minute)}, adapter.selectOneCalls[1].args)
+
+	// cleared access token matches no rows
+	require.NoError(t, store.RemoveByAccess(""))
+	assert.Equal(t, 1, len(adapter.execCalls))
+
+	_, err = NewTokenStore(adapter, WithTokenStoreAccessExpiration(), WithTokenStoreCompression(GzipCompressor{}), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: access expiration is not supported with token data compression")
+	_, err = NewTokenStore(adapter, WithTokenStoreAccessExpiration(), WithTokenStoreGCPGCron("*/5 * * * *"), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: access expiration is not supported with pg_cron GC strategy")
+}
+
+func TestWithTokenStoreBatchSize(t *testing.T) {
+	store, err := NewTokenStore(nil, WithTokenStoreBatchSize(10), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, 10, store.batchSize)
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestWithTokenStoreClock(t *testing.T) {
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreClock(clock), WithTokenStoreGCRetention(time.Hour), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, clock, store.clock)
+
+	store.clean()
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, clock.now.Add(-time.Hour), adapter.selectOneCalls[0].args[0])
 }
 
 func TestWithTokenStoreLogger(t *testing.T) {
@@ -57,3 +468,413 @@ func TestWithTokenStoreLogger(t *testing.T) {
 	assert.Equal(t, 12, l.args[1][0])
 	assert.Equal(t, "22", l.args[1][1])
 }
+
+// deadlineAdapter records whether the query contexts have deadlines
+type deadlineAdapter struct {
+	mockAdapter
+	deadlines []bool
+}
+
+func (a *deadlineAdapter) ExecContext(ctx context.Context, query string, args ...interface{}) error {
+	_, ok := ctx.Deadline()
+	a.deadlines = append(a.deadlines, ok)
+	return a.Exec(query, args...)
+}
+
+func (a *deadlineAdapter) SelectOneContext(ctx context.Context, dst interface{}, query string, args ...interface{}) error {
+	_, ok := ctx.Deadline()
+	a.deadlines = append(a.deadlines, ok)
+	return a.SelectOne(dst, query, args...)
+}
+
+func TestWithTokenStoreInitTimeout(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreInitTimeout(-time.Second), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: init timeout must not be negative, got -1s")
+
+	adapter := new(deadlineAdapter)
+	_, err = NewTokenStore(adapter, WithTokenStoreInitTimeout(1500*time.Microsecond), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.True(t, strings.HasPrefix(adapter.execCalls[0].query, "SET LOCAL statement_timeout = 2;\nSET LOCAL lock_timeout = 2;\nSELECT pg_advisory_xact_lock("))
+	assert.Equal(t, []bool{true}, adapter.deadlines)
+
+	adapter = new(deadlineAdapter)
+	_, err = NewTokenStore(adapter, WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+	assert.NotContains(t, adapter.execCalls[0].query, "statement_timeout")
+	assert.Equal(t, []bool{false}, adapter.deadlines)
+}
+
+func TestWithTokenStoreQueryTimeout(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreQueryTimeout(-time.Second), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: query timeout must not be negative, got -1s")
+
+	adapter := new(deadlineAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return pgadapter.ErrNoRows
+	}
+	store, err := NewTokenStore(adapter, WithTokenStoreQueryTimeout(time.Second), WithTokenStoreGCDisabled())
+	require.NoError(t, err)
+
+	require.NoError(t, store.RemoveByAccess("access"))
+	_, err = store.GetByAccess("access")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	// table initialization is not bounded by the query timeout
+	assert.Equal(t, []bool{false, true, true}, adapter.deadlines)
+
+	// the query of the adapter without context support returns once the deadline is exceeded
+	release := make(chan struct{})
+	defer close(release)
+	plain := new(mockAdapter)
+	plain.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		<-release
+		return nil
+	}
+	store, err = NewTokenStore(plain, WithTokenStoreQueryTimeout(50*time.Millisecond), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = store.GetByAccess("access")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < time.Second)
+
+	// scanned row is copied to the destination
+	plain = new(mockAdapter)
+	plain.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*TokenStoreItem).ID = 42
+		return nil
+	}
+	store, err = NewTokenStore(plain, WithTokenStoreQueryTimeout(time.Second), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	id, err := store.CreateWithID(context.Background(), &models.Token{Access: "access", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+}
+
+func TestWithTokenStoreSlowQueryThreshold(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreSlowQueryThreshold(-time.Second), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: slow query threshold must not be negative, got -1s")
+
+	l := new(memoryLogger)
+	adapter := new(mockAdapter)
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	}
+	store, err := NewTokenStore(adapter, WithTokenStoreSlowQueryThreshold(time.Millisecond), WithTokenStoreLogger(l), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	require.NoError(t, store.RemoveByAccess("secret-access"))
+	require.Equal(t, 1, len(l.formats))
+	assert.Equal(t, "Slow token store query took %s: %s", l.formats[0])
+	assert.True(t, l.args[0][0].(time.Duration) >= time.Millisecond)
+	assert.Equal(t, "DELETE FROM oauth2_tokens WHERE access = $1", l.args[0][1])
+
+	adapter.execCallback = nil
+	store.slowQueryThreshold = time.Hour
+	require.NoError(t, store.RemoveByAccess("secret-access"))
+	assert.Equal(t, 1, len(l.formats))
+}
+
+func TestWithTokenStoreExpiryFilter(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if strings.HasPrefix(query, "SELECT TRUE AS expired") {
+			return nil
+		}
+		return pgadapter.ErrNoRows
+	}
+	store, err := NewTokenStore(adapter, WithTokenStoreExpiryFilter(), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT data AS data FROM tokens WHERE code = $1 AND expires_at > now()", store.getByCodeQuery)
+	assert.Equal(t, "SELECT data AS data FROM tokens WHERE access = $1 AND expires_at > now()", store.getByAccessQuery)
+	assert.Equal(t, "SELECT data AS data FROM tokens WHERE refresh = $1 AND expires_at > now()", store.getByRefreshQuery)
+
+	// filtered out token is still stored, so it is expired
+	_, err = store.GetByRefresh("refresh")
+	assert.Equal(t, ErrTokenExpired, err)
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Equal(t, "SELECT TRUE AS expired FROM tokens WHERE refresh = $1", adapter.selectOneCalls[1].query)
+
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return pgadapter.ErrNoRows
+	}
+	_, err = store.GetByCode("code")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	store, err = NewTokenStore(adapter, WithTokenStoreExpiryFilter(), WithTokenStoreRefreshFamilies(), WithTokenStoreRefreshReuseDetection(), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT data AS data FROM tokens WHERE access = $1 AND consumed_at IS NULL AND expires_at > now()", store.getByAccessQuery)
+
+	_, err = store.GetByAccess("access")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	assert.Equal(t, "SELECT TRUE AS expired FROM tokens WHERE access = $1 AND consumed_at IS NULL", adapter.selectOneCalls[len(adapter.selectOneCalls)-1].query)
+}
+
+func TestWithTokenStoreDialect(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreDialect("oracle"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, `invalid token store configuration: unknown dialect "oracle"`)
+
+	store, err := NewTokenStore(nil, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, DialectPostgres, store.dialect)
+}
+
+func TestWithTokenStoreLazyInit(t *testing.T) {
+	adapter := new(mockAdapter)
+	initErr := errors.New("database is not available")
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		if strings.Contains(query, "CREATE TABLE") {
+			return initErr
+		}
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreLazyInit(), WithTokenStoreGCDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(adapter.execCalls))
+
+	// failed initialization fails the operation and is run again by the next one
+	assert.Equal(t, initErr, store.RemoveByAccess("access"))
+	require.Equal(t, 1, len(adapter.execCalls))
+
+	adapter.execCallback = nil
+	require.NoError(t, store.RemoveByAccess("access"))
+	require.NoError(t, store.RemoveByCode("code"))
+	require.Equal(t, 4, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[1].query, "CREATE TABLE IF NOT EXISTS oauth2_tokens")
+	assert.Equal(t, "DELETE FROM oauth2_tokens WHERE access = $1", adapter.execCalls[2].query)
+	assert.Equal(t, "DELETE FROM oauth2_tokens WHERE code = $1", adapter.execCalls[3].query)
+}
+
+func TestWithTokenStoreGCEveryCreates(t *testing.T) {
+	adapter := new(mockAdapter)
+	passes := make(chan GCStats, 10)
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCEveryCreates(2), WithTokenStoreGCObserver(func(s GCStats) {
+		passes <- s
+	}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	token := models.NewToken()
+	token.SetAccess("access")
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Minute)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, store.Create(token))
+		if i%2 == 1 {
+			select {
+			case <-passes:
+			case <-time.After(time.Second):
+				t.Fatalf("GC pass did not run after %d created tokens", i+1)
+			}
+			// wait for the pass to finish, the next one is skipped otherwise
+			for atomic.LoadInt32(&store.gcRunning) == 1 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	// rotated tokens are counted as created ones
+	require.NoError(t, store.Create(token))
+	require.NoError(t, store.Rotate(context.Background(), "refresh", token))
+	select {
+	case <-passes:
+	case <-time.After(time.Second):
+		t.Fatal("GC pass did not run after the rotated token")
+	}
+	for atomic.LoadInt32(&store.gcRunning) == 1 {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, store.Close())
+	assert.Equal(t, 0, len(passes))
+
+	_, err = NewTokenStore(adapter, WithTokenStoreGCEveryCreates(-1), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC creates count must not be negative, got -1")
+}
+
+func TestWithTokenStoreCleanupOnRead(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if strings.HasPrefix(query, "SELECT TRUE AS expired") {
+			return nil
+		}
+		return pgadapter.ErrNoRows
+	}
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreCleanupOnRead(), WithTokenStoreExpiryFilter(), WithTokenStoreGCRetention(time.Hour), WithTokenStoreClock(clock), WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	_, err = store.GetByAccess("access")
+	assert.Equal(t, ErrTokenExpired, err)
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Equal(t, "DELETE FROM tokens WHERE access = $1 AND expires_at <= $2", adapter.execCalls[0].query)
+	assert.Equal(t, []interface{}{"access", clock.now.Add(-time.Hour)}, adapter.execCalls[0].args)
+
+	// tokens that are not found have nothing to remove
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return pgadapter.ErrNoRows
+	}
+	_, err = store.GetByRefresh("refresh")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	assert.Equal(t, 1, len(adapter.execCalls))
+}
+
+func TestWithTokenStoreGCMaxDuration(t *testing.T) {
+	adapter := new(mockAdapter)
+	var batches int64
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		// the backlog of 3 full batches and the last partial one
+		count := int64(10)
+		if batches++; batches == 4 {
+			count = 5
+		}
+		reflect.ValueOf(dst).Elem().FieldByName("Count").SetInt(count)
+		return nil
+	}
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	var stats []GCStats
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCMaxDuration(time.Minute), WithTokenStoreBatchSize(10), WithTokenStoreGCObserver(func(s GCStats) {
+		stats = append(stats, s)
+	}), WithTokenStoreClock(clock), WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	store.clean()
+	require.Equal(t, 4, len(adapter.selectOneCalls))
+	assert.Equal(t, "WITH deleted AS (DELETE FROM tokens WHERE id IN (SELECT id FROM tokens WHERE expires_at <= $1 LIMIT $2) RETURNING 1) SELECT count(*) AS count FROM deleted", adapter.selectOneCalls[0].query)
+	assert.Equal(t, []interface{}{clock.now, 10}, adapter.selectOneCalls[0].args)
+	require.Equal(t, 1, len(stats))
+	assert.Equal(t, int64(35), stats[0].Deleted)
+
+	// the run stops once the budget is spent
+	adapter.selectOneCalls = nil
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		time.Sleep(20 * time.Millisecond)
+		reflect.ValueOf(dst).Elem().FieldByName("Count").SetInt(10)
+		return nil
+	}
+	store, err = NewTokenStore(adapter, WithTokenStoreGCMaxDuration(50*time.Millisecond), WithTokenStoreBatchSize(10), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	store.clean()
+	// the batch running when the budget is spent finishes in the background
+	assert.True(t, adapter.selectOneCallsCount() >= 2)
+	assert.True(t, adapter.selectOneCallsCount() <= 4)
+
+	_, err = NewTokenStore(adapter, WithTokenStoreGCMaxDuration(-time.Second), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC max duration must not be negative, got -1s")
+	_, err = NewTokenStore(adapter, WithTokenStoreGCMaxDuration(time.Second), WithTokenStoreTimescaleHypertable(time.Hour), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC max duration is not supported with hypertable")
+}
+
+func TestWithTokenStoreGCAnalyze(t *testing.T) {
+	adapter := new(mockAdapter)
+	var deleted int64
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		reflect.ValueOf(dst).Elem().FieldByName("Count").SetInt(deleted)
+		return nil
+	}
+	l := new(memoryLogger)
+	var hooked []GCStats
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCAnalyze(100), WithTokenStoreGCMaintenanceHook(10, func(ctx context.Context, stats GCStats) error {
+		hooked = append(hooked, stats)
+		return errors.New("vacuum failed")
+	}), WithTokenStoreLogger(l), WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	deleted = 10
+	store.clean()
+	assert.Equal(t, 0, len(adapter.execCalls))
+	assert.Equal(t, 0, len(hooked))
+
+	deleted = 50
+	store.clean()
+	assert.Equal(t, 0, len(adapter.execCalls))
+	require.Equal(t, 1, len(hooked))
+	assert.Equal(t, int64(50), hooked[0].Deleted)
+	assert.Equal(t, "Error while running GC maintenance hook: %+v", l.formats[len(l.formats)-1])
+
+	deleted = 101
+	store.clean()
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Equal(t, "ANALYZE tokens", adapter.execCalls[0].query)
+	assert.Equal(t, 2, len(hooked))
+
+	_, err = NewTokenStore(adapter, WithTokenStoreGCAnalyze(-1), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC analyze threshold must not be negative, got -1")
+	_, err = NewTokenStore(adapter, WithTokenStoreGCMaintenanceHook(-1, nil), WithTokenStoreInitTableDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: GC maintenance threshold must not be negative, got -1")
+}
+
+func TestWithTokenStoreGCObserver(t *testing.T) {
+	adapter := new(mockAdapter)
+	var deleted int64
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		reflect.ValueOf(dst).Elem().FieldByName("Count").SetInt(deleted)
+		return nil
+	}
+	l := new(memoryLogger)
+	var stats []GCStats
+
+	store, err := NewTokenStore(adapter, WithTokenStoreGCObserver(func(s GCStats) {
+		stats = append(stats, s)
+	}), WithTokenStoreLogger(l), WithTokenStoreTableName("tokens"), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	// runs without removed tokens are not logged
+	store.clean()
+	deleted = 3
+	store.clean()
+
+	require.Equal(t, 2, len(stats))
+	assert.Equal(t, "tokens", stats[0].TableName)
+	assert.Equal(t, int64(0), stats[0].Deleted)
+	assert.Equal(t, int64(3), stats[1].Deleted)
+	require.Equal(t, 1, len(l.formats))
+	assert.Equal(t, "Token store GC finished: table=%s deleted=%d duration=%s", l.formats[0])
+	assert.Equal(t, []interface{}{"tokens", int64(3), stats[1].Duration}, l.args[0])
+
+	store, err = NewTokenStore(adapter, WithTokenStoreGCLogAlways(), WithTokenStoreLogger(l), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	deleted = 0
+	store.clean()
+	require.Equal(t, 2, len(l.formats))
+	assert.Equal(t, int64(0), l.args[1][1])
+}
+
+func TestWithTokenStoreErrorHandler(t *testing.T) {
+	adapter := new(mockAdapter)
+	queryErr := errors.New("query error")
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		return queryErr
+	}
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if strings.Contains(query, "access") {
+			return pgadapter.ErrNoRows
+		}
+		return queryErr
+	}
+
+	var ops []string
+	store, err := NewTokenStore(adapter, WithTokenStoreErrorHandler(func(op string, err error) {
+		ops = append(ops, op)
+		assert.Equal(t, queryErr, err)
+	}), WithTokenStoreLogger(new(memoryLogger)), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	assert.Equal(t, queryErr, store.RemoveByCode("code"))
+	_, err = store.GetByRefresh("refresh")
+	assert.Equal(t, queryErr, err)
+	store.clean()
+
+	// missing token is not the failure
+	_, err = store.GetByAccess("access")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	assert.Equal(t, []string{"RemoveByCode", "GetByRefresh", "GC"}, ops)
+}
@@ -1,21 +1,33 @@
 package pg
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/jackc/pgx"
 	_ "github.com/jackc/pgx/stdlib"
 	"github.com/jmoiron/sqlx"
+	"github.com/json-iterator/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vgarvardt/go-oauth2-pg/internal/pgcontainer"
 	"github.com/vgarvardt/go-pg-adapter"
 	"github.com/vgarvardt/go-pg-adapter/pgxadapter"
 	"github.com/vgarvardt/go-pg-adapter/sqladapter"
+	"gopkg.in/oauth2.v3"
 	"gopkg.in/oauth2.v3/models"
 )
 
@@ -23,12 +35,31 @@ var uri string
 
 func TestMain(m *testing.M) {
 	uri = os.Getenv("PG_URI")
-	if uri == "" {
-		fmt.Println("Env variable PG_URI is required to run the tests")
+	if uri != "" {
+		os.Exit(m.Run())
+	}
+
+	// start disposable postgres instance when no running instance is provided
+	var (
+		instance *pgcontainer.Instance
+		err      error
+	)
+	if os.Getenv("PG_EMBEDDED") != "" {
+		instance, err = pgcontainer.StartEmbedded(context.Background())
+	} else {
+		instance, err = pgcontainer.StartDocker(context.Background(), "")
+	}
+	if err != nil {
+		fmt.Printf("Env variable PG_URI is not set and postgres instance could not be started: %v\n", err)
 		os.Exit(1)
 	}
+	uri = instance.URI
 
-	os.Exit(m.Run())
+	code := m.Run()
+	if err := instance.Stop(context.Background()); err != nil {
+		fmt.Printf("Could not stop postgres instance: %v\n", err)
+	}
+	os.Exit(code)
 }
 
 type memoryLogger struct {
@@ -61,6 +92,7 @@ type queryCall struct {
 }
 
 type mockAdapter struct {
+	mu             sync.Mutex
 	execCalls      []queryCall
 	selectOneCalls []queryCall
 
@@ -69,7 +101,9 @@ type mockAdapter struct {
 }
 
 func (a *mockAdapter) Exec(query string, args ...interface{}) error {
+	a.mu.Lock()
 	a.execCalls = append(a.execCalls, queryCall{query: query, args: args})
+	a.mu.Unlock()
 
 	if a.execCallback != nil {
 		return a.execCallback(query, args...)
@@ -79,7 +113,9 @@ func (a *mockAdapter) Exec(query string, args ...interface{}) error {
 }
 
 func (a *mockAdapter) SelectOne(dst interface{}, query string, args ...interface{}) error {
+	a.mu.Lock()
 	a.selectOneCalls = append(a.selectOneCalls, queryCall{query: query, args: args})
+	a.mu.Unlock()
 
 	if a.selectCallback != nil {
 		return a.selectCallback(dst, query, args...)
@@ -88,6 +124,18 @@ func (a *mockAdapter) SelectOne(dst interface{}, query string, args ...interface
 	return nil
 }
 
+func (a *mockAdapter) execCallsCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.execCalls)
+}
+
+func (a *mockAdapter) selectOneCallsCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.selectOneCalls)
+}
+
 func TestTokenStore_initTable(t *testing.T) {
 	adapter := new(mockAdapter)
 
@@ -101,32 +149,551 @@ func TestTokenStore_initTable(t *testing.T) {
 	assert.Equal(t, 1, len(adapter.execCalls))
 	assert.Equal(t, 0, len(adapter.selectOneCalls))
 
-	// new line character is the character at position 0
-	assert.Equal(t, 1, strings.Index(adapter.execCalls[0].query, "CREATE TABLE IF NOT EXISTS"))
+	// table initialization is serialized with the advisory lock taken in the same implicit transaction
+	assert.True(t, strings.HasPrefix(adapter.execCalls[0].query, "SELECT pg_advisory_xact_lock(hashtext('oauth2_pg_init:oauth2_tokens'));\nCREATE TABLE IF NOT EXISTS"))
 }
 
-func TestTokenStore_gc(t *testing.T) {
+func TestTokenStore_initFailed(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		return errors.New("permission denied")
+	}
+
+	// store returned with the init error can be closed
+	store, err := NewTokenStore(adapter)
+	assert.EqualError(t, err, "permission denied")
+	require.NotNil(t, store)
+	assert.NoError(t, store.Close())
+}
+
+func TestTokenStore_compression(t *testing.T) {
 	adapter := new(mockAdapter)
 
-	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCInterval(time.Second))
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreCompression(GzipCompressor{}))
 	require.NoError(t, err)
 
-	defer func() {
-		assert.NoError(t, store.Close())
+	token := models.NewToken()
+	token.SetAccess(strings.Repeat("access", 100))
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Minute)
+	require.NoError(t, store.Create(token))
+
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	data := adapter.selectOneCalls[0].args[5].([]byte)
+	assert.Contains(t, string(data), `"$compression":"gzip"`)
+
+	info, err := store.toTokenInfo(data)
+	require.NoError(t, err)
+	assert.Equal(t, token.GetAccess(), info.GetAccess())
+
+	// uncompressed data is read as is
+	info, err = store.toTokenInfo([]byte(`{"Access":"access"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "access", info.GetAccess())
+}
+
+func TestTokenStore_filterWhere(t *testing.T) {
+	store, err := NewTokenStore(nil, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled())
+	require.NoError(t, err)
+
+	createdBefore := time.Now()
+	where, args := store.filterWhere(TokenFilter{ClientID: "client", Scope: "read", CreatedBefore: createdBefore}, []interface{}{"foo"})
+	assert.Equal(t, "TRUE AND data->>'ClientID' = $2 AND $3 = ANY(string_to_array(data->>'Scope', ' ')) AND created_at < $4", where)
+	assert.Equal(t, []interface{}{"foo", "client", "read", createdBefore}, args)
+
+	where, args = store.filterWhere(TokenFilter{}, nil)
+	assert.Equal(t, "TRUE", where)
+	assert.Empty(t, args)
+}
+
+func TestTokenStore_RemoveWhere_compression(t *testing.T) {
+	adapter := new(mockAdapter)
+	store, err := NewTokenStore(adapter, WithTokenStoreCompression(GzipCompressor{}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	// compressed tokens can not be matched by the client, so nothing would be removed
+	_, err = store.RemoveWhere(TokenFilter{ClientID: "client"})
+	assert.EqualError(t, err, "RemoveWhere by client, user or scope is not supported with token data compression")
+	assert.Empty(t, adapter.selectOneCalls)
+
+	// time criteria are the columns
+	_, err = store.RemoveWhere(TokenFilter{CreatedBefore: time.Now()})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(adapter.selectOneCalls))
+}
+
+func TestTokenStore_Search_compression(t *testing.T) {
+	adapter := new(mockAdapter)
+	store, err := NewTokenStore(adapter, WithTokenStoreCompression(GzipCompressor{}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	_, err = store.Search(TokenFilter{UserID: "user"}, Pagination{})
+	assert.EqualError(t, err, "Search by client, user or scope is not supported with token data compression")
+	assert.Empty(t, adapter.selectOneCalls)
+}
+
+func TestTokenStore_ForEach_compression(t *testing.T) {
+	adapter := new(mockAdapter)
+	store, err := NewTokenStore(adapter, WithTokenStoreCompression(GzipCompressor{}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	err = store.ForEach(context.Background(), TokenFilter{Scope: "read"}, func(oauth2.TokenInfo) error { return nil })
+	assert.EqualError(t, err, "ForEach by client, user or scope is not supported with token data compression")
+	assert.Empty(t, adapter.selectOneCalls)
+}
+
+func TestTokenStore_Statistics_compression(t *testing.T) {
+	adapter := new(mockAdapter)
+	store, err := NewTokenStore(adapter, WithTokenStoreCompression(GzipCompressor{}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	_, err = store.Statistics(context.Background())
+	assert.EqualError(t, err, "Statistics is not supported with token data compression")
+	assert.Empty(t, adapter.selectOneCalls)
+}
+
+func TestTokenStore_FindByClaim_compression(t *testing.T) {
+	adapter := new(mockAdapter)
+	store, err := NewTokenStore(adapter, WithTokenStoreCompression(GzipCompressor{}), WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	_, err = store.FindByClaim("Extension.tenant", "tenant")
+	assert.EqualError(t, err, "FindByClaim is not supported with token data compression")
+	assert.Empty(t, adapter.selectOneCalls)
+}
+
+func TestTokenStore_Import(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreBatchSize(3))
+	require.NoError(t, err)
+
+	var tokens []oauth2.TokenInfo
+	for i, createdAt := range []time.Time{time.Now(), time.Now().Add(-time.Hour), time.Now(), time.Now(), time.Now()} {
+		token := models.NewToken()
+		token.SetAccess(fmt.Sprintf("access %d", i))
+		token.SetAccessCreateAt(createdAt)
+		token.SetAccessExpiresIn(time.Minute)
+		tokens = append(tokens, token)
+	}
+	// the same token repeated in the batch
+	tokens[3] = tokens[0]
+
+	_, err = store.Import(context.Background(), TokenSourceFunc(func(ctx context.Context, fn func(oauth2.TokenInfo) error) error {
+		for _, token := range tokens {
+			if err := fn(token); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+
+	// expired and repeated tokens are skipped, valid ones are inserted in batches skipping the stored ones
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	query := adapter.selectOneCalls[0].query
+	assert.Contains(t, query, "FROM (VALUES ($1::TIMESTAMPTZ, $2::TIMESTAMPTZ, $3::TEXT, $4::TEXT, $5::TEXT, $6::JSONB, $7::JSONB), ($8::TIMESTAMPTZ, ")
+	assert.Contains(t, query, "WHERE (input.code = '' OR NOT EXISTS (SELECT 1 FROM oauth2_tokens AS stored WHERE stored.code = input.code)) AND (input.access = ''")
+	assert.Equal(t, 14, len(adapter.selectOneCalls[0].args))
+	assert.Equal(t, "access 0", adapter.selectOneCalls[0].args[3])
+	assert.Equal(t, "access 2", adapter.selectOneCalls[0].args[10])
+	assert.Equal(t, 7, len(adapter.selectOneCalls[1].args))
+	assert.Equal(t, "access 4", adapter.selectOneCalls[1].args[3])
+}
+
+func TestTokenStore_CreateWithID(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*TokenStoreItem).ID = 42
+		return nil
+	}
+
+	for _, columnsStorage := range []bool{false, true} {
+		adapter.selectOneCalls = nil
+
+		options := []TokenStoreOption{WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled()}
+		if columnsStorage {
+			options = append(options, WithTokenStoreColumnsStorage())
+		}
+		store, err := NewTokenStore(adapter, options...)
+		require.NoError(t, err)
+
+		token := models.NewToken()
+		token.SetAccess("access")
+		token.SetAccessCreateAt(time.Now())
+		token.SetAccessExpiresIn(time.Minute)
+
+		id, err := store.CreateWithID(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), id)
+
+		require.Equal(t, 1, len(adapter.selectOneCalls))
+		assert.Contains(t, adapter.selectOneCalls[0].query, "RETURNING id")
+		assert.Equal(t, 0, len(adapter.execCalls))
+	}
+}
+
+func TestTokenStore_notFound(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		if strings.HasPrefix(query, "SELECT TRUE AS expired") {
+			return nil
+		}
+		return pgadapter.ErrNoRows
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	_, err = store.GetByAccess("access")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	// adapter error is still matched for compatibility
+	assert.True(t, errors.Is(err, pgadapter.ErrNoRows))
+	assert.EqualError(t, err, "token not found: sql: no rows in result set")
+
+	// refresh token that was not rotated is still stored, so it is expired
+	assert.Equal(t, ErrTokenExpired, store.Rotate(context.Background(), "refresh", newRefreshToken("new")))
+	require.Equal(t, 3, len(adapter.selectOneCalls))
+	assert.Equal(t, "SELECT TRUE AS expired FROM tokens WHERE refresh = $1", adapter.selectOneCalls[2].query)
+}
+
+func TestTokenStore_connectionLost(t *testing.T) {
+	for _, driverErr := range []error{
+		driver.ErrBadConn,
+		pgx.ErrDeadConn,
+		io.ErrUnexpectedEOF,
+		&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")},
+		pgx.PgError{Code: "57P01", Message: "terminating connection due to administrator command"},
+		sqlStateError("08006"),
+		fmt.Errorf("query failed: %w", sqlStateError("08003")),
+	} {
+		adapter := new(mockAdapter)
+		adapter.execCallback = func(query string, args ...interface{}) error {
+			return driverErr
+		}
+		adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+			return driverErr
+		}
+		store, err := NewTokenStore(adapter, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+		require.NoError(t, err)
+
+		err = store.RemoveByAccess("access")
+		assert.True(t, errors.Is(err, ErrConnectionLost), driverErr.Error())
+		assert.Equal(t, driverErr, errors.Unwrap(err))
+
+		_, err = store.GetByAccess("access")
+		assert.True(t, errors.Is(err, ErrConnectionLost), driverErr.Error())
+		assert.False(t, errors.Is(err, ErrTokenNotFound))
+	}
+
+	// other errors are returned as is
+	adapter := new(mockAdapter)
+	adapter.execCallback = func(query string, args ...interface{}) error {
+		return sqlStateError(uniqueViolation)
+	}
+	store, err := NewTokenStore(adapter, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+	assert.Equal(t, sqlStateError(uniqueViolation), store.RemoveByAccess("access"))
+
+	// timeouts are the slow queries, not the lost connection
+	for _, driverErr := range []error{
+		context.DeadlineExceeded,
+		context.Canceled,
+		fmt.Errorf("query failed: %w", context.DeadlineExceeded),
+		&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}},
+	} {
+		adapter.execCallback = func(query string, args ...interface{}) error {
+			return driverErr
+		}
+		err := store.RemoveByAccess("access")
+		assert.False(t, errors.Is(err, ErrConnectionLost), driverErr.Error())
+		assert.Equal(t, driverErr, err)
+	}
+}
+
+// timeoutError is the network timeout error, e.g. the read deadline exceeded
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestTokenStore_busy(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return pgx.ErrAcquireTimeout
+	}
+	store, err := NewTokenStore(adapter, WithTokenStoreGCDisabled(), WithTokenStoreInitTableDisabled())
+	require.NoError(t, err)
+
+	_, err = store.GetByAccess("access")
+	assert.True(t, errors.Is(err, ErrStoreBusy))
+	assert.True(t, errors.Is(err, pgx.ErrAcquireTimeout))
+	assert.False(t, errors.Is(err, ErrConnectionLost))
+	assert.EqualError(t, err, "store is busy: timeout acquiring connection from pool")
+}
+
+func TestTokenStore_expired(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	data, err := jsoniter.Marshal(&models.Token{
+		Access: "access", AccessCreateAt: clock.now.Add(-time.Hour), AccessExpiresIn: time.Minute,
+		Refresh: "refresh", RefreshCreateAt: clock.now.Add(-time.Hour), RefreshExpiresIn: 2 * time.Hour,
+	})
+	require.NoError(t, err)
+
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*tokenDataItem).Data = data
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreClock(clock))
+	require.NoError(t, err)
+
+	info, err := store.GetByAccess("access")
+	assert.Equal(t, ErrTokenExpired, err)
+	assert.Nil(t, info)
+
+	// expiration is checked for the requested token kind only
+	info, err = store.GetByRefresh("refresh")
+	require.NoError(t, err)
+	assert.Equal(t, "refresh", info.GetRefresh())
+
+	// tokens without the expiration never expire
+	data, err = jsoniter.Marshal(&models.Token{Refresh: "refresh", RefreshCreateAt: clock.now.Add(-time.Hour)})
+	require.NoError(t, err)
+	_, err = store.GetByRefresh("refresh")
+	assert.NoError(t, err)
+}
+
+func TestTokenStore_ExpiredBacklog(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		dst.(*struct {
+			Backlog int64 `db:"backlog"`
+		}).Backlog = 42
+		return nil
+	}
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreClock(clock), WithTokenStoreTableName("auth.tokens"))
+	require.NoError(t, err)
+
+	backlog, err := store.ExpiredBacklog(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), backlog)
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, []interface{}{clock.now, "auth.tokens"}, adapter.selectOneCalls[0].args)
+	assert.Contains(t, adapter.selectOneCalls[0].query, "FROM auth.tokens TABLESAMPLE SYSTEM (1)")
+}
+
+func TestTokenStore_ListExpiringWithin(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		reflect.ValueOf(dst).Elem().FieldByName("Data").SetBytes([]byte(`[{"Access":"a1"},{"Access":"a2"}]`))
+		return nil
+	}
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreClock(clock), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	tokens, err := store.ListExpiringWithin(7*24*time.Hour, Pagination{Limit: 10, Offset: 20})
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "a2", tokens[1].GetAccess())
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Contains(t, adapter.selectOneCalls[0].query, "FROM tokens WHERE code = '' AND expires_at > $1 AND expires_at <= $2 ORDER BY expires_at, id LIMIT $3 OFFSET $4")
+	assert.Equal(t, []interface{}{clock.now, clock.now.Add(7 * 24 * time.Hour), 10, 20}, adapter.selectOneCalls[0].args)
+
+	_, err = store.ListExpiringWithin(0, Pagination{})
+	assert.EqualError(t, err, "expiration window must be positive, got 0s")
+}
+
+func TestTokenStore_Check(t *testing.T) {
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	// mock leaves exists flag false
+	assert.EqualError(t, store.Check(context.Background()), "table tokens does not exist")
+	require.Equal(t, 1, len(adapter.selectOneCalls))
+	assert.Equal(t, []interface{}{"tokens"}, adapter.selectOneCalls[0].args)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, store.Check(ctx))
+}
+
+func TestTokenStore_Drain(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	release := make(chan struct{})
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		<-release
+		return pgadapter.ErrNoRows
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCInterval(time.Hour))
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := store.GetByAccess("access")
+		assert.True(t, errors.Is(err, ErrTokenNotFound))
 	}()
 
-	time.Sleep(5 * time.Second)
+	// wait for the operation to start
+	for atomic.LoadInt64(&store.inflight) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, store.Drain(ctx))
 
-	// in 5 seconds we should have 4-5 gc calls
-	assert.True(t, 3 < len(adapter.execCalls))
-	assert.True(t, 5 >= len(adapter.execCalls))
-	assert.Equal(t, 0, len(adapter.selectOneCalls))
+	close(release)
+	<-done
+
+	assert.NoError(t, store.Drain(context.Background()))
+	assert.NoError(t, store.Close())
+}
+
+func TestTokenStore_CloseContext(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	release := make(chan struct{})
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		<-release
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCInterval(time.Hour))
+	require.NoError(t, err)
+
+	go store.GetByAccess("access")
+	for atomic.LoadInt64(&store.inflight) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, store.CloseContext(ctx))
+
+	// second call is no-op
+	assert.NoError(t, store.Close())
+	close(release)
+}
+
+func TestTickerGCStrategy(t *testing.T) {
+	// strategy that was not started stops with no goroutine to wait for
+	strategy := &TickerGCStrategy{Interval: time.Millisecond}
+	strategy.Stop()
+	assert.NoError(t, strategy.wait(context.Background()))
+
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	strategy = &TickerGCStrategy{Interval: time.Millisecond}
+	strategy.Start(func() {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	<-started
+
+	// running pass is finished before the goroutine exits
+	strategy.Stop()
+	strategy.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, strategy.wait(ctx))
+
+	close(release)
+	assert.NoError(t, strategy.wait(context.Background()))
+}
+
+func TestTokenStore_gc(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	// wait for several gc calls
+	deadline := time.Now().Add(time.Second)
+	for adapter.selectOneCallsCount() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	require.NoError(t, store.Close())
+
+	assert.True(t, 3 <= len(adapter.selectOneCalls))
+	assert.Equal(t, 0, len(adapter.execCalls))
 
-	for i := range adapter.execCalls {
-		assert.Equal(t, 0, strings.Index(adapter.execCalls[i].query, "DELETE FROM"))
+	for i := range adapter.selectOneCalls {
+		assert.Equal(t, 0, strings.Index(adapter.selectOneCalls[i].query, "WITH deleted AS (DELETE FROM oauth2_tokens WHERE expires_at <= $1 RETURNING 1)"))
 	}
 }
 
+func TestTokenStore_TriggerGCForTest(t *testing.T) {
+	adapter := new(mockAdapter)
+	clock := &fixedClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreClock(clock))
+	require.NoError(t, err)
+
+	store.TriggerGCForTest()
+	clock.now = clock.now.Add(time.Hour)
+	store.TriggerGCForTest()
+
+	require.Equal(t, 2, len(adapter.selectOneCalls))
+	assert.Equal(t, []interface{}{time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}, adapter.selectOneCalls[0].args)
+	assert.Equal(t, []interface{}{time.Date(2019, 3, 1, 13, 0, 0, 0, time.UTC)}, adapter.selectOneCalls[1].args)
+}
+
+func TestTokenStore_PauseGC(t *testing.T) {
+	adapter := new(mockAdapter)
+	logger := new(memoryLogger)
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled(), WithTokenStoreLogger(logger), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	store.PauseGC()
+	store.PauseGC()
+	assert.True(t, store.GCPaused())
+	store.TriggerGCForTest()
+	assert.Equal(t, 0, len(adapter.selectOneCalls))
+
+	store.ResumeGC()
+	store.ResumeGC()
+	assert.False(t, store.GCPaused())
+	store.TriggerGCForTest()
+	assert.Equal(t, 1, len(adapter.selectOneCalls))
+
+	assert.Equal(t, []string{"Token store GC paused: table=%s", "Token store GC resumed: table=%s"}, logger.formats)
+	assert.NoError(t, store.Close())
+}
+
+func TestTokenStore_gcPGCron(t *testing.T) {
+	adapter := new(mockAdapter)
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreTableName("tokens"), WithTokenStoreGCPGCron("*/5 * * * *"))
+	require.NoError(t, err)
+
+	defer func() {
+		assert.NoError(t, store.Close())
+	}()
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Equal(t, "SELECT cron.schedule($1, $2, $3)", adapter.execCalls[0].query)
+	assert.Equal(t, []interface{}{"oauth2_gc_tokens", "*/5 * * * *", "DELETE FROM tokens WHERE expires_at <= now() - interval '0 seconds'"}, adapter.execCalls[0].args)
+}
+
 func generateTokenTableName() string {
 	return fmt.Sprintf("token_%d", time.Now().UnixNano())
 }
@@ -135,6 +702,14 @@ func generateClientTableName() string {
 	return fmt.Sprintf("client_%d", time.Now().UnixNano())
 }
 
+func generateBackchannelTableName() string {
+	return fmt.Sprintf("backchannel_%d", time.Now().UnixNano())
+}
+
+func generatePARTableName() string {
+	return fmt.Sprintf("par_%d", time.Now().UnixNano())
+}
+
 func TestPGXConn(t *testing.T) {
 	l := new(memoryLogger)
 
@@ -172,6 +747,22 @@ func TestPGXConn(t *testing.T) {
 
 	runTokenStoreTest(t, tokenStore, l)
 	runClientStoreTest(t, clientStore)
+
+	columnsTokenStore, err := NewTokenStore(
+		adapter,
+		WithTokenStoreLogger(l),
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreGCInterval(time.Second),
+		WithTokenStoreColumnsStorage(),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, columnsTokenStore.Close())
+	}()
+
+	runTokenStoreTest(t, columnsTokenStore, l)
+	runClientStoreDeleteWithTokensTest(t, clientStore, tokenStore)
+	runClientStoreDeleteWithTokensTest(t, clientStore, columnsTokenStore)
 }
 
 func TestPGXConnPool(t *testing.T) {
@@ -211,6 +802,20 @@ func TestPGXConnPool(t *testing.T) {
 
 	runTokenStoreTest(t, tokenStore, l)
 	runClientStoreTest(t, clientStore)
+
+	for _, keyType := range []TokenKeyType{TokenKeyUUIDv4, TokenKeyUUIDv7} {
+		uuidTokenStore, err := NewTokenStore(
+			adapter,
+			WithTokenStoreLogger(l),
+			WithTokenStoreTableName(generateTokenTableName()),
+			WithTokenStoreGCInterval(time.Second),
+			WithTokenStoreKeyType(keyType),
+		)
+		require.NoError(t, err)
+
+		runTokenStoreTest(t, uuidTokenStore, l)
+		assert.NoError(t, uuidTokenStore.Close())
+	}
 }
 
 func TestSQL(t *testing.T) {
@@ -245,52 +850,209 @@ func TestSQL(t *testing.T) {
 
 	runTokenStoreTest(t, tokenStore, l)
 	runClientStoreTest(t, clientStore)
-}
 
-func TestNewX(t *testing.T) {
-	l := new(memoryLogger)
+	columnsTokenStore, err := NewTokenStore(
+		adapter,
+		WithTokenStoreLogger(l),
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreGCInterval(time.Second),
+		WithTokenStoreColumnsStorage(),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, columnsTokenStore.Close())
+	}()
 
-	conn, err := sql.Open("pgx", uri)
+	runTokenStoreTest(t, columnsTokenStore, l)
+
+	splitTokenStore, err := NewSplitTokenStore(
+		adapter,
+		WithSplitTokenStoreTablePrefix(generateTokenTableName()),
+		WithSplitTokenStoreOptions(WithTokenStoreLogger(l)),
+	)
 	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, splitTokenStore.Close())
+	}()
+
+	runSplitTokenStoreTest(t, splitTokenStore)
 
+	shardedTokenStore, err := NewShardedTokenStore(
+		adapter,
+		4,
+		WithShardedTokenStoreTablePrefix(generateTokenTableName()),
+		WithShardedTokenStoreOptions(WithTokenStoreLogger(l)),
+	)
+	require.NoError(t, err)
 	defer func() {
-		assert.NoError(t, conn.Close())
+		assert.NoError(t, shardedTokenStore.Close())
 	}()
 
-	adapter := sqladapter.NewX(sqlx.NewDb(conn, ""))
+	runShardedTokenStoreTest(t, shardedTokenStore)
 
-	tokenStore, err := NewTokenStore(
+	hashedTokenStore, err := NewTokenStore(
 		adapter,
 		WithTokenStoreLogger(l),
 		WithTokenStoreTableName(generateTokenTableName()),
-		WithTokenStoreGCInterval(time.Second),
+		WithTokenStoreHashedLookups(SHA256TokenHash),
 	)
 	require.NoError(t, err)
 	defer func() {
-		assert.NoError(t, tokenStore.Close())
+		assert.NoError(t, hashedTokenStore.Close())
 	}()
 
-	clientStore, err := NewClientStore(
+	runTokenStoreCodeTest(t, hashedTokenStore)
+	runTokenStoreAccessTest(t, hashedTokenStore)
+	runTokenStoreRefreshTest(t, hashedTokenStore)
+
+	hmacTokenStore, err := NewTokenStore(
 		adapter,
-		WithClientStoreLogger(l),
-		WithClientStoreTableName(generateClientTableName()),
+		WithTokenStoreLogger(l),
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreHMACLookups(TokenHashKey{ID: "k2", Key: []byte("secret2")}, TokenHashKey{ID: "k1", Key: []byte("secret1")}),
 	)
 	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, hmacTokenStore.Close())
+	}()
 
-	runTokenStoreTest(t, tokenStore, l)
-	runClientStoreTest(t, clientStore)
-}
-
-func runTokenStoreTest(t *testing.T, store *TokenStore, l *memoryLogger) {
-	runTokenStoreCodeTest(t, store)
-	runTokenStoreAccessTest(t, store)
-	runTokenStoreRefreshTest(t, store)
-
-	// sleep for a while just to wait for GC run for sure to ensure there were no errors there
-	time.Sleep(3 * time.Second)
-
-	assert.Equal(t, 0, len(l.formats))
-}
+	runTokenStoreCodeTest(t, hmacTokenStore)
+	runTokenStoreAccessTest(t, hmacTokenStore)
+	runTokenStoreRefreshTest(t, hmacTokenStore)
+
+	lineageTokenStore, err := NewTokenStore(
+		adapter,
+		WithTokenStoreLogger(l),
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreExchangeLineage(),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, lineageTokenStore.Close())
+	}()
+
+	runTokenStoreExchangeTest(t, lineageTokenStore)
+
+	familyTokenStore, err := NewTokenStore(
+		adapter,
+		WithTokenStoreLogger(l),
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreRefreshFamilies(),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, familyTokenStore.Close())
+	}()
+
+	runTokenStoreRefreshFamilyTest(t, familyTokenStore)
+
+	reuseTokenStore, err := NewTokenStore(
+		adapter,
+		WithTokenStoreLogger(l),
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreRefreshFamilies(),
+		WithTokenStoreRefreshReuseDetection(),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, reuseTokenStore.Close())
+	}()
+
+	runTokenStoreRefreshReuseTest(t, reuseTokenStore)
+
+	fkTokenStore, err := NewTokenStore(
+		adapter,
+		WithTokenStoreLogger(l),
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreClientForeignKey(clientStore.tableName),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, fkTokenStore.Close())
+	}()
+
+	runTokenStoreClientForeignKeyTest(t, fkTokenStore, clientStore)
+
+	backchannelStore, err := NewBackchannelRequestStore(
+		adapter,
+		WithBackchannelRequestStoreLogger(l),
+		WithBackchannelRequestStoreTableName(generateBackchannelTableName()),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, backchannelStore.Close())
+	}()
+
+	runBackchannelRequestStoreTest(t, backchannelStore)
+
+	parStore, err := NewPARStore(
+		adapter,
+		WithPARStoreLogger(l),
+		WithPARStoreTableName(generatePARTableName()),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, parStore.Close())
+	}()
+
+	runPARStoreTest(t, parStore)
+}
+
+func TestNewX(t *testing.T) {
+	l := new(memoryLogger)
+
+	conn, err := sql.Open("pgx", uri)
+	require.NoError(t, err)
+
+	defer func() {
+		assert.NoError(t, conn.Close())
+	}()
+
+	adapter := sqladapter.NewX(sqlx.NewDb(conn, ""))
+
+	tokenStore, err := NewTokenStore(
+		adapter,
+		WithTokenStoreLogger(l),
+		WithTokenStoreTableName(generateTokenTableName()),
+		WithTokenStoreGCInterval(time.Second),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, tokenStore.Close())
+	}()
+
+	clientStore, err := NewClientStore(
+		adapter,
+		WithClientStoreLogger(l),
+		WithClientStoreTableName(generateClientTableName()),
+	)
+	require.NoError(t, err)
+
+	runTokenStoreTest(t, tokenStore, l)
+	runClientStoreTest(t, clientStore)
+}
+
+func runTokenStoreTest(t *testing.T, store *TokenStore, l *memoryLogger) {
+	runTokenStoreCodeTest(t, store)
+	runTokenStoreAccessTest(t, store)
+	runTokenStoreRefreshTest(t, store)
+	runTokenStoreAuthorizationDetailsTest(t, store)
+	runTokenStoreFindByClaimTest(t, store)
+	runTokenStoreStatisticsTest(t, store)
+	runTokenStoreRemoveWhereTest(t, store)
+	runTokenStoreSearchTest(t, store)
+	runTokenStoreForEachTest(t, store)
+	runTokenStoreExportTest(t, store)
+	runTokenStoreImportTest(t, store)
+
+	assert.NoError(t, store.Check(context.Background()))
+	assert.NoError(t, store.HealthCheck())
+
+	// run GC for sure to ensure there were no errors there
+	store.TriggerGCForTest()
+
+	assert.Equal(t, 0, len(l.formats))
+}
 
 func runTokenStoreCodeTest(t *testing.T, store *TokenStore) {
 	code := fmt.Sprintf("code %s", time.Now().String())
@@ -308,7 +1070,7 @@ func runTokenStoreCodeTest(t *testing.T, store *TokenStore) {
 	require.NoError(t, store.RemoveByCode(code))
 
 	_, err = store.GetByCode(code)
-	assert.Equal(t, pgadapter.ErrNoRows, err)
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
 }
 
 func runTokenStoreAccessTest(t *testing.T, store *TokenStore) {
@@ -318,7 +1080,9 @@ func runTokenStoreAccessTest(t *testing.T, store *TokenStore) {
 	tokenCode.SetAccess(code)
 	tokenCode.SetAccessCreateAt(time.Now())
 	tokenCode.SetAccessExpiresIn(time.Minute)
-	require.NoError(t, store.Create(tokenCode))
+	key, err := store.CreateWithKey(context.Background(), tokenCode)
+	require.NoError(t, err)
+	assert.NotEmpty(t, key)
 
 	token, err := store.GetByAccess(code)
 	require.NoError(t, err)
@@ -327,7 +1091,7 @@ func runTokenStoreAccessTest(t *testing.T, store *TokenStore) {
 	require.NoError(t, store.RemoveByAccess(code))
 
 	_, err = store.GetByAccess(code)
-	assert.Equal(t, pgadapter.ErrNoRows, err)
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
 }
 
 func runTokenStoreRefreshTest(t *testing.T, store *TokenStore) {
@@ -346,10 +1110,395 @@ func runTokenStoreRefreshTest(t *testing.T, store *TokenStore) {
 	require.NoError(t, store.RemoveByRefresh(code))
 
 	_, err = store.GetByRefresh(code)
-	assert.Equal(t, pgadapter.ErrNoRows, err)
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+}
+
+func runTokenStoreAuthorizationDetailsTest(t *testing.T, store *TokenStore) {
+	code := fmt.Sprintf("rar %s", time.Now().String())
+
+	tokenCode := NewToken()
+	tokenCode.SetAccess(code)
+	tokenCode.SetAccessCreateAt(time.Now())
+	tokenCode.SetAccessExpiresIn(time.Minute)
+	tokenCode.SetAuthorizationDetails([]byte(`[{"type":"payment_initiation","actions":["initiate"]}]`))
+	require.NoError(t, store.Create(tokenCode))
+
+	token, err := store.GetByAccess(code)
+	require.NoError(t, err)
+	require.IsType(t, &Token{}, token)
+	assert.JSONEq(t, `[{"type":"payment_initiation","actions":["initiate"]}]`, string(token.(*Token).GetAuthorizationDetails()))
+
+	require.NoError(t, store.RemoveByAccess(code))
+}
+
+func runTokenStoreExchangeTest(t *testing.T, store *TokenStore) {
+	subject := models.NewToken()
+	subject.SetAccess(fmt.Sprintf("subject %s", time.Now().String()))
+	subject.SetAccessCreateAt(time.Now())
+	subject.SetAccessExpiresIn(time.Minute)
+	require.NoError(t, store.Create(subject))
+
+	exchanged := models.NewToken()
+	exchanged.SetAccess(fmt.Sprintf("exchanged %s", time.Now().String()))
+	exchanged.SetAccessCreateAt(time.Now())
+	exchanged.SetAccessExpiresIn(time.Minute)
+	require.NoError(t, store.CreateExchanged(context.Background(), subject, exchanged, "service"))
+
+	delegated := models.NewToken()
+	delegated.SetAccess(fmt.Sprintf("delegated %s", time.Now().String()))
+	delegated.SetAccessCreateAt(time.Now())
+	delegated.SetAccessExpiresIn(time.Minute)
+	require.NoError(t, store.CreateExchanged(context.Background(), exchanged, delegated, ""))
+
+	// subject token revocation revokes the whole exchange chain
+	require.NoError(t, store.RemoveByAccess(subject.GetAccess()))
+	_, err := store.GetByAccess(exchanged.GetAccess())
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	_, err = store.GetByAccess(delegated.GetAccess())
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	err = store.CreateExchanged(context.Background(), subject, exchanged, "")
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+}
+
+func newRefreshToken(refresh string) *models.Token {
+	token := models.NewToken()
+	token.SetAccess(fmt.Sprintf("access of %s", refresh))
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Minute)
+	token.SetRefresh(refresh)
+	token.SetRefreshCreateAt(time.Now())
+	token.SetRefreshExpiresIn(time.Hour)
+	return token
+}
+
+func runTokenStoreRefreshFamilyTest(t *testing.T, store *TokenStore) {
+	first := newRefreshToken(fmt.Sprintf("first %s", time.Now().String()))
+	require.NoError(t, store.Create(first))
+	familyID, err := store.FamilyID(first.GetRefresh())
+	require.NoError(t, err)
+	assert.NotEmpty(t, familyID)
+
+	second := newRefreshToken(fmt.Sprintf("second %s", time.Now().String()))
+	require.NoError(t, store.Rotate(context.Background(), first.GetRefresh(), second))
+	_, err = store.GetByRefresh(first.GetRefresh())
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	secondFamilyID, err := store.FamilyID(second.GetRefresh())
+	require.NoError(t, err)
+	assert.Equal(t, familyID, secondFamilyID)
+
+	// refresh token can be rotated only once
+	assert.True(t, errors.Is(store.Rotate(context.Background(), first.GetRefresh(), newRefreshToken("third")), ErrTokenNotFound))
+
+	another := newRefreshToken(fmt.Sprintf("another %s", time.Now().String()))
+	require.NoError(t, store.Create(another))
+
+	require.NoError(t, store.RemoveFamily(familyID))
+	_, err = store.GetByRefresh(second.GetRefresh())
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+	_, err = store.GetByRefresh(another.GetRefresh())
+	assert.NoError(t, err)
+
+	expired := newRefreshToken(fmt.Sprintf("expired %s", time.Now().String()))
+	expired.SetRefreshCreateAt(time.Now().Add(-2 * time.Hour))
+	require.NoError(t, store.Create(expired))
+	assert.Equal(t, ErrTokenExpired, store.Rotate(context.Background(), expired.GetRefresh(), newRefreshToken("fourth")))
+}
+
+func runTokenStoreRefreshReuseTest(t *testing.T, store *TokenStore) {
+	first := newRefreshToken(fmt.Sprintf("first %s", time.Now().String()))
+	require.NoError(t, store.Create(first))
+
+	second := newRefreshToken(fmt.Sprintf("second %s", time.Now().String()))
+	require.NoError(t, store.Rotate(context.Background(), first.GetRefresh(), second))
+
+	_, err := store.GetByAccess(first.GetAccess())
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	// stolen first refresh token is used again, so the legitimate second one is revoked as well
+	_, err = store.GetByRefresh(first.GetRefresh())
+	assert.Equal(t, ErrRefreshReuseDetected, err)
+	_, err = store.GetByRefresh(second.GetRefresh())
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	_, err = store.GetByRefresh(fmt.Sprintf("unknown %s", time.Now().String()))
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+}
+
+func runTokenStoreClientForeignKeyTest(t *testing.T, store *TokenStore, clientStore *ClientStore) {
+	client := &models.Client{ID: fmt.Sprintf("fk id %s", time.Now().String()), Secret: "secret"}
+	require.NoError(t, clientStore.Create(client))
+
+	token := newRefreshToken(fmt.Sprintf("fk %s", time.Now().String()))
+	token.SetClientID(client.GetID())
+	require.NoError(t, store.Create(token))
+
+	// tokens of unknown clients are rejected by the foreign key
+	unknown := newRefreshToken(fmt.Sprintf("unknown client %s", time.Now().String()))
+	unknown.SetClientID(fmt.Sprintf("unknown %s", time.Now().String()))
+	assert.Error(t, store.Create(unknown))
+
+	require.NoError(t, clientStore.Delete(client.GetID()))
+	_, err := store.GetByRefresh(token.GetRefresh())
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	assert.True(t, errors.Is(clientStore.Delete(client.GetID()), ErrClientNotFound))
+}
+
+func runClientStoreDeleteWithTokensTest(t *testing.T, store *ClientStore, tokenStore *TokenStore) {
+	client := &models.Client{ID: fmt.Sprintf("deleted id %s", time.Now().String()), Secret: "secret"}
+	require.NoError(t, store.Create(client))
+
+	token := newRefreshToken(fmt.Sprintf("deleted %s", time.Now().String()))
+	token.SetClientID(client.GetID())
+	require.NoError(t, tokenStore.Create(token))
+
+	require.NoError(t, store.DeleteWithTokens(client.GetID(), tokenStore))
+	_, err := store.GetByID(client.GetID())
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+	_, err = tokenStore.GetByRefresh(token.GetRefresh())
+	assert.True(t, errors.Is(err, ErrTokenNotFound))
+
+	assert.True(t, errors.Is(store.DeleteWithTokens(client.GetID(), tokenStore), ErrClientNotFound))
+}
+
+func runTokenStoreFindByClaimTest(t *testing.T, store *TokenStore) {
+	scope := fmt.Sprintf("scope %s", time.Now().String())
+
+	for i := 0; i < 2; i++ {
+		token := models.NewToken()
+		token.SetAccess(fmt.Sprintf("access %d %s", i, time.Now().String()))
+		token.SetAccessCreateAt(time.Now())
+		token.SetAccessExpiresIn(time.Minute)
+		token.SetScope(scope)
+		require.NoError(t, store.Create(token))
+	}
+
+	tokens, err := store.FindByClaim("Scope", scope)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(tokens))
+	for _, token := range tokens {
+		assert.Equal(t, scope, token.GetScope())
+		require.NoError(t, store.RemoveByAccess(token.GetAccess()))
+	}
+
+	tokens, err = store.FindByClaim("Scope", scope)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(tokens))
+}
+
+func runTokenStoreStatisticsTest(t *testing.T, store *TokenStore) {
+	clientID := fmt.Sprintf("client %s", time.Now().String())
+
+	for i, createdAt := range []time.Time{time.Now(), time.Now(), time.Now().Add(-time.Hour)} {
+		token := models.NewToken()
+		token.SetClientID(clientID)
+		token.SetAccess(fmt.Sprintf("access %d %s", i, time.Now().String()))
+		token.SetAccessCreateAt(createdAt)
+		token.SetAccessExpiresIn(time.Minute)
+		require.NoError(t, store.Create(token))
+	}
+
+	stats, err := store.Statistics(context.Background())
+	require.NoError(t, err)
+
+	var found bool
+	for _, stat := range stats {
+		if stat.ClientID == clientID {
+			found = true
+			assert.Equal(t, TokenKindAccess, stat.Kind)
+			assert.Equal(t, int64(2), stat.Active)
+			// expired token may be already removed by GC
+			assert.True(t, stat.Expired <= 1)
+		}
+	}
+	assert.True(t, found)
+
+	// tests table is small enough to be counted exactly
+	backlog, err := store.ExpiredBacklog(context.Background())
+	require.NoError(t, err)
+	assert.True(t, backlog >= 0)
+}
+
+func runTokenStoreImportTest(t *testing.T, store *TokenStore) {
+	clientID := fmt.Sprintf("import client %s", time.Now().String())
+
+	var tokens []oauth2.TokenInfo
+	for i := 0; i < 3; i++ {
+		token := models.NewToken()
+		token.SetClientID(clientID)
+		token.SetAccess(fmt.Sprintf("%s access %d", clientID, i))
+		token.SetAccessCreateAt(time.Now())
+		token.SetAccessExpiresIn(time.Hour)
+		tokens = append(tokens, token)
+	}
+	src := TokenSourceFunc(func(ctx context.Context, fn func(oauth2.TokenInfo) error) error {
+		for _, token := range tokens {
+			if err := fn(token); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	imported, err := store.Import(context.Background(), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), imported)
+
+	// rerun import skips the stored tokens
+	imported, err = store.Import(context.Background(), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), imported)
+
+	found, err := store.Search(TokenFilter{ClientID: clientID}, Pagination{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(found))
+}
+
+func runTokenStoreRemoveWhereTest(t *testing.T, store *TokenStore) {
+	clientID := fmt.Sprintf("client %s", time.Now().String())
+
+	for i, scope := range []string{"read write", "read", "write"} {
+		token := models.NewToken()
+		token.SetClientID(clientID)
+		token.SetScope(scope)
+		token.SetAccess(fmt.Sprintf("access %d %s", i, time.Now().String()))
+		token.SetAccessCreateAt(time.Now())
+		token.SetAccessExpiresIn(time.Minute)
+		require.NoError(t, store.Create(token))
+	}
+
+	_, err := store.RemoveWhere(TokenFilter{})
+	assert.Equal(t, ErrEmptyTokenFilter, err)
+
+	removed, err := store.RemoveWhere(TokenFilter{ClientID: clientID, Scope: "write", CreatedBefore: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+
+	removed, err = store.RemoveWhere(TokenFilter{ClientID: clientID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+}
+
+func runTokenStoreSearchTest(t *testing.T, store *TokenStore) {
+	userID := fmt.Sprintf("user %s", time.Now().String())
+
+	var accesses []string
+	for i := 0; i < 5; i++ {
+		token := models.NewToken()
+		token.SetUserID(userID)
+		token.SetAccess(fmt.Sprintf("access %d %s", i, time.Now().String()))
+		token.SetAccessCreateAt(time.Now())
+		token.SetAccessExpiresIn(time.Minute)
+		require.NoError(t, store.Create(token))
+		accesses = append(accesses, token.GetAccess())
+	}
+
+	tokens, err := store.Search(TokenFilter{UserID: userID, ExpiresAfter: time.Now()}, Pagination{Limit: 3})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(tokens))
+	for i := range tokens {
+		assert.Equal(t, accesses[i], tokens[i].GetAccess())
+	}
+
+	tokens, err = store.Search(TokenFilter{UserID: userID}, Pagination{Limit: 3, Offset: 3})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(tokens))
+	assert.Equal(t, accesses[3], tokens[0].GetAccess())
+	assert.Equal(t, accesses[4], tokens[1].GetAccess())
+
+	tokens, err = store.Search(TokenFilter{UserID: userID, ExpiresBefore: time.Now()}, Pagination{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(tokens))
+
+	removed, err := store.RemoveWhere(TokenFilter{UserID: userID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), removed)
+}
+
+func runTokenStoreForEachTest(t *testing.T, store *TokenStore) {
+	userID := fmt.Sprintf("user %s", time.Now().String())
+
+	originalBatchSize := store.batchSize
+	store.batchSize = 2
+	defer func() {
+		store.batchSize = originalBatchSize
+	}()
+
+	var accesses []string
+	for i := 0; i < 5; i++ {
+		token := models.NewToken()
+		token.SetUserID(userID)
+		token.SetAccess(fmt.Sprintf("access %d %s", i, time.Now().String()))
+		token.SetAccessCreateAt(time.Now())
+		token.SetAccessExpiresIn(time.Minute)
+		require.NoError(t, store.Create(token))
+		accesses = append(accesses, token.GetAccess())
+	}
+
+	var iterated []string
+	err := store.ForEach(context.Background(), TokenFilter{UserID: userID}, func(token oauth2.TokenInfo) error {
+		iterated = append(iterated, token.GetAccess())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, accesses, iterated)
+
+	stopErr := fmt.Errorf("stop")
+	iterated = nil
+	err = store.ForEach(context.Background(), TokenFilter{UserID: userID}, func(token oauth2.TokenInfo) error {
+		iterated = append(iterated, token.GetAccess())
+		return stopErr
+	})
+	assert.Equal(t, stopErr, err)
+	assert.Equal(t, 1, len(iterated))
+
+	_, err = store.RemoveWhere(TokenFilter{UserID: userID})
+	require.NoError(t, err)
+}
+
+func runTokenStoreExportTest(t *testing.T, store *TokenStore) {
+	token := models.NewToken()
+	token.SetAccess(fmt.Sprintf("export access %s", time.Now().String()))
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Minute)
+	require.NoError(t, store.Create(token))
+
+	defer func() {
+		require.NoError(t, store.RemoveByAccess(token.GetAccess()))
+	}()
+
+	var buf bytes.Buffer
+	require.NoError(t, store.Export(context.Background(), &buf, ExportJSONLines))
+	assert.Contains(t, buf.String(), token.GetAccess())
+	assert.True(t, strings.HasSuffix(buf.String(), "\n"))
+
+	buf.Reset()
+	require.NoError(t, store.Export(context.Background(), &buf, ExportJSONLinesRedacted))
+	assert.NotContains(t, buf.String(), token.GetAccess())
+	assert.Contains(t, buf.String(), redacted)
 }
 
 func runClientStoreTest(t *testing.T, store *ClientStore) {
+	runClientStoreCreateTest(t, store)
+	runClientStoreRedirectURIsTest(t, store)
+	runClientStoreScopeTest(t, store)
+	runClientStoreGrantTypesTest(t, store)
+	runClientStoreDisabledExpiredTest(t, store)
+	runClientStoreRotateSecretTest(t, store)
+	runClientStoreUpdateTest(t, store)
+	runClientStoreEnsureClientsTest(t, store)
+	runClientStoreImportJSONTest(t, store)
+	runClientStoreSyncTest(t, store)
+	runClientStoreValidateSecretTest(t, store)
+	runClientStoreExportTest(t, store)
+
+	assert.NoError(t, store.Check(context.Background()))
+	assert.NoError(t, store.HealthCheck())
+}
+
+func runClientStoreCreateTest(t *testing.T, store *ClientStore) {
 	originalClient := &models.Client{
 		ID:     fmt.Sprintf("id %s", time.Now().String()),
 		Secret: fmt.Sprintf("secret %s", time.Now().String()),
@@ -365,4 +1514,346 @@ func runClientStoreTest(t *testing.T, store *ClientStore) {
 	assert.Equal(t, originalClient.GetSecret(), client.GetSecret())
 	assert.Equal(t, originalClient.GetDomain(), client.GetDomain())
 	assert.Equal(t, originalClient.GetUserID(), client.GetUserID())
+
+	assert.Equal(t, ErrClientAlreadyExists, store.Create(originalClient))
+}
+
+func runClientStoreRedirectURIsTest(t *testing.T, store *ClientStore) {
+	originalClient := &Client{
+		Client: models.Client{
+			ID:     fmt.Sprintf("id %s", time.Now().String()),
+			Secret: fmt.Sprintf("secret %s", time.Now().String()),
+		},
+		RedirectURIs: []string{"https://example.com/cb", "https://example.org/cb"},
+	}
+
+	require.NoError(t, store.Create(originalClient))
+
+	client, err := store.GetByID(originalClient.GetID())
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/cb", client.GetDomain())
+	assert.Equal(t, originalClient.RedirectURIs, client.(*Client).GetRedirectURIs())
+
+	valid, err := store.ValidateRedirectURI(originalClient.GetID(), "https://example.org/cb")
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = store.ValidateRedirectURI(originalClient.GetID(), "https://example.net/cb")
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	_, err = store.ValidateRedirectURI(fmt.Sprintf("unknown %s", time.Now().String()), "https://example.com/cb")
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+}
+
+func runClientStoreScopeTest(t *testing.T, store *ClientStore) {
+	restrictedClient := &Client{
+		Client: models.Client{
+			ID:     fmt.Sprintf("restricted id %s", time.Now().String()),
+			Secret: fmt.Sprintf("secret %s", time.Now().String()),
+		},
+		AllowedScopes: []string{"read", "write"},
+	}
+	require.NoError(t, store.Create(restrictedClient))
+
+	allowed, err := store.CheckScope(restrictedClient.GetID(), "read write")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = store.CheckScope(restrictedClient.GetID(), "read admin")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	unrestrictedClient := &models.Client{
+		ID:     fmt.Sprintf("unrestricted id %s", time.Now().String()),
+		Secret: fmt.Sprintf("secret %s", time.Now().String()),
+	}
+	require.NoError(t, store.Create(unrestrictedClient))
+
+	allowed, err = store.CheckScope(unrestrictedClient.GetID(), "read admin")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func runClientStoreGrantTypesTest(t *testing.T, store *ClientStore) {
+	restrictedClient := &Client{
+		Client: models.Client{
+			ID:     fmt.Sprintf("restricted id %s", time.Now().String()),
+			Secret: fmt.Sprintf("secret %s", time.Now().String()),
+		},
+		AllowedGrantTypes: []oauth2.GrantType{oauth2.ClientCredentials, oauth2.Refreshing},
+	}
+	require.NoError(t, store.Create(restrictedClient))
+
+	grantTypes, err := store.AllowedGrantTypes(restrictedClient.GetID())
+	require.NoError(t, err)
+	assert.Equal(t, restrictedClient.AllowedGrantTypes, grantTypes)
+
+	allowed, err := store.CheckGrantType(restrictedClient.GetID(), oauth2.ClientCredentials)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = store.CheckGrantType(restrictedClient.GetID(), oauth2.AuthorizationCode)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	unrestrictedClient := &models.Client{
+		ID:     fmt.Sprintf("unrestricted id %s", time.Now().String()),
+		Secret: fmt.Sprintf("secret %s", time.Now().String()),
+	}
+	require.NoError(t, store.Create(unrestrictedClient))
+
+	grantTypes, err = store.AllowedGrantTypes(unrestrictedClient.GetID())
+	require.NoError(t, err)
+	assert.Empty(t, grantTypes)
+
+	allowed, err = store.CheckGrantType(unrestrictedClient.GetID(), oauth2.AuthorizationCode)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func runClientStoreDisabledExpiredTest(t *testing.T, store *ClientStore) {
+	client := &models.Client{
+		ID:     fmt.Sprintf("disabled id %s", time.Now().String()),
+		Secret: fmt.Sprintf("secret %s", time.Now().String()),
+	}
+	require.NoError(t, store.Create(client))
+
+	require.NoError(t, store.Disable(client.GetID()))
+	_, err := store.GetByID(client.GetID())
+	assert.Equal(t, ErrClientDisabled, err)
+
+	require.NoError(t, store.Enable(client.GetID()))
+	_, err = store.GetByID(client.GetID())
+	assert.NoError(t, err)
+
+	assert.True(t, errors.Is(store.Disable(fmt.Sprintf("unknown %s", time.Now().String())), ErrClientNotFound))
+
+	expiredClient := &Client{
+		Client: models.Client{
+			ID:     fmt.Sprintf("expired id %s", time.Now().String()),
+			Secret: fmt.Sprintf("secret %s", time.Now().String()),
+		},
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	require.NoError(t, store.Create(expiredClient))
+
+	_, err = store.GetByID(expiredClient.GetID())
+	assert.Equal(t, ErrClientExpired, err)
+}
+
+func runClientStoreRotateSecretTest(t *testing.T, store *ClientStore) {
+	client := &models.Client{
+		ID:     fmt.Sprintf("rotated id %s", time.Now().String()),
+		Secret: fmt.Sprintf("secret %s", time.Now().String()),
+	}
+	require.NoError(t, store.Create(client))
+
+	newSecret, err := store.RotateSecret(client.GetID())
+	require.NoError(t, err)
+	assert.NotEqual(t, client.GetSecret(), newSecret)
+
+	info, err := store.GetByID(client.GetID())
+	require.NoError(t, err)
+	assert.Equal(t, newSecret, info.GetSecret())
+
+	secrets, err := store.Secrets(client.GetID())
+	require.NoError(t, err)
+	require.Equal(t, 2, len(secrets))
+	assert.Equal(t, client.GetSecret(), secrets[0].Secret)
+	assert.NotNil(t, secrets[0].ExpiresAt)
+	assert.Equal(t, newSecret, secrets[1].Secret)
+	assert.Nil(t, secrets[1].ExpiresAt)
+
+	_, err = store.RotateSecret(fmt.Sprintf("unknown %s", time.Now().String()))
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+}
+
+func runClientStoreUpdateTest(t *testing.T, store *ClientStore) {
+	client := &Client{
+		Client: models.Client{
+			ID:     fmt.Sprintf("updated id %s", time.Now().String()),
+			Secret: fmt.Sprintf("secret %s", time.Now().String()),
+		},
+		RedirectURIs: []string{"https://example.com/cb"},
+	}
+	require.NoError(t, store.Create(client))
+
+	info, version, err := store.GetWithVersion(client.GetID())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	updated := info.(*Client)
+	updated.RedirectURIs = []string{"https://example.org/cb"}
+	newVersion, err := store.Update(updated, version)
+	require.NoError(t, err)
+	assert.Equal(t, version+1, newVersion)
+
+	// concurrent editor still has the old version
+	_, err = store.Update(updated, version)
+	assert.Equal(t, ErrVersionConflict, err)
+
+	info, err = store.GetByID(client.GetID())
+	require.NoError(t, err)
+	assert.Equal(t, client.GetSecret(), info.GetSecret())
+	assert.Equal(t, []string{"https://example.org/cb"}, info.(*Client).GetRedirectURIs())
+
+	_, err = store.Update(&Client{Client: models.Client{ID: fmt.Sprintf("unknown %s", time.Now().String())}}, 1)
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+}
+
+func runClientStoreValidateSecretTest(t *testing.T, store *ClientStore) {
+	client := &models.Client{
+		ID:     fmt.Sprintf("validated id %s", time.Now().String()),
+		Secret: fmt.Sprintf("secret %s", time.Now().String()),
+	}
+	require.NoError(t, store.Create(client))
+
+	info, err := store.ValidateSecret(client.GetID(), client.GetSecret())
+	require.NoError(t, err)
+	assert.Equal(t, client.GetID(), info.GetID())
+
+	_, err = store.ValidateSecret(client.GetID(), "invalid secret")
+	assert.Equal(t, ErrInvalidClientSecret, err)
+
+	newSecret, err := store.RotateSecret(client.GetID())
+	require.NoError(t, err)
+
+	// both secrets are valid during the grace period
+	_, err = store.ValidateSecret(client.GetID(), client.GetSecret())
+	assert.NoError(t, err)
+	_, err = store.ValidateSecret(client.GetID(), newSecret)
+	assert.NoError(t, err)
+}
+
+func runClientStoreExportTest(t *testing.T, store *ClientStore) {
+	client := &models.Client{
+		ID:     fmt.Sprintf("exported id %s", time.Now().String()),
+		Secret: fmt.Sprintf("secret %s", time.Now().String()),
+	}
+	require.NoError(t, store.Create(client))
+
+	var buf bytes.Buffer
+	require.NoError(t, store.Export(context.Background(), &buf, ExportJSONLines))
+	assert.Contains(t, buf.String(), client.GetID())
+	assert.Contains(t, buf.String(), client.GetSecret())
+
+	buf.Reset()
+	require.NoError(t, store.Export(context.Background(), &buf, ExportJSONLinesRedacted))
+	assert.Contains(t, buf.String(), client.GetID())
+	assert.NotContains(t, buf.String(), client.GetSecret())
+}
+
+func TestTokenStore_keyType(t *testing.T) {
+	_, err := NewTokenStore(nil, WithTokenStoreKeyType(TokenKeyType(42)), WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled())
+	assert.EqualError(t, err, "invalid token store configuration: unknown token key type 42")
+
+	adapter := new(mockAdapter)
+	store, err := NewTokenStore(adapter, WithTokenStoreKeyType(TokenKeyUUIDv7), WithTokenStoreGCDisabled(), WithTokenStoreTableName("tokens"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Contains(t, adapter.execCalls[0].query, "  id                    UUID        NOT NULL,")
+	adapter.execCalls = nil
+
+	token := models.NewToken()
+	token.SetAccess("access")
+	token.SetAccessCreateAt(time.Now())
+	token.SetAccessExpiresIn(time.Minute)
+
+	key, err := store.CreateWithKey(context.Background(), token)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(adapter.execCalls))
+	assert.Equal(t, "INSERT INTO tokens (created_at, expires_at, code, access, refresh, data, authorization_details, id, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $1)", adapter.execCalls[0].query)
+	assert.Equal(t, key, adapter.execCalls[0].args[7])
+	assert.Equal(t, 0, len(adapter.selectOneCalls))
+
+	_, err = store.CreateWithID(context.Background(), token)
+	assert.EqualError(t, err, "CreateWithID requires BIGSERIAL token keys, use CreateWithKey")
+
+	lastKey, err := TokenKeyUUIDv7.parseKey([]byte(`"` + key + `"`))
+	require.NoError(t, err)
+	assert.Equal(t, key, lastKey)
+	lastID, err := TokenKeyBigSerial.parseKey([]byte(`9007199254740993`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(9007199254740993), lastID)
+}
+
+func TestNewUUID(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	v4, err := newUUID(TokenKeyUUIDv4, now)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, v4)
+
+	v7, err := newUUID(TokenKeyUUIDv7, now)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, v7)
+	// first 48 bits are unix milliseconds
+	assert.Equal(t, fmt.Sprintf("%012x", now.UnixNano()/int64(time.Millisecond)), strings.Replace(v7, "-", "", 1)[:12])
+
+	later, err := newUUID(TokenKeyUUIDv7, now.Add(time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, later > v7)
+}
+
+func TestUnmarshalToken(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 123000000, time.FixedZone("", 3600))
+	data, err := jsoniter.Marshal(&models.Token{ClientID: "client", Access: "access", AccessCreateAt: createdAt, AccessExpiresIn: time.Hour})
+	require.NoError(t, err)
+
+	info, err := unmarshalToken(data)
+	require.NoError(t, err)
+	assert.Equal(t, "client", info.GetClientID())
+	assert.True(t, createdAt.Equal(info.GetAccessCreateAt()))
+	assert.Equal(t, time.Hour, info.GetAccessExpiresIn())
+
+	// columns storage mode produces null for the missing timestamps
+	info, err = unmarshalToken([]byte(`{"Access":"access","CodeCreateAt":null,"AccessCreateAt":"2019-03-01T12:00:00.123+01:00"}`))
+	require.NoError(t, err)
+	assert.True(t, info.GetCodeCreateAt().IsZero())
+	assert.True(t, createdAt.Equal(info.GetAccessCreateAt()))
+
+	info, err = unmarshalToken([]byte(`{"Access":"access","AuthorizationDetails":null}`))
+	require.NoError(t, err)
+	assert.IsType(t, &models.Token{}, info)
+
+	info, err = unmarshalToken([]byte(`{"Access":"access","AuthorizationDetails":[{"type":"account_information"}]}`))
+	require.NoError(t, err)
+	require.IsType(t, &Token{}, info)
+	assert.JSONEq(t, `[{"type":"account_information"}]`, string(info.(*Token).GetAuthorizationDetails()))
+
+	_, err = unmarshalToken([]byte(`{"AccessCreateAt":"yesterday"}`))
+	assert.Error(t, err)
+}
+
+func BenchmarkTokenStore_GetByAccess(b *testing.B) {
+	data, err := jsoniter.Marshal(&models.Token{
+		ClientID:        "client",
+		UserID:          "user",
+		Scope:           "read write",
+		Access:          "access",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	})
+	require.NoError(b, err)
+
+	adapter := new(mockAdapter)
+	adapter.selectCallback = func(dst interface{}, query string, args ...interface{}) error {
+		reflect.ValueOf(dst).Elem().FieldByName("Data").SetBytes(data)
+		return nil
+	}
+
+	store, err := NewTokenStore(adapter, WithTokenStoreInitTableDisabled(), WithTokenStoreGCDisabled())
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// drop recorded calls to measure the store allocations only
+		adapter.selectOneCalls = adapter.selectOneCalls[:0]
+		if _, err := store.GetByAccess("access"); err != nil {
+			b.Fatal(err)
+		}
+	}
 }